@@ -0,0 +1,206 @@
+package generator
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Values accepted by the -emoji-arbitration flag. With order, each character is rendered by the first font of the
+// merged collection that maps it, which is the Emoji font for the symbols that it shares with the text fonts that
+// follow it, such as ☺, arrows, and dingbats. With presentation, the characters that the Emoji font shares with the
+// text fonts of a package are arbitrated by their default presentation; see arbitrateEmoji.
+const (
+	emojiArbitrationOrder        = "order"
+	emojiArbitrationPresentation = "presentation"
+)
+
+// emojiRange assigns a range of characters to the emoji or the text fonts, overriding their default presentation.
+type emojiRange struct {
+	first, last rune
+	emoji       bool
+}
+
+func (r emojiRange) String() string {
+	s := fmt.Sprintf("U+%04X", r.first)
+	if r.last != r.first {
+		s += fmt.Sprintf("-U+%04X", r.last)
+	}
+	if r.emoji {
+		return s + "=emoji"
+	}
+	return s + "=text"
+}
+
+// emojiRangeList is a flag.Value holding a comma-separated list of ranges, such as U+2190-U+21FF=text or U+263A=emoji.
+// The flag may be repeated, and later ranges take precedence.
+type emojiRangeList []emojiRange
+
+func (l *emojiRangeList) String() string {
+	var entries []string
+	for _, r := range *l {
+		entries = append(entries, r.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+func (l *emojiRangeList) Set(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return fmt.Errorf("range %q must end in =emoji or =text", entry)
+		}
+		var r emojiRange
+		switch entry[i+1:] {
+		case "emoji":
+			r.emoji = true
+		case "text":
+		default:
+			return fmt.Errorf("range %q must end in =emoji or =text", entry)
+		}
+		bounds := strings.SplitN(entry[:i], "-", 2)
+		var err error
+		if r.first, err = parseCodePoint(bounds[0]); err != nil {
+			return err
+		}
+		r.last = r.first
+		if len(bounds) == 2 {
+			if r.last, err = parseCodePoint(bounds[1]); err != nil {
+				return err
+			}
+		}
+		if r.last < r.first {
+			return fmt.Errorf("invalid range %q", entry)
+		}
+		*l = append(*l, r)
+	}
+	return nil
+}
+
+// registerEmojiArbitrationFlags registers the flags that choose which fonts render the characters that the Emoji font
+// shares with the text fonts.
+func registerEmojiArbitrationFlags(fs *flag.FlagSet, opts *generateOptions) {
+	fs.StringVar(&opts.emojiArbitration, "emoji-arbitration", emojiArbitrationOrder,
+		"which font renders characters that both the Emoji font and a text font map: order (the first font of the collection), "+
+			"or presentation (emoji-presentation characters from the Emoji font, the others from the text fonts; requires -rebrand)")
+	fs.Var((*emojiRangeList)(&opts.emojiRanges), "emoji-range",
+		"comma-separated ranges (e.g. U+2190-U+21FF=text or U+263A=emoji) that -emoji-arbitration presentation takes "+
+			"from the text or Emoji fonts regardless of their default presentation")
+}
+
+// validateEmojiArbitration returns an error if the -emoji-arbitration flags are invalid or contradict each other.
+func validateEmojiArbitration(opts *generateOptions) error {
+	switch opts.emojiArbitration {
+	case emojiArbitrationOrder:
+		if len(opts.emojiRanges) > 0 {
+			return errors.New("-emoji-range requires -emoji-arbitration " + emojiArbitrationPresentation)
+		}
+	case emojiArbitrationPresentation:
+	default:
+		return fmt.Errorf("invalid -emoji-arbitration value %q", opts.emojiArbitration)
+	}
+	return nil
+}
+
+// emojiPresentation lists the characters that are displayed as emoji by default, which have the Emoji_Presentation
+// property in the emoji data of Unicode 15.0. Other emoji, such as ☺ (U+263A) and ↔ (U+2194), are displayed as text
+// unless they are followed by the emoji variation selector.
+var emojiPresentation = [][2]rune{
+	{0x231A, 0x231B}, {0x23E9, 0x23EC}, {0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1}, {0x26AA, 0x26AB}, {0x26BD, 0x26BE},
+	{0x26C4, 0x26C5}, {0x26CE, 0x26CE}, {0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+	{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B}, {0x2728, 0x2728}, {0x274C, 0x274C},
+	{0x274E, 0x274E}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55},
+	{0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF}, {0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F1E6, 0x1F1FF},
+	{0x1F201, 0x1F201}, {0x1F21A, 0x1F21A}, {0x1F22F, 0x1F22F}, {0x1F232, 0x1F236}, {0x1F238, 0x1F23A},
+	{0x1F250, 0x1F251}, {0x1F300, 0x1F320}, {0x1F32D, 0x1F335}, {0x1F337, 0x1F37C}, {0x1F37E, 0x1F393},
+	{0x1F3A0, 0x1F3CA}, {0x1F3CF, 0x1F3D3}, {0x1F3E0, 0x1F3F0}, {0x1F3F4, 0x1F3F4}, {0x1F3F8, 0x1F43E},
+	{0x1F440, 0x1F440}, {0x1F442, 0x1F4FC}, {0x1F4FF, 0x1F53D}, {0x1F54B, 0x1F54E}, {0x1F550, 0x1F567},
+	{0x1F57A, 0x1F57A}, {0x1F595, 0x1F596}, {0x1F5A4, 0x1F5A4}, {0x1F5FB, 0x1F64F}, {0x1F680, 0x1F6C5},
+	{0x1F6CC, 0x1F6CC}, {0x1F6D0, 0x1F6D2}, {0x1F6D5, 0x1F6D7}, {0x1F6DC, 0x1F6DF}, {0x1F6EB, 0x1F6EC},
+	{0x1F6F4, 0x1F6FC}, {0x1F7E0, 0x1F7EB}, {0x1F7F0, 0x1F7F0}, {0x1F90C, 0x1F93A}, {0x1F93C, 0x1F945},
+	{0x1F947, 0x1F9FF}, {0x1FA70, 0x1FA7C}, {0x1FA80, 0x1FA88}, {0x1FA90, 0x1FABD}, {0x1FABF, 0x1FAC5},
+	{0x1FACE, 0x1FADB}, {0x1FAE0, 0x1FAE8}, {0x1FAF0, 0x1FAF8},
+}
+
+// presentsAsEmoji reports whether -emoji-arbitration presentation takes r from the Emoji fonts: by the last of ranges
+// that contains it, or else by its default presentation.
+func presentsAsEmoji(r rune, ranges []emojiRange) bool {
+	for i := len(ranges) - 1; i >= 0; i-- {
+		if ranges[i].first <= r && r <= ranges[i].last {
+			return ranges[i].emoji
+		}
+	}
+	i := sort.Search(len(emojiPresentation), func(i int) bool { return emojiPresentation[i][1] >= r })
+	return i < len(emojiPresentation) && emojiPresentation[i][0] <= r
+}
+
+// arbitrateEmoji implements -emoji-arbitration presentation for the source fonts of a package: each character that
+// both an Emoji font and a text font map is removed from the cmap tables of the text fonts if it presents as emoji, and
+// from those of the Emoji fonts otherwise, so that the merged collection renders it with the font of its presentation
+// wherever it is placed in the fallback order. Characters that only one kind of font maps are left alone. It returns
+// the sources, of which those that changed are copies, along with the number of shared characters that the text fonts
+// and the Emoji fonts render.
+func arbitrateEmoji(sources [][]byte, sourceFonts []*fontDesc, ranges []emojiRange) ([][]byte, int, int, error) {
+	fonts := make([]*sfntFont, len(sources))
+	emojiRunes := make(map[rune]bool)
+	for i, data := range sources {
+		parsed, err := parseFontCollection(data)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to parse %s: %w", sourceFonts[i].filename, err)
+		}
+		if len(parsed) != 1 {
+			return nil, 0, 0, fmt.Errorf("source font %s is a collection", sourceFonts[i].filename)
+		}
+		fonts[i] = parsed[0]
+		if sourceFonts[i].family == emojiFamily {
+			fonts[i].forEachRune(func(r rune) { emojiRunes[r] = true })
+		}
+	}
+	// The characters shared by an Emoji font and a text font, by whether they present as emoji
+	shared := make(map[rune]bool)
+	for i, f := range fonts {
+		if sourceFonts[i].family != emojiFamily {
+			f.forEachRune(func(r rune) {
+				if emojiRunes[r] {
+					shared[r] = presentsAsEmoji(r, ranges)
+				}
+			})
+		}
+	}
+	if len(shared) == 0 {
+		return sources, 0, 0, nil
+	}
+	var asText, asEmoji int
+	for _, emoji := range shared {
+		if emoji {
+			asEmoji++
+		} else {
+			asText++
+		}
+	}
+	out := make([][]byte, len(sources))
+	for i, f := range fonts {
+		out[i] = sources[i]
+		isEmoji := sourceFonts[i].family == emojiFamily
+		cmap, changed, err := filterCMAP(f.table("cmap"), func(r rune) bool {
+			emoji, ok := shared[r]
+			return ok && emoji != isEmoji
+		})
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to filter the cmap table of %s: %w", sourceFonts[i].filename, err)
+		}
+		if changed {
+			f.tables["cmap"] = cmap
+			out[i] = f.encode()
+		}
+	}
+	return out, asText, asEmoji, nil
+}
@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Formats of the input archives, detected from their contents; see detectArchiveFormat.
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+	archiveTarXz = "tar.xz"
+)
+
+// detectArchiveFormat returns the format of an input archive from its first bytes, so that tarballs produced by
+// release automation are accepted whatever their file names.
+func detectArchiveFormat(sourcePath string) (string, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open Noto input: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	var head [512]byte
+	n, err := io.ReadFull(f, head[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read Noto input: %w", err)
+	}
+	return archiveFormat(head[:n], sourcePath)
+}
+
+// archiveFormat returns the format of the input archive called name whose first 512 bytes, or all of its bytes if it
+// is shorter, are head.
+func archiveFormat(head []byte, name string) (string, error) {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK")):
+		return archiveZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return archiveTarGz, nil
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0}):
+		return archiveTarXz, nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return archiveTar, nil
+	}
+	return "", fmt.Errorf("%s is not a ZIP file, a tarball, or a directory", name)
+}
+
+// extractedTarballs holds the directories into which tarballs were extracted, or Google Fonts inputs downloaded, by
+// input path, so that each input is only extracted once per run.
+var extractedTarballs = struct {
+	sync.Mutex
+	dirs map[string]string
+}{dirs: make(map[string]string)}
+
+// extractTarball extracts the Noto fonts of a tarball into a temporary directory and returns it. Unlike ZIP files,
+// tarballs cannot be read at random, so the fonts are extracted once and read from the directory like any other
+// directory input. The directories are removed by removeExtractedTarballs.
+func extractTarball(sourcePath string, format string) (string, error) {
+	extractedTarballs.Lock()
+	defer extractedTarballs.Unlock()
+	if dir, ok := extractedTarballs.dirs[sourcePath]; ok {
+		return dir, nil
+	}
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open Noto input: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	dir, err := extractTarStream(f, sourcePath, format)
+	if err != nil {
+		return "", err
+	}
+	extractedTarballs.dirs[sourcePath] = dir
+	return dir, nil
+}
+
+// extractTarStream extracts the Noto fonts of the tarball read from r, called name, into a new temporary directory
+// and returns it. Decompressing tar.xz files requires the xz command.
+func extractTarStream(r io.Reader, name string, format string) (string, error) {
+	var wait func() error
+	switch format {
+	case archiveTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress Noto input: %w", err)
+		}
+		r = gz
+	case archiveTarXz:
+		cmd := exec.Command("xz", "--decompress", "--stdout")
+		cmd.Stdin = r
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return "", err
+		}
+		if err := cmd.Start(); err != nil {
+			return "", fmt.Errorf("decompressing tar.xz input requires the xz command: %w", err)
+		}
+		r = out
+		wait = func() error {
+			if err := cmd.Wait(); err != nil {
+				return fmt.Errorf("failed to decompress Noto input: %w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			return nil
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "gonoto-input-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	log.infof("Extracting the fonts of %s to %s", name, dir)
+	extracted, err := extractTarFonts(tar.NewReader(r), dir)
+	if wait != nil {
+		// Let xz finish writing before waiting for it
+		_, _ = io.Copy(ioutil.Discard, r)
+		if waitErr := wait(); err == nil {
+			err = waitErr
+		}
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	log.infof("Extracted %d fonts from %s", extracted, name)
+	return dir, nil
+}
+
+// extractTarFonts writes the .ttf and .otf files of a tar stream into dir, keeping their relative paths, and returns
+// the number of files written. Which of them are Noto fonts is decided when dir is scanned; see noto.Scan.
+func extractTarFonts(tr *tar.Reader, dir string) (int, error) {
+	extracted := 0
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return extracted, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read Noto input tarball: %w", err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if ext := path.Ext(h.Name); ext != ".ttf" && ext != ".otf" {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(h.Name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return 0, errors.New("tarball contains a file outside of its root: " + h.Name)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return 0, err
+		}
+		fw, err := os.Create(file)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.Copy(fw, tr); err != nil {
+			_ = fw.Close()
+			return 0, fmt.Errorf("failed to extract %s: %w", h.Name, err)
+		}
+		if err := fw.Close(); err != nil {
+			return 0, err
+		}
+		extracted++
+	}
+}
+
+// removeExtractedTarballs removes the directories of extractedTarballs.
+func removeExtractedTarballs() {
+	extractedTarballs.Lock()
+	defer extractedTarballs.Unlock()
+	for sourcePath, dir := range extractedTarballs.dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			log.warnf("Failed to remove extraction directory %s: %s", dir, err)
+		}
+		delete(extractedTarballs.dirs, sourcePath)
+	}
+}
@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Values accepted by the -base-table flag.
+const (
+	baseTableKeep       = "keep"
+	baseTableSynthesize = "synthesize"
+)
+
+// baseTableReport records how many members of a merged collection carry a BASE table. Renderers rely on BASE tables
+// to align the baselines of different scripts, so fonts without them may not line up with their neighbours.
+type baseTableReport struct {
+	Fonts       int `json:"fonts"`       // The number of fonts in the collection
+	Present     int `json:"present"`     // The number of source fonts that provided their own BASE table
+	Synthesized int `json:"synthesized"` // The number of BASE tables generated by gonoto
+}
+
+func (r baseTableReport) String() string {
+	return fmt.Sprintf("%d of %d fonts have a BASE table (%d synthesized)", r.Present+r.Synthesized, r.Fonts, r.Synthesized)
+}
+
+// prepareBaseTables detects which of the source fonts have a BASE table. If synthesize is set, a minimal BASE table is
+// added to the fonts that lack one and the modified font data is returned in place of the original.
+func prepareBaseTables(inputs [][]byte, synthesize bool) ([][]byte, baseTableReport, error) {
+	report := baseTableReport{Fonts: len(inputs)}
+	out := make([][]byte, len(inputs))
+	for i, data := range inputs {
+		out[i] = data
+		fonts, err := parseFontCollection(data)
+		if err != nil {
+			return nil, report, err
+		}
+		if len(fonts) != 1 {
+			return nil, report, fmt.Errorf("source font %d is a collection", i)
+		}
+		f := fonts[0]
+		if f.table("BASE") != nil {
+			report.Present++
+			continue
+		}
+		if !synthesize {
+			continue
+		}
+		f.tables["BASE"] = synthesizeBaseTable(f)
+		out[i] = f.encode()
+		report.Synthesized++
+	}
+	return out, report, nil
+}
+
+// synthesizeBaseTable builds a BASE table with a horizontal axis that defines the roman and ideographic baselines for
+// all scripts. The ideographic baseline is placed at the typographic descender, which matches the fallback used by
+// most layout engines for fonts that lack a BASE table. Fonts that cover CJK ideographs use the ideographic baseline
+// by default.
+func synthesizeBaseTable(f *sfntFont) []byte {
+	var descender int16
+	if os2 := f.table("OS/2"); len(os2) >= 72 {
+		descender = int16(binary.BigEndian.Uint16(os2[70:]))
+	} else if hhea := f.table("hhea"); len(hhea) >= 8 {
+		descender = int16(binary.BigEndian.Uint16(hhea[6:]))
+	}
+	defaultBaseline := uint16(1) // romn
+	if f.hasRune(0x4E00) {
+		defaultBaseline = 0 // ideo
+	}
+
+	var b bytes.Buffer
+	w := func(v interface{}) { _ = binary.Write(&b, binary.BigEndian, v) }
+	// Header: version 1.0, horizontal axis immediately following, no vertical axis
+	w([4]uint16{1, 0, 8, 0})
+	// Axis table: BaseTagList at +4, BaseScriptList at +14
+	w([2]uint16{4, 14})
+	// BaseTagList: two tags in alphabetical order
+	w(uint16(2))
+	b.WriteString("ideoromn")
+	// BaseScriptList: a single DFLT record whose BaseScript immediately follows the list
+	w(uint16(1))
+	b.WriteString("DFLT")
+	w(uint16(8))
+	// BaseScript: BaseValues at +6, no MinMax tables
+	w([3]uint16{6, 0, 0})
+	// BaseValues: two BaseCoord offsets
+	w([4]uint16{defaultBaseline, 2, 8, 12})
+	// BaseCoord format 1 for each baseline
+	w([2]int16{1, descender})
+	w([2]int16{1, 0})
+	return b.Bytes()
+}
@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// generatorInfo identifies the build of gonoto that generated a package, so that published packages can be traced
+// back to the commit of the generator. It is recorded in the manifest and in the headers of the generated Go files.
+type generatorInfo struct {
+	Version  string `json:"version"`            // The module version of gonoto, or "(devel)" for a build from a checkout
+	Revision string `json:"revision,omitempty"` // The VCS revision that gonoto was built from, if known
+	Time     string `json:"time,omitempty"`     // The commit time of the revision, in RFC 3339 format
+	Modified bool   `json:"modified,omitempty"` // Whether the working tree had uncommitted changes
+}
+
+// generator describes the running build of gonoto.
+var generator = readGeneratorInfo()
+
+// modulePath is the path of the gonoto module: the main module of the gonoto command, and a dependency of the programs
+// that call GeneratePackage.
+const modulePath = "github.com/gonoto/gonoto"
+
+// readGeneratorInfo reads the build information embedded by the Go toolchain. The VCS fields are only known for
+// binaries built with Go 1.18 or later from a checkout, without -buildvcs=false, and only describe the gonoto command;
+// the checkout of a program that calls GeneratePackage is not that of gonoto.
+func readGeneratorInfo() *generatorInfo {
+	g := &generatorInfo{Version: "(devel)"}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return g
+	}
+	if info.Main.Path != modulePath {
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath && dep.Version != "" {
+				g.Version = dep.Version
+			}
+		}
+		return g
+	}
+	if info.Main.Version != "" {
+		g.Version = info.Main.Version
+	}
+	readVCSInfo(info, g)
+	return g
+}
+
+// String describes the build on one line, such as "gonoto v1.4.0" or "gonoto (devel), revision 4f2c1e9a0b7d,
+// modified".
+func (g *generatorInfo) String() string {
+	s := "gonoto " + g.Version
+	if g.Revision != "" && !strings.Contains(g.Version, shortRevision(g.Revision)) {
+		s += ", revision " + shortRevision(g.Revision)
+	}
+	if g.Modified && !strings.HasSuffix(g.Version, "+dirty") {
+		s += ", modified"
+	}
+	return s
+}
+
+// shortRevision abbreviates a VCS revision to the 12 characters of pseudo-versions.
+func shortRevision(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
@@ -0,0 +1,20 @@
+//go:build go1.18
+// +build go1.18
+
+package generator
+
+import "runtime/debug"
+
+// readVCSInfo copies the VCS settings that the Go toolchain stamps into binaries built from a checkout.
+func readVCSInfo(info *debug.BuildInfo, g *generatorInfo) {
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			g.Revision = s.Value
+		case "vcs.time":
+			g.Time = s.Value
+		case "vcs.modified":
+			g.Modified = s.Value == "true"
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !go1.18
+// +build !go1.18
+
+package generator
+
+import "runtime/debug"
+
+// readVCSInfo does nothing before Go 1.18, which does not stamp VCS settings into binaries.
+func readVCSInfo(info *debug.BuildInfo, g *generatorInfo) {}
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// fontCacheVersion changes whenever the fonts read from an input change for the same archive, such as when variable
+// fonts are instanced differently, which invalidates the cached fonts.
+const fontCacheVersion = 1
+
+// fontCacheDir is the directory of the extraction cache, or "" if it is disabled; see cacheFS.
+var fontCacheDir string
+
+// cacheFlags are the flags of the extraction cache.
+type cacheFlags struct {
+	dir     string
+	disable bool
+}
+
+func (cf *cacheFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&cf.dir, "cache-dir", defaultCacheDir(),
+		"directory in which the fonts read from ZIP inputs are cached for later runs with the same archive")
+	fs.BoolVar(&cf.disable, "no-cache", false, "read every font from the input instead of the extraction cache")
+}
+
+// apply configures the extraction cache from the flags.
+func (cf *cacheFlags) apply() error {
+	fontCacheDir = ""
+	if cf.disable {
+		return nil
+	}
+	if cf.dir == "" {
+		return errors.New("the user cache directory is unknown; set -cache-dir or use -no-cache")
+	}
+	fontCacheDir = cf.dir
+	return nil
+}
+
+// defaultCacheDir returns the gonoto directory in the cache directory of the user, such as $XDG_CACHE_HOME/gonoto or
+// ~/.cache/gonoto on Linux, or "" if it is unknown.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gonoto")
+}
+
+// zipCacheKey identifies the contents of a ZIP file by its directory: the names, CRC-32 checksums, and sizes of its
+// files, which are known without reading them.
+func zipCacheKey(files []*zip.File) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "gonoto font cache %d\n", fontCacheVersion)
+	for _, f := range files {
+		_, _ = fmt.Fprintf(h, "%q %08x %d\n", f.Name, f.CRC32, f.UncompressedSize64)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// cacheFS caches the fonts read from a ZIP input in a directory of fontCacheDir named after the archive; see
+// zipCacheKey. Every file read with fs.ReadFile is cached as it is read: the fonts of the archive, which spares
+// decompressing and checking them, and the fonts derived from them, such as the instances of variable fonts, which
+// spares deriving them again. Other runs with the same archive, even one at another path, read them from the cache.
+type cacheFS struct {
+	fs.FS
+	dir string
+}
+
+// newCacheFS returns fsys with the extraction cache of z, or fsys itself if the cache is disabled or z is not a ZIP
+// file.
+func newCacheFS(fsys fs.FS, z fs.FS) fs.FS {
+	var files []*zip.File
+	switch z := z.(type) {
+	case *zip.ReadCloser:
+		files = z.File
+	case *zip.Reader:
+		files = z.File
+	default:
+		return fsys
+	}
+	if fontCacheDir == "" {
+		return fsys
+	}
+	return &cacheFS{FS: fsys, dir: filepath.Join(fontCacheDir, zipCacheKey(files))}
+}
+
+// ReadFile returns the contents of a file from the cache, or reads it and adds it to the cache. Failing to add it is
+// not an error, since the file can always be read again.
+func (c *cacheFS) ReadFile(name string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(name))
+	file := filepath.Join(c.dir, hex.EncodeToString(sum[:16])+path.Ext(name))
+	if data, err := ioutil.ReadFile(file); err == nil {
+		log.debugf("Reading %s from the extraction cache", name)
+		return data, nil
+	}
+	data, err := fs.ReadFile(c.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCacheFile(file, data); err != nil {
+		log.debugf("Failed to add %s to the extraction cache: %s", name, err)
+	}
+	return data, nil
+}
+
+// writeCacheFile writes a file of the cache through a temporary file, so that concurrent runs never read a partial
+// file.
+func writeCacheFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// hasCFF reports whether any font of a collection has CFF outlines.
+func hasCFF(fonts []*sfntFont) bool {
+	for _, f := range fonts {
+		if f.table("CFF ") != nil || f.table("CFF2") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// optimizeCFF passes a merged collection through the external optimizer command, such as a wrapper around a CFF
+// subroutinizer, and returns the optimized collection. Merging drops the subroutines of CFF fonts, so restoring them
+// can considerably shrink collections with CFF fonts, such as CJK fonts. The command is split into fields and run
+// without a shell; it reads the collection from standard input and writes the optimized collection to standard
+// output. The optimized collection must contain the same number of fonts and cover the same characters. Collections
+// without CFF fonts, and optimized collections that are not smaller, are returned unchanged.
+func optimizeCFF(merged []byte, command string) ([]byte, error) {
+	fonts, err := parseFontCollection(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merged font collection: %w", err)
+	}
+	if !hasCFF(fonts) {
+		return merged, nil
+	}
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty CFF optimizer command")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(merged)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("CFF optimizer failed: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("CFF optimizer failed: %w", err)
+	}
+	optimized := stdout.Bytes()
+	optimizedFonts, err := parseFontCollection(optimized)
+	if err != nil {
+		return nil, fmt.Errorf("CFF optimizer wrote an invalid font collection: %w", err)
+	}
+	if len(optimizedFonts) != len(fonts) {
+		return nil, fmt.Errorf("CFF optimizer wrote %d fonts, expected %d", len(optimizedFonts), len(fonts))
+	}
+	before, err := countCoverage(merged)
+	if err != nil {
+		return nil, err
+	}
+	after, err := countCoverage(optimized)
+	if err != nil {
+		return nil, fmt.Errorf("CFF optimizer wrote an invalid font collection: %w", err)
+	}
+	if after != before {
+		return nil, fmt.Errorf("CFF optimizer changed the coverage from %d to %d characters", before, after)
+	}
+	if len(optimized) >= len(merged) {
+		return merged, nil
+	}
+	return optimized, nil
+}
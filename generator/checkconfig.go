@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkConfig resolves the packages selected by the family flags, including those defined in the config file, and
+// checks them against the fonts in the inputs without merging anything. Packages whose input family has no font in
+// the inputs fail the check; packages that fall back to a different style than requested, and config families without a
+// description, produce warnings.
+func checkConfig(sourcePaths []string, ff *familyFlags, noIndex bool, skip []string) error {
+	selected, err := ff.resolve()
+	if err != nil {
+		fmt.Printf("FAIL config: %s\n", err.Error())
+		return fmt.Errorf("invalid configuration")
+	}
+	m, err := ff.cfg.Matching.matcher()
+	if err != nil {
+		fmt.Printf("FAIL config: invalid matching: %s\n", err.Error())
+		return fmt.Errorf("invalid configuration")
+	}
+	if _, err := parseRequiredCoverage(ff.cfg.Required); err != nil {
+		fmt.Printf("FAIL config: invalid required characters: %s\n", err.Error())
+		return fmt.Errorf("invalid configuration")
+	}
+	warnings := 0
+	for _, fc := range ff.cfg.Families {
+		if strings.TrimSpace(fc.Description) == "" && ff.cfg.Description == "" {
+			fmt.Printf("WARN %s: the config sets no description; a generic one is generated from the default template\n", fc.Name)
+			warnings++
+		}
+	}
+
+	inventory, err := scanInput(sourcePaths, noIndex, skip, ff.profile.prefersHinted(), nil)
+	if err != nil {
+		return err
+	}
+	fontDescriptions, _ := describeFonts(inventory)
+	var failed []string
+	for _, f := range selected {
+		sourceFonts := selectSourceFonts(f, fontDescriptions, inventory.Languages, m)
+		if !hasBaseFont(f, sourceFonts) {
+			fmt.Printf("FAIL %s: %s\n", f.name, exactSourceProblem(f, sourceFonts))
+			failed = append(failed, f.name)
+			continue
+		}
+		if problem := exactSourceProblem(f, sourceFonts); problem != "" {
+			fmt.Printf("WARN %s: %s\n", f.name, problem)
+			warnings++
+			continue
+		}
+		fmt.Printf("ok   %s: %d source fonts\n", f.name, len(sourceFonts))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d packages cannot be generated from the input: %s", len(failed), len(selected), strings.Join(failed, ", "))
+	}
+	if warnings > 0 {
+		fmt.Printf("%d packages checked with %d warnings\n", len(selected), warnings)
+	}
+	return nil
+}
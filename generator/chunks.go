@@ -0,0 +1,229 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+)
+
+// Values accepted by the -chunk-encoding flag. The uint64 encoding works with every Go version, but type checking a
+// 20 MiB chunk takes well over a gigabyte of memory, which language servers such as gopls repeat for every package
+// that imports it. String literals are several times cheaper to parse, and embedded files are not parsed at all.
+const (
+	chunkEncodingUint64 = "uint64"
+	chunkEncodingString = "string"
+	chunkEncodingEmbed  = "embed"
+)
+
+// defaultChunkSize is the default amount of compressed data in each chunk file.
+const defaultChunkSize = 20 << 20
+
+// minChunkSize is the smallest chunk size accepted by -chunk-size.
+const minChunkSize = 1 << 10
+
+// validateChunkSize returns an error if size cannot be used as the size of the chunks. The uint64 encoding pads each
+// chunk to a multiple of 8 bytes, so other sizes would corrupt the data.
+func validateChunkSize(size byteSize) error {
+	if min := byteSize(minChunkSize); size < min {
+		return fmt.Errorf("the chunk size must be at least %s", min.String())
+	}
+	if size%8 != 0 {
+		return errors.New("the chunk size must be a multiple of 8 bytes")
+	}
+	return nil
+}
+
+// embedGoVersion is the first Go version that supports the go:embed directive.
+const embedGoVersion = "1.16"
+
+// chunkStreamHeader starts the chunk data of a package: the magic string "gonoto", a zero byte, and the version of the
+// format of the data that follows, which is 1 for a gzip stream of the collection. The decoder in otc.go checks it, so
+// that chunk files of a different format, such as those of a data module from another version of gonoto, fail with a
+// clear error instead of decoding to garbage. It is 8 bytes long, which every chunk encoding can read at once.
+const chunkStreamHeader = "gonoto\x00\x01"
+
+// chunkHeaderVar is the name of the constant of otc.go that holds chunkStreamHeader. Packages generated before the
+// header was introduced lack it.
+const chunkHeaderVar = "chunkHeader"
+
+// stripChunkHeader returns the chunk data after its header. Data without a header is only accepted if legacy is set,
+// for packages whose otc.go predates the header.
+func stripChunkHeader(data []byte, legacy bool) ([]byte, error) {
+	magic := chunkStreamHeader[:len(chunkStreamHeader)-1]
+	if !bytes.HasPrefix(data, []byte(magic)) || len(data) < len(chunkStreamHeader) {
+		if legacy {
+			return data, nil
+		}
+		return nil, errors.New("chunk data has no format header; otc.go and the chunk files were generated by different versions of gonoto")
+	}
+	if legacy {
+		return nil, errors.New("chunk data has a format header that otc.go does not read; otc.go and the chunk files were generated by different versions of gonoto")
+	}
+	if version, want := data[len(magic)], chunkStreamHeader[len(magic)]; version != want {
+		return nil, fmt.Errorf("chunk data has format version %d, but otc.go reads version %d", version, want)
+	}
+	return data[len(chunkStreamHeader):], nil
+}
+
+// stringChunkLine is the number of bytes encoded in each string literal of a string chunk, which keeps the lines of the
+// generated files short enough for editors.
+const stringChunkLine = 4096
+
+// chunkListType returns the type of the chunks variable for an encoding.
+func chunkListType(encoding string) string {
+	switch encoding {
+	case chunkEncodingString:
+		return "[][]string"
+	case chunkEncodingEmbed:
+		return "[]string"
+	default:
+		return "[][]uint64"
+	}
+}
+
+// chunkDecoderSource returns the definition of the chunkDecoder type in otc.go, which reads the compressed data from
+// the chunks variable.
+func chunkDecoderSource(encoding string) string {
+	switch encoding {
+	case chunkEncodingString:
+		return `type chunkDecoder struct{}
+
+func (d chunkDecoder) Read(p []byte) (n int, err error) {
+	for len(chunks) > 0 {
+		if len(chunks[0]) < 1 {
+			chunks = chunks[1:]
+			continue
+		}
+		if len(chunks[0][0]) < 1 {
+			chunks[0] = chunks[0][1:]
+			continue
+		}
+		n = copy(p, chunks[0][0])
+		chunks[0][0] = chunks[0][0][n:]
+		return n, nil
+	}
+	return 0, io.EOF
+}
+`
+	case chunkEncodingEmbed:
+		return `type chunkDecoder struct{}
+
+func (d chunkDecoder) Read(p []byte) (n int, err error) {
+	for len(chunks) > 0 {
+		if len(chunks[0]) < 1 {
+			chunks = chunks[1:]
+			continue
+		}
+		n = copy(p, chunks[0])
+		chunks[0] = chunks[0][n:]
+		return n, nil
+	}
+	return 0, io.EOF
+}
+`
+	default:
+		return `type chunkDecoder struct{}
+
+func (d chunkDecoder) Read(p []byte) (n int, err error) {
+	for len(p) >= 8 {
+		if len(chunks) < 1 {
+			return n, io.EOF
+		}
+		if len(chunks[0]) < 1 {
+			chunks = chunks[1:]
+			continue
+		}
+		u := chunks[0][0]
+		chunks[0] = chunks[0][1:]
+		p[0] = byte(u & 0xff)
+		p[1] = byte(u & 0xff00 >> 8)
+		p[2] = byte(u & 0xff0000 >> 16)
+		p[3] = byte(u & 0xff000000 >> 24)
+		p[4] = byte(u & 0xff00000000 >> 32)
+		p[5] = byte(u & 0xff0000000000 >> 40)
+		p[6] = byte(u & 0xff000000000000 >> 48)
+		p[7] = byte(u & 0xff00000000000000 >> 56)
+		p = p[8:]
+		n += 8
+	}
+	return n, nil
+}
+`
+	}
+}
+
+// writeEncodedChunk passes the files of chunk varName with the data from r to sink, in directory dir of the package.
+// It reports whether the chunk contained any data; empty chunks are not written.
+func writeEncodedChunk(encoding string, packageName string, sink fileSink, dir string, varName string, r io.Reader, header string) (bool, error) {
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	outputFile := path.Join(dir, varName+".go")
+	switch encoding {
+	case chunkEncodingString:
+		return true, sink.stream(outputFile, func(w io.Writer) error { return writeStringChunk(packageName, w, varName, br, header) })
+	case chunkEncodingEmbed:
+		return true, writeEmbedChunk(packageName, sink, outputFile, varName, br, header)
+	default:
+		return true, sink.stream(outputFile, func(w io.Writer) error { return writeChunk(packageName, w, varName, br, header) })
+	}
+}
+
+// writeStringChunk writes a chunk as a slice of string literals. Printable ASCII characters are written as-is and all
+// other bytes are escaped, since Go source files must be valid UTF-8.
+func writeStringChunk(packageName string, fw io.Writer, varName string, r io.Reader, header string) error {
+	w := bufio.NewWriter(fw)
+
+	const hex = "0123456789abcdef"
+	var buf [stringChunkLine]byte
+	if _, err := w.WriteString(
+		header +
+			"package " + packageName + "\n\n" +
+			"var " + varName + " = []string{\n"); err != nil {
+		return err
+	}
+	for {
+		n, err := io.ReadFull(r, buf[:])
+		if n > 0 {
+			_, _ = w.WriteString("\t\"")
+			for _, b := range buf[:n] {
+				if b >= 0x20 && b < 0x7f && b != '"' && b != '\\' {
+					_ = w.WriteByte(b)
+				} else {
+					_, _ = w.Write([]byte{'\\', 'x', hex[b>>4], hex[b&0xf]})
+				}
+			}
+			if _, err := w.WriteString("\",\n"); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if _, err := w.WriteString("}\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// writeEmbedChunk passes the data of a chunk to sink as a binary file next to outputFile, and outputFile embeds it
+// into a string variable.
+func writeEmbedChunk(packageName string, sink fileSink, outputFile string, varName string, r io.Reader, header string) error {
+	dataName := varName + ".bin"
+	if err := sink(path.Join(path.Dir(outputFile), dataName), r); err != nil {
+		return err
+	}
+	return sink.writeString(outputFile, header+
+		"package "+packageName+"\n\n"+
+		"import _ \"embed\"\n\n"+
+		"//go:embed "+dataName+"\n"+
+		"var "+varName+" string\n")
+}
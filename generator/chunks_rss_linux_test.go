@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package generator
+
+import (
+	"os"
+	"syscall"
+)
+
+// peakRSS returns the peak resident set size of a process and its descendants in bytes. Linux reports it in KiB.
+func peakRSS(ps *os.ProcessState) (int64, bool) {
+	usage, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, false
+	}
+	return usage.Maxrss << 10, true
+}
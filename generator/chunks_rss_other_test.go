@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package generator
+
+import "os"
+
+// peakRSS is not implemented on this platform, so the benchmark does not report the peak RSS of go build.
+func peakRSS(ps *os.ProcessState) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// BenchmarkChunkEncoding measures a package holding a single chunk of defaultChunkSize random bytes, which are as
+// incompressible as the gzip stream of real packages, in each -chunk-encoding, as in the table of README.md:
+//
+//	go test -run '^$' -bench ChunkEncoding -benchtime 1x .
+//
+// It reports the size of the chunk files (source-MiB), the heap that remains live after parsing and type-checking the
+// package with go/parser and go/types, the stages that gopls runs (heap-MiB), the bytes they allocate (alloc-MiB), and
+// the peak RSS of go build where the platform reports it (build-rss-MiB).
+func BenchmarkChunkEncoding(b *testing.B) {
+	data := make([]byte, defaultChunkSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, encoding := range []string{chunkEncodingUint64, chunkEncodingString, chunkEncodingEmbed} {
+		b.Run(encoding, func(b *testing.B) {
+			dir := b.TempDir()
+			sink := dirSink(dir)
+			if _, err := writeEncodedChunk(encoding, "bench", sink, ".", "chunk0", bytes.NewReader(data), ""); err != nil {
+				b.Fatal(err)
+			}
+			if err := sink.writeString("go.mod", "module bench\n\ngo "+embedGoVersion+"\n"); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(sourceSize(b, dir))/(1<<20), "source-MiB")
+			for i := 0; i < b.N; i++ {
+				heap, alloc := typeCheckCost(b, dir)
+				b.ReportMetric(float64(heap)/(1<<20), "heap-MiB")
+				b.ReportMetric(float64(alloc)/(1<<20), "alloc-MiB")
+				// A new file changes the package, so that go build compiles it instead of reusing the build cache
+				if err := sink.writeString("run.go", "package bench\n\nconst benchRun = "+strconv.Itoa(rand.Int())+"\n"); err != nil {
+					b.Fatal(err)
+				}
+				// The build runs in a helper process, since a process started by the benchmark starts with its peak RSS
+				cmd := exec.Command(os.Args[0], "-test.run", "^TestBuildHelper$")
+				cmd.Env = append(os.Environ(), buildHelperEnv+"="+dir)
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					b.Fatalf("go build failed: %s\n%s", err, out)
+				}
+				var rss int64
+				if _, err := fmt.Sscanf(string(out), "peak RSS %d", &rss); err == nil && rss > 0 {
+					b.ReportMetric(float64(rss)/(1<<20), "build-rss-MiB")
+				}
+			}
+		})
+	}
+}
+
+// buildHelperEnv names the package directory that TestBuildHelper builds.
+const buildHelperEnv = "GONOTO_BUILD_HELPER_DIR"
+
+// TestBuildHelper runs go build for BenchmarkChunkEncoding and prints its peak RSS in bytes, or 0 if the platform does
+// not report it. It is skipped unless the benchmark starts it.
+func TestBuildHelper(t *testing.T) {
+	dir := os.Getenv(buildHelperEnv)
+	if dir == "" {
+		t.Skip("only run by BenchmarkChunkEncoding")
+	}
+	cmd := exec.Command("go", "build", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %s\n%s", err, out)
+	}
+	rss, _ := peakRSS(cmd.ProcessState)
+	fmt.Printf("peak RSS %d\n", rss)
+}
+
+// sourceSize returns the total size of the chunk files in dir, including the data files of the embed encoding.
+func sourceSize(b *testing.B, dir string) int64 {
+	files, err := filepath.Glob(filepath.Join(dir, "chunk*"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var size int64
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size += fi.Size()
+	}
+	return size
+}
+
+// typeCheckCost parses and type-checks the package in dir and returns the heap that stays live while the results are
+// held, and the bytes allocated along the way.
+func typeCheckCost(b *testing.B, dir string) (uint64, uint64) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var files []*ast.File
+	for _, f := range pkgs["bench"].Files {
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: emptyImporter{}}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue), Defs: make(map[*ast.Ident]types.Object)}
+	pkg, err := conf.Check("bench", fset, files, info)
+	if err != nil {
+		b.Fatal(err)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(pkg)
+	runtime.KeepAlive(info)
+	runtime.KeepAlive(files)
+	var heap uint64
+	if after.HeapAlloc > before.HeapAlloc {
+		heap = after.HeapAlloc - before.HeapAlloc
+	}
+	return heap, after.TotalAlloc - before.TotalAlloc
+}
+
+// emptyImporter imports the embed package of the embed encoding as an empty package, since the chunks only import it
+// for its side effect.
+type emptyImporter struct{}
+
+func (emptyImporter) Import(path string) (*types.Package, error) {
+	pkg := types.NewPackage(path, path)
+	pkg.MarkComplete()
+	return pkg, nil
+}
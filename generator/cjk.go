@@ -0,0 +1,204 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// The noto-cjk repository ships its fonts separately from the other Noto fonts, as pre-built collections such as
+// Sans/OTC/NotoSansCJK-Bold.ttc that hold the fonts of every region, as individual fonts such as
+// NotoSansCJKsc-Regular.otf, and as region subsets such as NotoSansJP-Regular.otf. The adapter in this file presents
+// all of them to the merge pipeline as individual fonts named like those of the release.
+
+// cjkCollectionPattern matches the file names of the pre-built CJK collections. The Mono fonts are part of the Sans
+// collections.
+var cjkCollectionPattern = regexp.MustCompile(`^Noto(Sans|Serif)CJK-([A-Za-z]+)\.ttc$`)
+
+// cjkRegions maps the region subsets of the CJK fonts, such as the JP of NotoSansJP-Regular.otf, to the language of
+// the corresponding full font, such as the CJKjp of NotoSansCJKjp-Regular.otf.
+var cjkRegions = map[string]string{"JP": "CJKjp", "KR": "CJKkr", "SC": "CJKsc", "TC": "CJKtc", "HK": "CJKhk"}
+
+// addCJKCollections adds the members of the pre-built CJK collections in fsys to the inventory as fonts named like the
+// individual CJK fonts, such as NotoSansMonoCJKkr-Bold.otf, whose paths are inside the collection, such as
+// Sans/OTC/NotoSansCJK-Bold.ttc/NotoSansMonoCJKkr-Bold.otf. The members are read through a collectionFS. They are
+// added after the other fonts, so that preferFonts keeps individual fonts of the same name instead.
+func addCJKCollections(fsys fs.FS, inventory *noto.Inventory) error {
+	var collections []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && cjkCollectionPattern.MatchString(d.Name()) {
+			collections = append(collections, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan the Noto input for CJK collections: %w", err)
+	}
+	for _, p := range collections {
+		members, err := cjkCollectionMembers(fsys, p)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(members))
+		for name := range members {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f, _ := noto.ParseFilename(name)
+			f.Path = p + "/" + name
+			f.Size = int64(len(members[name]))
+			f.CompressedSize = f.Size
+			inventory.Fonts = append(inventory.Fonts, f)
+		}
+		log.debugf("Found %d fonts in the CJK collection %s", len(members), p)
+	}
+	return nil
+}
+
+// cjkCollectionMembers reads a pre-built CJK collection and returns its members as standalone fonts, by the file name
+// of the corresponding individual font. The file names are derived from the family names of the members, such as
+// "Noto Sans Mono CJK KR", and the weight of the collection. Members whose names are not recognized are skipped.
+func cjkCollectionMembers(fsys fs.FS, collectionPath string) (map[string][]byte, error) {
+	m := cjkCollectionPattern.FindStringSubmatch(path.Base(collectionPath))
+	if m == nil {
+		return nil, fmt.Errorf("%s is not a CJK collection", collectionPath)
+	}
+	weight := m[2]
+	data, err := fs.ReadFile(fsys, collectionPath)
+	if err != nil {
+		return nil, err
+	}
+	fonts, err := parseFontCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the CJK collection %s: %w", collectionPath, err)
+	}
+	members := make(map[string][]byte)
+	for _, f := range fonts {
+		names := f.names()
+		family := append(names[16], names[1]...)
+		if len(family) == 0 {
+			continue
+		}
+		// Such as "Noto Sans Mono CJK KR"
+		terms := strings.Fields(family[0])
+		if len(terms) < 4 || terms[0] != "Noto" || terms[len(terms)-2] != "CJK" {
+			continue
+		}
+		language, ok := cjkRegions[terms[len(terms)-1]]
+		if !ok {
+			continue
+		}
+		name := strings.Join(terms[:len(terms)-2], "") + language + "-" + weight + ".otf"
+		if _, ok := noto.ParseFilename(name); !ok {
+			continue
+		}
+		members[name] = f.encode()
+	}
+	return members, nil
+}
+
+// adaptCJKSubsets renames the languages of the region subsets of the CJK fonts, such as the JP of
+// NotoSansJP-Regular.otf, to those of the full fonts, such as CJKjp, so that they take the place of the full fonts in
+// the packages. Subsets are dropped where the full font of the same style is also present, since it covers more.
+func adaptCJKSubsets(inventory *noto.Inventory) {
+	type styleKey struct {
+		family, language, weight, width, style string
+		ui                                     bool
+	}
+	key := func(f *noto.Font, language string) styleKey {
+		return styleKey{f.Family, language, f.Weight, f.Width, f.Style, f.UI}
+	}
+	full := make(map[styleKey]bool)
+	for _, f := range inventory.Fonts {
+		if strings.HasPrefix(f.Language, "CJK") {
+			full[key(f, f.Language)] = true
+		}
+	}
+	fonts := inventory.Fonts[:0]
+	dropped := 0
+	for _, f := range inventory.Fonts {
+		if language, ok := cjkRegions[f.Language]; ok {
+			if full[key(f, language)] {
+				dropped++
+				continue
+			}
+			f.Language = language
+		}
+		fonts = append(fonts, f)
+	}
+	inventory.Fonts = fonts
+	if dropped > 0 {
+		log.debugf("Using the full CJK fonts instead of %d region subsets", dropped)
+	}
+	languages := make(map[string]bool)
+	for _, f := range fonts {
+		languages[f.Language] = true
+	}
+	inventory.Languages = inventory.Languages[:0]
+	for l := range languages {
+		inventory.Languages = append(inventory.Languages, l)
+	}
+	sort.Strings(inventory.Languages)
+}
+
+// collectionFS adds the members of the pre-built CJK collections of an input to it, at the paths that
+// addCJKCollections assigns to them. The members of the most recently read collection are kept, since the members of
+// a collection are usually read one after the other.
+type collectionFS struct {
+	fs.FS
+
+	mu      sync.Mutex
+	path    string            // The path of the collection whose members are kept
+	members map[string][]byte // The members of the collection, by file name
+}
+
+func (c *collectionFS) Open(name string) (fs.File, error) {
+	dir := path.Dir(name)
+	if !cjkCollectionPattern.MatchString(path.Base(dir)) {
+		return c.FS.Open(name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path != dir {
+		members, err := cjkCollectionMembers(c.FS, dir)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		c.path, c.members = dir, members
+	}
+	data, ok := c.members[path.Base(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{name: path.Base(name), Reader: bytes.NewReader(data)}, nil
+}
+
+// memFile is a read-only file held in memory.
+type memFile struct {
+	name string
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return memFileInfo{f}, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memFileInfo struct{ f *memFile }
+
+func (fi memFileInfo) Name() string       { return fi.f.name }
+func (fi memFileInfo) Size() int64        { return fi.f.Size() }
+func (fi memFileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// recordingSink returns a sink that passes the files to sink and records their paths in written.
+func recordingSink(sink fileSink, written map[string]bool) fileSink {
+	return func(path string, r io.Reader) error {
+		written[path] = true
+		return sink(path, r)
+	}
+}
+
+// cleanPackageDir deletes the files in the package directory outputDir that are not in written, such as chunk files
+// beyond the current number of chunks or the files of another output format, and then the directories that became
+// empty. Files and directories whose names start with a dot, such as .git, are kept.
+func cleanPackageDir(outputDir string, written map[string]bool) error {
+	var stale, dirs []string
+	err := filepath.WalkDir(outputDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == outputDir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, file)
+			return nil
+		}
+		rel, err := filepath.Rel(outputDir, file)
+		if err != nil {
+			return err
+		}
+		if !written[filepath.ToSlash(rel)] {
+			stale = append(stale, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list the files of %s: %w", outputDir, err)
+	}
+	for _, file := range stale {
+		log.infof("Deleting stale file %s", file)
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to delete stale file: %w", err)
+		}
+	}
+	// Remove the deepest directories first; directories that still contain files are kept
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+			if err := os.Remove(dir); err != nil {
+				return fmt.Errorf("failed to delete empty directory: %w", err)
+			}
+		}
+	}
+	return nil
+}
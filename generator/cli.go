@@ -0,0 +1,965 @@
+package generator
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// Exit codes returned by the command.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage is returned by subcommands when they were invoked with invalid arguments. The usage text has already been
+// printed when this error is returned.
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name    string
+	args    string // Positional argument synopsis, printed after the flags
+	summary string
+
+	// setup registers the flags accepted by the command and returns the function that runs it.
+	setup func(c *command, fs *flag.FlagSet) func(args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "fetch",
+			args:    "OUTPUTZIP",
+			summary: "download a Noto release ZIP and verify its checksum",
+			setup:   setupFetch,
+		},
+		{
+			name:    "generate",
+			args:    "INPUTZIP... OUTPUTDIR",
+			summary: "generate the font packages from one or more Noto release ZIPs",
+			setup:   setupGenerate,
+		},
+		{
+			name:    "embed",
+			args:    "INPUTZIP...",
+			summary: "write a single merged font into a package of an existing module",
+			setup:   setupEmbed,
+		},
+		{
+			name:    "list",
+			summary: "list the font packages that would be generated",
+			setup:   setupList,
+		},
+		{
+			name:    "check-config",
+			args:    "INPUTZIP...",
+			summary: "check the selected font packages and config file against Noto release ZIPs without generating them",
+			setup:   setupCheckConfig,
+		},
+		{
+			name:    "verify",
+			args:    "OUTPUTDIR [PACKAGE...]",
+			summary: "check that previously generated font packages decode correctly",
+			setup:   setupVerify,
+		},
+		{
+			name:    "compare",
+			args:    "OLDDIR NEWDIR [PACKAGE...]",
+			summary: "render sample text with two versions of the font packages and report visual changes",
+			setup:   setupCompare,
+		},
+		{
+			name:    "preview",
+			args:    "[OUTPUTDIR]",
+			summary: "render sample text with a generated font package to a PNG image",
+			setup:   setupPreview,
+		},
+		{
+			name:    "publish-proxy",
+			args:    "OUTPUTDIR [PACKAGE...]",
+			summary: "upload the module zips of -output-format module-zip to a module proxy",
+			setup:   setupPublishProxy,
+		},
+		{
+			name:    "completion",
+			args:    "bash|zsh|fish",
+			summary: "print a shell completion script for the commands, flags, and package names",
+			setup:   setupCompletion,
+		},
+		{
+			name:    "help",
+			args:    "[COMMAND]",
+			summary: "show help for a command",
+			setup:   setupHelp,
+		},
+	}
+}
+
+// Run runs the gonoto command with the given arguments, which exclude the program name, and returns its exit code.
+// Usage and error messages are written to stderr.
+func Run(args []string, stderr io.Writer) int {
+	if len(args) < 1 {
+		printUsage(stderr)
+		return exitUsage
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		// Support the original "gonoto INPUTZIP OUTPUTDIR" invocation.
+		if len(args) == 2 {
+			c, args = findCommand("generate"), append([]string{"generate"}, args...)
+		} else {
+			_, _ = fmt.Fprintf(stderr, "Unknown command %q\n\n", args[0])
+			printUsage(stderr)
+			return exitUsage
+		}
+	}
+
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { printCommandUsage(stderr, c, fs) }
+	runCommand := c.setup(c, fs)
+	defer removeExtractedTarballs()
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := applyEnvFlags(fs); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n\n", err.Error())
+		printCommandUsage(stderr, c, fs)
+		return exitUsage
+	}
+	if err := runCommand(fs.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			return exitUsage
+		}
+		_, _ = fmt.Fprintf(stderr, "Fatal error: %s\n", err.Error())
+		return exitError
+	}
+	return exitOK
+}
+
+// envPrefix is the prefix of the environment variables that provide defaults for flags and positional arguments, such
+// as GONOTO_JOBS for -jobs and GONOTO_INPUT for the input ZIP.
+const envPrefix = "GONOTO_"
+
+// envName returns the environment variable that sets a flag: -max-memory is set by GONOTO_MAX_MEMORY.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnvFlags sets the flags that were not given on the command line from their environment variables, if set, so
+// that the command can be configured in environments where passing arguments is awkward.
+func applyEnvFlags(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("Invalid %s value %q: %s", envName(f.Name), value, setErr.Error())
+		}
+	})
+	return err
+}
+
+// envArgs appends the positional arguments missing from args from the environment variables GONOTO_NAME for each of
+// names, stopping at the first one that is not set.
+func envArgs(args []string, names ...string) []string {
+	for i := len(args); i < len(names); i++ {
+		value := os.Getenv(envPrefix + names[i])
+		if value == "" {
+			break
+		}
+		args = append(args, value)
+	}
+	return args
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "Usage: %s COMMAND [FLAGS] [ARGS]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+	}
+	_, _ = fmt.Fprintf(w, "\nRun \"%s help COMMAND\" for more information about a command.\n", os.Args[0])
+}
+
+func printCommandUsage(w io.Writer, c *command, fs *flag.FlagSet) {
+	_, _ = fmt.Fprintf(w, "Usage: %s %s [FLAGS] %s\n\n", os.Args[0], c.name, c.args)
+	_, _ = fmt.Fprintf(w, "The %s command will %s.\n", c.name, c.summary)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		_, _ = fmt.Fprintf(w, "\nFlags:\n")
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintf(w, "\nFlags that are not given can be set with environment variables, e.g. %s for -jobs.\n", envName("jobs"))
+	}
+}
+
+// usageErrorf prints an error message followed by the usage text of the command and returns errUsage.
+func usageErrorf(c *command, fs *flag.FlagSet, format string, a ...interface{}) error {
+	_, _ = fmt.Fprintf(fs.Output(), format+"\n\n", a...)
+	printCommandUsage(fs.Output(), c, fs)
+	return errUsage
+}
+
+// stringList is a flag.Value holding a comma-separated list of strings. The flag may be repeated.
+type stringList []string
+
+// skipUsage is the usage text of the -skip flag of the commands that read inputs.
+const skipUsage = "comma-separated list of glob patterns, e.g. NotoSansTest*,*-Hinted*, of input files and directories to ignore"
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// repeatedString is a flag.Value that collects the value of each occurrence of a repeated flag.
+type repeatedString []string
+
+func (r *repeatedString) String() string {
+	return strings.Join(*r, " ")
+}
+
+func (r *repeatedString) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// comboList is a flag.Value holding a comma-separated list of combo families. Unlike stringList, it distinguishes an
+// empty value, which removes all combo families, from an unset flag.
+type comboList struct {
+	families []string
+	set      bool
+}
+
+func (l *comboList) String() string {
+	return strings.Join(l.families, ",")
+}
+
+func (l *comboList) Set(value string) error {
+	l.set = true
+	if l.families == nil {
+		l.families = []string{}
+	}
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if _, _, ok := comboSource(s); !ok {
+			return fmt.Errorf("unknown combo family %q", s)
+		}
+		l.families = append(l.families, s)
+	}
+	return nil
+}
+
+// familyFlags holds the flags that determine which font packages are generated.
+type familyFlags struct {
+	configPath string
+	names      stringList
+	specs      repeatedString
+	allWeights bool
+	display    bool
+
+	prepend  comboList
+	append   comboList
+	priority stringList
+
+	profileName string
+	profile     *profile // The selected profile, once resolved
+	cfg         *config  // The loaded config file, once resolved
+}
+
+func (ff *familyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&ff.configPath, "config", "", "JSON file defining additional font packages")
+	fs.Var(&ff.names, "families", "comma-separated list of font packages to include (default all)")
+	fs.Var(&ff.specs, "add-family",
+		"define an additional font package from key=value pairs (name, input, weight, width, ui, style, prepend, "+
+			"append, priority, description), e.g. name=notosanslight,input=Sans,weight=Light; may be repeated")
+	fs.BoolVar(&ff.allWeights, "all-weights", false, "include packages for every weight from Thin to Black")
+	fs.BoolVar(&ff.display, "include-display", false,
+		"include a Display variant of every Sans and Serif package, such as notosansdisplay, based on the SansDisplay and SerifDisplay fonts")
+	fs.StringVar(&ff.profileName, "profile", "",
+		"generate packages tailored to a use case: minimal (Sans with Latin and CJK only), standard, full (all weights), "+
+			"mobile (unhinted sources without hinting or unused layout tables), or desktop (keeps hinting); more profiles may be defined in the config file (default standard)")
+	fs.Var(&ff.prepend, "prepend-combo",
+		"comma-separated list of combo families (e.g. Emoji) to merge after the default language of every package, "+
+			"replacing the configured list; may be empty")
+	fs.Var(&ff.append, "append-combo",
+		"comma-separated list of combo families (e.g. KufiArabic or SansSymbols) to merge after all other languages "+
+			"of every package, replacing the configured list; may be empty")
+	fs.Var(&ff.priority, "language-priority",
+		"comma-separated list of language patterns (e.g. CJKtc or CJKjp) to merge before the other languages of every "+
+			"package, in this order, so that their glyphs win for shared characters such as Han ideographs")
+}
+
+// resolve returns the selected output families. Families defined by the config file replace standard families with the
+// same name. Families defined by the config file or -add-family are always included, even when -families is set. The
+// naming scheme from the config file is applied after selection, so -families always refers to the standard names.
+// The combo families are taken from -prepend-combo and -append-combo, then from the family definition, then from the
+// top-level lists in the config file, and the language priority likewise from -language-priority.
+func (ff *familyFlags) resolve() ([]outputFamily, error) {
+	cfg := new(config)
+	var err error
+	if ff.configPath != "" {
+		if cfg, err = loadConfig(ff.configPath); err != nil {
+			return nil, err
+		}
+	}
+	ff.cfg = cfg
+	if ff.profile, err = findProfile(ff.profileName, cfg.Profiles); err != nil {
+		return nil, fmt.Errorf("invalid -profile value: %w", err)
+	}
+	var available []outputFamily
+	if !cfg.ReplaceDefaults {
+		available = append(available, defaultOutputFamilies...)
+		if ff.allWeights || (ff.profile != nil && ff.profile.allWeights) {
+			available = expandWeights(available)
+		}
+		if ff.display {
+			available = withDisplayFamilies(available)
+		}
+		available = withComboFamilies(available, cfg.Prepend, cfg.Append)
+		available = withLanguagePriority(available, cfg.Priority)
+	}
+	configured, err := cfg.outputFamilies()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+	adHoc, err := addOutputFamilies(nil, ff.specs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -add-family value: %w", err)
+	}
+	names := ff.names
+	for _, f := range configured {
+		replaced := false
+		for i := range available {
+			if available[i].name == f.name {
+				available[i], replaced = f, true
+			}
+		}
+		if !replaced {
+			available = append(available, f)
+		}
+		if len(names) > 0 {
+			names = append(names, f.name)
+		}
+	}
+	for _, f := range adHoc {
+		if available, err = appendUniqueFamily(available, f); err != nil {
+			return nil, fmt.Errorf("invalid -add-family value: %w", err)
+		}
+		if len(names) > 0 {
+			names = append(names, f.name)
+		}
+	}
+	selected, err := selectOutputFamilies(available, names)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -families value: %w", err)
+	}
+	if ff.profile != nil {
+		selected = withComboFamilies(selected, ff.profile.prepend, ff.profile.append)
+	}
+	var prepend, appended []string
+	if ff.prepend.set {
+		prepend = ff.prepend.families
+	}
+	if ff.append.set {
+		appended = ff.append.families
+	}
+	selected = withComboFamilies(selected, prepend, appended)
+	if err := validateLanguagePatterns(ff.priority); err != nil {
+		return nil, fmt.Errorf("invalid -language-priority value: %w", err)
+	}
+	selected = withLanguagePriority(selected, ff.priority)
+	if cfg.Naming != "" {
+		if selected, err = applyNaming(selected, cfg.Naming); err != nil {
+			return nil, err
+		}
+	}
+	if selected, err = describeFamilies(selected, cfg.Description); err != nil {
+		return nil, err
+	}
+	if ff.profile != nil {
+		selected = ff.profile.apply(selected)
+	}
+	return selected, nil
+}
+
+func setupGenerate(c *command, fs *flag.FlagSet) func(args []string) error {
+	opts := new(generateOptions)
+	var ff familyFlags
+	ff.register(fs)
+	noEmoji := fs.Bool("no-emoji", false, "do not merge the Emoji font into the font packages")
+	fs.StringVar(&opts.emojiFormat, "emoji-format", emojiFormatMono,
+		"format of the Emoji font to merge: mono, or the cbdt (color bitmap) or colr (color vector) build of a noto-emoji input")
+	registerEmojiArbitrationFlags(fs, opts)
+	fs.Var((*stringList)(&opts.includeLanguages), "include-languages",
+		"comma-separated list of language patterns (e.g. Devanagari or CJK*) to include in the merged fonts (default all)")
+	fs.Var((*stringList)(&opts.excludeLanguages), "exclude-languages",
+		"comma-separated list of language patterns to omit from the merged fonts")
+	fs.IntVar(&opts.topLanguages, "top-langs", 0,
+		"only merge the N most widely read languages that each package's family covers, for small prototype builds (default all)")
+	fs.StringVar(&opts.shapingCheck, "shaping-check", shapingCheckWarn,
+		"how to handle merged fonts that lack the layout features needed for complex scripts: off, warn, or error")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the source fonts of each package without merging or writing anything")
+	jsonSummary := fs.Bool("json", false, "print a JSON summary of the generated packages to stdout and log to stderr instead")
+	fs.BoolVar(&opts.keepGoing, "keep-going", false, "keep generating the other packages when one fails and report all failures at the end")
+	fs.BoolVar(&opts.warningsAsErrors, "warnings-as-errors", false,
+		"fail the run if it logs any warnings, once its packages and manifest are written")
+	fs.BoolVar(&opts.clean, "clean", false,
+		"delete the files in each generated package directory that the run did not write, such as chunks of a previous, larger build")
+	interactive := fs.Bool("interactive", false,
+		"list the families and weights in the input ZIP and choose which of the selected packages to generate before starting")
+	fs.IntVar(&opts.jobs, "jobs", runtime.NumCPU(), "maximum number of source fonts read or packages generated at the same time")
+	fs.Var(&opts.maxMemory, "max-memory",
+		"approximate memory limit (e.g. 4GiB) for the source fonts and merge buffers of the packages generated at the same time (default unlimited)")
+	fs.BoolVar(&opts.lowMemory, "low-memory", false,
+		"extract the source fonts to a temporary directory in the output directory first, then merge one package at a time from there (implies -jobs 1)")
+	var lf logFlags
+	lf.register(fs)
+	var cf cacheFlags
+	cf.register(fs)
+	fs.StringVar(&opts.progress, "progress", progressAuto,
+		"when to show a live display of the progress of each stage on standard error: auto (if it is a terminal), always, or never")
+	fs.BoolVar(&opts.skipDiskCheck, "skip-disk-check", false, "do not check for sufficient free disk space before generating")
+	fs.BoolVar(&opts.noIndex, "no-index", false, "scan the input ZIP without reading or writing the INPUTZIP"+noto.IndexSuffix+" index file")
+	fs.Var((*stringList)(&opts.skip), "skip", skipUsage)
+	fs.BoolVar(&opts.stripHints, "strip-hints", false,
+		"remove TrueType hinting tables and glyph instructions from the merged fonts (requires -rebrand for hinted sources)")
+	fs.StringVar(&opts.cffOptimizer, "cff-optimizer", "",
+		"command that reads a merged collection with CFF fonts on stdin and writes it with restored subroutines to stdout")
+	licensePath := fs.String("license", "", "file to use as the LICENSE of the generated packages instead of the Apache License")
+	registerCopyrightFlags(fs, opts)
+	headerPath := fs.String("header", "",
+		"text/template file for the comment at the top of each generated Go file, with .File, .Package, .Description, and .Notice")
+	var dropTableNames stringList
+	fs.Var(&dropTableNames, "drop-tables", "comma-separated list of table tags (e.g. DSIG) to remove from the merged fonts")
+	fs.StringVar(&opts.rebrand, "rebrand", "",
+		"replace the Noto trademark in font names and documentation with this name, as required for modified fonts")
+	fs.StringVar(&opts.modulePrefix, "module-prefix", defaultModulePrefix,
+		"import path prefix of the generated modules, e.g. git.corp.example/fonts/")
+	fs.StringVar(&opts.goVersion, "go-version", "",
+		"Go version declared in the generated go.mod files (default "+minGoVersion+", or "+embedGoVersion+
+			" with -chunk-encoding embed or -test-fixture)")
+	fs.StringVar(&opts.chunkEncoding, "chunk-encoding", chunkEncodingUint64,
+		"how the chunk files store the font data: uint64 literals, string literals, or embed files (requires -go-version 1.16)")
+	opts.chunkSize = defaultChunkSize
+	fs.Var(&opts.chunkSize, "chunk-size", "amount of compressed font data in each chunk file, a multiple of 8 bytes")
+	fs.StringVar(&opts.outputFormat, "output-format", outputFormatGo,
+		"write each package as a Go module (go), a module zip for a module proxy (module-zip), or a plain PACKAGE.otc font collection file (otc)")
+	fs.StringVar(&opts.moduleVersion, "module-version", "", "version of the module zips written with -output-format module-zip, e.g. v1.0.0")
+	fs.BoolVar(&opts.splitData, "split-data", false,
+		"write the font data of each package to a separate PACKAGE/data module that the font module requires")
+	fs.StringVar(&opts.dataVersion, "data-version", "v0.0.0", "version of the data module required by each font module with -split-data")
+	fs.BoolVar(&opts.localeHelper, "locale-helper", false,
+		"also write locales.go to each package, which maps HTTP Accept-Language headers to the fonts of the collection they need")
+	fs.BoolVar(&opts.pdfHelper, "pdf-helper", false,
+		"also write a PACKAGE/pdf sub-package that extracts the member fonts and their character mappings for PDF generators")
+	fs.BoolVar(&opts.testFixture, "test-fixture", false,
+		"also write a PACKAGE/fonttest sub-package that embeds a small sample of the collection for unit tests (requires -go-version 1.16)")
+	fs.StringVar(&opts.changelogPath, "changelog", "", "also write the list of upstream font revision changes to this file")
+	fs.BoolVar(&opts.changedOnly, "changed-only", false,
+		"only generate the packages whose source fonts changed since the run recorded in the manifest of the output directory")
+	fs.BoolVar(&opts.pinCompressor, "pin-compressor", false,
+		"fail instead of warning if the manifest shows that packages to regenerate were compressed by a different compressor")
+	fs.StringVar(&opts.lockPath, "lock", "",
+		"lockfile, e.g. gonoto.lock, that records the inputs and packages of the run if it does not exist, and that the run must match otherwise")
+	fs.BoolVar(&opts.updateLock, "update-lock", false, "rewrite the -lock file from this run instead of checking the run against it")
+	hashName := fs.String("hash", hashSHA256.name, "algorithm of the checksums in the manifest, lockfile, and JSON summary: sha256 or sha512")
+	fs.BoolVar(&opts.fips, "fips", false,
+		"require the FIPS 140-3 mode of the Go Cryptographic Module, and detect changed sources with -hash instead of the CRC-32s of the input ZIP")
+	fs.StringVar(&opts.changedList, "changed-list", "", "write the names of the generated packages to this file, one per line")
+	fs.StringVar(&opts.reportPath, "report", "",
+		"write an HTML report of the size, coverage, and validation changes of each package since the previous run to this file")
+	fs.StringVar(&opts.inputReport, "input-report", "",
+		"write a JSON report of the font files of the inputs that are not recognized and the fonts that no package merges to this file")
+	fs.StringVar(&opts.baseTable, "base-table", baseTableKeep,
+		"how to handle source fonts without a BASE table: keep them as-is, or synthesize a default BASE table (requires -rebrand)")
+	return func(args []string) error {
+		args = envArgs(args, "INPUT", "OUTPUT")
+		if len(args) < 2 {
+			return usageErrorf(c, fs, "Expected one or more input ZIPs and an output directory")
+		}
+		inputs, outputDir := args[:len(args)-1], args[len(args)-1]
+		if err := lf.apply(); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := cf.apply(); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if opts.baseTable != baseTableKeep && opts.baseTable != baseTableSynthesize {
+			return usageErrorf(c, fs, "Invalid -base-table value %q", opts.baseTable)
+		}
+		switch opts.shapingCheck {
+		case shapingCheckOff, shapingCheckWarn, shapingCheckError:
+		default:
+			return usageErrorf(c, fs, "Invalid -shaping-check value %q", opts.shapingCheck)
+		}
+		if err := validateModulePrefix(opts.modulePrefix); err != nil {
+			return usageErrorf(c, fs, "Invalid -module-prefix value: %s", err.Error())
+		}
+		if !strings.HasSuffix(opts.modulePrefix, "/") {
+			opts.modulePrefix += "/"
+		}
+		for _, name := range dropTableNames {
+			tag, err := parseTableTag(name)
+			if err != nil {
+				return usageErrorf(c, fs, "Invalid -drop-tables value: %s", err.Error())
+			}
+			opts.dropTables = append(opts.dropTables, tag)
+		}
+		if opts.goVersion == "" {
+			opts.goVersion = defaultGoVersion(opts)
+		}
+		if err := validateGoVersion(opts.goVersion); err != nil {
+			return usageErrorf(c, fs, "Invalid -go-version value %q: %s", opts.goVersion, err.Error())
+		}
+		switch opts.outputFormat {
+		case outputFormatGo:
+		case outputFormatOTC, outputFormatModuleZip:
+			if opts.splitData {
+				return usageErrorf(c, fs, "-split-data cannot be used with -output-format %s", opts.outputFormat)
+			}
+			if opts.localeHelper && opts.outputFormat == outputFormatOTC {
+				return usageErrorf(c, fs, "-locale-helper cannot be used with -output-format %s", opts.outputFormat)
+			}
+			if opts.pdfHelper && opts.outputFormat == outputFormatOTC {
+				return usageErrorf(c, fs, "-pdf-helper cannot be used with -output-format %s", opts.outputFormat)
+			}
+			if opts.testFixture && opts.outputFormat == outputFormatOTC {
+				return usageErrorf(c, fs, "-test-fixture cannot be used with -output-format %s", opts.outputFormat)
+			}
+		default:
+			return usageErrorf(c, fs, "Invalid -output-format value %q", opts.outputFormat)
+		}
+		if err := validateDataVersion(opts.dataVersion); err != nil {
+			return usageErrorf(c, fs, "Invalid -data-version value %q: %s", opts.dataVersion, err.Error())
+		}
+		if opts.lockPath != "" && opts.changedOnly {
+			return usageErrorf(c, fs, "-lock cannot be used with -changed-only, since the lockfile covers every package of the run")
+		}
+		if opts.updateLock && opts.lockPath == "" {
+			return usageErrorf(c, fs, "-update-lock requires -lock")
+		}
+		h, err := findHash(*hashName)
+		if err != nil {
+			return usageErrorf(c, fs, "Invalid -hash value: %s", err.Error())
+		}
+		opts.hash = h
+		if opts.outputFormat == outputFormatModuleZip {
+			if opts.moduleVersion == "" {
+				return usageErrorf(c, fs, "-output-format %s requires -module-version", outputFormatModuleZip)
+			}
+			if err := validateDataVersion(opts.moduleVersion); err != nil {
+				return usageErrorf(c, fs, "Invalid -module-version value %q: %s", opts.moduleVersion, err.Error())
+			}
+		}
+		if err := validateCopyright(opts); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateChunkSize(opts.chunkSize); err != nil {
+			return usageErrorf(c, fs, "Invalid -chunk-size value: %s", err.Error())
+		}
+		if opts.jobs < 1 {
+			return usageErrorf(c, fs, "Invalid -jobs value %d", opts.jobs)
+		}
+		if opts.lowMemory {
+			opts.jobs = 1
+		}
+		switch opts.progress {
+		case progressAuto, progressAlways, progressNever:
+		default:
+			return usageErrorf(c, fs, "Invalid -progress value %q", opts.progress)
+		}
+		switch opts.chunkEncoding {
+		case chunkEncodingUint64, chunkEncodingString:
+		case chunkEncodingEmbed:
+			minor, _ := goMinorVersion(opts.goVersion)
+			if min, _ := goMinorVersion(embedGoVersion); minor < min {
+				return usageErrorf(c, fs, "-chunk-encoding %s requires -go-version %s or later", chunkEncodingEmbed, embedGoVersion)
+			}
+		default:
+			return usageErrorf(c, fs, "Invalid -chunk-encoding value %q", opts.chunkEncoding)
+		}
+		if opts.testFixture {
+			minor, _ := goMinorVersion(opts.goVersion)
+			if min, _ := goMinorVersion(embedGoVersion); minor < min {
+				return usageErrorf(c, fs, "-test-fixture requires -go-version %s or later", embedGoVersion)
+			}
+		}
+		if err := validateLanguagePatterns(append(opts.includeLanguages, opts.excludeLanguages...)); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateSkipPatterns(opts.skip); err != nil {
+			return usageErrorf(c, fs, "Invalid -skip value: %s", err.Error())
+		}
+		if opts.topLanguages < 0 {
+			return usageErrorf(c, fs, "Invalid -top-langs value %d", opts.topLanguages)
+		}
+		if *jsonSummary {
+			if opts.dryRun {
+				return usageErrorf(c, fs, "-json cannot be used with -dry-run")
+			}
+			log.w = os.Stderr
+			opts.summary = os.Stdout
+		}
+		selected, err := ff.resolve()
+		if err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateEmojiFormat(opts.emojiFormat, *noEmoji); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateEmojiArbitration(opts); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if *noEmoji {
+			selected = withoutComboFamily(selected, "Emoji")
+		}
+		if *interactive {
+			for _, input := range inputs {
+				if input == stdinInput {
+					return usageErrorf(c, fs, "-interactive reads the selection from standard input, so the input cannot be read from it")
+				}
+			}
+			if selected, err = selectInteractively(os.Stdin, os.Stderr, inputs, opts.noIndex, opts.skip, ff.profile.prefersHinted(), selected); err != nil {
+				return err
+			}
+		}
+		if opts.matcher, err = ff.cfg.Matching.matcher(); err != nil {
+			return usageErrorf(c, fs, "Invalid matching in config file: %s", err.Error())
+		}
+		if opts.readme, err = ff.cfg.Readme.templates(); err != nil {
+			return usageErrorf(c, fs, "Invalid readme in config file: %s", err.Error())
+		}
+		if opts.requiredCoverage, err = parseRequiredCoverage(ff.cfg.Required); err != nil {
+			return usageErrorf(c, fs, "Invalid required characters in config file: %s", err.Error())
+		}
+		if *licensePath == "" {
+			*licensePath = ff.cfg.License
+		}
+		if *licensePath != "" {
+			license, err := ioutil.ReadFile(*licensePath)
+			if err != nil {
+				return fmt.Errorf("failed to read license file: %w", err)
+			}
+			opts.license = string(license)
+		}
+		if *headerPath == "" {
+			*headerPath = ff.cfg.Header
+		}
+		if *headerPath != "" {
+			if opts.headerTemplate, err = loadHeaderTemplate(*headerPath); err != nil {
+				return err
+			}
+		}
+		if p := ff.profile; p != nil {
+			opts.stripHints = opts.stripHints || p.stripHints
+			opts.dropTables = append(opts.dropTables, p.dropTables...)
+			opts.requireHinting = p.requireHinting
+			opts.preferHinted = p.prefersHinted()
+			opts.checkLineMetrics = p.checkLineMetrics
+			if len(opts.includeLanguages) == 0 {
+				opts.includeLanguages = p.includeLanguages
+			}
+		}
+		if opts.rebrand != "" {
+			if err := validateRebrandName(opts.rebrand); err != nil {
+				return usageErrorf(c, fs, "Invalid -rebrand value: %s", err.Error())
+			}
+			for i := range selected {
+				selected[i].description = rebrandDescription(selected[i].description, opts.rebrand)
+			}
+		}
+		opts.outputFamilies = selected
+		return generateFonts(inputs, outputDir, opts)
+	}
+}
+
+// setupEmbed configures the embed command, which generates the Go files of a single font package, without go.mod,
+// README, or LICENSE files, into a directory of the user's own module. The font is chosen with the same terms as the
+// keys of -add-family.
+func setupEmbed(c *command, fs *flag.FlagSet) func(args []string) error {
+	opts := &generateOptions{baseTable: baseTableKeep, embed: true, matcher: defaultMatcher, hash: hashSHA256}
+	into := fs.String("into", "", "directory of the package to write the font files to, e.g. ./internal/fonts (required)")
+	packageName := fs.String("package", "", "name of the package in the -into directory (default the directory name)")
+	var fc familyConfig
+	fs.StringVar(&fc.Input, "family", "Sans", "input family of the font, e.g. Sans, Serif, or SansMono")
+	fs.StringVar(&fc.Weight, "weight", "Regular", "weight of the font, e.g. Light or Bold")
+	fs.StringVar(&fc.Width, "width", "", "width of the font, e.g. Condensed (default normal)")
+	fs.BoolVar(&fc.UI, "ui", false, "use the UI variants of the source fonts")
+	fs.StringVar(&fc.Style, "style", "", "style of the font: Italic (default normal)")
+	noEmoji := fs.Bool("no-emoji", false, "do not merge the Emoji font into the font")
+	fs.StringVar(&opts.emojiFormat, "emoji-format", emojiFormatMono,
+		"format of the Emoji font to merge: mono, or the cbdt (color bitmap) or colr (color vector) build of a noto-emoji input")
+	registerEmojiArbitrationFlags(fs, opts)
+	registerCopyrightFlags(fs, opts)
+	fs.Var((*stringList)(&opts.includeLanguages), "include-languages",
+		"comma-separated list of language patterns (e.g. Devanagari or CJK*) to include in the merged font (default all)")
+	fs.Var((*stringList)(&opts.excludeLanguages), "exclude-languages",
+		"comma-separated list of language patterns to omit from the merged font")
+	fs.IntVar(&opts.topLanguages, "top-langs", 0,
+		"only merge the N most widely read languages that the family covers, for small prototype builds (default all)")
+	fs.StringVar(&opts.shapingCheck, "shaping-check", shapingCheckWarn,
+		"how to handle a merged font that lacks the layout features needed for complex scripts: off, warn, or error")
+	fs.StringVar(&opts.chunkEncoding, "chunk-encoding", chunkEncodingUint64,
+		"how the chunk files store the font data: uint64 literals, string literals, or embed files (requires Go 1.16)")
+	opts.chunkSize = defaultChunkSize
+	fs.Var(&opts.chunkSize, "chunk-size", "amount of compressed font data in each chunk file, a multiple of 8 bytes")
+	fs.IntVar(&opts.jobs, "jobs", runtime.NumCPU(), "maximum number of source fonts read at the same time")
+	var lf logFlags
+	lf.register(fs)
+	var cf cacheFlags
+	cf.register(fs)
+	fs.StringVar(&opts.progress, "progress", progressAuto,
+		"when to show a live display of the progress of each stage on standard error: auto (if it is a terminal), always, or never")
+	fs.BoolVar(&opts.skipDiskCheck, "skip-disk-check", false, "do not check for sufficient free disk space before generating")
+	fs.BoolVar(&opts.noIndex, "no-index", false, "scan the input ZIP without reading or writing the INPUTZIP"+noto.IndexSuffix+" index file")
+	fs.Var((*stringList)(&opts.skip), "skip", skipUsage)
+	fs.BoolVar(&opts.warningsAsErrors, "warnings-as-errors", false, "fail the run if it logs any warnings, once the font files are written")
+	return func(args []string) error {
+		args = envArgs(args, "INPUT")
+		if len(args) == 0 {
+			return usageErrorf(c, fs, "Expected one or more input ZIPs")
+		}
+		if err := lf.apply(); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := cf.apply(); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if *into == "" {
+			return usageErrorf(c, fs, "Missing -into directory")
+		}
+		if *packageName == "" {
+			abs, err := filepath.Abs(*into)
+			if err != nil {
+				return err
+			}
+			*packageName = filepath.Base(abs)
+		}
+		fc.Name = *packageName
+		if f := (outputFamily{name: fc.Name}); !isFamilyName(fc.Name) || f.packageName() != fc.Name {
+			return usageErrorf(c, fs, "Invalid package name %q: use -package with a name of lowercase letters and digits", fc.Name)
+		}
+		switch opts.shapingCheck {
+		case shapingCheckOff, shapingCheckWarn, shapingCheckError:
+		default:
+			return usageErrorf(c, fs, "Invalid -shaping-check value %q", opts.shapingCheck)
+		}
+		switch opts.chunkEncoding {
+		case chunkEncodingUint64, chunkEncodingString, chunkEncodingEmbed:
+		default:
+			return usageErrorf(c, fs, "Invalid -chunk-encoding value %q", opts.chunkEncoding)
+		}
+		if err := validateCopyright(opts); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateChunkSize(opts.chunkSize); err != nil {
+			return usageErrorf(c, fs, "Invalid -chunk-size value: %s", err.Error())
+		}
+		if opts.jobs < 1 {
+			return usageErrorf(c, fs, "Invalid -jobs value %d", opts.jobs)
+		}
+		switch opts.progress {
+		case progressAuto, progressAlways, progressNever:
+		default:
+			return usageErrorf(c, fs, "Invalid -progress value %q", opts.progress)
+		}
+		if err := validateLanguagePatterns(append(opts.includeLanguages, opts.excludeLanguages...)); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateSkipPatterns(opts.skip); err != nil {
+			return usageErrorf(c, fs, "Invalid -skip value: %s", err.Error())
+		}
+		if opts.topLanguages < 0 {
+			return usageErrorf(c, fs, "Invalid -top-langs value %d", opts.topLanguages)
+		}
+		f, err := fc.outputFamily()
+		if err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		selected, err := describeFamilies([]outputFamily{f}, "")
+		if err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateEmojiFormat(opts.emojiFormat, *noEmoji); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if err := validateEmojiArbitration(opts); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if *noEmoji {
+			selected = withoutComboFamily(selected, "Emoji")
+		}
+		opts.outputFamilies = selected
+		return generateFonts(args, *into, opts)
+	}
+}
+
+// validateModulePrefix returns an error if prefix cannot start a module path. Only the basic syntax is checked; the
+// characters allowed are a subset of those permitted by the go command.
+func validateModulePrefix(prefix string) error {
+	trimmed := strings.TrimSuffix(prefix, "/")
+	if trimmed == "" {
+		return errors.New("the prefix must not be empty")
+	}
+	for _, elem := range strings.Split(trimmed, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return fmt.Errorf("invalid path element %q", elem)
+		}
+		for _, r := range elem {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && !strings.ContainsRune("-._~", r) {
+				return fmt.Errorf("invalid character %q in path element %q", r, elem)
+			}
+		}
+	}
+	return nil
+}
+
+func setupList(c *command, fs *flag.FlagSet) func(args []string) error {
+	var ff familyFlags
+	ff.register(fs)
+	return func(args []string) error {
+		if len(args) != 0 {
+			return usageErrorf(c, fs, "Unexpected arguments: %v", args)
+		}
+		available, err := ff.resolve()
+		if err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		for _, f := range available {
+			fmt.Printf("%s\t%s\n", f.name, f.description)
+		}
+		return nil
+	}
+}
+
+func setupCheckConfig(c *command, fs *flag.FlagSet) func(args []string) error {
+	var ff familyFlags
+	ff.register(fs)
+	noIndex := fs.Bool("no-index", false, "scan the input ZIP without reading or writing the INPUTZIP"+noto.IndexSuffix+" index file")
+	var skip stringList
+	fs.Var(&skip, "skip", skipUsage)
+	return func(args []string) error {
+		args = envArgs(args, "INPUT")
+		if len(args) == 0 {
+			return usageErrorf(c, fs, "Expected one or more input ZIPs")
+		}
+		if err := validateSkipPatterns(skip); err != nil {
+			return usageErrorf(c, fs, "Invalid -skip value: %s", err.Error())
+		}
+		return checkConfig(args, &ff, *noIndex, skip)
+	}
+}
+
+func setupVerify(c *command, fs *flag.FlagSet) func(args []string) error {
+	var opts verifyOptions
+	fs.IntVar(&opts.fuzz, "fuzz", 0, "rasterize this many random glyphs of each font at random sizes to check that they load and draw safely")
+	fs.Int64Var(&opts.seed, "seed", 0, "seed of the random glyphs and sizes of -fuzz, to reproduce a failure (default random)")
+	fs.BoolVar(&opts.harfBuzz, "harfbuzz", false,
+		"check that HarfBuzz shapes complex script clusters with the merged fonts (requires a build with -tags harfbuzz)")
+	return func(args []string) error {
+		args = envArgs(args, "OUTPUT")
+		if len(args) < 1 {
+			return usageErrorf(c, fs, "Expected an output directory")
+		}
+		packages := args[1:]
+		if len(packages) == 0 {
+			for _, f := range defaultOutputFamilies {
+				packages = append(packages, f.name)
+			}
+		}
+		if opts.fuzz < 0 {
+			return usageErrorf(c, fs, "Invalid -fuzz value %d", opts.fuzz)
+		}
+		if opts.harfBuzz && newHarfBuzzShaper == nil {
+			return usageErrorf(c, fs, "-harfbuzz requires gonoto to be built with -tags harfbuzz")
+		}
+		if opts.seed == 0 {
+			opts.seed = time.Now().UnixNano()
+		}
+		return verifyPackages(args[0], packages, opts)
+	}
+}
+
+func setupCompare(c *command, fs *flag.FlagSet) func(args []string) error {
+	var opts visualOptions
+	fs.Float64Var(&opts.size, "size", 32, "font size of the samples, in pixels")
+	fs.Float64Var(&opts.threshold, "threshold", 0.01, "fraction of the inked pixels of a sample that may change before it is reported")
+	fs.StringVar(&opts.diffDir, "diff-dir", "", "write an image of the old, new, and changed pixels of each reported sample to this directory")
+	return func(args []string) error {
+		if len(args) < 2 {
+			return usageErrorf(c, fs, "Expected the previous and new output directories")
+		}
+		if opts.size < 4 || opts.size > 512 {
+			return usageErrorf(c, fs, "Invalid -size value %g", opts.size)
+		}
+		if opts.threshold < 0 || opts.threshold > 1 {
+			return usageErrorf(c, fs, "Invalid -threshold value %g", opts.threshold)
+		}
+		packages := args[2:]
+		if len(packages) == 0 {
+			for _, f := range defaultOutputFamilies {
+				packages = append(packages, f.name)
+			}
+		}
+		return compareVisuals(args[0], args[1], packages, opts)
+	}
+}
+
+func setupHelp(c *command, fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		if len(args) == 0 {
+			printUsage(fs.Output())
+			return nil
+		}
+		if len(args) > 1 {
+			return usageErrorf(c, fs, "Expected at most one command name")
+		}
+		target := findCommand(args[0])
+		if target == nil {
+			return usageErrorf(c, fs, "Unknown command %q", args[0])
+		}
+		targetFlags := flag.NewFlagSet(target.name, flag.ContinueOnError)
+		targetFlags.SetOutput(fs.Output())
+		target.setup(target, targetFlags)
+		printCommandUsage(fs.Output(), target, targetFlags)
+		return nil
+	}
+}
@@ -0,0 +1,257 @@
+package generator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// filterCMAP returns a copy of a cmap table in which the Unicode subtables of formats 4 and 12 no longer map the
+// characters for which remove returns true, and whether any subtable changed. The other subtables, such as the
+// variation sequences of format 14, are copied unchanged. Subtables shared by several encoding records stay shared.
+func filterCMAP(cmap []byte, remove func(r rune) bool) ([]byte, bool, error) {
+	if len(cmap) < 4 {
+		return nil, false, errors.New("cmap table is truncated")
+	}
+	numTables := int(binary.BigEndian.Uint16(cmap[2:]))
+	if len(cmap) < 4+8*numTables {
+		return nil, false, errors.New("cmap encoding records are truncated")
+	}
+	// The Unicode subtables are recognized as in findCMAPSubtable
+	unicodeOffsets := make(map[int]bool)
+	for i := 0; i < numTables; i++ {
+		record := cmap[4+8*i:]
+		platform, encoding := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:])
+		if platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10)) {
+			unicodeOffsets[int(binary.BigEndian.Uint32(record[4:]))] = true
+		}
+	}
+	subtables := make(map[int][]byte)
+	var offsets []int
+	changed := false
+	for i := 0; i < numTables; i++ {
+		offset := int(binary.BigEndian.Uint32(cmap[4+8*i+4:]))
+		if _, ok := subtables[offset]; ok {
+			continue
+		}
+		if offset < 0 || len(cmap) < offset+2 {
+			return nil, false, fmt.Errorf("cmap subtable %d is truncated", i)
+		}
+		sub, err := cmapSubtable(cmap[offset:])
+		if err != nil {
+			return nil, false, fmt.Errorf("cmap subtable %d: %w", i, err)
+		}
+		if unicodeOffsets[offset] {
+			removed := 0
+			switch binary.BigEndian.Uint16(sub) {
+			case 4:
+				sub, removed, err = filterCMAP4(sub, remove)
+			case 12:
+				sub, removed, err = filterCMAP12(sub, remove)
+			}
+			if err != nil {
+				return nil, false, fmt.Errorf("cmap subtable %d: %w", i, err)
+			}
+			changed = changed || removed > 0
+		}
+		subtables[offset] = sub
+		offsets = append(offsets, offset)
+	}
+	if !changed {
+		return cmap, false, nil
+	}
+	out := make([]byte, 4+8*numTables)
+	copy(out, cmap[:4+8*numTables])
+	newOffsets := make(map[int]int, len(offsets))
+	for _, offset := range offsets {
+		newOffsets[offset] = len(out)
+		out = append(out, subtables[offset]...)
+	}
+	for i := 0; i < numTables; i++ {
+		record := out[4+8*i:]
+		binary.BigEndian.PutUint32(record[4:], uint32(newOffsets[int(binary.BigEndian.Uint32(record[4:]))]))
+	}
+	return out, true, nil
+}
+
+// cmapSubtable returns the subtable at the start of data, by the length recorded in its header.
+func cmapSubtable(data []byte) ([]byte, error) {
+	var length int
+	switch format := binary.BigEndian.Uint16(data); format {
+	case 0, 2, 4, 6:
+		if len(data) >= 4 {
+			length = int(binary.BigEndian.Uint16(data[2:]))
+		}
+	case 8, 10, 12, 13:
+		if len(data) >= 8 {
+			length = int(binary.BigEndian.Uint32(data[4:]))
+		}
+	case 14:
+		if len(data) >= 6 {
+			length = int(binary.BigEndian.Uint32(data[2:]))
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %d", format)
+	}
+	if length < 2 || len(data) < length {
+		return nil, errors.New("subtable is truncated")
+	}
+	return data[:length], nil
+}
+
+// cmap4Segment is a segment of a format 4 subtable. glyphs is the index of the glyph of start in the glyph ID array, or
+// -1 if the glyphs are computed from the characters with delta alone.
+type cmap4Segment struct {
+	start, end int
+	delta      uint16
+	glyphs     int
+}
+
+// filterCMAP4 removes characters from a format 4 subtable and returns the number removed. A character is removed from a
+// segment that uses the glyph ID array by clearing its glyph, and from a segment that uses delta alone by splitting the
+// segment around it.
+func filterCMAP4(sub []byte, remove func(r rune) bool) ([]byte, int, error) {
+	if len(sub) < 14 {
+		return nil, 0, errors.New("format 4 subtable is truncated")
+	}
+	segCount := int(binary.BigEndian.Uint16(sub[6:]) / 2)
+	endCodes := 14
+	startCodes := endCodes + 2*segCount + 2
+	idDeltas := startCodes + 2*segCount
+	idRangeOffsets := idDeltas + 2*segCount
+	glyphArray := idRangeOffsets + 2*segCount
+	if len(sub) < glyphArray {
+		return nil, 0, errors.New("format 4 subtable is truncated")
+	}
+	glyphIDs := make([]uint16, (len(sub)-glyphArray)/2)
+	for i := range glyphIDs {
+		glyphIDs[i] = binary.BigEndian.Uint16(sub[glyphArray+2*i:])
+	}
+	var segments []cmap4Segment
+	removed := 0
+	for i := 0; i < segCount; i++ {
+		s := cmap4Segment{
+			start:  int(binary.BigEndian.Uint16(sub[startCodes+2*i:])),
+			end:    int(binary.BigEndian.Uint16(sub[endCodes+2*i:])),
+			delta:  binary.BigEndian.Uint16(sub[idDeltas+2*i:]),
+			glyphs: -1,
+		}
+		if rangeOffset := int(binary.BigEndian.Uint16(sub[idRangeOffsets+2*i:])); rangeOffset != 0 {
+			s.glyphs = (idRangeOffsets + 2*i + rangeOffset - glyphArray) / 2
+			if s.glyphs < 0 || s.start > s.end || s.glyphs+s.end-s.start >= len(glyphIDs) {
+				return nil, 0, fmt.Errorf("segment %d of the format 4 subtable is out of range", i)
+			}
+			for c := s.start; c <= s.end; c++ {
+				if g := &glyphIDs[s.glyphs+c-s.start]; *g != 0 && *g+s.delta != 0 && remove(rune(c)) {
+					*g = 0
+					removed++
+				}
+			}
+			segments = append(segments, s)
+			continue
+		}
+		// Split the segment into the runs of characters that are kept
+		first := s.start
+		for c := s.start; c <= s.end; c++ {
+			if uint16(c)+s.delta == 0 || !remove(rune(c)) {
+				continue
+			}
+			if c > first {
+				segments = append(segments, cmap4Segment{first, c - 1, s.delta, -1})
+			}
+			first = c + 1
+			removed++
+		}
+		if first <= s.end {
+			segments = append(segments, cmap4Segment{first, s.end, s.delta, -1})
+		}
+	}
+	if removed == 0 {
+		return sub, 0, nil
+	}
+
+	n := len(segments)
+	glyphArray = 16 + 8*n
+	length := glyphArray + 2*len(glyphIDs)
+	if n > 0x7fff || length > 0xffff {
+		return nil, 0, errors.New("the filtered format 4 subtable is too large")
+	}
+	out := make([]byte, length)
+	searchRange := 2 << (bits.Len(uint(n)) - 1)
+	binary.BigEndian.PutUint16(out, 4)
+	binary.BigEndian.PutUint16(out[2:], uint16(length))
+	copy(out[4:6], sub[4:6]) // language
+	binary.BigEndian.PutUint16(out[6:], uint16(2*n))
+	binary.BigEndian.PutUint16(out[8:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[10:], uint16(bits.Len(uint(n))-1))
+	binary.BigEndian.PutUint16(out[12:], uint16(2*n-searchRange))
+	endCodes, startCodes = 14, 16+2*n
+	idDeltas, idRangeOffsets = startCodes+2*n, startCodes+4*n
+	for i, s := range segments {
+		binary.BigEndian.PutUint16(out[endCodes+2*i:], uint16(s.end))
+		binary.BigEndian.PutUint16(out[startCodes+2*i:], uint16(s.start))
+		binary.BigEndian.PutUint16(out[idDeltas+2*i:], s.delta)
+		if s.glyphs >= 0 {
+			rangeOffset := glyphArray + 2*s.glyphs - (idRangeOffsets + 2*i)
+			if rangeOffset > 0xffff {
+				return nil, 0, errors.New("the filtered format 4 subtable is too large")
+			}
+			binary.BigEndian.PutUint16(out[idRangeOffsets+2*i:], uint16(rangeOffset))
+		}
+	}
+	for i, g := range glyphIDs {
+		binary.BigEndian.PutUint16(out[glyphArray+2*i:], g)
+	}
+	return out, removed, nil
+}
+
+// filterCMAP12 removes characters from a format 12 subtable by splitting its groups around them, and returns the
+// number removed.
+func filterCMAP12(sub []byte, remove func(r rune) bool) ([]byte, int, error) {
+	if len(sub) < 16 {
+		return nil, 0, errors.New("format 12 subtable is truncated")
+	}
+	numGroups := int(binary.BigEndian.Uint32(sub[12:]))
+	if len(sub) < 16+12*numGroups {
+		return nil, 0, errors.New("format 12 subtable is truncated")
+	}
+	type group struct{ start, end, glyph uint32 }
+	var groups []group
+	removed := 0
+	for i := 0; i < numGroups; i++ {
+		g := sub[16+12*i:]
+		start, end, glyph := binary.BigEndian.Uint32(g), binary.BigEndian.Uint32(g[4:]), binary.BigEndian.Uint32(g[8:])
+		if end > 0x10ffff || start > end {
+			return nil, 0, fmt.Errorf("group %d of the format 12 subtable is out of range", i)
+		}
+		first := start
+		for c := start; c <= end; c++ {
+			if glyph+(c-start) == 0 || !remove(rune(c)) {
+				continue
+			}
+			if c > first {
+				groups = append(groups, group{first, c - 1, glyph + (first - start)})
+			}
+			first = c + 1
+			removed++
+		}
+		if first <= end {
+			groups = append(groups, group{first, end, glyph + (first - start)})
+		}
+	}
+	if removed == 0 {
+		return sub, 0, nil
+	}
+	out := make([]byte, 16+12*len(groups))
+	binary.BigEndian.PutUint16(out, 12)
+	binary.BigEndian.PutUint32(out[4:], uint32(len(out)))
+	copy(out[8:12], sub[8:12]) // language
+	binary.BigEndian.PutUint32(out[12:], uint32(len(groups)))
+	for i, g := range groups {
+		binary.BigEndian.PutUint32(out[16+12*i:], g.start)
+		binary.BigEndian.PutUint32(out[16+12*i+4:], g.end)
+		binary.BigEndian.PutUint32(out[16+12*i+8:], g.glyph)
+	}
+	return out, removed, nil
+}
@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// completionShells lists the shells accepted by the completion command.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionFlag describes a flag of a command for the completion scripts.
+type completionFlag struct {
+	name   string
+	usage  string   // The first line of the usage text
+	isBool bool     // Whether the flag takes no value
+	values []string // The suggested values, if the values are known
+}
+
+// completionValues returns the suggested values of the flags whose values come from a known set. Lists such as
+// -families accept the values separated by commas. The standard package names include every weight and the Display
+// variants, since -all-weights, -include-display, and profiles may add them.
+func completionValues() map[string][]string {
+	var packages []string
+	for _, f := range withDisplayFamilies(expandWeights(defaultOutputFamilies)) {
+		packages = append(packages, f.name)
+	}
+	var profileNames []string
+	for _, p := range profiles {
+		profileNames = append(profileNames, p.name)
+	}
+	var widths []string
+	for _, w := range hDensities {
+		if w != "" {
+			widths = append(widths, w)
+		}
+	}
+	return map[string][]string{
+		"families":       packages,
+		"profile":        profileNames,
+		"prepend-combo":  families,
+		"append-combo":   families,
+		"family":         families,
+		"weight":         weights,
+		"width":          widths,
+		"style":          {"Italic"},
+		"progress":       {progressAuto, progressAlways, progressNever},
+		"output-format":  {outputFormatGo, outputFormatOTC, outputFormatModuleZip},
+		"emoji-format":   {emojiFormatMono, emojiFormatCBDT, emojiFormatCOLR},
+		"repo":           {defaultRepo, "noto-cjk", "noto-emoji"},
+		"chunk-encoding": {chunkEncodingUint64, chunkEncodingString, chunkEncodingEmbed},
+		"shaping-check":  {shapingCheckOff, shapingCheckWarn, shapingCheckError},
+		"base-table":     {baseTableKeep, baseTableSynthesize},
+	}
+}
+
+// completionFlags returns the flags of a command, sorted by name.
+func completionFlags(c *command, values map[string][]string) []completionFlag {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.setup(c, fs)
+	var out []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := completionFlag{name: f.Name, usage: strings.SplitN(f.Usage, "\n", 2)[0], values: values[f.Name]}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			cf.isBool = true
+		}
+		out = append(out, cf)
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+func setupCompletion(c *command, fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		if len(args) != 1 {
+			return usageErrorf(c, fs, "Expected a shell: %s", strings.Join(completionShells, ", "))
+		}
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(os.Stdout, false)
+		case "zsh":
+			writeBashCompletion(os.Stdout, true)
+		case "fish":
+			writeFishCompletion(os.Stdout)
+		default:
+			return usageErrorf(c, fs, "Unknown shell %q: expected one of %s", args[0], strings.Join(completionShells, ", "))
+		}
+		return nil
+	}
+}
+
+// writeBashCompletion writes a bash completion function for gonoto. The zsh script loads the same function through
+// zsh's bash completion emulation.
+func writeBashCompletion(w io.Writer, zsh bool) {
+	values := completionValues()
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	var valueCases, flagCases strings.Builder
+	valueFlags := make(map[string]bool)
+	for _, c := range commands {
+		var flags []string
+		for _, f := range completionFlags(c, values) {
+			flags = append(flags, "-"+f.name)
+			if len(f.values) > 0 && !valueFlags[f.name] {
+				valueFlags[f.name] = true
+				fmt.Fprintf(&valueCases, "\t-%s|--%s) values=%q ;;\n", f.name, f.name, strings.Join(f.values, " "))
+			}
+		}
+		fmt.Fprintf(&flagCases, "\t\t%s) flags=%q ;;\n", c.name, strings.Join(flags, " "))
+	}
+	if zsh {
+		_, _ = io.WriteString(w, "#compdef gonoto\n\nautoload -U +X bashcompinit && bashcompinit\n\n")
+	}
+	_, _ = fmt.Fprintf(w, `# gonoto completion; load it with: source <(gonoto completion %s)
+_gonoto() {
+	local cur prev cmd values flags prefix
+	cur=${COMP_WORDS[COMP_CWORD]}
+	prev=${COMP_WORDS[COMP_CWORD-1]}
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W %q -- "$cur"))
+		return
+	fi
+	cmd=${COMP_WORDS[1]}
+	case "$prev" in
+%s	esac
+	if [ -n "$values" ]; then
+		# Lists such as -families take comma-separated values
+		prefix=""
+		case "$cur" in *,*) prefix=${cur%%,*},; cur=${cur##*,} ;; esac
+		COMPREPLY=($(compgen -P "$prefix" -W "$values" -- "$cur"))
+		return
+	fi
+	case "$cur" in
+	-*)
+		case "$cmd" in
+%s		esac
+		COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+		return
+		;;
+	esac
+	COMPREPLY=($(compgen -f -- "$cur"))
+}
+complete -o filenames -F _gonoto gonoto
+`, map[bool]string{false: "bash", true: "zsh"}[zsh], strings.Join(names, " "), valueCases.String(), flagCases.String())
+}
+
+// writeFishCompletion writes the fish completions for gonoto.
+func writeFishCompletion(w io.Writer) {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+	}
+	values := completionValues()
+	_, _ = fmt.Fprintf(w, "# gonoto completion; load it with: gonoto completion fish | source\n")
+	_, _ = fmt.Fprintf(w, "complete -c gonoto -f\n")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "complete -c gonoto -n __fish_use_subcommand -a %s -d %s\n", c.name, quote(c.summary))
+	}
+	for _, c := range commands {
+		condition := quote("__fish_seen_subcommand_from " + c.name)
+		if c.args != "" {
+			_, _ = fmt.Fprintf(w, "complete -c gonoto -n %s -F\n", condition)
+		}
+		for _, f := range completionFlags(c, values) {
+			line := fmt.Sprintf("complete -c gonoto -n %s -o %s -d %s", condition, f.name, quote(f.usage))
+			switch {
+			case len(f.values) > 0:
+				line += " -x -a " + quote(strings.Join(f.values, " "))
+			case !f.isBool:
+				line += " -r -F"
+			}
+			_, _ = fmt.Fprintln(w, line)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The SIL Open Font License prohibits distributing Modified Versions of the fonts under their Reserved Font Names. The
+// Noto fonts reserve the name "Noto". Merging whole fonts into a collection and choosing which fonts to merge do not
+// modify the fonts, but adjustments to their tables (such as synthesized BASE tables) do, so those outputs must be
+// rebranded before they can be published.
+
+// reservedNameProblem describes a member of a merged collection that was modified but still uses a Reserved Font Name.
+type reservedNameProblem struct {
+	font    string   // The source font
+	changes []string // The tables that differ from the source font, formatted as "added TAG", "changed TAG", etc.
+}
+
+func (p reservedNameProblem) String() string {
+	return fmt.Sprintf("%s is modified (%s) but its name still contains the Reserved Font Name %q",
+		p.font, strings.Join(p.changes, ", "), trademark)
+}
+
+// upstreamFont describes the file of the input that a derived source font was made from: the variable font of a static
+// instance, or the WOFF2 file of a decoded font.
+type upstreamFont struct {
+	path      string // The path of the file in the input
+	names     []byte // Its name table, as read before instancing or decoding
+	instanced bool   // Whether the font is a static instance of it, which modifies the font
+}
+
+// upstreamPath returns the path of the file of the input that the font at p is derived from, or p itself if the font
+// is read as it is; see isVariableInstance and isWOFF2Font.
+func upstreamPath(p string) string {
+	elems := strings.Split(p, "/")
+	for i, elem := range elems[:len(elems)-1] {
+		if path.Ext(elem) == woff2Ext || variableFontPattern.MatchString(elem) {
+			return strings.Join(elems[:i+1], "/")
+		}
+	}
+	return p
+}
+
+// readUpstreamFonts reads the name tables of the upstream files of the derived fonts among fonts, each file once, so
+// that checkReservedNames compares the derived fonts with the fonts they were made from rather than with themselves.
+func readUpstreamFonts(z fs.FS, fonts []*fontDesc) (map[string]*upstreamFont, error) {
+	upstreams := make(map[string]*upstreamFont)
+	names := make(map[string][]byte)
+	for _, f := range fonts {
+		p := upstreamPath(f.filename)
+		if p == f.filename {
+			continue
+		}
+		n, ok := names[p]
+		if !ok {
+			data, err := fs.ReadFile(z, p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the upstream font of %s: %w", f.filename, err)
+			}
+			if n, err = upstreamNameTable(p, data); err != nil {
+				return nil, fmt.Errorf("failed to read the name table of %s: %w", p, err)
+			}
+			names[p] = n
+		}
+		upstreams[f.filename] = &upstreamFont{path: p, names: n, instanced: isVariableInstance(f.filename)}
+	}
+	return upstreams, nil
+}
+
+// upstreamNameTable returns the name table of the font file at p. The name table of a WOFF2 file is never transformed,
+// so it is read without decoding the font.
+func upstreamNameTable(p string, data []byte) ([]byte, error) {
+	if path.Ext(p) == woff2Ext {
+		f, _, err := readWOFF2Tables(data)
+		if err != nil {
+			return nil, err
+		}
+		return f.table("name"), nil
+	}
+	fonts, err := parseFontCollection(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(fonts) != 1 {
+		return nil, fmt.Errorf("%s is a collection", p)
+	}
+	return fonts[0].table("name"), nil
+}
+
+// checkReservedNames compares each member of the merged collection with its unmodified source font and reports the
+// members that differ while their name table still contains the trademark. The collection members must correspond
+// one-to-one with sourceFonts. The source fonts derived from the files of the input, which upstreams describes, are
+// also compared with those files: a static instance always differs from its variable font, and the name table of a
+// decoded WOFF2 font must be that of the WOFF2 file.
+func checkReservedNames(merged []byte, sourceFonts []*fontDesc, fontData map[string][]byte,
+	upstreams map[string]*upstreamFont) ([]reservedNameProblem, error) {
+	members, err := parseFontCollection(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merged font collection: %w", err)
+	}
+	if len(members) != len(sourceFonts) {
+		return nil, fmt.Errorf("merged collection contains %d fonts, expected %d", len(members), len(sourceFonts))
+	}
+	var problems []reservedNameProblem
+	for i, m := range members {
+		if !usesReservedName(m) {
+			continue
+		}
+		source, err := parseFontCollection(fontData[sourceFonts[i].filename])
+		if err != nil || len(source) != 1 {
+			return nil, fmt.Errorf("failed to parse source font %s", sourceFonts[i].filename)
+		}
+		changes := tableChanges(source[0], m)
+		if u := upstreams[sourceFonts[i].filename]; u != nil {
+			if !bytes.Equal(m.table("name"), u.names) && exactIndexOf("changed name", changes) < 0 {
+				changes = append(changes, "changed name")
+				sort.Strings(changes)
+			}
+			if u.instanced {
+				changes = append([]string{"instanced from " + path.Base(u.path)}, changes...)
+			}
+		}
+		if len(changes) > 0 {
+			problems = append(problems, reservedNameProblem{font: sourceFonts[i].filename, changes: changes})
+		}
+	}
+	return problems, nil
+}
+
+// usesReservedName reports whether any of the family, full, unique, or PostScript names of f contain the trademark.
+func usesReservedName(f *sfntFont) bool {
+	for nameID, values := range f.names() {
+		if !rebrandedNameIDs[nameID] && nameID != namePostScript && nameID != namePostScriptCID && nameID != nameVariationsPSName {
+			continue
+		}
+		for _, v := range values {
+			if strings.Contains(v, trademark) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tableChanges lists the tables that were added, removed, or changed between two versions of a font. The
+// checkSumAdjustment field of the head table is ignored, since it depends on the position of the font in the file.
+func tableChanges(from *sfntFont, to *sfntFont) []string {
+	var changes []string
+	for tag, tbl := range to.tables {
+		old, ok := from.tables[tag]
+		switch {
+		case !ok:
+			changes = append(changes, "added "+tag)
+		case tag == "head" && len(tbl) >= 12 && len(old) >= 12:
+			if !bytes.Equal(tbl[:8], old[:8]) || !bytes.Equal(tbl[12:], old[12:]) {
+				changes = append(changes, "changed "+tag)
+			}
+		case !bytes.Equal(tbl, old):
+			changes = append(changes, "changed "+tag)
+		}
+	}
+	for tag := range from.tables {
+		if _, ok := to.tables[tag]; !ok {
+			changes = append(changes, "removed "+tag)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
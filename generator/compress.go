@@ -0,0 +1,120 @@
+package generator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// compressionLevel is the gzip compression level of the chunk data.
+const compressionLevel = gzip.BestCompression
+
+// compressorProbeSize is the size of the data compressed by compressorFingerprint.
+const compressorProbeSize = 1 << 20
+
+// newCompressor returns the gzip writer that compresses the chunk data. The gzip header has no file name and a zero
+// modification time, so the output only depends on the data and on the deflate implementation.
+func newCompressor(w io.Writer) (*gzip.Writer, error) {
+	return gzip.NewWriterLevel(w, compressionLevel)
+}
+
+var compressor struct {
+	once        sync.Once
+	fingerprint string
+}
+
+// compressorFingerprint identifies the compressor of the chunk data, such as "gzip-9/0123456789abcdef". The deflate
+// encoder of the standard library has changed between Go releases, and publishing chunks compressed by a different
+// toolchain changes every chunk file even if the fonts did not change. The fingerprint is a hash of the compressed
+// output for fixed data rather than the Go version, so that toolchains that compress identically share a
+// fingerprint.
+func compressorFingerprint() string {
+	compressor.once.Do(func() {
+		var buf bytes.Buffer
+		gz, err := newCompressor(&buf)
+		if err == nil {
+			_, err = gz.Write(compressorProbe())
+		}
+		if err == nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			compressor.fingerprint = fmt.Sprintf("gzip-%d/unknown", compressionLevel)
+			return
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		compressor.fingerprint = fmt.Sprintf("gzip-%d/%s", compressionLevel, hex.EncodeToString(sum[:8]))
+	})
+	return compressor.fingerprint
+}
+
+// compressorProbe returns the data compressed by compressorFingerprint. It mixes phrases repeated at varying
+// distances, which exercise the match finder, with runs of pseudo-random bytes, which exercise the choice between
+// literals and matches and the Huffman encoder. The pseudo-random bytes come from a fixed xorshift generator rather
+// than math/rand so that they cannot change with the Go version either.
+func compressorProbe() []byte {
+	phrases := []string{"glyf", "loca", "hmtx", "cmap", "GSUB", "GPOS", "Noto Sans ", "Regular", "\x00\x01\x00\x00"}
+	data := make([]byte, 0, compressorProbeSize)
+	x := uint32(2463534242)
+	next := func() uint32 {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		return x
+	}
+	for len(data) < compressorProbeSize {
+		switch r := next(); r % 4 {
+		case 0, 1:
+			data = append(data, phrases[(r>>8)%uint32(len(phrases))]...)
+		case 2:
+			for n := (r >> 8) % 64; n > 0; n-- {
+				data = append(data, byte(next()))
+			}
+		case 3:
+			// Repeat earlier data at a pseudo-random distance and length
+			if len(data) > 0 {
+				start := int(next() % uint32(len(data)))
+				end := start + int((r>>8)%258)
+				if end > len(data) {
+					end = len(data)
+				}
+				data = append(data, data[start:end]...)
+			}
+		}
+	}
+	return data[:compressorProbeSize]
+}
+
+// checkCompressor reports the packages about to be regenerated whose chunk files were written by a different
+// compressor according to the previous manifest, since all of their chunk files will change. With pin, they are an
+// error instead of a warning, so that a release pipeline cannot republish every chunk file after a toolchain upgrade
+// by accident.
+func checkCompressor(prev *manifest, packages []string, pin bool) error {
+	current := compressorFingerprint()
+	byCompressor := make(map[string][]string)
+	for _, name := range packages {
+		if old := prev.findPackage(name); old != nil && old.Compressor != "" && old.Compressor != current {
+			byCompressor[old.Compressor] = append(byCompressor[old.Compressor], name)
+		}
+	}
+	var previous []string
+	for c := range byCompressor {
+		previous = append(previous, c)
+	}
+	sort.Strings(previous)
+	for _, c := range previous {
+		msg := fmt.Sprintf("The chunk files of %s were written by compressor %s, but this build of gonoto uses %s, so "+
+			"all of their chunk files will change", strings.Join(byCompressor[c], ", "), c, current)
+		if pin {
+			return fmt.Errorf("%s; build gonoto with the toolchain that wrote them, or omit -pin-compressor", msg)
+		}
+		runWarnings.warnf(warnOutput, severityMinor, "", "%s", msg)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// config is the content of the JSON file passed with the -config flag.
+type config struct {
+	// ReplaceDefaults omits the standard Go Noto packages, so that only the packages defined in the config are
+	// generated.
+	ReplaceDefaults bool           `json:"replace_defaults"`
+	Families        []familyConfig `json:"families"`
+	Matrix          []matrixConfig `json:"matrix"`
+
+	// Prepend and Append replace the combo families of every package that does not list its own, including the
+	// standard packages. Unset lists keep the defaults.
+	Prepend []string `json:"prepend"`
+	Append  []string `json:"append"`
+
+	// Priority replaces the language priority of every package that does not list its own, including the standard
+	// packages; see prioritizeLanguages.
+	Priority []string `json:"priority"`
+
+	// Profiles defines additional profiles for the -profile flag; see profile.
+	Profiles []profileConfig `json:"profiles"`
+
+	// License and Header are paths, relative to the config file, of files that replace the LICENSE file and the Go
+	// file header of the generated packages; see the -license and -header flags.
+	License string `json:"license"`
+	Header  string `json:"header"`
+
+	// Required lists characters that every package must cover, as strings or as code point ranges such as
+	// "U+0600-U+06FF"; see parseRequiredCoverage. Each Go package also gets a test that checks them.
+	Required []string `json:"required"`
+
+	// Naming is an optional text/template that renames all of the output families; see applyNaming.
+	Naming string `json:"naming"`
+
+	// Description is an optional text/template that describes the packages without a description of their own; see
+	// describeFamilies.
+	Description string `json:"description"`
+
+	// Readme adds a repository link, badges, and sections to the README files of the generated packages.
+	Readme *readmeConfig `json:"readme"`
+
+	// Matching tunes how source fonts are chosen for styles that a family does not provide; see matcher.
+	Matching *matchingConfig `json:"matching"`
+}
+
+// familyConfig defines a single output family. Empty values use the same defaults as the -add-family flag.
+type familyConfig struct {
+	Name        string   `json:"name"`
+	Input       string   `json:"input"`  // The family to import language glyphs from, e.g. "Sans"
+	Weight      string   `json:"weight"` // Default "Regular"
+	Width       string   `json:"width"`  // e.g. "Condensed"; default normal width
+	UI          bool     `json:"ui"`     // Whether to prefer the UI variants, which have tighter vertical metrics
+	Style       string   `json:"style"`  // Either "Italic" or normal (the default)
+	Prepend     []string `json:"prepend"`
+	Append      []string `json:"append"`
+	Priority    []string `json:"priority"`    // Language patterns, e.g. "CJKtc", merged before the other languages
+	Description string   `json:"description"` // Optional; may use the same fields as the description template
+}
+
+// matrixConfig defines the output families formed by every combination of the listed weights, widths, UI settings,
+// and styles. The package names are formed by appending the lowercase attributes to the prefix, in the same order in
+// which they appear in upstream file names, e.g. "notosans" + "condensed" + "bold" + "italic". Regular weight and
+// normal width and style are omitted from the names.
+type matrixConfig struct {
+	Prefix   string   `json:"prefix"`
+	Input    string   `json:"input"`
+	Weights  []string `json:"weights"` // Default ["Regular"]
+	Widths   []string `json:"widths"`  // Default normal width only
+	UI       []bool   `json:"ui"`      // Default [false]
+	Styles   []string `json:"styles"`  // Default normal style only
+	Prepend  []string `json:"prepend"`
+	Append   []string `json:"append"`
+	Priority []string `json:"priority"`
+	Summary  string   `json:"summary"` // An optional sentence appended to each generated description
+}
+
+func loadConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	cfg := new(config)
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err := d.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	for _, p := range []*string{&cfg.License, &cfg.Header} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(filepath.Dir(path), *p)
+		}
+	}
+	return cfg, nil
+}
+
+// outputFamilies returns the families defined by the config, followed by the families produced by each matrix.
+func (cfg *config) outputFamilies() ([]outputFamily, error) {
+	for _, c := range append(append([]string(nil), cfg.Prepend...), cfg.Append...) {
+		if _, _, ok := comboSource(c); !ok {
+			return nil, fmt.Errorf("unknown combo family %q", c)
+		}
+	}
+	if err := validateLanguagePatterns(cfg.Priority); err != nil {
+		return nil, err
+	}
+	var out []outputFamily
+	for _, fc := range cfg.Families {
+		if fc.Prepend == nil {
+			fc.Prepend = cfg.Prepend
+		}
+		if fc.Append == nil {
+			fc.Append = cfg.Append
+		}
+		if fc.Priority == nil {
+			fc.Priority = cfg.Priority
+		}
+		f, err := fc.outputFamily()
+		if err != nil {
+			return nil, fmt.Errorf("family %q: %w", fc.Name, err)
+		}
+		if out, err = appendUniqueFamily(out, f); err != nil {
+			return nil, err
+		}
+	}
+	for _, mc := range cfg.Matrix {
+		if mc.Prepend == nil {
+			mc.Prepend = cfg.Prepend
+		}
+		if mc.Append == nil {
+			mc.Append = cfg.Append
+		}
+		if mc.Priority == nil {
+			mc.Priority = cfg.Priority
+		}
+		expanded, err := mc.expand()
+		if err != nil {
+			return nil, fmt.Errorf("matrix %q: %w", mc.Prefix, err)
+		}
+		for _, f := range expanded {
+			if out, err = appendUniqueFamily(out, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func (mc matrixConfig) expand() ([]outputFamily, error) {
+	if mc.Prefix == "" {
+		return nil, fmt.Errorf("missing prefix")
+	}
+	weightList := mc.Weights
+	if len(weightList) == 0 {
+		weightList = []string{"Regular"}
+	}
+	widthList := mc.Widths
+	if len(widthList) == 0 {
+		widthList = []string{""}
+	}
+	uiList := mc.UI
+	if len(uiList) == 0 {
+		uiList = []bool{false}
+	}
+	styleList := mc.Styles
+	if len(styleList) == 0 {
+		styleList = []string{""}
+	}
+
+	var out []outputFamily
+	for _, ui := range uiList {
+		for _, width := range widthList {
+			for _, weight := range weightList {
+				for _, style := range styleList {
+					fc := familyConfig{
+						Input:    mc.Input,
+						Weight:   weight,
+						Width:    width,
+						UI:       ui,
+						Style:    style,
+						Prepend:  mc.Prepend,
+						Append:   mc.Append,
+						Priority: mc.Priority,
+					}
+					fc.Name = mc.Prefix
+					if ui {
+						fc.Name += "ui"
+					}
+					for _, term := range []string{width, weight, style} {
+						if term != "Regular" && term != "Normal" {
+							fc.Name += strings.ToLower(term)
+						}
+					}
+					f, err := fc.outputFamily()
+					if err != nil {
+						return nil, err
+					}
+					f.summary = mc.Summary
+					out = append(out, f)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// outputFamily validates the configuration and applies the defaults for unset fields.
+func (fc familyConfig) outputFamily() (outputFamily, error) {
+	f := outputFamily{
+		name:                 fc.Name,
+		inputFamily:          fc.Input,
+		weight:               fc.Weight,
+		hDensity:             fc.Width,
+		style:                fc.Style,
+		prependComboFamilies: fc.Prepend,
+		appendComboFamilies:  fc.Append,
+		priority:             fc.Priority,
+		description:          fc.Description,
+	}
+	if f.weight == "" {
+		f.weight = "Regular"
+	}
+	if fc.UI {
+		f.vDensity = "UI"
+	}
+	if f.prependComboFamilies == nil {
+		f.prependComboFamilies = emoji
+	}
+	if f.appendComboFamilies == nil {
+		f.appendComboFamilies = comboFamilies
+	}
+
+	if !isFamilyName(f.name) {
+		return f, fmt.Errorf("name %q must contain only lowercase letters, digits, and -._ and start with a letter", f.name)
+	}
+	if exactIndexOf(f.inputFamily, families) < 0 {
+		return f, fmt.Errorf("unknown input family %q", f.inputFamily)
+	}
+	for _, c := range append(append([]string(nil), f.prependComboFamilies...), f.appendComboFamilies...) {
+		if _, _, ok := comboSource(c); !ok {
+			return f, fmt.Errorf("unknown combo family %q", c)
+		}
+	}
+	if err := validateLanguagePatterns(f.priority); err != nil {
+		return f, err
+	}
+	if _, err := noto.ParseWeight(f.weight); err != nil {
+		return f, err
+	}
+	// The normal width and style may be named "Normal", but are stored as in file names
+	width, err := noto.ParseWidth(f.hDensity)
+	if err != nil {
+		return f, err
+	}
+	style, err := noto.ParseStyle(f.style)
+	if err != nil {
+		return f, err
+	}
+	f.hDensity, f.style = width.Term(), style.Term()
+	return f, nil
+}
@@ -0,0 +1,248 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// coverageTestFile is the name of the generated test that checks the required coverage of a package.
+const coverageTestFile = "coverage_test.go"
+
+// parseRequiredCoverage returns the sorted ranges of characters required by the "required" list of the config file.
+// Each entry is either a code point or range of code points, such as "U+0600" or "U+0600-U+06FF", or a string whose
+// characters other than white space are required.
+func parseRequiredCoverage(entries []string) ([][2]rune, error) {
+	var runes []rune
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "U+") {
+			bounds := strings.SplitN(entry, "-", 2)
+			start, err := parseCodePoint(bounds[0])
+			if err != nil {
+				return nil, err
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = parseCodePoint(bounds[1]); err != nil {
+					return nil, err
+				}
+			}
+			if end < start || end-start > 0x10000 {
+				return nil, fmt.Errorf("invalid range %q", entry)
+			}
+			for r := start; r <= end; r++ {
+				runes = append(runes, r)
+			}
+			continue
+		}
+		for _, r := range entry {
+			if !unicode.IsSpace(r) {
+				runes = append(runes, r)
+			}
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	var ranges [][2]rune
+	for _, r := range runes {
+		if n := len(ranges); n > 0 && r <= ranges[n-1][1]+1 {
+			if r > ranges[n-1][1] {
+				ranges[n-1][1] = r
+			}
+			continue
+		}
+		ranges = append(ranges, [2]rune{r, r})
+	}
+	return ranges, nil
+}
+
+func parseCodePoint(s string) (rune, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(s), "U+"), 16, 32)
+	if err != nil || v > unicode.MaxRune {
+		return 0, fmt.Errorf("invalid code point %q", s)
+	}
+	return rune(v), nil
+}
+
+// formatRanges formats ranges of characters as U+XXXX or U+XXXX-U+YYYY.
+func formatRanges(ranges [][2]rune) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r[0] == r[1] {
+			parts[i] = fmt.Sprintf("U+%04X", r[0])
+		} else {
+			parts[i] = fmt.Sprintf("U+%04X-U+%04X", r[0], r[1])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkRequiredCoverage returns the required characters that no member of the merged collection provides.
+func checkRequiredCoverage(merged []byte, required [][2]rune) ([][2]rune, error) {
+	members, err := parseFontCollection(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merged font collection: %w", err)
+	}
+	var missing [][2]rune
+	for _, r := range required {
+		for c := r[0]; c <= r[1]; c++ {
+			covered := false
+			for _, m := range members {
+				if m.hasRune(c) {
+					covered = true
+					break
+				}
+			}
+			if covered {
+				continue
+			}
+			if n := len(missing); n > 0 && missing[n-1][1] == c-1 {
+				missing[n-1][1] = c
+			} else {
+				missing = append(missing, [2]rune{c, c})
+			}
+		}
+	}
+	return missing, nil
+}
+
+// countCoverage returns the number of distinct characters provided by any member of the merged collection.
+func countCoverage(merged []byte) (int, error) {
+	members, err := parseFontCollection(merged)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse merged font collection: %w", err)
+	}
+	covered := make([]uint64, (unicode.MaxRune+64)/64)
+	count := 0
+	for _, m := range members {
+		m.forEachRune(func(r rune) {
+			if covered[r/64]&(1<<(r%64)) == 0 {
+				covered[r/64] |= 1 << (r % 64)
+				count++
+			}
+		})
+	}
+	return count, nil
+}
+
+// generateCoverageTest writes a test to the package that checks that the font collection still covers the required
+// characters, so that users who upgrade the package notice regressions in their own CI. The test parses the cmap
+// tables itself so that the package keeps having no dependencies. Without required characters, no test is written;
+// see removeCoverageTest.
+func generateCoverageTest(packageName string, sink fileSink, required [][2]rune) error {
+	if len(required) == 0 {
+		return nil
+	}
+	var ranges strings.Builder
+	for _, r := range required {
+		fmt.Fprintf(&ranges, "\t{0x%04X, 0x%04X},\n", r[0], r[1])
+	}
+	if err := sink.writeString(coverageTestFile, `// Code generated by gonoto. DO NOT EDIT.
+
+package `+packageName+`
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// requiredCoverage lists the ranges of characters that the font collection must cover.
+var requiredCoverage = [][2]rune{
+`+ranges.String()+`}
+
+func TestRequiredCoverage(t *testing.T) {
+	otc := OTC()
+	if len(otc) < 12 || string(otc[:4]) != "ttcf" {
+		t.Fatal("the font data is not an OpenType collection")
+	}
+	var subtables [][]byte
+	numFonts := int(binary.BigEndian.Uint32(otc[8:]))
+	for i := 0; i < numFonts; i++ {
+		offset := int(binary.BigEndian.Uint32(otc[12+4*i:]))
+		numTables := int(binary.BigEndian.Uint16(otc[offset+4:]))
+		for j := 0; j < numTables; j++ {
+			record := otc[offset+12+16*j:]
+			if string(record[:4]) != "cmap" {
+				continue
+			}
+			cmap := otc[binary.BigEndian.Uint32(record[8:]):]
+			for k := 0; k < int(binary.BigEndian.Uint16(cmap[2:])); k++ {
+				encoding := cmap[4+8*k:]
+				platform, id := binary.BigEndian.Uint16(encoding), binary.BigEndian.Uint16(encoding[2:])
+				if platform == 0 || (platform == 3 && (id == 1 || id == 10)) {
+					subtables = append(subtables, cmap[binary.BigEndian.Uint32(encoding[4:]):])
+				}
+			}
+		}
+	}
+	for _, r := range requiredCoverage {
+		for c := r[0]; c <= r[1]; c++ {
+			covered := false
+			for _, sub := range subtables {
+				if covered = cmapHasRune(sub, c); covered {
+					break
+				}
+			}
+			if !covered {
+				t.Errorf("U+%04X is not covered by any font in the collection", c)
+			}
+		}
+	}
+}
+
+func cmapHasRune(sub []byte, r rune) bool {
+	switch binary.BigEndian.Uint16(sub) {
+	case 4:
+		if r > 0xffff {
+			return false
+		}
+		segCount := int(binary.BigEndian.Uint16(sub[6:]) / 2)
+		endCodes := 14
+		startCodes := endCodes + 2*segCount + 2
+		idDeltas := startCodes + 2*segCount
+		idRangeOffsets := idDeltas + 2*segCount
+		c := uint16(r)
+		for i := 0; i < segCount; i++ {
+			if binary.BigEndian.Uint16(sub[endCodes+2*i:]) < c {
+				continue
+			}
+			start := binary.BigEndian.Uint16(sub[startCodes+2*i:])
+			if start > c {
+				return false
+			}
+			delta := binary.BigEndian.Uint16(sub[idDeltas+2*i:])
+			rangeOffset := int(binary.BigEndian.Uint16(sub[idRangeOffsets+2*i:]))
+			if rangeOffset == 0 {
+				return c+delta != 0
+			}
+			glyph := binary.BigEndian.Uint16(sub[idRangeOffsets+2*i+rangeOffset+2*int(c-start):])
+			return glyph != 0 && glyph+delta != 0
+		}
+	case 12:
+		c := uint32(r)
+		for i := 0; i < int(binary.BigEndian.Uint32(sub[12:])); i++ {
+			group := sub[16+12*i:]
+			if start := binary.BigEndian.Uint32(group); c >= start && c <= binary.BigEndian.Uint32(group[4:]) {
+				return binary.BigEndian.Uint32(group[8:])+(c-start) != 0
+			}
+		}
+	}
+	return false
+}
+`); err != nil {
+		return fmt.Errorf("failed to write coverage test: %w", err)
+	}
+	return nil
+}
+
+// removeCoverageTest removes the coverage test that a previous run with required characters wrote to the package in
+// outputDir.
+func removeCoverageTest(outputDir string) error {
+	if err := os.Remove(filepath.Join(outputDir, coverageTestFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete stale coverage test: %w", err)
+	}
+	return nil
+}
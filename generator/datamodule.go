@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// dataPackage is the name of the data package generated with -split-data, and of its directory within the font
+// module.
+const dataPackage = "data"
+
+// dataVersionPattern matches the semantic versions accepted by -data-version and -module-version.
+var dataVersionPattern = regexp.MustCompile(`^v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?$`)
+
+// validateDataVersion returns an error if v cannot be used as the version of a generated module, such as the required
+// version of a data module. Versions v2 and later are rejected because they require a major version suffix in the
+// module path.
+func validateDataVersion(v string) error {
+	m := dataVersionPattern.FindStringSubmatch(v)
+	if m == nil {
+		return errors.New("expected a semantic version such as v1.0.0")
+	}
+	if m[1] != "0" && m[1] != "1" {
+		return errors.New("the major version must be v0 or v1")
+	}
+	return nil
+}
+
+// dataModuleRequirement returns the go.mod lines of a font module that depend on its data module. The replace
+// directive only applies when the font module itself is built, such as in its own repository; users of the font module
+// download the required version of the data module.
+func dataModuleRequirement(moduleName string, opts *generateOptions) string {
+	dataModule := opts.modulePrefix + moduleName + "/" + dataPackage
+	return "\nrequire " + dataModule + " " + opts.dataVersion + "\n\nreplace " + dataModule + " => ./" + dataPackage + "\n"
+}
+
+// generateDataModule writes the support files of the data module of a font package, and the chunk.go file of the font
+// package that refers to it. The chunk files themselves are written by generateChunks.
+func generateDataModule(packageName string, moduleName string, description string, sink fileSink, opts *generateOptions) error {
+	dataModule := opts.modulePrefix + moduleName + "/" + dataPackage
+	if err := sink.writeString(dataPackage+"/go.mod", "module "+dataModule+"\n\ngo "+opts.goVersion+"\n"); err != nil {
+		return fmt.Errorf("failed to write data go.mod file: %w", err)
+	}
+	if err := sink.writeString(dataPackage+"/LICENSE", packageLicense(opts)); err != nil {
+		return fmt.Errorf("failed to write data LICENSE file: %w", err)
+	}
+	if err := sink.writeString(dataPackage+"/README.md", `# `+dataModule+`
+
+Package `+dataPackage+` contains the compressed font data of package `+packageName+`.
+Import `+opts.modulePrefix+moduleName+` instead of using this package directly.
+`); err != nil {
+		return fmt.Errorf("failed to write data README file: %w", err)
+	}
+
+	header, err := goFileHeader(opts, headerData{File: "chunk.go", Package: packageName, Description: description, Notice: fontNotice(opts.rebrand)})
+	if err != nil {
+		return err
+	}
+	if err := sink.writeString("chunk.go",
+		header+"package "+packageName+"\n\n"+
+			"import \""+dataModule+"\"\n\n"+
+			"var chunks = "+dataPackage+".Chunks\n"+
+			"const decompressedSize = "+dataPackage+".DecompressedSize\n"); err != nil {
+		return fmt.Errorf("failed to write chunk file: %w", err)
+	}
+	return nil
+}
+
+// removeStaleChunks removes the chunk files that a previous run without -split-data left in the font package in
+// outputDir, since they would otherwise still be compiled into it.
+func removeStaleChunks(outputDir string) error {
+	for _, pattern := range []string{"chunk[0-9]*.go", "chunk[0-9]*.bin"} {
+		stale, err := filepath.Glob(filepath.Join(outputDir, pattern))
+		if err != nil {
+			return err
+		}
+		for _, f := range stale {
+			if err := os.Remove(f); err != nil {
+				return fmt.Errorf("failed to delete stale chunk file %s: %w", f, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// defaultDescription is the description template of the packages that neither the config file nor their definition
+// describe. Descriptions follow the package name in the package documentation, e.g. "Package notosans provides ...".
+const defaultDescription = `provides the "{{.DisplayName}}" font collection.` +
+	`{{if .Classification}} It is a {{.Spacing}}, {{.Classification}} font.{{end}}`
+
+// descriptionData is the data available to description templates. It extends the data of naming templates.
+type descriptionData struct {
+	namingData
+	DisplayName    string // The name of the collection, e.g. "Noto Sans Bold"
+	Spacing        string // Either "fixed-width" or "proportional-width"
+	Classification string // Either "serif", "sans-serif", or "" for families that are neither, such as NaskhArabic
+}
+
+func newDescriptionData(f outputFamily) descriptionData {
+	d := descriptionData{
+		namingData:  newNamingData(f),
+		DisplayName: f.displayName,
+		Spacing:     "proportional-width",
+	}
+	if d.DisplayName == "" {
+		d.DisplayName = familyDisplayName(f)
+	}
+	if strings.Contains(f.inputFamily, "Mono") {
+		d.Spacing = "fixed-width"
+	}
+	if strings.Contains(f.inputFamily, "Serif") {
+		d.Classification = "serif"
+	} else if strings.Contains(f.inputFamily, "Sans") {
+		d.Classification = "sans-serif"
+	}
+	return d
+}
+
+// describeFamilies sets the descriptions of the families. The description of each family is a text/template with the
+// fields of descriptionData; families without one use tmpl, or defaultDescription if tmpl is empty. The summary of
+// each family is appended to its description.
+func describeFamilies(families []outputFamily, tmpl string) ([]outputFamily, error) {
+	if tmpl == "" {
+		tmpl = defaultDescription
+	}
+	common, err := template.New("description").Funcs(namingFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid description template: %w", err)
+	}
+	out := make([]outputFamily, len(families))
+	for i, f := range families {
+		t := common
+		if f.description != "" {
+			if t, err = template.New("description").Funcs(namingFuncs).Option("missingkey=error").Parse(f.description); err != nil {
+				return nil, fmt.Errorf("invalid description of %s: %w", f.name, err)
+			}
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, newDescriptionData(f)); err != nil {
+			return nil, fmt.Errorf("failed to describe %s: %w", f.name, err)
+		}
+		f.description = strings.TrimSpace(b.String())
+		if f.summary != "" {
+			f.description += " " + f.summary
+			f.summary = ""
+		}
+		out[i] = f
+	}
+	return out, nil
+}
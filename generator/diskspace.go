@@ -0,0 +1,22 @@
+package generator
+
+import "fmt"
+
+// diskSpaceFactor estimates the size of the generated packages relative to the compressed font data. Each byte of
+// compressed data is written as two hex digits, plus ",0x" for every 8 bytes.
+const diskSpaceFactor = 2.5
+
+// checkDiskSpace returns an error if the filesystem containing outputDir is known to have insufficient free space to
+// hold packages embedding the given amount of compressed font data. The compressed size of the source fonts in the
+// input archive is a good estimate of the compressed size of the merged fonts. extractedSize is the size of the
+// source fonts that -low-memory extracts next to the packages, or 0.
+func checkDiskSpace(outputDir string, compressedSize, extractedSize int64) error {
+	required := uint64(float64(compressedSize)*diskSpaceFactor) + uint64(extractedSize)
+	available, ok := availableDiskSpace(outputDir)
+	if !ok || available >= required {
+		return nil
+	}
+	return fmt.Errorf("insufficient disk space in %s: generating the packages requires about %.1f MiB, but only "+
+		"%.1f MiB is available (use -skip-disk-check to generate anyway)",
+		outputDir, float64(required)/(1024*1024), float64(available)/(1024*1024))
+}
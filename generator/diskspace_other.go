@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package generator
+
+// availableDiskSpace is not implemented on this platform, so the disk space check is skipped.
+func availableDiskSpace(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package generator
+
+import "syscall"
+
+func availableDiskSpace(path string) (uint64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// Values accepted by the -emoji-format flag. The noto-emoji repository builds its emoji font in several formats: the
+// monochrome outlines of the Emoji family in the Noto releases, color bitmaps in CBDT tables, and color vector glyphs
+// in COLR tables.
+const (
+	emojiFormatMono = "mono"
+	emojiFormatCBDT = "cbdt"
+	emojiFormatCOLR = "colr"
+)
+
+// emojiFamily is the family of the emoji fonts, which the default packages merge as a combo family.
+const emojiFamily = "Emoji"
+
+// colorEmojiFiles maps the file names of the color emoji fonts built by the noto-emoji repository, which do not follow
+// the naming of the other Noto fonts, to their formats.
+var colorEmojiFiles = map[string]string{
+	"NotoColorEmoji.ttf": emojiFormatCBDT,
+	"Noto-COLRv1.ttf":    emojiFormatCOLR,
+}
+
+// emojiFontFormat returns the format of an emoji font by its path.
+func emojiFontFormat(p string) string {
+	if format, ok := colorEmojiFiles[path.Base(p)]; ok {
+		return format
+	}
+	return emojiFormatMono
+}
+
+// addColorEmojiFonts adds the color emoji fonts in fsys, such as those in the fonts directory of a noto-emoji checkout,
+// to the inventory as fonts of the Emoji family. selectEmojiFormat later keeps only those of one format.
+func addColorEmojiFonts(fsys fs.FS, inventory *noto.Inventory) error {
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || colorEmojiFiles[d.Name()] == "" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		inventory.Fonts = append(inventory.Fonts, &noto.Font{
+			Path:           p,
+			Family:         emojiFamily,
+			Weight:         "Regular",
+			Size:           info.Size(),
+			CompressedSize: info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan the Noto input for color emoji fonts: %w", err)
+	}
+	return nil
+}
+
+// validateEmojiFormat returns an error if format is not a value of -emoji-format, or if it selects a color format
+// although the Emoji font is not merged.
+func validateEmojiFormat(format string, noEmoji bool) error {
+	switch format {
+	case emojiFormatMono:
+	case emojiFormatCBDT, emojiFormatCOLR:
+		if noEmoji {
+			return fmt.Errorf("-emoji-format %s cannot be used with -no-emoji", format)
+		}
+	default:
+		return fmt.Errorf("invalid -emoji-format value %q", format)
+	}
+	return nil
+}
+
+// selectEmojiFormat removes the emoji fonts of the inventory that are not in the given format, so that the packages
+// merge the emoji font of that format rather than whichever the inputs happen to contain. It fails if a color format
+// is requested but the inputs have no emoji font in it; the monochrome fonts are optional, like other combo families.
+func selectEmojiFormat(inventory *noto.Inventory, format string) error {
+	fonts := inventory.Fonts[:0]
+	found := false
+	for _, f := range inventory.Fonts {
+		if f.Family == emojiFamily && f.Language == "" {
+			if emojiFontFormat(f.Path) != format {
+				continue
+			}
+			found = true
+		}
+		fonts = append(fonts, f)
+	}
+	inventory.Fonts = fonts
+	if !found && format != emojiFormatMono {
+		return fmt.Errorf("-emoji-format %s: the inputs have no emoji font in this format; add a noto-emoji release as an input", format)
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// The font families and style terms recognized in Noto file names; see package noto.
+var (
+	families   = noto.Families
+	weights    = noto.Weights
+	hDensities = noto.Widths
+	vDensities = noto.VDensities
+	styles     = noto.Styles
+)
+
+type outputFamily struct {
+	name        string // The name / subdirectory of the family to output
+	inputFamily string // The family to import language glyphs from by default; see languageSource
+
+	weight   string
+	hDensity string
+	vDensity string
+	style    string
+
+	prependComboFamilies []string // The default languages in these families are injected after default language
+	appendComboFamilies  []string // The default languages in these families are injected after input languages
+	priority             []string // Language patterns merged before the other languages, in order; see prioritizeLanguages
+
+	displayName string // The name of the collection in the description; default familyDisplayName
+	description string // The package description, or a template for it; see describeFamilies
+	summary     string // An optional sentence appended to the description
+}
+
+var (
+	emoji = []string{"Emoji"}
+	// The symbol and math fonts only exist in Sans, so the Serif packages take them from there too
+	comboFamilies = []string{"KufiArabic", "NaskhArabic", "NastaliqUrdu", "SansMath", "SansSymbols", "SansSymbols2"}
+)
+
+// comboSource resolves the name of a combo family to the fonts that it injects. The name is either one of the
+// families, whose default language fonts are injected, or a family followed by one of its languages, such as
+// "SansDevanagari" or "SerifThai", whose fonts for that language are injected.
+func comboSource(name string) (family string, language string, ok bool) {
+	if exactIndexOf(name, families) >= 0 {
+		return name, "", true
+	}
+	family, language = noto.SplitFamily(name)
+	if family == "" || language == "" || exactIndexOf(language, vDensities) >= 0 {
+		return "", "", false
+	}
+	return family, language, true
+}
+
+// defaultOutputFamilies lists the packages published by the Go Noto project.
+var defaultOutputFamilies = []outputFamily{
+	{"notosans", "Sans", "Regular", "", "", "", emoji, comboFamilies, nil, "Noto Sans", "", ""},
+	{"notosansbold", "Sans", "Bold", "", "", "", emoji, comboFamilies, nil, "Noto Sans Bold", "", ""},
+	{"notosansbolditalic", "Sans", "Bold", "", "", "Italic", emoji, comboFamilies, nil, "Noto Sans Bold Italic", "", ""},
+	{"notosansitalic", "Sans", "Regular", "", "", "Italic", emoji, comboFamilies, nil, "Noto Sans Italic", "", ""},
+	{"notosanscondensed", "Sans", "Regular", "Condensed", "UI", "", emoji, comboFamilies, nil, "Noto Sans Condensed", "", ""},
+
+	{"notoserif", "Serif", "Regular", "", "", "", emoji, comboFamilies, nil, "Noto Serif", "", ""},
+	{"notoserifbold", "Serif", "Bold", "", "", "", emoji, comboFamilies, nil, "Noto Serif Bold", "", ""},
+	{"notoserifbolditalic", "Serif", "Bold", "", "", "Italic", emoji, comboFamilies, nil, "Noto Serif Bold Italic", "", ""},
+	{"notoserifitalic", "Serif", "Regular", "", "", "Italic", emoji, comboFamilies, nil, "Noto Serif Italic", "", ""},
+	{"notoserifcondensed", "Serif", "Regular", "Condensed", "UI", "", emoji, comboFamilies, nil, "Noto Serif Condensed", "", ""},
+
+	{"notomono", "SansMono", "Regular", "", "", "", emoji, nil, nil, "Noto Mono", "", ""},
+	{"notomonobold", "SansMono", "Bold", "", "", "", emoji, nil, nil, "Noto Mono Bold", "", ""},
+	{"notomonobolditalic", "SansMono", "Bold", "", "", "Italic", emoji, nil, nil, "Noto Mono Bold Italic", "", ""},
+	{"notomonoitalic", "SansMono", "Regular", "", "", "Italic", emoji, nil, nil, "Noto Mono Italic", "", ""},
+	{"notomonocondensed", "SansMono", "Regular", "Condensed", "UI", "", emoji, nil, nil, "Noto Mono Condensed", "", ""},
+
+	// The Arabic display families on their own, for applications that only need Arabic script in one style
+	{"notokufiarabic", "KufiArabic", "Regular", "", "", "", nil, nil, nil, "Noto Kufi Arabic", "", "It only covers the Arabic script."},
+	{"notonaskharabic", "NaskhArabic", "Regular", "", "", "", nil, nil, nil, "Noto Naskh Arabic", "", "It only covers the Arabic script."},
+	{"notonastaliqurdu", "NastaliqUrdu", "Regular", "", "", "", nil, nil, nil, "Noto Nastaliq Urdu", "", "It only covers the Arabic script."},
+}
+
+// selectOutputFamilies returns the members of available with the given names, in the order in which they appear in
+// available. If names is empty, all of the available families are returned.
+func selectOutputFamilies(available []outputFamily, names []string) ([]outputFamily, error) {
+	if len(names) == 0 {
+		return available, nil
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		wanted[n] = true
+	}
+	var selected []outputFamily
+	for _, f := range available {
+		if wanted[f.name] {
+			selected = append(selected, f)
+			delete(wanted, f.name)
+		}
+	}
+	if len(wanted) > 0 {
+		var unknown []string
+		for _, n := range names {
+			if wanted[n] {
+				unknown = append(unknown, n)
+			}
+		}
+		return nil, fmt.Errorf("unknown font packages: %s", strings.Join(unknown, ", "))
+	}
+	return selected, nil
+}
+
+// addOutputFamilies returns the available families followed by the families parsed from the given specs (see
+// parseFamilySpec). Package names must be unique.
+func addOutputFamilies(available []outputFamily, specs []string) ([]outputFamily, error) {
+	out := append([]outputFamily(nil), available...)
+	for _, spec := range specs {
+		f, err := parseFamilySpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", spec, err)
+		}
+		if out, err = appendUniqueFamily(out, f); err != nil {
+			return nil, fmt.Errorf("%q: %w", spec, err)
+		}
+	}
+	return out, nil
+}
+
+func appendUniqueFamily(families []outputFamily, f outputFamily) ([]outputFamily, error) {
+	for _, existing := range families {
+		if existing.name == f.name {
+			return nil, fmt.Errorf("duplicate package name %s", f.name)
+		}
+	}
+	return append(families, f), nil
+}
+
+// parseFamilySpec parses an ad-hoc output family from a comma-separated list of key=value pairs, such as
+// "name=notosanslight,input=Sans,weight=Light". The keys are the same as those used for families in the config file.
+// Values of the prepend and append keys are lists of families separated by "+", and those of the priority key lists of
+// language patterns. A description may contain commas, as long as the text that follows each comma does not contain
+// "=".
+func parseFamilySpec(spec string) (outputFamily, error) {
+	var fc familyConfig
+	var lastKey *string
+	for _, term := range strings.Split(spec, ",") {
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) != 2 {
+			if lastKey == nil {
+				return outputFamily{}, fmt.Errorf("expected key=value, found %q", term)
+			}
+			*lastKey += "," + term
+			continue
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		lastKey = nil
+		switch key {
+		case "name":
+			fc.Name = value
+		case "input":
+			fc.Input = value
+		case "weight":
+			fc.Weight = value
+		case "width":
+			fc.Width = value
+		case "ui":
+			switch value {
+			case "true":
+				fc.UI = true
+			case "false":
+				fc.UI = false
+			default:
+				return outputFamily{}, fmt.Errorf("ui must be true or false, found %q", value)
+			}
+		case "style":
+			fc.Style = value
+		case "prepend", "append", "priority":
+			list := []string{}
+			for _, c := range strings.Split(value, "+") {
+				if c = strings.TrimSpace(c); c != "" {
+					list = append(list, c)
+				}
+			}
+			switch key {
+			case "prepend":
+				fc.Prepend = list
+			case "append":
+				fc.Append = list
+			default:
+				fc.Priority = list
+			}
+		case "description":
+			fc.Description = value
+			lastKey = &fc.Description
+		default:
+			return outputFamily{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return fc.outputFamily()
+}
+
+// familyDisplayName returns the human-readable name of an output family, such as "Noto Sans Condensed Light Italic".
+// Style terms are spelled and ordered as in the upstream font names.
+func familyDisplayName(f outputFamily) string {
+	terms := []string{"Noto", splitCamelCase(f.inputFamily)}
+	for _, t := range []string{f.vDensity, f.hDensity, f.weight, f.style} {
+		if t != "" && t != "Regular" {
+			terms = append(terms, t)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// splitCamelCase inserts spaces between words in names such as "SansMono". Runs of capitals (such as "UI") are kept
+// together.
+func splitCamelCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && r >= 'A' && r <= 'Z' && !(s[i-1] >= 'A' && s[i-1] <= 'Z') {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isFamilyName reports whether s can be used as the name of an output family. The name is used as a directory name
+// and as the last element of the module path, so it may contain dashes, dots, and underscores in addition to lowercase
+// letters and digits; it must start with a letter.
+func isFamilyName(s string) bool {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '.' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// packageName returns the Go package name of the output family, which is its name without any punctuation.
+func (f outputFamily) packageName() string {
+	var b strings.Builder
+	for _, r := range f.name {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// expandWeights returns the given families followed by variants of every Regular family in each of the other weights,
+// such as "notosansmedium", "notoserifblackitalic", or "notosanscondensedbold". Families that already exist are not
+// duplicated.
+func expandWeights(available []outputFamily) []outputFamily {
+	out := append([]outputFamily(nil), available...)
+	exists := make(map[string]bool, len(available))
+	for _, f := range available {
+		exists[f.name] = true
+	}
+	for _, f := range available {
+		if f.weight != "Regular" {
+			continue
+		}
+		for _, w := range weights {
+			if w == "Regular" {
+				continue
+			}
+			v := f
+			v.weight = w
+			v.name = strings.TrimSuffix(f.name, strings.ToLower(f.style)) + strings.ToLower(w) + strings.ToLower(f.style)
+			if exists[v.name] {
+				continue
+			}
+			if f.displayName != "" {
+				v.displayName = insertWeightName(f.displayName, f.style, w)
+			}
+			out = append(out, v)
+			exists[v.name] = true
+		}
+	}
+	return out
+}
+
+// displayFamilies maps the families of the Display variants to the families that provide the fonts of their other
+// languages, since upstream only has Display fonts for Latin, Greek, and Cyrillic.
+var displayFamilies = map[string]string{"SansDisplay": "Sans", "SerifDisplay": "Serif"}
+
+// withDisplayFamilies returns the given families followed by a Display variant of every Sans and Serif family, such as
+// "notosansdisplay" or "notoserifdisplaybolditalic", whose default language fonts come from SansDisplay or SerifDisplay
+// and whose other fonts come from Sans or Serif. Display fonts have no UI variants, so the variants do not prefer
+// them. Families that already exist are not duplicated.
+func withDisplayFamilies(available []outputFamily) []outputFamily {
+	out := append([]outputFamily(nil), available...)
+	exists := make(map[string]bool, len(available))
+	for _, f := range available {
+		exists[f.name] = true
+	}
+	for _, display := range []string{"SansDisplay", "SerifDisplay"} {
+		base := displayFamilies[display]
+		prefix := "noto" + strings.ToLower(base)
+		for _, f := range available {
+			if f.inputFamily != base || !strings.HasPrefix(f.name, prefix) {
+				continue
+			}
+			v := f
+			v.name = "noto" + strings.ToLower(display) + strings.TrimPrefix(f.name, prefix)
+			v.inputFamily = display
+			v.vDensity = ""
+			if exists[v.name] {
+				continue
+			}
+			if f.displayName != "" {
+				v.displayName = strings.Replace(f.displayName, "Noto "+splitCamelCase(base), "Noto "+splitCamelCase(display), 1)
+			}
+			out = append(out, v)
+			exists[v.name] = true
+		}
+	}
+	return out
+}
+
+// reportUnusedDisplayFonts notes the Display fonts of the input if none of the families are based on them, so that they
+// are not dropped without a word.
+func reportUnusedDisplayFonts(families []outputFamily, fontDescriptions map[string]map[string][]*fontDesc) {
+	for _, f := range families {
+		if _, ok := displayFamilies[f.inputFamily]; ok {
+			return
+		}
+	}
+	n := 0
+	for display := range displayFamilies {
+		for _, fonts := range fontDescriptions[display] {
+			n += len(fonts)
+		}
+	}
+	if n > 0 {
+		log.infof("Ignoring the %d SansDisplay and SerifDisplay fonts of the input; -include-display generates packages from them", n)
+	}
+}
+
+// languageSource returns the family that provides the fonts of the languages other than the default: the input family,
+// or Sans or Serif for the Display families.
+func (f outputFamily) languageSource() string {
+	if base, ok := displayFamilies[f.inputFamily]; ok {
+		return base
+	}
+	return f.inputFamily
+}
+
+// insertWeightName adds the weight to a display name, so that "Noto Sans Italic" becomes "Noto Sans Light Italic".
+func insertWeightName(name string, style string, weight string) string {
+	if style != "" {
+		return strings.TrimSuffix(name, " "+style) + " " + weight + " " + style
+	}
+	return name + " " + weight
+}
+
+// withComboFamilies returns copies of the families with their prepended or appended combo families replaced. A nil list
+// leaves the corresponding combo families unchanged.
+func withComboFamilies(available []outputFamily, prepend []string, appended []string) []outputFamily {
+	out := make([]outputFamily, len(available))
+	for i, f := range available {
+		if prepend != nil {
+			f.prependComboFamilies = prepend
+		}
+		if appended != nil {
+			f.appendComboFamilies = appended
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// withLanguagePriority returns copies of the families with their language priority replaced. A nil list leaves it
+// unchanged.
+func withLanguagePriority(available []outputFamily, priority []string) []outputFamily {
+	out := make([]outputFamily, len(available))
+	for i, f := range available {
+		if priority != nil {
+			f.priority = priority
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// withoutComboFamily returns copies of the families that no longer inject the given combo family.
+func withoutComboFamily(available []outputFamily, family string) []outputFamily {
+	remove := func(combo []string) []string {
+		var out []string
+		for _, c := range combo {
+			if c != family {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	out := make([]outputFamily, len(available))
+	for i, f := range available {
+		f.prependComboFamilies = remove(f.prependComboFamilies)
+		f.appendComboFamilies = remove(f.appendComboFamilies)
+		out[i] = f
+	}
+	return out
+}
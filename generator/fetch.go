@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultRepo is the repository whose releases the fetch command downloads by default.
+const defaultRepo = "noto-fonts"
+
+// releaseURLs maps the repositories accepted by -repo to the URL templates of their release archives. The archive of a
+// release tag of the noto-fonts repository contains the hinted and unhinted fonts of that release; upstream releases
+// the CJK and emoji fonts separately.
+var releaseURLs = map[string]string{
+	defaultRepo:  "https://github.com/googlefonts/noto-fonts/archive/refs/tags/{{.Release}}.zip",
+	"noto-cjk":   "https://github.com/googlefonts/noto-cjk/archive/refs/tags/{{.Release}}.zip",
+	"noto-emoji": "https://github.com/googlefonts/noto-emoji/archive/refs/tags/{{.Release}}.zip",
+}
+
+func setupFetch(c *command, fs *flag.FlagSet) func(args []string) error {
+	release := fs.String("release", "", "tag of the release to download, e.g. v20201206-phase3 for noto-fonts or v2.042 for noto-emoji")
+	repo := fs.String("repo", defaultRepo, "repository whose release to download: noto-fonts, noto-cjk, or noto-emoji")
+	urlTemplate := fs.String("url", "",
+		"URL of the release ZIP, a template in which {{.Release}} is the -release value (default the archive of the -repo release)")
+	checksum := fs.String("sha256", "", "expected SHA-256 checksum of the release ZIP in hex; the download fails if it differs")
+	checksum512 := fs.String("sha512", "", "expected SHA-512 checksum of the release ZIP in hex, instead of -sha256")
+	var lf logFlags
+	lf.register(fs)
+	return func(args []string) error {
+		args = envArgs(args, "INPUT")
+		if len(args) != 1 {
+			return usageErrorf(c, fs, "Expected the path of the ZIP file to write")
+		}
+		if err := lf.apply(); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if *urlTemplate == "" {
+			if *urlTemplate = releaseURLs[*repo]; *urlTemplate == "" {
+				return usageErrorf(c, fs, "Invalid -repo value %q", *repo)
+			}
+		}
+		if *release == "" && strings.Contains(*urlTemplate, "{{") {
+			return usageErrorf(c, fs, "Expected -release")
+		}
+		h := hashSHA256
+		if *checksum512 != "" {
+			if *checksum != "" {
+				return usageErrorf(c, fs, "-sha256 and -sha512 cannot be used together")
+			}
+			h, *checksum = hashSHA512, *checksum512
+		}
+		*checksum = strings.ToLower(*checksum)
+		if b, err := hex.DecodeString(*checksum); err != nil || (*checksum != "" && len(b) != h.new().Size()) {
+			return usageErrorf(c, fs, "Invalid -%s value %q: expected %d hexadecimal digits", h.name, *checksum, 2*h.new().Size())
+		}
+		t, err := template.New("url").Option("missingkey=error").Parse(*urlTemplate)
+		if err != nil {
+			return usageErrorf(c, fs, "Invalid -url value: %s", err.Error())
+		}
+		var url strings.Builder
+		if err := t.Execute(&url, struct{ Release string }{*release}); err != nil {
+			return usageErrorf(c, fs, "Invalid -url value: %s", err.Error())
+		}
+		return fetchRelease(url.String(), args[0], h, *checksum)
+	}
+}
+
+// fetchRelease downloads the release ZIP at url to outputPath. If checksum is set, the download fails unless the
+// checksum of the ZIP in the hash algorithm h matches it, and an existing file with that checksum is kept instead of
+// downloading it again. The file is written under a temporary name and renamed once it is complete, so that an
+// interrupted download never leaves a truncated ZIP at outputPath.
+func fetchRelease(url string, outputPath string, h *hashAlgorithm, checksum string) error {
+	if checksum != "" {
+		if sum, err := h.sumFile(outputPath); err == nil && sum == checksum {
+			log.infof("%s already matches the expected checksum", outputPath)
+			return recordSourceURL(outputPath, url)
+		}
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to download release: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download release: %s returned %s", url, resp.Status)
+	}
+	if resp.ContentLength > 0 {
+		log.infof("Downloading %s (%.1f MiB) to %s", url, float64(resp.ContentLength)/(1024*1024), outputPath)
+	} else {
+		log.infof("Downloading %s to %s", url, outputPath)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(outputPath), filepath.Base(outputPath)+".*.part")
+	if err != nil {
+		return fmt.Errorf("failed to create download file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	w := h.new()
+	n, err := io.Copy(io.MultiWriter(tmp, w), resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download release: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write download file: %w", err)
+	}
+	sum := hex.EncodeToString(w.Sum(nil))
+	if checksum == "" {
+		log.warnf("Downloaded %s without verifying it; pass -%s %s to verify future downloads", url, h.name, sum)
+	} else if sum != checksum {
+		return fmt.Errorf("downloaded release has %s checksum %s, expected %s", h.label, sum, checksum)
+	}
+	// Temporary files are only readable by their owner
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write release ZIP: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), outputPath); err != nil {
+		return fmt.Errorf("failed to write release ZIP: %w", err)
+	}
+	log.infof("Downloaded %.1f MiB to %s (%s %s)", float64(n)/(1024*1024), outputPath, h.label, sum)
+	return recordSourceURL(outputPath, url)
+}
+
+// recordSourceURL records the URL from which the archive at archivePath was downloaded next to it, for lockfiles.
+func recordSourceURL(archivePath string, url string) error {
+	if err := ioutil.WriteFile(archivePath+sourceURLSuffix, []byte(url+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record the URL of the release ZIP: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build go1.24
+// +build go1.24
+
+package generator
+
+import "crypto/fips140"
+
+// fipsModuleEnabled reports whether the hash functions come from the Go Cryptographic Module in FIPS 140-3 mode.
+func fipsModuleEnabled() (enabled bool, known bool) {
+	return fips140.Enabled(), true
+}
@@ -0,0 +1,9 @@
+//go:build !go1.24
+// +build !go1.24
+
+package generator
+
+// fipsModuleEnabled cannot tell whether the hash functions are FIPS 140 validated before Go 1.24.
+func fipsModuleEnabled() (enabled bool, known bool) {
+	return false, false
+}
@@ -0,0 +1,411 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/Nik-U/otcmerge"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// fixturePackage is the name of the sub-package generated with -test-fixture, and of its directory within the font
+// module.
+const fixturePackage = "fonttest"
+
+// fixtureSample is the path of the sample collection within the fixture sub-package.
+const fixtureSample = "testdata/sample.otc"
+
+// fixtureText returns the characters of the sample collection: the printable ASCII characters, the samples of
+// compare, and a few emoji, in code point order.
+func fixtureText() []rune {
+	seen := make(map[rune]bool)
+	for r := rune(0x20); r < 0x7f; r++ {
+		seen[r] = true
+	}
+	for _, s := range visualSamples {
+		for _, r := range s.text {
+			seen[r] = true
+		}
+	}
+	for _, r := range "😀👍🎉" {
+		seen[r] = true
+	}
+	text := make([]rune, 0, len(seen))
+	for r := range seen {
+		text = append(text, r)
+	}
+	sort.Slice(text, func(i, j int) bool { return text[i] < text[j] })
+	return text
+}
+
+// generateTestFixture writes the fonttest sub-package of a font package, which embeds a sample of its collection for
+// the tests of programs that use it; see sampleCollection. The sub-package only imports the standard library, and is
+// only compiled into programs that import it, such as test binaries. Stale copies from runs without -test-fixture are
+// removed by removeTestFixture.
+func generateTestFixture(packageName string, description string, otc []byte, sink fileSink, opts *generateOptions) error {
+	sample, text, err := sampleCollection(otc)
+	if err != nil {
+		return fmt.Errorf("failed to build test fixture: %w", err)
+	}
+	if err := sink(path.Join(fixturePackage, fixtureSample), bytes.NewReader(sample)); err != nil {
+		return fmt.Errorf("failed to write test fixture: %w", err)
+	}
+	file := path.Join(fixturePackage, fixturePackage+".go")
+	header, err := goFileHeader(opts, headerData{File: file, Package: fixturePackage, Description: description, Notice: fontNotice(opts.rebrand)})
+	if err != nil {
+		return err
+	}
+	if err := sink.writeString(file, header+`// Package `+fixturePackage+` provides a small sample of the font collection of package `+packageName+`, so that
+// unit tests can load a representative collection without decompressing the full one.
+//
+// The sample has the fonts of the collection in the same order, so that their indexes and the scripts that package
+// `+packageName+` reports for them apply to it. Each character of Text is drawn by the first font of the collection that
+// draws it, and the sample has no other characters. The glyphs have TrueType outlines without hinting, and the fonts
+// have no layout tables, so the sample suits tests of font loading, fallback, and simple text drawing, but not of
+// shaping.
+package `+fixturePackage+`
+
+import _ "embed" // For sample
+
+//go:embed `+fixtureSample+`
+var sample []byte
+
+// Text holds the characters that the sample collection covers.
+const Text = `+strconv.Quote(string(text))+`
+
+// OTC returns the sample collection. The returned slice must not be modified.
+func OTC() []byte {
+	return sample
+}
+`); err != nil {
+		return fmt.Errorf("failed to write test fixture: %w", err)
+	}
+	return nil
+}
+
+// removeTestFixture removes the fonttest sub-package that a previous run with -test-fixture wrote to the package in
+// outputDir. The directories are kept if they contain other files.
+func removeTestFixture(outputDir string) error {
+	dir := filepath.Join(outputDir, fixturePackage)
+	for _, name := range []string{fixturePackage + ".go", filepath.FromSlash(fixtureSample)} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete stale test fixture: %w", err)
+		}
+	}
+	for _, d := range []string{filepath.Join(dir, "testdata"), dir} {
+		if entries, err := os.ReadDir(d); err == nil && len(entries) == 0 {
+			_ = os.Remove(d)
+		}
+	}
+	return nil
+}
+
+// sampleCollection builds the sample collection of a font collection and returns it along with the characters it
+// covers. It has a font for each font of the collection, with the name and OS/2 tables of that font and the glyphs of
+// the characters of fixtureText that the collection draws with it, which is the first font that maps them. Outlines
+// are converted to TrueType outlines, approximating cubic curves by two quadratic curves each, so that fonts with
+// CFF outlines need no CFF table; characters of fonts without outlines, such as color emoji fonts, are left out.
+func sampleCollection(otc []byte) ([]byte, []rune, error) {
+	raw, err := parseFontCollection(otc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) == 0 {
+		// The collection of a package without source fonts is its own sample
+		return otc, nil, nil
+	}
+	collection, err := sfnt.ParseCollection(otc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) != collection.NumFonts() {
+		return nil, nil, fmt.Errorf("found %d fonts, want %d", len(raw), collection.NumFonts())
+	}
+	fonts := make([]*sfnt.Font, len(raw))
+	for i := range fonts {
+		// Fonts that x/image cannot read, such as color emoji fonts without outlines, are sampled without glyphs
+		fonts[i], _ = collection.Font(i)
+	}
+	var buf sfnt.Buffer
+	assigned := make([][]rune, len(fonts))
+	for _, r := range fixtureText() {
+		for i, f := range fonts {
+			if f == nil {
+				continue
+			}
+			if x, err := f.GlyphIndex(&buf, r); err == nil && x != 0 {
+				assigned[i] = append(assigned[i], r)
+				break
+			}
+		}
+	}
+
+	var text []rune
+	inputs := make([]io.ReadSeeker, len(fonts))
+	for i, f := range fonts {
+		data, covered, err := sampleFont(f, raw[i], assigned[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to sample font %d: %w", i, err)
+		}
+		inputs[i] = bytes.NewReader(data)
+		text = append(text, covered...)
+	}
+	sort.Slice(text, func(i, j int) bool { return text[i] < text[j] })
+	out := new(seekBuffer)
+	if err := otcmerge.Merge(inputs, out); err != nil {
+		return nil, nil, err
+	}
+	return out.buf, text, nil
+}
+
+// sampleFont builds a font with the glyphs of the given characters of f and the name and OS/2 tables of raw, which
+// holds the tables of f. It returns the font and the characters it covers. If f is nil, the font has no glyph but
+// .notdef.
+func sampleFont(f *sfnt.Font, raw *sfntFont, text []rune) ([]byte, []rune, error) {
+	head, hhea := raw.tables["head"], raw.tables["hhea"]
+	if len(head) < 54 || len(hhea) < 36 || raw.tables["OS/2"] == nil || raw.tables["name"] == nil {
+		return nil, nil, fmt.Errorf("missing or truncated head, hhea, OS/2, or name table")
+	}
+	var buf sfnt.Buffer
+	glyphs := []*glyphOutline{{}}
+	advances := []int{0}
+	var ppem fixed.Int26_6
+	if f != nil {
+		ppem = fixed.I(int(f.UnitsPerEm()))
+		notdefAdvance, _ := f.GlyphAdvance(&buf, 0, ppem, font.HintingNone)
+		advances[0] = notdefAdvance.Round()
+	}
+	cmap := make(map[rune]uint16)
+	var covered []rune
+	for _, r := range text {
+		x, err := f.GlyphIndex(&buf, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		segments, err := f.LoadGlyph(&buf, x, ppem, nil)
+		if err != nil {
+			// Bitmap glyphs, as of color emoji fonts, have no outline
+			continue
+		}
+		advance, err := f.GlyphAdvance(&buf, x, ppem, font.HintingNone)
+		if err != nil {
+			return nil, nil, err
+		}
+		cmap[r] = uint16(len(glyphs))
+		glyphs = append(glyphs, quadraticOutline(segments))
+		advances = append(advances, advance.Round())
+		covered = append(covered, r)
+	}
+
+	var glyf, loca, hmtx bytes.Buffer
+	w := func(b *bytes.Buffer, v interface{}) { _ = binary.Write(b, binary.BigEndian, v) }
+	var maxPoints, maxContours, maxAdvance int
+	var bounds [4]int // The union of the bounding boxes of the glyphs, for the head table
+	first := true
+	for i, o := range glyphs {
+		w(&loca, uint32(glyf.Len()))
+		glyf.Write(o.encode())
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+		w(&hmtx, [2]int16{int16(advances[i]), int16(o.xMin)})
+		if advances[i] > maxAdvance {
+			maxAdvance = advances[i]
+		}
+		if o.empty() {
+			continue
+		}
+		if len(o.xs) > maxPoints {
+			maxPoints = len(o.xs)
+		}
+		if len(o.contourEnds) > maxContours {
+			maxContours = len(o.contourEnds)
+		}
+		if first {
+			bounds, first = [4]int{o.xMin, o.yMin, o.xMax, o.yMax}, false
+		}
+		bounds[0], bounds[1] = minInt(bounds[0], o.xMin), minInt(bounds[1], o.yMin)
+		bounds[2], bounds[3] = maxInt(bounds[2], o.xMax), maxInt(bounds[3], o.yMax)
+	}
+	w(&loca, uint32(glyf.Len()))
+
+	newHead := append([]byte(nil), head[:54]...)
+	for i, v := range bounds {
+		binary.BigEndian.PutUint16(newHead[36+2*i:], uint16(int16(v)))
+	}
+	binary.BigEndian.PutUint16(newHead[50:], 1) // indexToLocFormat: long offsets
+	binary.BigEndian.PutUint16(newHead[52:], 0)
+	newHhea := append([]byte(nil), hhea[:36]...)
+	binary.BigEndian.PutUint16(newHhea[10:], uint16(maxAdvance))
+	binary.BigEndian.PutUint16(newHhea[34:], uint16(len(glyphs)))
+	var maxp bytes.Buffer
+	w(&maxp, uint32(0x00010000))
+	w(&maxp, [14]uint16{uint16(len(glyphs)), uint16(maxPoints), uint16(maxContours), 0, 0, 2})
+	post := make([]byte, 32)
+	binary.BigEndian.PutUint32(post, 0x00030000)
+	if p := raw.tables["post"]; len(p) >= 16 {
+		// The italic angle, underline, and isFixedPitch are kept, but not the memory usage
+		copy(post[4:16], p[4:16])
+	}
+
+	sample := &sfntFont{version: "\x00\x01\x00\x00", tables: map[string][]byte{
+		"cmap": sampleCMap(cmap),
+		"glyf": glyf.Bytes(),
+		"head": newHead,
+		"hhea": newHhea,
+		"hmtx": hmtx.Bytes(),
+		"loca": loca.Bytes(),
+		"maxp": maxp.Bytes(),
+		"name": raw.tables["name"],
+		"OS/2": raw.tables["OS/2"],
+		"post": post,
+	}}
+	return sample.encode(), covered, nil
+}
+
+// quadraticOutline converts the outline of a glyph, in font units with y growing downwards, to a TrueType glyph. Each
+// cubic curve is split in half, and each half is approximated by the quadratic curve whose control point is the
+// average of those that the two ends of the half suggest.
+func quadraticOutline(segments sfnt.Segments) *glyphOutline {
+	o := &glyphOutline{}
+	type point struct{ x, y float64 }
+	var start, cur point
+	add := func(p point, on bool) {
+		var flag byte
+		if on {
+			flag = onCurvePoint
+		}
+		o.xs = append(o.xs, roundHalfUp(p.x))
+		o.ys = append(o.ys, -roundHalfUp(p.y))
+		o.flags = append(o.flags, flag)
+	}
+	closeContour := func() {
+		n := len(o.xs)
+		contourStart := 0
+		if len(o.contourEnds) > 0 {
+			contourStart = o.contourEnds[len(o.contourEnds)-1] + 1
+		}
+		if n == contourStart {
+			return
+		}
+		// The closing point repeats the first one
+		if n-contourStart > 1 && cur == start && o.flags[n-1]&onCurvePoint != 0 {
+			o.xs, o.ys, o.flags = o.xs[:n-1], o.ys[:n-1], o.flags[:n-1]
+		}
+		o.contourEnds = append(o.contourEnds, len(o.xs)-1)
+	}
+	pt := func(p fixed.Point26_6) point { return point{float64(p.X) / 64, float64(p.Y) / 64} }
+	mid := func(a, b point) point { return point{(a.x + b.x) / 2, (a.y + b.y) / 2} }
+	control := func(p0, p1, p2, p3 point) point {
+		return point{(3*(p1.x+p2.x) - p0.x - p3.x) / 4, (3*(p1.y+p2.y) - p0.y - p3.y) / 4}
+	}
+	for _, s := range segments {
+		switch s.Op {
+		case sfnt.SegmentOpMoveTo:
+			closeContour()
+			start, cur = pt(s.Args[0]), pt(s.Args[0])
+			add(cur, true)
+		case sfnt.SegmentOpLineTo:
+			cur = pt(s.Args[0])
+			add(cur, true)
+		case sfnt.SegmentOpQuadTo:
+			add(pt(s.Args[0]), false)
+			cur = pt(s.Args[1])
+			add(cur, true)
+		case sfnt.SegmentOpCubeTo:
+			p0, p1, p2, p3 := cur, pt(s.Args[0]), pt(s.Args[1]), pt(s.Args[2])
+			m01, m12, m23 := mid(p0, p1), mid(p1, p2), mid(p2, p3)
+			m012, m123 := mid(m01, m12), mid(m12, m23)
+			m := mid(m012, m123)
+			add(control(p0, m01, m012, m), false)
+			add(m, true)
+			add(control(m, m123, m23, p3), false)
+			cur = p3
+			add(cur, true)
+		}
+	}
+	closeContour()
+	if o.empty() {
+		return o
+	}
+	o.xMin, o.yMin, o.xMax, o.yMax = o.xs[0], o.ys[0], o.xs[0], o.ys[0]
+	for i := range o.xs {
+		o.xMin, o.xMax = minInt(o.xMin, o.xs[i]), maxInt(o.xMax, o.xs[i])
+		o.yMin, o.yMax = minInt(o.yMin, o.ys[i]), maxInt(o.yMax, o.ys[i])
+	}
+	return o
+}
+
+// sampleCMap builds a cmap table that maps characters to glyphs: a format 4 subtable for the Basic Multilingual Plane,
+// and a format 12 subtable for all characters if any are beyond it. Each character is a segment of its own, which is
+// compact enough for the few characters of a sample.
+func sampleCMap(glyphs map[rune]uint16) []byte {
+	runes := make([]rune, 0, len(glyphs))
+	var supplementary bool
+	for r := range glyphs {
+		runes = append(runes, r)
+		supplementary = supplementary || r > 0xffff
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	var format4 bytes.Buffer
+	w := func(b *bytes.Buffer, v interface{}) { _ = binary.Write(b, binary.BigEndian, v) }
+	var bmp []rune
+	for _, r := range runes {
+		if r <= 0xfffe {
+			bmp = append(bmp, r)
+		}
+	}
+	segCount := len(bmp) + 1
+	searchRange := 2 << (bits.Len(uint(segCount)) - 1)
+	w(&format4, [7]uint16{4, uint16(16 + 8*segCount), 0, uint16(2 * segCount), uint16(searchRange),
+		uint16(bits.Len(uint(segCount)) - 1), uint16(2*segCount - searchRange)})
+	for _, r := range bmp {
+		w(&format4, uint16(r))
+	}
+	w(&format4, [2]uint16{0xffff, 0}) // The last endCode, and reservedPad
+	for _, r := range bmp {
+		w(&format4, uint16(r))
+	}
+	w(&format4, uint16(0xffff))
+	for _, r := range bmp {
+		w(&format4, glyphs[r]-uint16(r))
+	}
+	w(&format4, uint16(1))
+	w(&format4, make([]uint16, segCount)) // idRangeOffset
+
+	subtables := [][]byte{format4.Bytes()}
+	encodings := []uint16{1}
+	if supplementary {
+		var format12 bytes.Buffer
+		w(&format12, [2]uint16{12, 0})
+		w(&format12, [3]uint32{uint32(16 + 12*len(runes)), 0, uint32(len(runes))})
+		for _, r := range runes {
+			w(&format12, [3]uint32{uint32(r), uint32(r), uint32(glyphs[r])})
+		}
+		subtables = append(subtables, format12.Bytes())
+		encodings = append(encodings, 10)
+	}
+	var cmap bytes.Buffer
+	w(&cmap, [2]uint16{0, uint16(len(subtables))})
+	offset := 4 + 8*len(subtables)
+	for i, s := range subtables {
+		w(&cmap, [2]uint16{3, encodings[i]})
+		w(&cmap, uint32(offset))
+		offset += len(s)
+	}
+	for _, s := range subtables {
+		cmap.Write(s)
+	}
+	return cmap.Bytes()
+}
@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+const (
+	maxFuzzPPEM     = 512    // The largest size at which glyphs are rasterized, in pixels per em
+	maxGlyphEms     = 32     // The largest width or height of a glyph outline, in ems
+	maxGlyphSegment = 100000 // The largest number of outline segments of a glyph
+)
+
+// fuzzGlyphs loads random glyphs of each font of a collection at random sizes with package sfnt and rasterizes them,
+// as applications that use the packages do. It returns an error for the first glyph that panics or fails to load, or
+// whose outline is so large or complex that drawing it would need unbounded memory, so that malformed merge output is
+// caught before it reaches downstream consumers. Color glyphs, which sfnt cannot draw, are skipped.
+func fuzzGlyphs(data []byte, glyphs int, rng *rand.Rand) error {
+	collection, err := sfnt.ParseCollection(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse the font collection: %w", err)
+	}
+	var buf sfnt.Buffer
+	for i := 0; i < collection.NumFonts(); i++ {
+		f, err := collection.Font(i)
+		if err != nil {
+			return fmt.Errorf("failed to parse font %d: %w", i, err)
+		}
+		if f.NumGlyphs() == 0 {
+			continue
+		}
+		for j := 0; j < glyphs; j++ {
+			x := sfnt.GlyphIndex(rng.Intn(f.NumGlyphs()))
+			ppem := 1 + rng.Intn(maxFuzzPPEM)
+			if err := rasterizeGlyph(f, &buf, x, ppem); err != nil {
+				return fmt.Errorf("font %d, glyph %d at %d ppem: %w", i, x, ppem, err)
+			}
+		}
+	}
+	return nil
+}
+
+// rasterizeGlyph loads a glyph at the given size and draws it into an image of its bounds.
+func rasterizeGlyph(f *sfnt.Font, buf *sfnt.Buffer, x sfnt.GlyphIndex, ppem int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	segments, err := f.LoadGlyph(buf, x, fixed.I(ppem), nil)
+	if errors.Is(err, sfnt.ErrColoredGlyph) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(segments) > maxGlyphSegment {
+		return fmt.Errorf("outline has %d segments", len(segments))
+	}
+	bounds := segments.Bounds()
+	width, height := (bounds.Max.X - bounds.Min.X).Ceil(), (bounds.Max.Y - bounds.Min.Y).Ceil()
+	if width > maxGlyphEms*ppem || height > maxGlyphEms*ppem {
+		return fmt.Errorf("outline extends %dx%d pixels", width, height)
+	}
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	point := func(p fixed.Point26_6) (float32, float32) {
+		return float32(p.X-bounds.Min.X) / 64, float32(p.Y-bounds.Min.Y) / 64
+	}
+	r := vector.NewRasterizer(width, height)
+	r.DrawOp = draw.Src
+	for _, s := range segments {
+		switch s.Op {
+		case sfnt.SegmentOpMoveTo:
+			r.MoveTo(point(s.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			r.LineTo(point(s.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			x1, y1 := point(s.Args[0])
+			x2, y2 := point(s.Args[1])
+			r.QuadTo(x1, y1, x2, y2)
+		case sfnt.SegmentOpCubeTo:
+			x1, y1 := point(s.Args[0])
+			x2, y2 := point(s.Args[1])
+			x3, y3 := point(s.Args[2])
+			r.CubeTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	dst := image.NewAlpha(image.Rect(0, 0, width, height))
+	r.Draw(dst, dst.Bounds(), image.Opaque, image.Point{})
+	return nil
+}
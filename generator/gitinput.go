@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitScheme starts the inputs that read the fonts of a commit, tag, or branch of a GitHub repository, such as
+// "git:noto-fonts@main" or "git:someone/noto-fonts@4f2c1e9", so that fixes can be built before they are released. The
+// repository is a -repo of the fetch command, which is taken from the googlefonts organization, or OWNER/NAME.
+const gitScheme = "git:"
+
+// defaultGitHubURL is the URL of the site from which the archives of git inputs are downloaded.
+const defaultGitHubURL = "https://github.com"
+
+// gitHubURLEnv replaces defaultGitHubURL, such as with a mirror.
+var gitHubURLEnv = envPrefix + "GITHUB_URL"
+
+// gitArchiveFile is the name of the archive of a git input in its download directory.
+const gitArchiveFile = "archive.zip"
+
+// gitArchiveURL returns the URL of the ZIP archive of the commit that a git input names.
+func gitArchiveURL(sourcePath string) (string, error) {
+	spec := strings.TrimPrefix(sourcePath, gitScheme)
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 || i == len(spec)-1 {
+		return "", fmt.Errorf("invalid input %q: expected %sREPO@REF, such as %snoto-fonts@main", sourcePath, gitScheme, gitScheme)
+	}
+	repo, ref := spec[:i], spec[i+1:]
+	if !strings.Contains(repo, "/") {
+		if releaseURLs[repo] == "" {
+			return "", fmt.Errorf("invalid input %q: unknown repository %q (expected noto-fonts, noto-cjk, noto-emoji, or OWNER/NAME)",
+				sourcePath, repo)
+		}
+		repo = "googlefonts/" + repo
+	}
+	elems := strings.Split(repo, "/")
+	if len(elems) != 2 || elems[0] == "" || elems[1] == "" || elems[0] == ".." || elems[1] == ".." {
+		return "", fmt.Errorf("invalid input %q: expected the repository as OWNER/NAME", sourcePath)
+	}
+	// Branch names may contain slashes, which the archive URLs of GitHub keep
+	var escaped []string
+	for _, elem := range strings.Split(ref, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return "", fmt.Errorf("invalid input %q: invalid ref %q", sourcePath, ref)
+		}
+		escaped = append(escaped, url.PathEscape(elem))
+	}
+	base := defaultGitHubURL
+	if v := os.Getenv(gitHubURLEnv); v != "" {
+		base = strings.TrimSuffix(v, "/")
+	}
+	return base + "/" + url.PathEscape(elems[0]) + "/" + url.PathEscape(elems[1]) + "/archive/" + strings.Join(escaped, "/") + ".zip", nil
+}
+
+// downloadGitArchive downloads the archive of a git input into a temporary directory and returns the path of the ZIP
+// file, which is then read like a release ZIP. Each input is only downloaded once per run, and the directories are
+// removed by removeExtractedTarballs.
+func downloadGitArchive(sourcePath string) (string, error) {
+	extractedTarballs.Lock()
+	defer extractedTarballs.Unlock()
+	if dir, ok := extractedTarballs.dirs[sourcePath]; ok {
+		return filepath.Join(dir, gitArchiveFile), nil
+	}
+	archiveURL, err := gitArchiveURL(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir("", "gonoto-git-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create download directory: %w", err)
+	}
+	log.infof("Downloading %s", archiveURL)
+	file := filepath.Join(dir, gitArchiveFile)
+	if err := downloadFile(archiveURL, file); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to download the input %s: %w", sourcePath, err)
+	}
+	if fi, err := os.Stat(file); err == nil {
+		log.infof("Downloaded a %.1f MiB archive of %s", float64(fi.Size())/(1024*1024), strings.TrimPrefix(sourcePath, gitScheme))
+	}
+	extractedTarballs.dirs[sourcePath] = dir
+	return file, nil
+}
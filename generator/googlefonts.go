@@ -0,0 +1,196 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// googleFontsScheme starts the inputs that download Noto fonts through the Google Fonts Developer API, such as
+// "googlefonts:" for every Noto family or "googlefonts:Noto Sans Adlam,Noto Sans Osage" for some of them. Families
+// are published on Google Fonts before they appear in a release archive, so such an input can add them to a release.
+const googleFontsScheme = "googlefonts:"
+
+// defaultGoogleFontsAPI is the URL of the family list of the Google Fonts Developer API.
+const defaultGoogleFontsAPI = "https://www.googleapis.com/webfonts/v1/webfonts"
+
+// The environment variables that configure Google Fonts inputs. The API requires a key.
+var (
+	googleFontsKeyEnv = envPrefix + "GOOGLE_FONTS_KEY"
+	googleFontsAPIEnv = envPrefix + "GOOGLE_FONTS_API"
+)
+
+// googleFontsWeights maps the numeric weights of Google Fonts variants to the weight terms of Noto file names.
+var googleFontsWeights = map[string]string{
+	"100": "Thin", "200": "ExtraLight", "300": "Light", "400": "Regular", "500": "Medium",
+	"600": "SemiBold", "700": "Bold", "800": "ExtraBold", "900": "Black",
+}
+
+// googleFontsFamily is a family in the response of the Google Fonts Developer API.
+type googleFontsFamily struct {
+	Family  string            `json:"family"`  // The family name, such as "Noto Sans Adlam"
+	Version string            `json:"version"` // The version of the family on Google Fonts, such as "v14"
+	Files   map[string]string `json:"files"`   // The font file URL of each variant, such as "regular" or "700italic"
+}
+
+// googleFontsFilename returns the Noto file name of a variant of a Google Fonts family, such as
+// "NotoSansAdlam-BoldItalic.ttf" for variant "700italic" of "Noto Sans Adlam", so that the downloaded fonts are
+// recognized like those of a release archive. It reports false for families and variants without a Noto file name,
+// such as Noto Color Emoji.
+func googleFontsFilename(family string, variant string, fileURL string) (string, bool) {
+	if !strings.HasPrefix(family, "Noto ") {
+		return "", false
+	}
+	var style string
+	if strings.HasSuffix(variant, "italic") {
+		style, variant = "Italic", strings.TrimSuffix(variant, "italic")
+	}
+	if variant == "" || variant == "regular" {
+		variant = "400"
+	}
+	weight, ok := googleFontsWeights[variant]
+	if !ok {
+		return "", false
+	}
+	styling := weight + style
+	if weight == "Regular" && style != "" {
+		styling = style
+	}
+	ext := ".ttf"
+	if u, err := url.Parse(fileURL); err == nil && path.Ext(u.Path) == ".otf" {
+		ext = ".otf"
+	}
+	name := strings.ReplaceAll(family, " ", "") + "-" + styling + ext
+	if _, ok := noto.ParseFilename(name); !ok {
+		return "", false
+	}
+	return name, true
+}
+
+// downloadGoogleFonts downloads the fonts of the Noto families of a Google Fonts input into a temporary directory
+// under their Noto file names and returns it, so that it is read like any other directory input. Each input is only
+// downloaded once per run, and the directories are removed by removeExtractedTarballs.
+func downloadGoogleFonts(sourcePath string) (string, error) {
+	extractedTarballs.Lock()
+	defer extractedTarballs.Unlock()
+	if dir, ok := extractedTarballs.dirs[sourcePath]; ok {
+		return dir, nil
+	}
+	key := os.Getenv(googleFontsKeyEnv)
+	if key == "" {
+		return "", fmt.Errorf("Google Fonts inputs require an API key in %s", googleFontsKeyEnv)
+	}
+	api := defaultGoogleFontsAPI
+	if v := os.Getenv(googleFontsAPIEnv); v != "" {
+		api = v
+	}
+	wanted := make(map[string]bool)
+	for _, f := range strings.Split(strings.TrimPrefix(sourcePath, googleFontsScheme), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			wanted[f] = true
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, api, nil)
+	if err != nil {
+		return "", err
+	}
+	// The key is sent in a header rather than the URL so that it does not appear in error messages
+	req.Header.Set("X-Goog-Api-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to list Google Fonts families: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to list Google Fonts families: %s returned %s", api, resp.Status)
+	}
+	var list struct {
+		Items []googleFontsFamily `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", fmt.Errorf("failed to parse the Google Fonts family list: %w", err)
+	}
+
+	dir, err := ioutil.TempDir("", "gonoto-googlefonts-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create download directory: %w", err)
+	}
+	files, families := 0, 0
+	for _, family := range list.Items {
+		if len(wanted) > 0 && !wanted[family.Family] {
+			continue
+		}
+		delete(wanted, family.Family)
+		var variants []string
+		for v := range family.Files {
+			variants = append(variants, v)
+		}
+		sort.Strings(variants)
+		downloaded := 0
+		for _, v := range variants {
+			name, ok := googleFontsFilename(family.Family, v, family.Files[v])
+			if !ok {
+				continue
+			}
+			if err := downloadFile(family.Files[v], filepath.Join(dir, name)); err != nil {
+				_ = os.RemoveAll(dir)
+				return "", fmt.Errorf("failed to download %s %s: %w", family.Family, v, err)
+			}
+			downloaded++
+		}
+		if downloaded > 0 {
+			log.debugf("Downloaded %d fonts of %s %s from Google Fonts", downloaded, family.Family, family.Version)
+			files += downloaded
+			families++
+		}
+	}
+	if len(wanted) > 0 {
+		_ = os.RemoveAll(dir)
+		var missing []string
+		for f := range wanted {
+			missing = append(missing, f)
+		}
+		sort.Strings(missing)
+		return "", fmt.Errorf("Google Fonts has no families named %s", strings.Join(missing, ", "))
+	}
+	if files == 0 {
+		_ = os.RemoveAll(dir)
+		return "", errors.New("Google Fonts has no Noto fonts for the input " + sourcePath)
+	}
+	log.infof("Downloaded %d fonts of %d Noto families from Google Fonts", files, families)
+	extractedTarballs.dirs[sourcePath] = dir
+	return dir, nil
+}
+
+// downloadFile downloads fileURL to the file at dest.
+func downloadFile(fileURL string, dest string) error {
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", fileURL, resp.Status)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultGoVersion returns the oldest Go version that can build the packages generated with opts: embedGoVersion if
+// their chunks or test fixtures use go:embed, and minGoVersion otherwise. Unlike the version of the toolchain that
+// built gonoto, it keeps the output independent of the builder and does not require newer toolchains of the users of
+// the packages.
+func defaultGoVersion(opts *generateOptions) string {
+	if opts.chunkEncoding == chunkEncodingEmbed || opts.testFixture {
+		return embedGoVersion
+	}
+	return minGoVersion
+}
+
+// goMinorVersion returns the minor version of a Go 1.x version string such as "1.16", "1.21.3", or "1.22rc1".
+func goMinorVersion(v string) (int, bool) {
+	if !strings.HasPrefix(v, "1.") {
+		return 0, false
+	}
+	v = v[2:]
+	end := 0
+	for end < len(v) && v[end] >= '0' && v[end] <= '9' {
+		end++
+	}
+	minor, err := strconv.Atoi(v[:end])
+	if err != nil {
+		return 0, false
+	}
+	return minor, true
+}
+
+// validateGoVersion returns an error if v cannot be used in the go directive of a generated go.mod file.
+func validateGoVersion(v string) error {
+	minor, ok := goMinorVersion(v)
+	if !ok {
+		return fmt.Errorf("expected a version such as %s", minGoVersion)
+	}
+	if rest := strings.TrimPrefix(v, "1."+strconv.Itoa(minor)); rest != "" {
+		if patch, err := strconv.Atoi(strings.TrimPrefix(rest, ".")); err != nil || patch < 0 || rest[0] != '.' {
+			return fmt.Errorf("expected a version such as %s", minGoVersion)
+		}
+	}
+	if min, _ := goMinorVersion(minGoVersion); minor < min {
+		return fmt.Errorf("the generated packages require Go %s or later", minGoVersion)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// shapedGlyph is a glyph produced by a shaping engine.
+type shapedGlyph struct {
+	id      uint32 // The glyph index; 0 is .notdef
+	cluster uint32 // The index of the first character of the cluster that produced the glyph
+}
+
+// shaper shapes text with the fonts of a collection.
+type shaper interface {
+	shape(font int, text []rune) []shapedGlyph
+	close()
+}
+
+// newHarfBuzzShaper loads a font collection into HarfBuzz. It is nil unless gonoto is built with -tags harfbuzz; see
+// harfbuzz_cgo.go.
+var newHarfBuzzShaper func(data []byte) (shaper, error)
+
+// checkHarfBuzz shapes the clusters of shapingChecks with HarfBuzz, using the member of the merged collection that
+// provides their first character, as applications do. The shaping check only proves that the layout features exist;
+// this proves that a real shaping engine uses them. A cluster fails if HarfBuzz produces .notdef glyphs, splits it
+// into several clusters, or produces the same glyphs as for its characters shaped one at a time, which means that no
+// substitution or composition took place. Clusters that no member covers are skipped.
+func checkHarfBuzz(data []byte) ([]string, error) {
+	if newHarfBuzzShaper == nil {
+		return nil, errors.New("gonoto was built without HarfBuzz support; rebuild it with -tags harfbuzz")
+	}
+	members, err := parseFontCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the font collection: %w", err)
+	}
+	s, err := newHarfBuzzShaper(data)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	var problems []string
+	for _, check := range shapingChecks {
+		font := -1
+		for i, m := range members {
+			if m.hasRune(check.text[0]) {
+				font = i
+				break
+			}
+		}
+		if font < 0 {
+			continue
+		}
+		glyphs := s.shape(font, check.text)
+		var separate []shapedGlyph
+		for _, r := range check.text {
+			separate = append(separate, s.shape(font, []rune{r})...)
+		}
+		if problem := harfBuzzProblem(glyphs, separate); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s (font %d): %s", check.name, font, problem))
+		}
+	}
+	return problems, nil
+}
+
+// harfBuzzProblem compares the glyphs of a shaped cluster with the glyphs of its characters shaped separately, and
+// describes why the cluster was not shaped as expected, or returns the empty string.
+func harfBuzzProblem(glyphs []shapedGlyph, separate []shapedGlyph) string {
+	if len(glyphs) == 0 {
+		return "no glyphs"
+	}
+	for _, g := range glyphs {
+		if g.id == 0 {
+			return "contains .notdef glyphs"
+		}
+		if g.cluster != glyphs[0].cluster {
+			return "shaped into several clusters"
+		}
+	}
+	if len(glyphs) != len(separate) {
+		return ""
+	}
+	for i := range glyphs {
+		if glyphs[i].id != separate[i].id {
+			return ""
+		}
+	}
+	return "no substitution took place"
+}
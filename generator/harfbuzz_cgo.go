@@ -0,0 +1,79 @@
+//go:build harfbuzz
+// +build harfbuzz
+
+package generator
+
+// #cgo pkg-config: harfbuzz
+// #include <stdlib.h>
+// #include <hb.h>
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+func init() {
+	newHarfBuzzShaper = newHarfBuzz
+}
+
+// harfBuzz is a font collection loaded into HarfBuzz. The font data is copied to C memory, which HarfBuzz reads
+// without copying it again.
+type harfBuzz struct {
+	data  unsafe.Pointer
+	blob  *C.hb_blob_t
+	fonts map[int]*C.hb_font_t
+}
+
+func newHarfBuzz(data []byte) (shaper, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty font collection")
+	}
+	h := &harfBuzz{data: C.CBytes(data), fonts: make(map[int]*C.hb_font_t)}
+	h.blob = C.hb_blob_create((*C.char)(h.data), C.uint(len(data)), C.HB_MEMORY_MODE_READONLY, nil, nil)
+	return h, nil
+}
+
+func (h *harfBuzz) font(index int) *C.hb_font_t {
+	if f, ok := h.fonts[index]; ok {
+		return f
+	}
+	face := C.hb_face_create(h.blob, C.uint(index))
+	f := C.hb_font_create(face)
+	C.hb_face_destroy(face)
+	h.fonts[index] = f
+	return f
+}
+
+func (h *harfBuzz) shape(font int, text []rune) []shapedGlyph {
+	if len(text) == 0 {
+		return nil
+	}
+	buf := C.hb_buffer_create()
+	defer C.hb_buffer_destroy(buf)
+	codepoints := make([]C.uint32_t, len(text))
+	for i, r := range text {
+		codepoints[i] = C.uint32_t(r)
+	}
+	C.hb_buffer_add_utf32(buf, &codepoints[0], C.int(len(text)), 0, C.int(len(text)))
+	C.hb_buffer_guess_segment_properties(buf)
+	C.hb_shape(h.font(font), buf, nil, 0)
+	var n C.uint
+	infos := C.hb_buffer_get_glyph_infos(buf, &n)
+	if n == 0 {
+		return nil
+	}
+	out := make([]shapedGlyph, n)
+	for i, info := range (*[1 << 28]C.hb_glyph_info_t)(unsafe.Pointer(infos))[:n:n] {
+		out[i] = shapedGlyph{id: uint32(info.codepoint), cluster: uint32(info.cluster)}
+	}
+	return out
+}
+
+func (h *harfBuzz) close() {
+	for _, f := range h.fonts {
+		C.hb_font_destroy(f)
+	}
+	C.hb_blob_destroy(h.blob)
+	C.free(h.data)
+}
@@ -0,0 +1,101 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// hashAlgorithm is a hash function that checksums are recorded with: in manifests, lockfiles, and the -json summary,
+// and for the change detection of -changed-only. Both algorithms are approved by FIPS 140.
+type hashAlgorithm struct {
+	name  string // As in -hash, manifests, and lockfiles, e.g. "sha256"
+	label string // As in messages, e.g. "SHA-256"
+	new   func() hash.Hash
+}
+
+var (
+	hashSHA256 = &hashAlgorithm{"sha256", "SHA-256", sha256.New}
+	hashSHA512 = &hashAlgorithm{"sha512", "SHA-512", sha512.New}
+
+	hashAlgorithms = []*hashAlgorithm{hashSHA256, hashSHA512}
+)
+
+// findHash returns the hash algorithm with the given name. The empty name, as in manifests and lockfiles written by
+// older versions, denotes SHA-256.
+func findHash(name string) (*hashAlgorithm, error) {
+	if name == "" {
+		return hashSHA256, nil
+	}
+	var names []string
+	for _, h := range hashAlgorithms {
+		if h.name == name {
+			return h, nil
+		}
+		names = append(names, h.name)
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// sum returns the hex-encoded checksum of data.
+func (h *hashAlgorithm) sum(data []byte) string {
+	w := h.new()
+	_, _ = w.Write(data)
+	return hex.EncodeToString(w.Sum(nil))
+}
+
+// sumFile returns the hex-encoded checksum of the file at path.
+func (h *hashAlgorithm) sumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	w := h.new()
+	if _, err := io.Copy(w, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(w.Sum(nil)), nil
+}
+
+// checksums holds the checksum of a file in manifests and lockfiles, under the name of the algorithm of the run, so
+// that the sha256 fields of older files keep their meaning.
+type checksums struct {
+	SHA256 string `json:"sha256,omitempty"` // The hex-encoded SHA-256 of the file
+	SHA512 string `json:"sha512,omitempty"` // The hex-encoded SHA-512 of the file
+}
+
+// get returns the checksum in the given algorithm, or "" if it was not recorded.
+func (c checksums) get(h *hashAlgorithm) string {
+	if h == hashSHA512 {
+		return c.SHA512
+	}
+	return c.SHA256
+}
+
+// set records the checksum in the given algorithm.
+func (c *checksums) set(h *hashAlgorithm, sum string) {
+	if h == hashSHA512 {
+		c.SHA512 = sum
+	} else {
+		c.SHA256 = sum
+	}
+}
+
+// checkFIPS returns an error for -fips if the hash functions do not come from a FIPS 140 validated module. Whether they
+// do is only known with Go 1.24 and later, so with older versions it only warns.
+func checkFIPS() error {
+	enabled, known := fipsModuleEnabled()
+	switch {
+	case !known:
+		log.warnf("Cannot tell whether this build of gonoto uses a FIPS 140 validated cryptographic module; build it with Go 1.24 or later and run it with GODEBUG=fips140=on")
+	case !enabled:
+		return fmt.Errorf("-fips requires the Go Cryptographic Module in FIPS 140-3 mode; run gonoto with GODEBUG=fips140=on")
+	}
+	return nil
+}
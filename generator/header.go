@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// headerData is the data available to the header template set with -header.
+type headerData struct {
+	File        string   // The name of the generated file, e.g. "otc.go" or "chunk0.go"
+	Package     string   // The Go package name
+	Description string   // The package description
+	Notice      []string // The trademark and license notice of the fonts; see fontNotice
+	Year        int      // The copyright year of the generated code; see -copyright-year
+	Holder      string   // The copyright holder of the generated code; see -copyright-holder
+	Generator   string   // The build of gonoto that generated the file, e.g. "gonoto v1.4.0"; see generatorInfo
+}
+
+// defaultCopyrightHolder is the default copyright holder of the generated code.
+const defaultCopyrightHolder = "Go Noto Authors"
+
+// apacheHeader is the header of otc.go, formatted with the copyright year and holder.
+const apacheHeader = `// Copyright %d %s
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+`
+
+// registerCopyrightFlags registers the flags that set the copyright of the generated code.
+func registerCopyrightFlags(fs *flag.FlagSet, opts *generateOptions) {
+	fs.IntVar(&opts.copyrightYear, "copyright-year", time.Now().Year(),
+		"copyright year of the generated code in the otc.go header and README (default the current year)")
+	fs.StringVar(&opts.copyrightHolder, "copyright-holder", defaultCopyrightHolder,
+		"copyright holder of the generated code in the otc.go header and README")
+}
+
+// validateCopyright returns an error if the copyright flags cannot be used in the generated files.
+func validateCopyright(opts *generateOptions) error {
+	if opts.copyrightYear < 1000 || opts.copyrightYear > 9999 {
+		return fmt.Errorf("invalid -copyright-year value %d", opts.copyrightYear)
+	}
+	if h := strings.TrimSpace(opts.copyrightHolder); h == "" || strings.ContainsAny(h, "\r\n") {
+		return fmt.Errorf("invalid -copyright-holder value %q: expected a single non-empty line", opts.copyrightHolder)
+	}
+	return nil
+}
+
+// goFileHeader returns the comment placed at the top of a generated Go file, followed by a blank line, or the empty
+// string if the file has no header. A custom template produces plain text, which is turned into line comments. Of the
+// default headers, only those of otc.go and sources.go name the build of gonoto, which manifest.json records in full,
+// so that the many chunk files do not all change with each new build.
+func goFileHeader(opts *generateOptions, data headerData) (string, error) {
+	data.Year, data.Holder, data.Generator = opts.copyrightYear, opts.copyrightHolder, generator.String()
+	if opts.headerTemplate == nil {
+		stamp := "//\n// Generated by " + data.Generator + ".\n"
+		switch data.File {
+		case "otc.go":
+			return fmt.Sprintf(apacheHeader, data.Year, data.Holder) + commentLines(data.Notice) + stamp + "\n", nil
+		case "sources.go":
+			return commentLines(data.Notice) + stamp + "\n", nil
+		case "chunk.go":
+			return "", nil
+		default:
+			return commentLines(data.Notice) + "\n", nil
+		}
+	}
+	var b strings.Builder
+	if err := opts.headerTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to apply header template to %s: %w", data.File, err)
+	}
+	text := strings.TrimRight(b.String(), "\n")
+	if text == "" {
+		return "", nil
+	}
+	var out strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimRight(line, " \t"); line == "" {
+			out.WriteString("//\n")
+		} else {
+			out.WriteString("// " + line + "\n")
+		}
+	}
+	return out.String() + "\n", nil
+}
+
+func loadHeaderTemplate(path string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid header template: %w", err)
+	}
+	// Catch references to unknown fields before any fonts are merged
+	if err := tmpl.Execute(ioutil.Discard, headerData{File: "otc.go", Package: "example", Notice: fontNotice(""),
+		Year: 2020, Holder: defaultCopyrightHolder, Generator: "gonoto v1.0.0"}); err != nil {
+		return nil, fmt.Errorf("invalid header template: %w", err)
+	}
+	return tmpl, nil
+}
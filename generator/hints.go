@@ -0,0 +1,199 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// hintingTables are the TrueType tables that only serve the hinting interpreter or cache its results. Renderers that
+// do not hint, such as those typically used on high-density mobile screens, do not need them.
+var hintingTables = []string{"fpgm", "prep", "cvt ", "hdmx", "VDMX", "LTSH"}
+
+// stripHints removes the hinting tables and the glyph instructions from TrueType source fonts. CFF-based fonts are
+// returned unchanged, since their hints are part of the charstrings. Fonts without hinting are also returned unchanged,
+// so that unhinted sources are not considered modified. The number of fonts that were changed is returned as well.
+func stripHints(inputs [][]byte) ([][]byte, int, error) {
+	out := make([][]byte, len(inputs))
+	stripped := 0
+	for i, data := range inputs {
+		out[i] = data
+		fonts, err := parseFontCollection(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(fonts) != 1 {
+			return nil, 0, fmt.Errorf("source font %d is a collection", i)
+		}
+		f := fonts[0]
+		if f.version == "OTTO" {
+			continue
+		}
+		changed := false
+		for _, tag := range hintingTables {
+			if f.table(tag) != nil {
+				delete(f.tables, tag)
+				changed = true
+			}
+		}
+		glyfChanged, err := stripGlyphInstructions(f)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to strip instructions from font %d: %w", i, err)
+		}
+		if changed || glyfChanged {
+			out[i] = f.encode()
+			stripped++
+		}
+	}
+	return out, stripped, nil
+}
+
+// stripGlyphInstructions rewrites the glyf and loca tables without glyph instructions and clears the instruction
+// limits in the maxp table. The loca table is always rewritten in the long format. It reports whether any glyph had
+// instructions; if not, the font is left untouched.
+func stripGlyphInstructions(f *sfntFont) (bool, error) {
+	head, maxp, loca, glyf := f.table("head"), f.table("maxp"), f.table("loca"), f.table("glyf")
+	if glyf == nil || loca == nil {
+		return false, nil
+	}
+	if len(head) < 54 || len(maxp) < 6 {
+		return false, errors.New("head or maxp table is truncated")
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	longOffsets := binary.BigEndian.Uint16(head[50:]) != 0
+	offset := func(i int) int {
+		if longOffsets {
+			return int(binary.BigEndian.Uint32(loca[4*i:]))
+		}
+		return 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+	}
+	if (longOffsets && len(loca) < 4*(numGlyphs+1)) || (!longOffsets && len(loca) < 2*(numGlyphs+1)) {
+		return false, errors.New("loca table is truncated")
+	}
+
+	var newGlyf bytes.Buffer
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	changed := false
+	for i := 0; i < numGlyphs; i++ {
+		start, end := offset(i), offset(i+1)
+		if start > end || end > len(glyf) {
+			return false, fmt.Errorf("glyph %d is out of bounds", i)
+		}
+		glyph, stripped, err := stripInstructions(glyf[start:end])
+		if err != nil {
+			return false, fmt.Errorf("glyph %d: %w", i, err)
+		}
+		changed = changed || stripped
+		binary.BigEndian.PutUint32(newLoca[4*i:], uint32(newGlyf.Len()))
+		newGlyf.Write(glyph)
+		newGlyf.Write(make([]byte, (4-len(glyph)%4)%4))
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(newGlyf.Len()))
+	if !changed {
+		return false, nil
+	}
+
+	f.tables["glyf"] = newGlyf.Bytes()
+	f.tables["loca"] = newLoca
+	head = append([]byte(nil), head...)
+	binary.BigEndian.PutUint16(head[50:], 1)
+	f.tables["head"] = head
+	if len(maxp) >= 32 {
+		// Version 1.0 of maxp records the instruction limits: maxFunctionDefs, maxInstructionDefs, and
+		// maxSizeOfInstructions are no longer used.
+		maxp = append([]byte(nil), maxp...)
+		binary.BigEndian.PutUint16(maxp[20:], 0)
+		binary.BigEndian.PutUint16(maxp[22:], 0)
+		binary.BigEndian.PutUint16(maxp[26:], 0)
+		f.tables["maxp"] = maxp
+	}
+	return true, nil
+}
+
+// Flags of composite glyph components.
+const (
+	argsAreWords     = 0x0001
+	argsAreXYValues  = 0x0002
+	haveScale        = 0x0008
+	moreComponents   = 0x0020
+	haveXYScale      = 0x0040
+	haveTwoByTwo     = 0x0080
+	haveInstructions = 0x0100
+)
+
+// stripInstructions returns the glyph description without its instructions and reports whether it had any.
+func stripInstructions(glyph []byte) ([]byte, bool, error) {
+	if len(glyph) == 0 {
+		return glyph, false, nil
+	}
+	if len(glyph) < 10 {
+		return nil, false, errors.New("glyph header is truncated")
+	}
+	numContours := int(int16(binary.BigEndian.Uint16(glyph)))
+	if numContours >= 0 {
+		pos := 10 + 2*numContours
+		if len(glyph) < pos+2 {
+			return nil, false, errors.New("simple glyph is truncated")
+		}
+		length := int(binary.BigEndian.Uint16(glyph[pos:]))
+		if length == 0 {
+			return glyph, false, nil
+		}
+		if len(glyph) < pos+2+length {
+			return nil, false, errors.New("glyph instructions are truncated")
+		}
+		out := make([]byte, 0, len(glyph)-length)
+		out = append(out, glyph[:pos]...)
+		out = append(out, 0, 0)
+		return append(out, glyph[pos+2+length:]...), true, nil
+	}
+
+	pos := 10
+	var flags uint16
+	lastFlags := -1
+	for {
+		if len(glyph) < pos+4 {
+			return nil, false, errors.New("composite glyph is truncated")
+		}
+		flags = binary.BigEndian.Uint16(glyph[pos:])
+		lastFlags = pos
+		pos += 4
+		if flags&argsAreWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			pos += 2
+		case flags&haveXYScale != 0:
+			pos += 4
+		case flags&haveTwoByTwo != 0:
+			pos += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	if len(glyph) < pos {
+		return nil, false, errors.New("composite glyph is truncated")
+	}
+	if flags&haveInstructions == 0 {
+		return glyph, false, nil
+	}
+	out := append([]byte(nil), glyph[:pos]...)
+	binary.BigEndian.PutUint16(out[lastFlags:], flags&^haveInstructions)
+	return out, true, nil
+}
+
+// isHinted reports whether a TrueType font contains a hinting program. CFF-based fonts are always considered hinted,
+// since their hints cannot be detected without parsing the charstrings.
+func isHinted(data []byte) bool {
+	fonts, err := parseFontCollection(data)
+	if err != nil || len(fonts) != 1 {
+		return false
+	}
+	f := fonts[0]
+	return f.version == "OTTO" || f.table("fpgm") != nil || f.table("prep") != nil
+}
@@ -0,0 +1,421 @@
+package generator
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// stdinInput is the input path that reads the input archive from standard input, so that a release can be piped into
+// gonoto, as in "curl ... | gonoto generate - out/".
+const stdinInput = "-"
+
+// stdin holds the input archive read from standard input, which can only be read once per run.
+var stdin struct {
+	once sync.Once
+	dir  string // The directory into which the fonts of a tarball were extracted
+	zip  []byte // The contents of a ZIP file
+	err  error
+}
+
+// readStdin reads the input archive from standard input. The fonts of tarballs are extracted while they are read, as
+// for tarball files; see extractTarball. ZIP files cannot be read in order, since their directory is at the end, so
+// they are held in memory rather than written to disk first.
+func readStdin() (dir string, zipData []byte, err error) {
+	stdin.once.Do(func() {
+		r := bufio.NewReaderSize(os.Stdin, 512)
+		head, err := r.Peek(512)
+		if err != nil && err != io.EOF {
+			stdin.err = fmt.Errorf("failed to read Noto input from standard input: %w", err)
+			return
+		}
+		format, err := archiveFormat(head, "standard input")
+		if err != nil {
+			stdin.err = err
+			return
+		}
+		if format == archiveZip {
+			if stdin.zip, err = ioutil.ReadAll(r); err != nil {
+				stdin.err = fmt.Errorf("failed to read Noto input from standard input: %w", err)
+				return
+			}
+			log.infof("Read a %.1f MiB ZIP file from standard input", float64(len(stdin.zip))/(1024*1024))
+			return
+		}
+		if stdin.dir, stdin.err = extractTarStream(r, "standard input", format); stdin.err == nil {
+			extractedTarballs.Lock()
+			extractedTarballs.dirs[stdinInput] = stdin.dir
+			extractedTarballs.Unlock()
+		}
+	})
+	return stdin.dir, stdin.zip, stdin.err
+}
+
+// inputDir returns the directory of fonts for inputs that are not ZIP files: the input itself if it is a directory tree
+// of fonts, such as an extracted release or a checkout of the noto-fonts repository, the directory into which the
+// fonts of a tarball are extracted (see extractTarball), or the directory into which the fonts of a Google Fonts input
+// are downloaded (see downloadGoogleFonts). The archive of a git input is downloaded, but read as a ZIP file; see
+// downloadGitArchive.
+func inputDir(sourcePath string) (string, bool, error) {
+	if sourcePath == stdinInput {
+		dir, _, err := readStdin()
+		return dir, dir != "", err
+	}
+	if strings.HasPrefix(sourcePath, googleFontsScheme) {
+		dir, err := downloadGoogleFonts(sourcePath)
+		return dir, err == nil, err
+	}
+	if strings.HasPrefix(sourcePath, gitScheme) {
+		_, err := downloadGitArchive(sourcePath)
+		return "", false, err
+	}
+	fi, err := os.Stat(sourcePath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open Noto input: %w", err)
+	}
+	if fi.IsDir() {
+		return sourcePath, true, nil
+	}
+	format, err := detectArchiveFormat(sourcePath)
+	if err != nil || format == archiveZip {
+		return "", false, err
+	}
+	dir, err := extractTarball(sourcePath, format)
+	return dir, err == nil, err
+}
+
+// openSource opens an input, which is a Noto release ZIP, a tarball, or a directory tree of fonts; see inputDir. The
+// members of its CJK collections, the fonts that its WOFF2 files decode to, and the static instances of its variable
+// fonts are added to it; see collectionFS, woff2FS, and variableFS. The fonts of ZIP files are cached; see cacheFS. The
+// returned function closes it.
+func openSource(sourcePath string) (fs.FS, func() error, error) {
+	z, closeSource, err := openArchive(sourcePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newCacheFS(&variableFS{FS: woff2FS{FS: &collectionFS{FS: z}}}, z), closeSource, nil
+}
+
+// openArchive opens an input without adding the members of its CJK collections, the fonts of its WOFF2 files, or the
+// instances of its variable fonts; see openSource.
+func openArchive(sourcePath string) (fs.FS, func() error, error) {
+	if dir, ok, err := inputDir(sourcePath); err != nil {
+		return nil, nil, err
+	} else if ok {
+		return os.DirFS(dir), func() error { return nil }, nil
+	}
+	if sourcePath == stdinInput {
+		_, data, _ := readStdin()
+		z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load Noto input ZIP: %w", err)
+		}
+		return z, func() error { return nil }, nil
+	}
+	zipPath := sourcePath
+	if strings.HasPrefix(sourcePath, gitScheme) {
+		var err error
+		if zipPath, err = downloadGitArchive(sourcePath); err != nil {
+			return nil, nil, err
+		}
+	}
+	z, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load Noto input ZIP: %w", err)
+	}
+	return z, z.Close, nil
+}
+
+// scanSource lists the fonts in an input. The fonts of a ZIP file are listed from the index file next to it unless
+// noIndex is set; directories, tarballs, standard input, and git inputs are always walked, since directories change
+// without a single modification time to check, tarballs are extracted anyway, and standard input and the archives of
+// git inputs have no lasting file to index. Fonts
+// that appear more than once are reduced to the preferred copy; see preferFonts. The fonts of noto-cjk, the WOFF2 fonts
+// of web distributions, and the variable fonts of newer releases are adapted to the names of the release, see
+// addCJKCollections, adaptCJKSubsets, addWOFF2Fonts, and addVariableFonts, and the color fonts of noto-emoji are added
+// to the Emoji family, see addColorEmojiFonts. Fonts matching the skip patterns are removed before the copies are
+// reduced, so that another copy of a skipped font can take its place; the patterns that matched are added to matched.
+// preferHinted selects the hinted copies of fonts instead of the unhinted ones. The paths of all recognized fonts,
+// including those that are skipped or reduced, are added to recognized if it is not nil.
+func scanSource(sourcePath string, noIndex bool, skip []string, preferHinted bool, matched map[string]bool, recognized map[string]bool) (*noto.Inventory, error) {
+	_, isDir, err := inputDir(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	z, closeSource, err := openSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = closeSource() }()
+	var inventory *noto.Inventory
+	if noIndex || isDir || sourcePath == stdinInput || strings.HasPrefix(sourcePath, gitScheme) {
+		if inventory, err = noto.Scan(z); err != nil {
+			return nil, fmt.Errorf("failed to scan the Noto input: %w", err)
+		}
+	} else {
+		var cached bool
+		if inventory, cached, err = noto.ScanZipFile(sourcePath); err != nil {
+			return nil, fmt.Errorf("failed to scan the Noto input ZIP: %w", err)
+		}
+		if cached {
+			log.debugf("Using the index %s", sourcePath+noto.IndexSuffix)
+		}
+	}
+	if err := addCJKCollections(z, inventory); err != nil {
+		return nil, err
+	}
+	if err := addWOFF2Fonts(z, inventory); err != nil {
+		return nil, err
+	}
+	if err := addVariableFonts(z, inventory); err != nil {
+		return nil, err
+	}
+	addRecognized := func() {
+		if recognized != nil {
+			for _, f := range inventory.Fonts {
+				recognized[f.Path] = true
+			}
+		}
+	}
+	// The region subsets that the full CJK fonts replace count as recognized too
+	addRecognized()
+	adaptCJKSubsets(inventory)
+	if err := addColorEmojiFonts(z, inventory); err != nil {
+		return nil, err
+	}
+	addRecognized()
+	skipFonts(inventory, skip, matched)
+	preferFonts(inventory, preferHinted)
+	return inventory, nil
+}
+
+// inputPrefixes returns the directory that holds the files of each input when several inputs are combined; see
+// openInput. The directories are named after the inputs, such as "Noto-unhinted.zip", with a number appended to
+// repeated names.
+func inputPrefixes(sourcePaths []string) []string {
+	var prefixes []string
+	used := make(map[string]bool)
+	for _, p := range sourcePaths {
+		prefix := filepath.Base(p)
+		for i := 2; used[prefix]; i++ {
+			prefix = fmt.Sprintf("%s-%d", filepath.Base(p), i)
+		}
+		used[prefix] = true
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// inputsFS combines several inputs into one file system, in which the files of each input are in the directory
+// returned by inputPrefixes.
+type inputsFS map[string]fs.FS
+
+func (m inputsFS) Open(name string) (fs.File, error) {
+	if i := strings.IndexByte(name, '/'); i >= 0 && fs.ValidPath(name) {
+		if f, ok := m[name[:i]]; ok {
+			return f.Open(name[i+1:])
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadFile reads a file of an input, so that the inputs that cache their files do so; see cacheFS.
+func (m inputsFS) ReadFile(name string) ([]byte, error) {
+	if i := strings.IndexByte(name, '/'); i >= 0 && fs.ValidPath(name) {
+		if f, ok := m[name[:i]]; ok {
+			return fs.ReadFile(f, name[i+1:])
+		}
+	}
+	return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+}
+
+// openInput opens the inputs. A single input is opened as is; several inputs are combined into an inputsFS. The
+// returned function closes them.
+func openInput(sourcePaths []string) (fs.FS, func() error, error) {
+	if len(sourcePaths) == 1 {
+		return openSource(sourcePaths[0])
+	}
+	combined := make(inputsFS)
+	var closers []func() error
+	closeAll := func() error {
+		var first error
+		for _, c := range closers {
+			if err := c(); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+	for i, prefix := range inputPrefixes(sourcePaths) {
+		f, closeSource, err := openSource(sourcePaths[i])
+		if err != nil {
+			_ = closeAll()
+			return nil, nil, err
+		}
+		combined[prefix] = f
+		closers = append(closers, closeSource)
+	}
+	return combined, closeAll, nil
+}
+
+// scanInput lists the fonts in the inputs. Upstream splits its releases across repositories, such as the main Noto
+// release and the noto-cjk and noto-emoji releases, so the inventories of several inputs are combined before the
+// packages are resolved: the paths of their fonts are prefixed with the directories of openInput, and a font that
+// appears in several inputs is taken from the first of them, unless a later one has a preferred copy; see preferFonts.
+// The fonts that match the skip patterns are left out; see skipFonts. If recognized is not nil, the paths of all fonts
+// recognized in the inputs are added to it, including those left out; see newInputReport.
+func scanInput(sourcePaths []string, noIndex bool, skip []string, preferHinted bool, recognized map[string]bool) (*noto.Inventory, error) {
+	matched := make(map[string]bool)
+	inventory, err := scanInputs(sourcePaths, noIndex, skip, preferHinted, matched, recognized)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range skip {
+		if !matched[p] {
+			runWarnings.warnf(warnInput, severityMinor, "", "The -skip pattern %q matches no font in the input", p)
+		}
+	}
+	return inventory, nil
+}
+
+func scanInputs(sourcePaths []string, noIndex bool, skip []string, preferHinted bool, matched map[string]bool, recognized map[string]bool) (*noto.Inventory, error) {
+	if len(sourcePaths) == 1 {
+		return scanSource(sourcePaths[0], noIndex, skip, preferHinted, matched, recognized)
+	}
+	combined := new(noto.Inventory)
+	languages := make(map[string]bool)
+	for i, prefix := range inputPrefixes(sourcePaths) {
+		var found map[string]bool
+		if recognized != nil {
+			found = make(map[string]bool)
+		}
+		inventory, err := scanSource(sourcePaths[i], noIndex, skip, preferHinted, matched, found)
+		if err != nil {
+			return nil, err
+		}
+		for p := range found {
+			recognized[prefix+"/"+p] = true
+		}
+		log.debugf("Found %d fonts in %s", len(inventory.Fonts), sourcePaths[i])
+		for _, f := range inventory.Fonts {
+			f.Path = prefix + "/" + f.Path
+			combined.Fonts = append(combined.Fonts, f)
+		}
+		for _, l := range inventory.Languages {
+			if !languages[l] {
+				languages[l] = true
+				combined.Languages = append(combined.Languages, l)
+			}
+		}
+	}
+	sort.Strings(combined.Languages)
+	preferFonts(combined, preferHinted)
+	return combined, nil
+}
+
+// skipFonts removes the fonts of the inventory that match any of the patterns, which use the syntax of path.Match, so
+// that broken or unwanted upstream files can be left out without changing how the others are recognized. A pattern
+// without a slash, such as NotoSansTest* or *-Hinted*, is matched against each element of the path of a font within
+// its input, so that it matches files and directories alike, including the variable and WOFF2 files from which
+// fonts are derived; a pattern with a slash is matched against the path and each of the directories and files that
+// contain it. The patterns that matched a font are added to matched.
+func skipFonts(inventory *noto.Inventory, patterns []string, matched map[string]bool) {
+	if len(patterns) == 0 {
+		return
+	}
+	fonts := inventory.Fonts[:0]
+	for _, f := range inventory.Fonts {
+		if p, ok := matchSkipPattern(patterns, f.Path); ok {
+			log.debugf("Skipping %s, which matches %q", f.Path, p)
+			matched[p] = true
+			continue
+		}
+		fonts = append(fonts, f)
+	}
+	inventory.Fonts = fonts
+}
+
+// matchSkipPattern returns the first of the patterns that matches the path of a font; see skipFonts.
+func matchSkipPattern(patterns []string, name string) (string, bool) {
+	for _, p := range patterns {
+		elems := strings.Split(name, "/")
+		for i, elem := range elems {
+			if strings.Contains(p, "/") {
+				elem = strings.Join(elems[:i+1], "/")
+			}
+			if ok, _ := path.Match(p, elem); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// validateSkipPatterns checks the syntax of the patterns of -skip.
+func validateSkipPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// preferFonts removes the fonts of the inventory that also appear in another directory or format, such as the copies
+// of NotoSans-Regular in the hinted/ttf, unhinted/ttf, and unhinted/otf directories of a noto-fonts checkout. TrueType
+// fonts are preferred over CFF fonts, which lose their subroutines when merged, and unhinted fonts over hinted ones,
+// matching the Noto-unhinted.zip release, unless preferHinted is set, as by profiles that require hinting, static fonts
+// over the instances that gonoto derives from variable fonts, and fonts in SFNT files over those decoded from WOFF2
+// files. Otherwise, the first font of the inventory is kept.
+func preferFonts(inventory *noto.Inventory, preferHinted bool) {
+	rank := func(f *noto.Font) int {
+		r := 0
+		if path.Ext(f.Path) != ".ttf" {
+			r += 2
+		}
+		if isVariableInstance(f.Path) {
+			r++
+		}
+		if isWOFF2Font(f.Path) {
+			r++
+		}
+		for _, dir := range strings.Split(path.Dir(f.Path), "/") {
+			if dir == "hinted" && !preferHinted || dir == "unhinted" && preferHinted {
+				r++
+				break
+			}
+		}
+		return r
+	}
+	preferred := make(map[string]*noto.Font)
+	for _, f := range inventory.Fonts {
+		name := strings.TrimSuffix(path.Base(f.Path), path.Ext(f.Path))
+		if p, ok := preferred[name]; !ok || rank(f) < rank(p) {
+			preferred[name] = f
+		}
+	}
+	if len(preferred) == len(inventory.Fonts) {
+		return
+	}
+	log.debugf("Using %d of %d fonts in the input; the others are copies in other directories or formats",
+		len(preferred), len(inventory.Fonts))
+	fonts := inventory.Fonts[:0]
+	for _, f := range inventory.Fonts {
+		if preferred[strings.TrimSuffix(path.Base(f.Path), path.Ext(f.Path))] == f {
+			fonts = append(fonts, f)
+		}
+	}
+	inventory.Fonts = fonts
+}
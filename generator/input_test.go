@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+func TestPreferFonts(t *testing.T) {
+	paths := []string{
+		"fonts/NotoSans/hinted/ttf/NotoSans-Regular.ttf",
+		"fonts/NotoSans/unhinted/otf/NotoSans-Regular.otf",
+		"fonts/NotoSans/unhinted/ttf/NotoSans-Regular.ttf",
+		"fonts/NotoSans/hinted/ttf/NotoSans-Bold.ttf",
+		"fonts/NotoSansThai/unhinted/ttf/NotoSansThai-Regular.ttf",
+		"web/NotoSansThai-Regular.woff2/NotoSansThai-Regular.ttf",
+		"fonts/NotoSansArabic/unhinted/otf/NotoSansArabic-Regular.otf",
+	}
+	for _, test := range []struct {
+		preferHinted bool
+		expected     []string
+	}{
+		{false, []string{
+			"fonts/NotoSans/unhinted/ttf/NotoSans-Regular.ttf",
+			// Fonts without an unhinted copy are still used
+			"fonts/NotoSans/hinted/ttf/NotoSans-Bold.ttf",
+			"fonts/NotoSansThai/unhinted/ttf/NotoSansThai-Regular.ttf",
+			"fonts/NotoSansArabic/unhinted/otf/NotoSansArabic-Regular.otf",
+		}},
+		{true, []string{
+			"fonts/NotoSans/hinted/ttf/NotoSans-Regular.ttf",
+			"fonts/NotoSans/hinted/ttf/NotoSans-Bold.ttf",
+			// Fonts without a hinted copy are still used
+			"fonts/NotoSansThai/unhinted/ttf/NotoSansThai-Regular.ttf",
+			"fonts/NotoSansArabic/unhinted/otf/NotoSansArabic-Regular.otf",
+		}},
+	} {
+		inventory := new(noto.Inventory)
+		for _, p := range paths {
+			inventory.Fonts = append(inventory.Fonts, &noto.Font{Path: p})
+		}
+		preferFonts(inventory, test.preferHinted)
+		var got []string
+		for _, f := range inventory.Fonts {
+			got = append(got, f.Path)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("preferHinted %t: kept %q, expected %q", test.preferHinted, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// fontFileExts lists the extensions of the files of the inputs that hold fonts, for inputReport.
+var fontFileExts = map[string]bool{".ttf": true, ".otf": true, ".ttc": true, ".otc": true, ".woff2": true, ".woff": true}
+
+// inputReport lists the fonts of the inputs that no package merges, so that fonts that a new Noto release renames or
+// adds do not silently go missing from the packages. It is logged as a summary, and written in full with
+// -input-report.
+type inputReport struct {
+	// Unmatched lists the font files of the inputs from which no font was recognized, such as files whose names and
+	// name tables use unknown families or style terms, or that are in unsupported formats.
+	Unmatched []string `json:"unmatched"`
+	// Unused lists the recognized fonts that are not merged into any of the packages of the run, such as the weights
+	// for which no package is generated. Copies of fonts that are preferred elsewhere and fonts skipped with -skip are
+	// not listed.
+	Unused []unusedFont `json:"unused"`
+	// Languages lists the languages of which no font is merged into any package.
+	Languages []string `json:"languages"`
+}
+
+type unusedFont struct {
+	Path     string `json:"path"`
+	Family   string `json:"family"`
+	Language string `json:"language,omitempty"`
+	UI       bool   `json:"ui,omitempty"`
+	Style    string `json:"style"` // The style terms, as in the file names, e.g. "CondensedBold"
+}
+
+// newInputReport compares the font files of the inputs with the fonts recognized in them and the source fonts of the
+// packages. recognized holds the paths of all recognized fonts; see scanInput.
+func newInputReport(sourcePaths []string, recognized map[string]bool, allFonts []*fontDesc, selected [][]*fontDesc) (*inputReport, error) {
+	files, err := inputFontFiles(sourcePaths)
+	if err != nil {
+		return nil, err
+	}
+	recognizedFiles := make(map[string]bool)
+	for p := range recognized {
+		recognizedFiles[inputFile(p)] = true
+	}
+	r := &inputReport{Unmatched: []string{}, Unused: []unusedFont{}, Languages: []string{}}
+	for _, p := range files {
+		if !recognizedFiles[p] {
+			r.Unmatched = append(r.Unmatched, p)
+		}
+	}
+	used := make(map[*fontDesc]bool)
+	usedLanguages := make(map[string]bool)
+	for _, fonts := range selected {
+		for _, f := range fonts {
+			used[f] = true
+			usedLanguages[f.language] = true
+		}
+	}
+	languages := make(map[string]bool)
+	for _, f := range allFonts {
+		if used[f] {
+			continue
+		}
+		r.Unused = append(r.Unused, unusedFont{Path: f.filename, Family: f.family, Language: f.language,
+			UI:    vDensities[f.vDensity] == "UI",
+			Style: strings.Join(styleTerms(hDensities[f.hDensity], weights[f.weight], styles[f.style] == "Italic"), "")})
+		if f.language != "" && !usedLanguages[f.language] && !languages[f.language] {
+			languages[f.language] = true
+			r.Languages = append(r.Languages, f.language)
+		}
+	}
+	sort.Slice(r.Unused, func(i, j int) bool { return r.Unused[i].Path < r.Unused[j].Path })
+	sort.Strings(r.Languages)
+	return r, nil
+}
+
+// inputFontFiles lists the font files of the inputs, with the prefixes of inputPrefixes when there are several inputs.
+// The fonts of Google Fonts inputs are downloaded by family, so that there are no other files to report.
+func inputFontFiles(sourcePaths []string) ([]string, error) {
+	prefixes := inputPrefixes(sourcePaths)
+	var files []string
+	for i, sourcePath := range sourcePaths {
+		if strings.HasPrefix(sourcePath, googleFontsScheme) {
+			continue
+		}
+		fsys, closeArchive, err := openArchive(sourcePath)
+		if err != nil {
+			return nil, err
+		}
+		err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && fontFileExts[strings.ToLower(path.Ext(p))] {
+				if len(sourcePaths) > 1 {
+					p = prefixes[i] + "/" + p
+				}
+				files = append(files, p)
+			}
+			return nil
+		})
+		_ = closeArchive()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the fonts of %s: %w", sourcePath, err)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// inputFile returns the path of the file of the inputs that a font is read from. The fonts derived from collections,
+// WOFF2 files, and variable fonts have paths inside those files, such as
+// Sans/OTC/NotoSansCJK-Bold.ttc/NotoSansCJKjp-Bold.otf; see collectionFS, woff2FS, and variableFS.
+func inputFile(fontPath string) string {
+	elems := strings.Split(fontPath, "/")
+	for i, elem := range elems[:len(elems)-1] {
+		if fontFileExts[strings.ToLower(path.Ext(elem))] {
+			return strings.Join(elems[:i+1], "/")
+		}
+	}
+	return fontPath
+}
+
+// summarize logs the number of unmatched files and the languages that no package merges.
+func (r *inputReport) summarize() {
+	if len(r.Unmatched) > 0 {
+		log.infof("%d font files of the input are not recognized as Noto fonts; see -input-report", len(r.Unmatched))
+		for _, p := range r.Unmatched {
+			log.debugf("  %s", p)
+		}
+	}
+	if len(r.Languages) > 0 {
+		log.infof("No package merges the fonts of %d languages of the input: %s", len(r.Languages), strings.Join(r.Languages, ", "))
+	}
+	log.debugf("%d recognized fonts of the input are not merged into any package", len(r.Unused))
+}
+
+// write writes the report to file as JSON.
+func (r *inputReport) write(file string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write input report: %w", err)
+	}
+	return nil
+}
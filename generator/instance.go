@@ -0,0 +1,1106 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// variationTables are the tables that describe the variations of a variable font, which its static instances drop.
+// The hdmx table caches advance widths at the default location, so it is dropped as well.
+var variationTables = []string{"fvar", "avar", "gvar", "cvar", "HVAR", "VVAR", "MVAR", "STAT", "hdmx"}
+
+// variationAxis is an axis of a variable font, in user coordinates such as 400 for the default weight.
+type variationAxis struct {
+	tag           string
+	min, def, max float64
+}
+
+// fontAxes returns the variation axes of a font, which has none unless it is a variable font.
+func fontAxes(f *sfntFont) ([]variationAxis, error) {
+	fvar := f.table("fvar")
+	if fvar == nil {
+		return nil, nil
+	}
+	if len(fvar) < 16 {
+		return nil, errors.New("fvar table is truncated")
+	}
+	offset := int(binary.BigEndian.Uint16(fvar[4:]))
+	count := int(binary.BigEndian.Uint16(fvar[8:]))
+	size := int(binary.BigEndian.Uint16(fvar[10:]))
+	if size < 20 || len(fvar) < offset+count*size {
+		return nil, errors.New("fvar table is truncated")
+	}
+	axes := make([]variationAxis, count)
+	for i := range axes {
+		record := fvar[offset+i*size:]
+		axes[i] = variationAxis{
+			tag: string(record[:4]),
+			min: fixedValue(record[4:]),
+			def: fixedValue(record[8:]),
+			max: fixedValue(record[12:]),
+		}
+	}
+	return axes, nil
+}
+
+func fixedValue(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func f2dot14Value(b []byte) float64 {
+	return float64(int16(binary.BigEndian.Uint16(b))) / 16384
+}
+
+// roundF2Dot14 rounds a normalized coordinate to the precision in which fonts store them.
+func roundF2Dot14(v float64) float64 {
+	return math.Floor(v*16384+0.5) / 16384
+}
+
+// roundHalfUp rounds a coordinate to an integer the way font compilers do, with halves rounded towards +∞.
+func roundHalfUp(v float64) int {
+	return int(math.Floor(v + 0.5))
+}
+
+// instanceFont turns a TrueType variable font into the static instance at a location given in user coordinates, such
+// as {"wght": 700, "wdth": 75}. Axes that the location omits are pinned to their defaults, and coordinates outside of
+// an axis are clamped to it. The outlines, advance widths, cvt values, font-wide metrics, and GPOS positions are
+// varied, and the variation tables are removed. The names and style fields are left to the caller; see
+// setInstanceStyle.
+//
+// Feature variations, which substitute glyphs in some regions of the design space, are not applied, so the instance
+// keeps the glyphs of the default location.
+func instanceFont(f *sfntFont, location map[string]float64) error {
+	axes, err := fontAxes(f)
+	if err != nil {
+		return err
+	}
+	if len(axes) == 0 {
+		return errors.New("the font has no variation axes")
+	}
+	if f.table("glyf") == nil || f.table("CFF2") != nil {
+		return errors.New("only variable fonts with TrueType outlines can be instanced")
+	}
+	coords, err := normalizeLocation(axes, location, f.table("avar"))
+	if err != nil {
+		return err
+	}
+	if err := instanceGlyphs(f, coords); err != nil {
+		return fmt.Errorf("failed to instance the glyphs: %w", err)
+	}
+	if err := instanceCVT(f, coords); err != nil {
+		return fmt.Errorf("failed to instance the cvt table: %w", err)
+	}
+	if err := instanceMetrics(f, coords); err != nil {
+		return fmt.Errorf("failed to instance the MVAR metrics: %w", err)
+	}
+	if err := instanceGPOS(f, coords); err != nil {
+		return fmt.Errorf("failed to instance the GPOS table: %w", err)
+	}
+	for _, tag := range variationTables {
+		delete(f.tables, tag)
+	}
+	return nil
+}
+
+// normalizeLocation converts a location in user coordinates to the normalized coordinates of each axis, between -1
+// and 1, and applies the axis mappings of the avar table, if any.
+func normalizeLocation(axes []variationAxis, location map[string]float64, avar []byte) ([]float64, error) {
+	coords := make([]float64, len(axes))
+	for i, a := range axes {
+		v, ok := location[a.tag]
+		if !ok {
+			continue
+		}
+		v = math.Max(a.min, math.Min(a.max, v))
+		switch {
+		case v < a.def:
+			coords[i] = (v - a.def) / (a.def - a.min)
+		case v > a.def:
+			coords[i] = (v - a.def) / (a.max - a.def)
+		}
+		coords[i] = roundF2Dot14(coords[i])
+	}
+	if avar == nil {
+		return coords, nil
+	}
+	if len(avar) < 8 || int(binary.BigEndian.Uint16(avar[6:])) != len(axes) {
+		return nil, errors.New("avar table is truncated or does not match the axes")
+	}
+	pos := 8
+	for i := range coords {
+		if len(avar) < pos+2 {
+			return nil, errors.New("avar table is truncated")
+		}
+		n := int(binary.BigEndian.Uint16(avar[pos:]))
+		pos += 2
+		if len(avar) < pos+4*n {
+			return nil, errors.New("avar table is truncated")
+		}
+		coords[i] = roundF2Dot14(mapSegments(avar[pos:pos+4*n], coords[i]))
+		pos += 4 * n
+	}
+	return coords, nil
+}
+
+// mapSegments applies the piecewise linear mapping of an avar segment map, given as pairs of coordinates, to v.
+func mapSegments(segments []byte, v float64) float64 {
+	n := len(segments) / 4
+	if n == 0 {
+		return v
+	}
+	from := func(i int) float64 { return f2dot14Value(segments[4*i:]) }
+	to := func(i int) float64 { return f2dot14Value(segments[4*i+2:]) }
+	if v <= from(0) {
+		return v + to(0) - from(0)
+	}
+	if v >= from(n-1) {
+		return v + to(n-1) - from(n-1)
+	}
+	for i := 1; i < n; i++ {
+		if v <= from(i) {
+			if from(i) == from(i-1) {
+				return to(i)
+			}
+			return to(i-1) + (v-from(i-1))*(to(i)-to(i-1))/(from(i)-from(i-1))
+		}
+	}
+	return v
+}
+
+// regionScalar returns the factor by which the deltas of a variation region apply at the normalized coordinates. The
+// region peaks at peak; start and end bound it on each axis, or are nil for the region between the default and the
+// peak.
+func regionScalar(coords, peak, start, end []float64) float64 {
+	scalar := 1.0
+	for i, p := range peak {
+		if p == 0 {
+			continue
+		}
+		v := coords[i]
+		if v == p {
+			continue
+		}
+		lower, upper := math.Min(p, 0), math.Max(p, 0)
+		if start != nil {
+			lower, upper = start[i], end[i]
+		}
+		if lower > p || p > upper || (lower < 0 && upper > 0) {
+			continue
+		}
+		if v <= lower || upper <= v {
+			return 0
+		}
+		if v < p {
+			scalar *= (v - lower) / (p - lower)
+		} else {
+			scalar *= (v - upper) / (p - upper)
+		}
+	}
+	return scalar
+}
+
+// tupleVariation is a set of deltas of the points of a glyph, or of the values of the cvt table, that applies at the
+// instance.
+type tupleVariation struct {
+	scalar float64 // The factor by which the deltas apply; see regionScalar
+	points []int   // The points that the deltas apply to, or nil for all of them
+	deltas []int32 // The deltas of each point for the first dimension, then for the second dimension, if any
+}
+
+// Flags of the tuple variation headers of gvar and cvar.
+const (
+	sharedPointNumbers  = 0x8000
+	tupleCountMask      = 0x0fff
+	embeddedPeakTuple   = 0x8000
+	intermediateRegion  = 0x4000
+	privatePointNumbers = 0x2000
+	tupleIndexMask      = 0x0fff
+)
+
+// parseTupleVariations decodes the tuple variations that apply at the normalized coordinates from the variation data
+// of a glyph in gvar, or from cvar. The tupleVariationCount field is at start, and data begins with the structure
+// that the offset of the serialized data is relative to. Each point has dims deltas, and numPoints is the number of
+// points that a variation without point numbers applies to.
+func parseTupleVariations(data []byte, start int, coords []float64, sharedTuples [][]float64, dims int, numPoints int) ([]tupleVariation, error) {
+	if len(data) < start+4 {
+		return nil, errors.New("tuple variations are truncated")
+	}
+	countField := binary.BigEndian.Uint16(data[start:])
+	dataOffset := int(binary.BigEndian.Uint16(data[start+2:]))
+	if len(data) < dataOffset {
+		return nil, errors.New("tuple variation data is out of bounds")
+	}
+	serialized := data[dataOffset:]
+	var shared []int
+	if countField&sharedPointNumbers != 0 {
+		points, n, err := parsePackedPoints(serialized)
+		if err != nil {
+			return nil, err
+		}
+		shared, serialized = points, serialized[n:]
+	}
+	axisCount := len(coords)
+	tuple := func(pos int) ([]float64, error) {
+		if len(data) < pos+2*axisCount {
+			return nil, errors.New("tuple is truncated")
+		}
+		t := make([]float64, axisCount)
+		for i := range t {
+			t[i] = f2dot14Value(data[pos+2*i:])
+		}
+		return t, nil
+	}
+
+	var variations []tupleVariation
+	pos := start + 4
+	for i := 0; i < int(countField&tupleCountMask); i++ {
+		if len(data) < pos+4 {
+			return nil, errors.New("tuple variation header is truncated")
+		}
+		size := int(binary.BigEndian.Uint16(data[pos:]))
+		index := binary.BigEndian.Uint16(data[pos+2:])
+		pos += 4
+		var peak, startTuple, endTuple []float64
+		var err error
+		if index&embeddedPeakTuple != 0 {
+			if peak, err = tuple(pos); err != nil {
+				return nil, err
+			}
+			pos += 2 * axisCount
+		} else {
+			if int(index&tupleIndexMask) >= len(sharedTuples) {
+				return nil, errors.New("shared tuple index is out of bounds")
+			}
+			peak = sharedTuples[index&tupleIndexMask]
+		}
+		if index&intermediateRegion != 0 {
+			if startTuple, err = tuple(pos); err != nil {
+				return nil, err
+			}
+			if endTuple, err = tuple(pos + 2*axisCount); err != nil {
+				return nil, err
+			}
+			pos += 4 * axisCount
+		}
+		if len(serialized) < size {
+			return nil, errors.New("tuple variation data is truncated")
+		}
+		body := serialized[:size]
+		serialized = serialized[size:]
+		scalar := regionScalar(coords, peak, startTuple, endTuple)
+		if scalar == 0 {
+			continue
+		}
+		points := shared
+		if index&privatePointNumbers != 0 {
+			var n int
+			if points, n, err = parsePackedPoints(body); err != nil {
+				return nil, err
+			}
+			body = body[n:]
+		}
+		count := numPoints
+		if points != nil {
+			count = len(points)
+		}
+		deltas, err := parsePackedDeltas(body, dims*count)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range points {
+			if p >= numPoints {
+				return nil, errors.New("tuple variation point is out of bounds")
+			}
+		}
+		variations = append(variations, tupleVariation{scalar: scalar, points: points, deltas: deltas})
+	}
+	return variations, nil
+}
+
+// parsePackedPoints decodes packed point numbers. It returns nil for all points, and the number of bytes read.
+func parsePackedPoints(b []byte) ([]int, int, error) {
+	truncated := errors.New("packed point numbers are truncated")
+	if len(b) < 1 {
+		return nil, 0, truncated
+	}
+	count, pos := int(b[0]), 1
+	if count&0x80 != 0 {
+		if len(b) < 2 {
+			return nil, 0, truncated
+		}
+		count, pos = (count&0x7f)<<8|int(b[1]), 2
+	}
+	if count == 0 {
+		return nil, pos, nil
+	}
+	points := make([]int, 0, count)
+	last := 0
+	for len(points) < count {
+		if len(b) < pos+1 {
+			return nil, 0, truncated
+		}
+		control := b[pos]
+		pos++
+		words := control&0x80 != 0
+		for run := int(control&0x7f) + 1; run > 0 && len(points) < count; run-- {
+			if words {
+				if len(b) < pos+2 {
+					return nil, 0, truncated
+				}
+				last += int(binary.BigEndian.Uint16(b[pos:]))
+				pos += 2
+			} else {
+				if len(b) < pos+1 {
+					return nil, 0, truncated
+				}
+				last += int(b[pos])
+				pos++
+			}
+			points = append(points, last)
+		}
+	}
+	return points, pos, nil
+}
+
+// parsePackedDeltas decodes count packed deltas.
+func parsePackedDeltas(b []byte, count int) ([]int32, error) {
+	truncated := errors.New("packed deltas are truncated")
+	deltas := make([]int32, 0, count)
+	pos := 0
+	for len(deltas) < count {
+		if len(b) < pos+1 {
+			return nil, truncated
+		}
+		control := b[pos]
+		pos++
+		for run := int(control&0x3f) + 1; run > 0 && len(deltas) < count; run-- {
+			switch control & 0xc0 {
+			case 0x80: // Zero
+				deltas = append(deltas, 0)
+			case 0x40: // 16-bit
+				if len(b) < pos+2 {
+					return nil, truncated
+				}
+				deltas = append(deltas, int32(int16(binary.BigEndian.Uint16(b[pos:]))))
+				pos += 2
+			case 0xc0: // 32-bit
+				if len(b) < pos+4 {
+					return nil, truncated
+				}
+				deltas = append(deltas, int32(binary.BigEndian.Uint32(b[pos:])))
+				pos += 4
+			default: // 8-bit
+				if len(b) < pos+1 {
+					return nil, truncated
+				}
+				deltas = append(deltas, int32(int8(b[pos])))
+				pos++
+			}
+		}
+	}
+	return deltas, nil
+}
+
+// instanceGlyphs applies the deltas of the gvar table to the outlines of the glyf table and to the advance widths,
+// which gvar varies through the phantom points of each glyph, and recomputes the bounding boxes, side bearings, and
+// the metrics derived from them. The loca table is rewritten in the long format.
+func instanceGlyphs(f *sfntFont, coords []float64) error {
+	head, maxp, hhea, hmtx, loca, glyf, gvar := f.table("head"), f.table("maxp"), f.table("hhea"), f.table("hmtx"),
+		f.table("loca"), f.table("glyf"), f.table("gvar")
+	if len(head) < 54 || len(maxp) < 6 || len(hhea) < 36 {
+		return errors.New("head, maxp, or hhea table is truncated")
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	longOffsets := binary.BigEndian.Uint16(head[50:]) != 0
+	if (longOffsets && len(loca) < 4*(numGlyphs+1)) || (!longOffsets && len(loca) < 2*(numGlyphs+1)) {
+		return errors.New("loca table is truncated")
+	}
+	offset := func(i int) int {
+		if longOffsets {
+			return int(binary.BigEndian.Uint32(loca[4*i:]))
+		}
+		return 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+	}
+	numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if numHMetrics < 1 || numHMetrics > numGlyphs || len(hmtx) < 4*numHMetrics+2*(numGlyphs-numHMetrics) {
+		return errors.New("hmtx table is truncated")
+	}
+	advances, lsbs := make([]int, numGlyphs), make([]int, numGlyphs)
+	for i := range advances {
+		if i < numHMetrics {
+			advances[i] = int(binary.BigEndian.Uint16(hmtx[4*i:]))
+			lsbs[i] = int(int16(binary.BigEndian.Uint16(hmtx[4*i+2:])))
+		} else {
+			advances[i] = advances[numHMetrics-1]
+			lsbs[i] = int(int16(binary.BigEndian.Uint16(hmtx[4*numHMetrics+2*(i-numHMetrics):])))
+		}
+	}
+	glyphVariations, sharedTuples, err := parseGvar(gvar, len(coords), numGlyphs)
+	if err != nil {
+		return err
+	}
+
+	outlines := make([]*glyphOutline, numGlyphs)
+	origins := make([]int, numGlyphs) // The x coordinate of the first phantom point of each glyph
+	for i := range outlines {
+		start, end := offset(i), offset(i+1)
+		if start > end || end > len(glyf) {
+			return fmt.Errorf("glyph %d is out of bounds", i)
+		}
+		o, err := decodeGlyph(glyf[start:end])
+		if err != nil {
+			return fmt.Errorf("glyph %d: %w", i, err)
+		}
+		outlines[i] = o
+		origins[i] = o.xMin - lsbs[i]
+		vars := glyphVariations(i)
+		if len(vars) == 0 {
+			continue
+		}
+		// The points of the outline, or the offsets of the components, followed by the four phantom points, of which
+		// the first two give the horizontal origin and advance.
+		xs, ys := o.coordinates()
+		xs = append(xs, origins[i], origins[i]+advances[i], 0, 0)
+		ys = append(ys, 0, 0, 0, 0)
+		numPoints := len(xs)
+		tuples, err := parseTupleVariations(vars, 0, coords, sharedTuples, 2, numPoints)
+		if err != nil {
+			return fmt.Errorf("glyph %d: %w", i, err)
+		}
+		dx, dy := make([]float64, numPoints), make([]float64, numPoints)
+		for _, t := range tuples {
+			tx, ty := make([]float64, numPoints), make([]float64, numPoints)
+			if t.points == nil {
+				for p := range tx {
+					tx[p], ty[p] = float64(t.deltas[p]), float64(t.deltas[numPoints+p])
+				}
+			} else {
+				touched := make([]bool, numPoints)
+				for k, p := range t.points {
+					tx[p], ty[p] = float64(t.deltas[k]), float64(t.deltas[len(t.points)+k])
+					touched[p] = true
+				}
+				if len(o.components) == 0 {
+					interpolateDeltas(o, touched, tx, ty)
+				}
+			}
+			for p := range dx {
+				dx[p] += t.scalar * tx[p]
+				dy[p] += t.scalar * ty[p]
+			}
+		}
+		for p := range xs {
+			xs[p] = roundHalfUp(float64(xs[p]) + dx[p])
+			ys[p] = roundHalfUp(float64(ys[p]) + dy[p])
+		}
+		o.setCoordinates(xs[:numPoints-4], ys[:numPoints-4])
+		advances[i] = xs[numPoints-3] - xs[numPoints-4]
+		if advances[i] < 0 {
+			advances[i] = 0
+		}
+		// The side bearing is measured from the varied origin, which is usually unchanged
+		origins[i] = xs[numPoints-4]
+	}
+
+	var newGlyf bytes.Buffer
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	var bounds [4]int // xMin, yMin, xMax, yMax of the font
+	haveBounds := false
+	advanceMax, minLSB, minRSB, xMaxExtent := 0, math.MaxInt32, math.MaxInt32, math.MinInt32
+	var advanceSum, advanceCount int
+	for i, o := range outlines {
+		if o.empty() {
+			lsbs[i] = -origins[i]
+		} else {
+			o.xMin, o.yMin, o.xMax, o.yMax = glyphBounds(outlines, i)
+			lsbs[i] = o.xMin - origins[i]
+			minLSB = minInt(minLSB, lsbs[i])
+			minRSB = minInt(minRSB, advances[i]-(lsbs[i]+o.xMax-o.xMin))
+			xMaxExtent = maxInt(xMaxExtent, lsbs[i]+o.xMax-o.xMin)
+			if !haveBounds {
+				bounds = [4]int{o.xMin, o.yMin, o.xMax, o.yMax}
+				haveBounds = true
+			}
+			bounds = [4]int{minInt(bounds[0], o.xMin), minInt(bounds[1], o.yMin), maxInt(bounds[2], o.xMax), maxInt(bounds[3], o.yMax)}
+		}
+		advanceMax = maxInt(advanceMax, advances[i])
+		if advances[i] > 0 {
+			advanceSum += advances[i]
+			advanceCount++
+		}
+		binary.BigEndian.PutUint32(newLoca[4*i:], uint32(newGlyf.Len()))
+		glyph := o.encode()
+		newGlyf.Write(glyph)
+		newGlyf.Write(make([]byte, (4-len(glyph)%4)%4))
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(newGlyf.Len()))
+	f.tables["glyf"] = newGlyf.Bytes()
+	f.tables["loca"] = newLoca
+
+	// Trailing glyphs with the same advance width share the last long metric
+	numHMetrics = numGlyphs
+	for numHMetrics > 1 && advances[numHMetrics-1] == advances[numHMetrics-2] {
+		numHMetrics--
+	}
+	var newHmtx bytes.Buffer
+	for i := range advances {
+		if i < numHMetrics {
+			_ = binary.Write(&newHmtx, binary.BigEndian, uint16(advances[i]))
+		}
+		_ = binary.Write(&newHmtx, binary.BigEndian, int16(lsbs[i]))
+	}
+	f.tables["hmtx"] = newHmtx.Bytes()
+
+	hhea = append([]byte(nil), hhea...)
+	binary.BigEndian.PutUint16(hhea[10:], uint16(advanceMax))
+	if minLSB != math.MaxInt32 {
+		binary.BigEndian.PutUint16(hhea[12:], uint16(int16(minLSB)))
+		binary.BigEndian.PutUint16(hhea[14:], uint16(int16(minRSB)))
+		binary.BigEndian.PutUint16(hhea[16:], uint16(int16(xMaxExtent)))
+	}
+	binary.BigEndian.PutUint16(hhea[34:], uint16(numHMetrics))
+	f.tables["hhea"] = hhea
+
+	head = append([]byte(nil), head...)
+	for k, v := range bounds {
+		binary.BigEndian.PutUint16(head[36+2*k:], uint16(int16(v)))
+	}
+	binary.BigEndian.PutUint16(head[50:], 1)
+	f.tables["head"] = head
+
+	if os2 := f.table("OS/2"); len(os2) >= 4 && advanceCount > 0 {
+		os2 = append([]byte(nil), os2...)
+		binary.BigEndian.PutUint16(os2[2:], uint16(int16(roundHalfUp(float64(advanceSum)/float64(advanceCount)))))
+		f.tables["OS/2"] = os2
+	}
+	return nil
+}
+
+// parseGvar returns a function that returns the variation data of each glyph, and the shared tuples of the gvar
+// table. Fonts without a gvar table have no glyph variations.
+func parseGvar(gvar []byte, axisCount int, numGlyphs int) (func(i int) []byte, [][]float64, error) {
+	if gvar == nil {
+		return func(int) []byte { return nil }, nil, nil
+	}
+	if len(gvar) < 20 {
+		return nil, nil, errors.New("gvar table is truncated")
+	}
+	if int(binary.BigEndian.Uint16(gvar[4:])) != axisCount {
+		return nil, nil, errors.New("gvar table does not match the axes")
+	}
+	sharedCount := int(binary.BigEndian.Uint16(gvar[6:]))
+	sharedOffset := int(binary.BigEndian.Uint32(gvar[8:]))
+	glyphCount := int(binary.BigEndian.Uint16(gvar[12:]))
+	longOffsets := binary.BigEndian.Uint16(gvar[14:])&1 != 0
+	dataOffset := int(binary.BigEndian.Uint32(gvar[16:]))
+	offsetSize := 2
+	if longOffsets {
+		offsetSize = 4
+	}
+	if len(gvar) < 20+offsetSize*(glyphCount+1) || len(gvar) < sharedOffset+2*axisCount*sharedCount || glyphCount > numGlyphs {
+		return nil, nil, errors.New("gvar table is truncated")
+	}
+	sharedTuples := make([][]float64, sharedCount)
+	for i := range sharedTuples {
+		sharedTuples[i] = make([]float64, axisCount)
+		for j := range sharedTuples[i] {
+			sharedTuples[i][j] = f2dot14Value(gvar[sharedOffset+2*(axisCount*i+j):])
+		}
+	}
+	offset := func(i int) int {
+		if longOffsets {
+			return dataOffset + int(binary.BigEndian.Uint32(gvar[20+4*i:]))
+		}
+		return dataOffset + 2*int(binary.BigEndian.Uint16(gvar[20+2*i:]))
+	}
+	return func(i int) []byte {
+		if i >= glyphCount {
+			return nil
+		}
+		start, end := offset(i), offset(i+1)
+		if start >= end || end > len(gvar) {
+			return nil
+		}
+		return gvar[start:end]
+	}, sharedTuples, nil
+}
+
+// interpolateDeltas infers the deltas of the points of a simple glyph that a tuple variation does not reference from
+// the deltas of the nearest referenced points before and after them on the same contour, as gvar specifies.
+func interpolateDeltas(o *glyphOutline, touched []bool, dx, dy []float64) {
+	start := 0
+	for _, end := range o.contourEnds {
+		var refs []int
+		for p := start; p <= end; p++ {
+			if touched[p] {
+				refs = append(refs, p)
+			}
+		}
+		switch len(refs) {
+		case 0:
+		case 1:
+			for p := start; p <= end; p++ {
+				dx[p], dy[p] = dx[refs[0]], dy[refs[0]]
+			}
+		default:
+			for k, r := range refs {
+				next := refs[(k+1)%len(refs)]
+				for p := r + 1; ; p++ {
+					if p > end {
+						p = start
+					}
+					if p == next {
+						break
+					}
+					dx[p] = interpolateDelta(o.xs[p], o.xs[r], o.xs[next], dx[r], dx[next])
+					dy[p] = interpolateDelta(o.ys[p], o.ys[r], o.ys[next], dy[r], dy[next])
+				}
+			}
+		}
+		start = end + 1
+	}
+}
+
+// interpolateDelta infers the delta of a coordinate c from the coordinates and deltas of two referenced points.
+func interpolateDelta(c, c1, c2 int, d1, d2 float64) float64 {
+	if c1 == c2 {
+		if d1 == d2 {
+			return d1
+		}
+		return 0
+	}
+	if c1 > c2 {
+		c1, c2, d1, d2 = c2, c1, d2, d1
+	}
+	switch {
+	case c <= c1:
+		return d1
+	case c >= c2:
+		return d2
+	}
+	return d1 + float64(c-c1)*(d2-d1)/float64(c2-c1)
+}
+
+// instanceCVT applies the deltas of the cvar table to the cvt table of a hinted font.
+func instanceCVT(f *sfntFont, coords []float64) error {
+	cvar, cvt := f.table("cvar"), f.table("cvt ")
+	if cvar == nil || cvt == nil {
+		return nil
+	}
+	numValues := len(cvt) / 2
+	tuples, err := parseTupleVariations(cvar, 4, coords, nil, 1, numValues)
+	if err != nil {
+		return err
+	}
+	deltas := make([]float64, numValues)
+	for _, t := range tuples {
+		for k, d := range t.deltas {
+			p := k
+			if t.points != nil {
+				p = t.points[k]
+			}
+			deltas[p] += t.scalar * float64(d)
+		}
+	}
+	cvt = append([]byte(nil), cvt...)
+	for i, d := range deltas {
+		v := float64(int16(binary.BigEndian.Uint16(cvt[2*i:])))
+		binary.BigEndian.PutUint16(cvt[2*i:], uint16(int16(roundHalfUp(v+d))))
+	}
+	f.tables["cvt "] = cvt
+	return nil
+}
+
+// Flags of the points of simple glyphs.
+const (
+	onCurvePoint    = 0x01
+	xShortVector    = 0x02
+	yShortVector    = 0x04
+	repeatFlag      = 0x08
+	xSameOrPositive = 0x10
+	ySameOrPositive = 0x20
+	overlapSimple   = 0x40
+)
+
+// glyphOutline is a decoded glyph of the glyf table.
+type glyphOutline struct {
+	xMin, yMin, xMax, yMax int
+
+	// Simple glyphs
+	contourEnds []int  // The index of the last point of each contour
+	flags       []byte // The on-curve and overlap flags of each point
+	xs, ys      []int  // The coordinates of each point
+
+	components   []glyphComponent // The components of composite glyphs
+	instructions []byte
+}
+
+// glyphComponent is a component of a composite glyph.
+type glyphComponent struct {
+	flags      uint16
+	glyph      uint16
+	arg1, arg2 int    // The offset of the component, or the points to align if argsAreXYValues is not set
+	transform  []byte // The scale or 2x2 matrix, as stored
+}
+
+func (o *glyphOutline) empty() bool {
+	return len(o.contourEnds) == 0 && len(o.components) == 0
+}
+
+// coordinates returns the coordinates that gvar varies: the points of a simple glyph, or the offsets of the components
+// of a composite glyph.
+func (o *glyphOutline) coordinates() ([]int, []int) {
+	if len(o.components) == 0 {
+		return append([]int(nil), o.xs...), append([]int(nil), o.ys...)
+	}
+	xs, ys := make([]int, len(o.components)), make([]int, len(o.components))
+	for i, c := range o.components {
+		if c.flags&argsAreXYValues != 0 {
+			xs[i], ys[i] = c.arg1, c.arg2
+		}
+	}
+	return xs, ys
+}
+
+// setCoordinates replaces the coordinates returned by coordinates.
+func (o *glyphOutline) setCoordinates(xs, ys []int) {
+	if len(o.components) == 0 {
+		o.xs, o.ys = xs, ys
+		return
+	}
+	for i := range o.components {
+		if o.components[i].flags&argsAreXYValues != 0 {
+			o.components[i].arg1, o.components[i].arg2 = xs[i], ys[i]
+		}
+	}
+}
+
+// decodeGlyph decodes a glyph of the glyf table. Empty glyphs have no data.
+func decodeGlyph(data []byte) (*glyphOutline, error) {
+	o := new(glyphOutline)
+	if len(data) == 0 {
+		return o, nil
+	}
+	if len(data) < 10 {
+		return nil, errors.New("glyph header is truncated")
+	}
+	numContours := int(int16(binary.BigEndian.Uint16(data)))
+	o.xMin = int(int16(binary.BigEndian.Uint16(data[2:])))
+	o.yMin = int(int16(binary.BigEndian.Uint16(data[4:])))
+	o.xMax = int(int16(binary.BigEndian.Uint16(data[6:])))
+	o.yMax = int(int16(binary.BigEndian.Uint16(data[8:])))
+	if numContours < 0 {
+		return o, decodeComponents(o, data)
+	}
+
+	truncated := errors.New("simple glyph is truncated")
+	pos := 10
+	if len(data) < pos+2*numContours+2 {
+		return nil, truncated
+	}
+	numPoints := 0
+	for i := 0; i < numContours; i++ {
+		end := int(binary.BigEndian.Uint16(data[pos+2*i:]))
+		if end < numPoints-1 {
+			return nil, errors.New("contour end points are not increasing")
+		}
+		o.contourEnds = append(o.contourEnds, end)
+		numPoints = end + 1
+	}
+	pos += 2 * numContours
+	length := int(binary.BigEndian.Uint16(data[pos:]))
+	pos += 2
+	if len(data) < pos+length {
+		return nil, truncated
+	}
+	o.instructions = data[pos : pos+length]
+	pos += length
+	flags := make([]byte, 0, numPoints)
+	for len(flags) < numPoints {
+		if len(data) < pos+1 {
+			return nil, truncated
+		}
+		flag := data[pos]
+		pos++
+		flags = append(flags, flag)
+		if flag&repeatFlag != 0 {
+			if len(data) < pos+1 {
+				return nil, truncated
+			}
+			for n := int(data[pos]); n > 0; n-- {
+				flags = append(flags, flag)
+			}
+			pos++
+		}
+	}
+	flags = flags[:numPoints]
+	decode := func(short, same byte) ([]int, error) {
+		values := make([]int, numPoints)
+		v := 0
+		for i, flag := range flags {
+			switch {
+			case flag&short != 0:
+				if len(data) < pos+1 {
+					return nil, truncated
+				}
+				if flag&same != 0 {
+					v += int(data[pos])
+				} else {
+					v -= int(data[pos])
+				}
+				pos++
+			case flag&same == 0:
+				if len(data) < pos+2 {
+					return nil, truncated
+				}
+				v += int(int16(binary.BigEndian.Uint16(data[pos:])))
+				pos += 2
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+	var err error
+	if o.xs, err = decode(xShortVector, xSameOrPositive); err != nil {
+		return nil, err
+	}
+	if o.ys, err = decode(yShortVector, ySameOrPositive); err != nil {
+		return nil, err
+	}
+	o.flags = make([]byte, numPoints)
+	for i, flag := range flags {
+		o.flags[i] = flag & (onCurvePoint | overlapSimple)
+	}
+	return o, nil
+}
+
+// decodeComponents decodes the components of a composite glyph.
+func decodeComponents(o *glyphOutline, data []byte) error {
+	truncated := errors.New("composite glyph is truncated")
+	pos := 10
+	for {
+		if len(data) < pos+4 {
+			return truncated
+		}
+		c := glyphComponent{flags: binary.BigEndian.Uint16(data[pos:]), glyph: binary.BigEndian.Uint16(data[pos+2:])}
+		pos += 4
+		xy := c.flags&argsAreXYValues != 0
+		if c.flags&argsAreWords != 0 {
+			if len(data) < pos+4 {
+				return truncated
+			}
+			if xy {
+				c.arg1, c.arg2 = int(int16(binary.BigEndian.Uint16(data[pos:]))), int(int16(binary.BigEndian.Uint16(data[pos+2:])))
+			} else {
+				c.arg1, c.arg2 = int(binary.BigEndian.Uint16(data[pos:])), int(binary.BigEndian.Uint16(data[pos+2:]))
+			}
+			pos += 4
+		} else {
+			if len(data) < pos+2 {
+				return truncated
+			}
+			if xy {
+				c.arg1, c.arg2 = int(int8(data[pos])), int(int8(data[pos+1]))
+			} else {
+				c.arg1, c.arg2 = int(data[pos]), int(data[pos+1])
+			}
+			pos += 2
+		}
+		size := 0
+		switch {
+		case c.flags&haveScale != 0:
+			size = 2
+		case c.flags&haveXYScale != 0:
+			size = 4
+		case c.flags&haveTwoByTwo != 0:
+			size = 8
+		}
+		if len(data) < pos+size {
+			return truncated
+		}
+		c.transform = data[pos : pos+size]
+		pos += size
+		o.components = append(o.components, c)
+		if c.flags&moreComponents == 0 {
+			break
+		}
+	}
+	if o.components[len(o.components)-1].flags&haveInstructions != 0 {
+		if len(data) < pos+2 {
+			return truncated
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if len(data) < pos+2+length {
+			return truncated
+		}
+		o.instructions = data[pos+2 : pos+2+length]
+	}
+	return nil
+}
+
+// encode encodes the glyph for the glyf table, with the bounding box of the outline.
+func (o *glyphOutline) encode() []byte {
+	if o.empty() {
+		return nil
+	}
+	var b bytes.Buffer
+	w := func(v interface{}) { _ = binary.Write(&b, binary.BigEndian, v) }
+	numContours := int16(len(o.contourEnds))
+	if len(o.components) > 0 {
+		numContours = -1
+	}
+	w([5]int16{numContours, int16(o.xMin), int16(o.yMin), int16(o.xMax), int16(o.yMax)})
+
+	if len(o.components) > 0 {
+		for i, c := range o.components {
+			flags := c.flags &^ (argsAreWords | moreComponents | haveInstructions)
+			if i < len(o.components)-1 {
+				flags |= moreComponents
+			} else if len(o.instructions) > 0 {
+				flags |= haveInstructions
+			}
+			words := c.arg1 < 0 || c.arg1 > 255 || c.arg2 < 0 || c.arg2 > 255
+			if flags&argsAreXYValues != 0 {
+				words = c.arg1 < -128 || c.arg1 > 127 || c.arg2 < -128 || c.arg2 > 127
+			}
+			if words {
+				flags |= argsAreWords
+			}
+			w([2]uint16{flags, c.glyph})
+			if words {
+				w([2]uint16{uint16(c.arg1), uint16(c.arg2)})
+			} else {
+				w([2]uint8{uint8(c.arg1), uint8(c.arg2)})
+			}
+			b.Write(c.transform)
+		}
+		if len(o.instructions) > 0 {
+			w(uint16(len(o.instructions)))
+			b.Write(o.instructions)
+		}
+		return b.Bytes()
+	}
+
+	for _, end := range o.contourEnds {
+		w(uint16(end))
+	}
+	w(uint16(len(o.instructions)))
+	b.Write(o.instructions)
+	flags := make([]byte, len(o.xs))
+	var xs, ys []byte
+	encode := func(values []int, i int, short, same byte, out []byte) []byte {
+		d := values[i]
+		if i > 0 {
+			d -= values[i-1]
+		}
+		switch {
+		case d == 0:
+			flags[i] |= same
+		case d >= -255 && d <= 255:
+			flags[i] |= short
+			if d > 0 {
+				flags[i] |= same
+			} else {
+				d = -d
+			}
+			out = append(out, byte(d))
+		default:
+			out = append(out, byte(uint16(d)>>8), byte(d))
+		}
+		return out
+	}
+	for i := range o.xs {
+		flags[i] = o.flags[i]
+		xs = encode(o.xs, i, xShortVector, xSameOrPositive, xs)
+		ys = encode(o.ys, i, yShortVector, ySameOrPositive, ys)
+	}
+	for i := 0; i < len(flags); {
+		run := 1
+		for i+run < len(flags) && flags[i+run] == flags[i] && run < 256 {
+			run++
+		}
+		if run > 2 {
+			b.Write([]byte{flags[i] | repeatFlag, byte(run - 1)})
+		} else {
+			b.Write(flags[i : i+run])
+		}
+		i += run
+	}
+	b.Write(xs)
+	b.Write(ys)
+	return b.Bytes()
+}
+
+// glyphBounds returns the bounding box of a glyph, resolving the components of composite glyphs.
+func glyphBounds(outlines []*glyphOutline, i int) (int, int, int, int) {
+	points := glyphPoints(outlines, i, 0)
+	if len(points) == 0 {
+		return 0, 0, 0, 0
+	}
+	xMin, yMin, xMax, yMax := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		xMin, yMin = math.Min(xMin, p[0]), math.Min(yMin, p[1])
+		xMax, yMax = math.Max(xMax, p[0]), math.Max(yMax, p[1])
+	}
+	return roundHalfUp(xMin), roundHalfUp(yMin), roundHalfUp(xMax), roundHalfUp(yMax)
+}
+
+// glyphPoints returns the points of a glyph, with the components of composite glyphs transformed and placed.
+func glyphPoints(outlines []*glyphOutline, i int, depth int) [][2]float64 {
+	if i >= len(outlines) || depth > 16 {
+		return nil
+	}
+	o := outlines[i]
+	var points [][2]float64
+	if len(o.components) == 0 {
+		for k := range o.xs {
+			points = append(points, [2]float64{float64(o.xs[k]), float64(o.ys[k])})
+		}
+		return points
+	}
+	for _, c := range o.components {
+		a, b, cc, d := 1.0, 0.0, 0.0, 1.0
+		switch {
+		case c.flags&haveScale != 0:
+			a = f2dot14Value(c.transform)
+			d = a
+		case c.flags&haveXYScale != 0:
+			a, d = f2dot14Value(c.transform), f2dot14Value(c.transform[2:])
+		case c.flags&haveTwoByTwo != 0:
+			a, b = f2dot14Value(c.transform), f2dot14Value(c.transform[2:])
+			cc, d = f2dot14Value(c.transform[4:]), f2dot14Value(c.transform[6:])
+		}
+		child := glyphPoints(outlines, int(c.glyph), depth+1)
+		for k, p := range child {
+			child[k] = [2]float64{a*p[0] + cc*p[1], b*p[0] + d*p[1]}
+		}
+		var dx, dy float64
+		if c.flags&argsAreXYValues != 0 {
+			dx, dy = float64(c.arg1), float64(c.arg2)
+		} else if c.arg1 < len(points) && c.arg2 < len(child) {
+			// The component is placed so that its point arg2 matches the point arg1 of the glyph so far
+			dx, dy = points[c.arg1][0]-child[c.arg2][0], points[c.arg1][1]-child[c.arg2][1]
+		}
+		for _, p := range child {
+			points = append(points, [2]float64{p[0] + dx, p[1] + dy})
+		}
+	}
+	return points
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,264 @@
+package generator
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// u16s encodes values as consecutive 16-bit big-endian fields; negative values are stored in two's complement.
+func u16s(values ...int) []byte {
+	b := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(b[2*i:], uint16(v))
+	}
+	return b
+}
+
+// u32s encodes values as consecutive 32-bit big-endian fields.
+func u32s(values ...int) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[4*i:], uint32(v))
+	}
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// testVariableFont returns a TrueType variable font with a wght axis from 100 to 900, whose default is 400, and two
+// glyphs: an empty .notdef and a square with the corners (100, 0), (100, 700), (500, 700), and (500, 0), an advance
+// of 600, and a left side bearing of 100. The gvar table of the square has two tuple variations:
+//
+//   - at wght 900 (+1), the deltas of every point: x -20, -20, +60, +60 and y 0, +50, +50, 0, and +80 for the advance
+//     phantom point, which makes the square wider and taller;
+//   - at wght 100 (-1), the x deltas +10 and -10 of points 0 and 2 only, so that points 1 and 3 are interpolated.
+//
+// The cvar table varies the cvt values 100 and 200 by +10 and -20 at wght 900, and the MVAR table varies the caret
+// offset of the hhea table by +40 at wght 900.
+func testVariableFont() *sfntFont {
+	head := make([]byte, 54)
+	copy(head, u16s(1, 0))
+	copy(head[18:], u16s(1000)) // unitsPerEm
+	copy(head[36:], u16s(100, 0, 500, 700))
+	hhea := make([]byte, 36)
+	copy(hhea, u16s(1, 0))
+	copy(hhea[34:], u16s(2)) // numberOfHMetrics
+
+	square := concat(
+		u16s(1, 100, 0, 500, 700), // numberOfContours and bounding box
+		u16s(3, 0),                // endPtsOfContours and instructionLength
+		[]byte{onCurvePoint, onCurvePoint, onCurvePoint, onCurvePoint},
+		u16s(100, 0, 400, 0),  // x deltas
+		u16s(0, 700, 0, -700), // y deltas
+	)
+	square = append(square, make([]byte, len(square)%4)...)
+
+	// The variation data of the square: two tuple variation headers with embedded peaks, then their serialized data
+	allPoints := concat([]byte{0x40 | 15}, u16s(-20, -20, 60, 60, 0, 80, 0, 0, 0, 50, 50, 0, 0, 0, 0, 0))
+	twoPoints := []byte{2, 0x01, 0, 2, 0x03, 10, 0xf6, 0, 0} // Points 0 and 2, then 4 byte-sized deltas
+	variations := concat(
+		u16s(2, 16),
+		u16s(len(allPoints), embeddedPeakTuple, 0x4000),
+		u16s(len(twoPoints), embeddedPeakTuple|privatePointNumbers, -0x4000),
+		allPoints, twoPoints,
+	)
+	variations = append(variations, make([]byte, len(variations)%2)...)
+	gvar := concat(
+		u16s(1, 0, 1, 0), u32s(26), // version, axisCount, sharedTupleCount, sharedTuplesOffset
+		u16s(2, 0), u32s(26), // glyphCount, flags (short offsets), glyphVariationDataArrayOffset
+		u16s(0, 0, len(variations)/2),
+		variations,
+	)
+
+	cvarData := []byte{0x01, 10, 0xec}
+	cvar := concat(u16s(1, 0, 1, 14), u16s(len(cvarData), embeddedPeakTuple, 0x4000), cvarData)
+
+	store := concat(
+		u16s(1), u32s(12), u16s(1), u32s(22), // format, regionListOffset, itemVariationDataCount, offset
+		u16s(1, 1, 0, 0x4000, 0x4000), // a region from 0 to +1 on the only axis, peaking at +1
+		u16s(1, 0, 1, 0), []byte{40},  // one item with a byte-sized delta for region 0
+	)
+	mvar := concat(u16s(1, 0, 0, 8, 1, 20), []byte("hcof"), u16s(0, 0), store)
+
+	fvar := concat(
+		u16s(1, 0, 16, 2, 1, 20, 0, 8),
+		[]byte("wght"), u32s(100<<16, 400<<16, 900<<16), u16s(0, 256),
+	)
+	return &sfntFont{version: "\x00\x01\x00\x00", tables: map[string][]byte{
+		"head": head,
+		"hhea": hhea,
+		"maxp": u16s(0, 0x5000, 2),
+		"hmtx": u16s(500, 0, 600, 100),
+		"loca": u16s(0, 0, len(square)/2),
+		"glyf": square,
+		"fvar": fvar,
+		"gvar": gvar,
+		"cvt ": u16s(100, 200),
+		"cvar": cvar,
+		"MVAR": mvar,
+	}}
+}
+
+// TestInstanceFont instances testVariableFont at several weights. The expected values were worked out by hand from the
+// OpenType algorithms that fontTools also implements: the location is normalized, each tuple variation applies with
+// the scalar of its region, the deltas of points that a tuple does not reference are interpolated from those of their
+// neighbors on the contour, and the results are rounded to integers.
+func TestInstanceFont(t *testing.T) {
+	for _, test := range []struct {
+		weight  float64
+		xs, ys  []int
+		advance int
+		bounds  [4]int // The bounding box of the head table
+		cvt     []int
+		caret   int
+	}{
+		// The default location leaves everything unchanged
+		{400, []int{100, 100, 500, 500}, []int{0, 700, 700, 0}, 600, [4]int{100, 0, 500, 700}, []int{100, 200}, 0},
+		// +1: the deltas of the first tuple apply in full
+		{900, []int{80, 80, 560, 560}, []int{0, 750, 750, 0}, 680, [4]int{80, 0, 560, 750}, []int{110, 180}, 40},
+		// +0.5: half of them
+		{650, []int{90, 90, 530, 530}, []int{0, 725, 725, 0}, 640, [4]int{90, 0, 530, 725}, []int{105, 190}, 20},
+		// Beyond the axis, the weight is clamped to 900
+		{1000, []int{80, 80, 560, 560}, []int{0, 750, 750, 0}, 680, [4]int{80, 0, 560, 750}, []int{110, 180}, 40},
+		// -0.5: half of the deltas of the second tuple, where point 1 takes the delta +10 of point 0, whose x it
+		// shares, and point 3 the delta -10 of point 2
+		{250, []int{105, 105, 495, 495}, []int{0, 700, 700, 0}, 600, [4]int{105, 0, 495, 700}, []int{100, 200}, 0},
+		// 0.6 is stored as 9830/16384, so the x delta of point 0 is -11.9995, which rounds to -12
+		{700, []int{88, 88, 536, 536}, []int{0, 730, 730, 0}, 648, [4]int{88, 0, 536, 730}, []int{106, 188}, 24},
+	} {
+		f := testVariableFont()
+		if err := instanceFont(f, map[string]float64{"wght": test.weight}); err != nil {
+			t.Fatalf("wght %v: %v", test.weight, err)
+		}
+		for _, tag := range variationTables {
+			if f.table(tag) != nil {
+				t.Errorf("wght %v: the %s table was kept", test.weight, tag)
+			}
+		}
+		loca, glyf := f.table("loca"), f.table("glyf")
+		if len(loca) != 12 {
+			t.Fatalf("wght %v: the loca table has %d bytes, expected the long format", test.weight, len(loca))
+		}
+		o, err := decodeGlyph(glyf[binary.BigEndian.Uint32(loca[4:]):binary.BigEndian.Uint32(loca[8:])])
+		if err != nil {
+			t.Fatalf("wght %v: %v", test.weight, err)
+		}
+		if !reflect.DeepEqual(o.xs, test.xs) || !reflect.DeepEqual(o.ys, test.ys) {
+			t.Errorf("wght %v: points are x %v y %v, expected x %v y %v", test.weight, o.xs, o.ys, test.xs, test.ys)
+		}
+		if bounds := [4]int{o.xMin, o.yMin, o.xMax, o.yMax}; bounds != test.bounds {
+			t.Errorf("wght %v: glyph bounds are %v, expected %v", test.weight, bounds, test.bounds)
+		}
+		hmtx := f.table("hmtx")
+		// The advances differ unless the instance is at the default location, so both glyphs keep a long metric
+		advance, lsb := int(binary.BigEndian.Uint16(hmtx[4:])), int(int16(binary.BigEndian.Uint16(hmtx[6:])))
+		if advance != test.advance || lsb != test.xs[0] {
+			t.Errorf("wght %v: advance %d and side bearing %d, expected %d and %d", test.weight, advance, lsb,
+				test.advance, test.xs[0])
+		}
+		if max := int(binary.BigEndian.Uint16(f.table("hhea")[10:])); max != test.advance {
+			t.Errorf("wght %v: advanceWidthMax is %d, expected %d", test.weight, max, test.advance)
+		}
+		head := f.table("head")
+		var bounds [4]int
+		for k := range bounds {
+			bounds[k] = int(int16(binary.BigEndian.Uint16(head[36+2*k:])))
+		}
+		if bounds != test.bounds {
+			t.Errorf("wght %v: font bounds are %v, expected %v", test.weight, bounds, test.bounds)
+		}
+		cvt := f.table("cvt ")
+		got := []int{int(int16(binary.BigEndian.Uint16(cvt))), int(int16(binary.BigEndian.Uint16(cvt[2:])))}
+		if !reflect.DeepEqual(got, test.cvt) {
+			t.Errorf("wght %v: cvt values are %v, expected %v", test.weight, got, test.cvt)
+		}
+		if caret := int(int16(binary.BigEndian.Uint16(f.table("hhea")[22:]))); caret != test.caret {
+			t.Errorf("wght %v: caret offset is %d, expected %d", test.weight, caret, test.caret)
+		}
+	}
+}
+
+func TestNormalizeLocation(t *testing.T) {
+	axes := []variationAxis{{"wght", 100, 400, 900}, {"wdth", 62.5, 100, 100}}
+	// Maps -1, 0, +0.5, and +1 of the wght axis to -1, 0, +0.8, and +1, and leaves the wdth axis alone
+	avar := concat(u16s(1, 0, 0, 2), u16s(4, -0x4000, -0x4000, 0, 0, 0x2000, 0x3333, 0x4000, 0x4000), u16s(0))
+	for _, test := range []struct {
+		location map[string]float64
+		avar     []byte
+		expected []float64
+	}{
+		{map[string]float64{}, nil, []float64{0, 0}},
+		{map[string]float64{"wght": 100, "wdth": 62.5}, nil, []float64{-1, -1}},
+		{map[string]float64{"wght": 250, "wdth": 75}, nil, []float64{-0.5, roundF2Dot14(-2.0 / 3)}},
+		{map[string]float64{"wght": 50, "wdth": 150}, nil, []float64{-1, 0}},
+		{map[string]float64{"wght": 650}, avar, []float64{roundF2Dot14(0x3333 / 16384.0), 0}},
+		// Halfway between +0.5 and +1, which map to +0.8 and +1
+		{map[string]float64{"wght": 775}, avar, []float64{roundF2Dot14((0x3333/16384.0 + 1) / 2), 0}},
+		{map[string]float64{"wght": 250}, avar, []float64{-0.5, 0}},
+	} {
+		coords, err := normalizeLocation(axes, test.location, test.avar)
+		if err != nil {
+			t.Fatalf("%v: %v", test.location, err)
+		}
+		if !reflect.DeepEqual(coords, test.expected) {
+			t.Errorf("%v (avar %t): normalized to %v, expected %v", test.location, test.avar != nil, coords, test.expected)
+		}
+	}
+	if _, err := normalizeLocation(axes, nil, avar[:10]); err == nil {
+		t.Error("a truncated avar table was accepted")
+	}
+}
+
+func TestRegionScalar(t *testing.T) {
+	for _, test := range []struct {
+		coords, peak, start, end []float64
+		expected                 float64
+	}{
+		{[]float64{1}, []float64{1}, nil, nil, 1},
+		{[]float64{0.25}, []float64{1}, nil, nil, 0.25},
+		{[]float64{-0.25}, []float64{1}, nil, nil, 0},
+		{[]float64{-0.5}, []float64{-1}, nil, nil, 0.5},
+		// Axes on which the region does not peak do not restrict it
+		{[]float64{0.5, -1}, []float64{1, 0}, nil, nil, 0.5},
+		// The scalars of the axes multiply
+		{[]float64{0.5, 0.5}, []float64{1, 1}, nil, nil, 0.25},
+		// An intermediate region from 0.2 to 1 that peaks at 0.6
+		{[]float64{0.4}, []float64{0.6}, []float64{0.2}, []float64{1}, 0.5},
+		{[]float64{0.8}, []float64{0.6}, []float64{0.2}, []float64{1}, 0.5},
+		{[]float64{0.1}, []float64{0.6}, []float64{0.2}, []float64{1}, 0},
+	} {
+		if s := regionScalar(test.coords, test.peak, test.start, test.end); math.Abs(s-test.expected) > 1e-9 {
+			t.Errorf("regionScalar(%v, %v, %v, %v) = %v, expected %v", test.coords, test.peak, test.start, test.end, s,
+				test.expected)
+		}
+	}
+}
+
+func TestInstanceFontErrors(t *testing.T) {
+	f := testVariableFont()
+	delete(f.tables, "fvar")
+	if err := instanceFont(f, nil); err == nil {
+		t.Error("a font without axes was instanced")
+	}
+	// Every truncation of the gvar table either fails or leaves the glyphs without variations; none may panic
+	gvar := testVariableFont().table("gvar")
+	for n := 0; n < len(gvar); n++ {
+		f := testVariableFont()
+		f.tables["gvar"] = gvar[:n]
+		_ = instanceFont(f, map[string]float64{"wght": 900})
+	}
+	mvar := testVariableFont().table("MVAR")
+	for n := 0; n < len(mvar); n++ {
+		f := testVariableFont()
+		f.tables["MVAR"] = mvar[:n]
+		_ = instanceFont(f, map[string]float64{"wght": 900})
+	}
+}
@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// selectInteractively prints the families and weights found in the input ZIP and lets the user toggle which of the
+// available packages to generate. It returns the selected packages in their original order once the user confirms
+// the selection.
+func selectInteractively(in io.Reader, out io.Writer, sourcePaths []string, noIndex bool, skip []string, preferHinted bool, available []outputFamily) ([]outputFamily, error) {
+	inventory, err := scanInput(sourcePaths, noIndex, skip, preferHinted, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]map[string]bool)
+	for _, f := range inventory.Fonts {
+		if found[f.Family] == nil {
+			found[f.Family] = make(map[string]bool)
+		}
+		found[f.Family][f.Weight] = true
+	}
+	_, _ = fmt.Fprintf(out, "The input ZIP contains %d fonts in %d languages:\n", len(inventory.Fonts), len(inventory.Languages))
+	for _, family := range families {
+		if found[family] == nil {
+			continue
+		}
+		var familyWeights []string
+		for _, w := range weights {
+			if found[family][w] {
+				familyWeights = append(familyWeights, w)
+			}
+		}
+		_, _ = fmt.Fprintf(out, "  %-14s %s\n", family, strings.Join(familyWeights, ", "))
+	}
+
+	selected := make([]bool, len(available))
+	for i := range selected {
+		selected[i] = true
+	}
+	scanner := bufio.NewScanner(in)
+	for {
+		_, _ = fmt.Fprintf(out, "\nPackages to generate:\n")
+		for i, f := range available {
+			mark := " "
+			if selected[i] {
+				mark = "x"
+			}
+			_, _ = fmt.Fprintf(out, "  [%s] %3d %-32s %s\n", mark, i+1, f.name, familyDisplayName(f))
+		}
+		_, _ = fmt.Fprintf(out, "Enter numbers or ranges (e.g. 1,3-5) to toggle, a for all, n for none, or an empty line to start: ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("no selection was confirmed")
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+			var out []outputFamily
+			for i, f := range available {
+				if selected[i] {
+					out = append(out, f)
+				}
+			}
+			if len(out) == 0 {
+				return nil, errors.New("no packages were selected")
+			}
+			return out, nil
+		case "a", "n":
+			for i := range selected {
+				selected[i] = line == "a"
+			}
+			continue
+		}
+		toggle, err := parseSelection(line, len(available))
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "%s\n", err.Error())
+			continue
+		}
+		for _, i := range toggle {
+			selected[i] = !selected[i]
+		}
+	}
+}
+
+// parseSelection parses a comma-separated list of 1-based numbers and ranges of numbers, such as "1,3-5", into the
+// sorted 0-based indices that they select.
+func parseSelection(s string, n int) ([]int, error) {
+	indices := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection %q", part)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, fmt.Errorf("invalid selection %q", part)
+			}
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("selection %q is not between 1 and %d", part, n)
+		}
+		for i := first; i <= last; i++ {
+			indices[i-1] = true
+		}
+	}
+	out := make([]int, 0, len(indices))
+	for i := range indices {
+		out = append(out, i)
+	}
+	sort.Ints(out)
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+// scriptReaders estimates the number of people who read the script of each language of the Noto fonts, in thousands,
+// so that -top-langs and the Scripts function of the generated packages can rank the scripts. Languages that are not
+// listed rank after all listed ones. The default language, which covers the Latin, Greek, and Cyrillic scripts, is
+// always merged and is not ranked.
+var scriptReaders = map[string]int{
+	"CJKsc": 1100000, "Arabic": 660000, "Devanagari": 610000, "Bengali": 300000, "CJKjp": 125000, "Telugu": 95000,
+	"CJKkr": 80000, "Tamil": 78000, "Gujarati": 60000, "Thai": 58000, "Kannada": 45000, "Oriya": 38000,
+	"Malayalam": 37000, "Myanmar": 33000, "CJKtc": 30000, "Gurmukhi": 29000, "Ethiopic": 28000, "Sinhala": 17000,
+	"Khmer": 16000, "Hebrew": 9000, "CJKhk": 7500, "Armenian": 6000, "Tibetan": 5000, "Georgian": 4000, "Lao": 3500,
+	"Tifinagh": 3000, "OlChiki": 2000, "Mongolian": 1500, "Syriac": 1000, "Yi": 900, "Javanese": 800,
+	"Sundanese": 700, "Balinese": 600, "MeeteiMayek": 500, "Chakma": 400, "Thaana": 350, "Adlam": 300, "NKo": 250,
+	"Vai": 100, "CanadianAboriginal": 50, "Cherokee": 20, "Lisu": 10, "Osage": 1,
+}
+
+// rankLanguages sorts languages by scriptReaders, most readers first. Languages with the same number of readers, such
+// as those that are not listed, keep their order.
+func rankLanguages(languages []string) {
+	sort.SliceStable(languages, func(i, j int) bool { return scriptReaders[languages[i]] > scriptReaders[languages[j]] })
+}
+
+// filterLanguages applies the -include-languages and -exclude-languages patterns to the languages found in the input.
+// Patterns use path.Match syntax and are matched against the language names that appear in the font file names, such
+// as "Devanagari" or "CJKjp". The default language ("") is always kept because it provides the basic Latin glyphs.
+func filterLanguages(languages []string, include []string, exclude []string) []string {
+	matched := make(map[string]bool)
+	matches := func(patterns []string, l string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, l); ok {
+				matched[p] = true
+				return true
+			}
+		}
+		return false
+	}
+	var out []string
+	for _, l := range languages {
+		if l != "" {
+			if len(include) > 0 && !matches(include, l) {
+				continue
+			}
+			if matches(exclude, l) {
+				continue
+			}
+		}
+		out = append(out, l)
+	}
+	for _, p := range append(append([]string(nil), include...), exclude...) {
+		if !matched[p] {
+			runWarnings.warnf(warnInput, severityMinor, "", "language pattern %q does not match any language in the input", p)
+		}
+	}
+	return out
+}
+
+// validateLanguagePatterns returns an error if any of the patterns is malformed.
+func validateLanguagePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid language pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// prioritizeLanguages moves the languages matching the patterns of priority before the others, in the order of the
+// patterns, so that their fonts come first in fallback order and win the characters that they share with other
+// languages, as CJKtc and CJKjp share Han ideographs with CJKsc. The other languages keep their order, as do the
+// languages matching the same pattern, and the default language stays first.
+func prioritizeLanguages(languages []string, priority []string) []string {
+	if len(priority) == 0 {
+		return languages
+	}
+	rank := func(l string) int {
+		if l == "" {
+			return -1
+		}
+		for i, p := range priority {
+			if ok, _ := path.Match(p, l); ok {
+				return i
+			}
+		}
+		return len(priority)
+	}
+	out := append([]string(nil), languages...)
+	sort.SliceStable(out, func(i, j int) bool { return rank(out[i]) < rank(out[j]) })
+	return out
+}
+
+// topLanguages keeps the default language and the n languages of languages with the most readers among those with
+// fonts in available, which are the fonts of one input family by language, so that each package gets the n most
+// widely read scripts that its family covers. The languages keep their order.
+func topLanguages(languages []string, available map[string][]*fontDesc, n int) []string {
+	var candidates []string
+	for _, l := range languages {
+		if l != "" && len(available[l]) > 0 {
+			candidates = append(candidates, l)
+		}
+	}
+	rankLanguages(candidates)
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	kept := make(map[string]bool)
+	for _, l := range candidates {
+		kept[l] = true
+	}
+	var out []string
+	for _, l := range languages {
+		if l == "" || kept[l] {
+			out = append(out, l)
+		}
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package generator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+)
+
+// lineMetricsTolerance is how far, in ems, the ascender or descender of a member font may exceed that of the base
+// font before checkLineMetrics reports it.
+const lineMetricsTolerance = 0.1
+
+// lineMetrics returns the ascender and descender of the hhea table of a font in ems. The descender is positive below
+// the baseline.
+func (f *sfntFont) lineMetrics() (ascender float64, descender float64, ok bool) {
+	head, hhea := f.table("head"), f.table("hhea")
+	if len(head) < 20 || len(hhea) < 8 {
+		return 0, 0, false
+	}
+	unitsPerEm := float64(binary.BigEndian.Uint16(head[18:]))
+	if unitsPerEm == 0 {
+		return 0, 0, false
+	}
+	ascender = float64(int16(binary.BigEndian.Uint16(hhea[4:]))) / unitsPerEm
+	descender = -float64(int16(binary.BigEndian.Uint16(hhea[6:]))) / unitsPerEm
+	return ascender, descender, true
+}
+
+// checkLineMetrics reports the member fonts of the merged collection whose ascender or descender exceeds that of the
+// base font by more than lineMetricsTolerance. Applications size lines by the base font, so text in those fonts is
+// clipped or overlaps the adjacent lines, which becomes noticeable at large text sizes. The collection members must
+// correspond one-to-one with sourceFonts.
+func checkLineMetrics(merged []byte, sourceFonts []*fontDesc) ([]string, error) {
+	members, err := parseFontCollection(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merged font collection: %w", err)
+	}
+	if len(members) != len(sourceFonts) || len(members) == 0 {
+		return nil, fmt.Errorf("merged font collection has %d fonts, expected %d", len(members), len(sourceFonts))
+	}
+	baseAscender, baseDescender, ok := members[0].lineMetrics()
+	if !ok {
+		return nil, fmt.Errorf("%s has no line metrics", path.Base(sourceFonts[0].filename))
+	}
+	var problems []string
+	for i, m := range members[1:] {
+		ascender, descender, ok := m.lineMetrics()
+		if !ok {
+			continue
+		}
+		if ascender > baseAscender+lineMetricsTolerance || descender > baseDescender+lineMetricsTolerance {
+			problems = append(problems, fmt.Sprintf("%s has taller line metrics (ascender %.2f em, descender %.2f em) "+
+				"than the base font (%.2f em, %.2f em)", path.Base(sourceFonts[i+1].filename), ascender, descender,
+				baseAscender, baseDescender))
+		}
+	}
+	return problems, nil
+}
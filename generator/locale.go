@@ -0,0 +1,194 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localeHelperFile is the name of the generated file that maps Accept-Language headers to the fonts of a package.
+const localeHelperFile = "locales.go"
+
+// arabicLanguages are the Noto languages and families that cover the Arabic script, in order of preference.
+var arabicLanguages = []string{"Arabic", "NaskhArabic", "KufiArabic", "NastaliqUrdu"}
+
+// localeLanguages maps locales to the Noto languages whose fonts render them, in order of preference. The keys are
+// language subtags such as "hi", ISO 15924 script subtags such as "Deva", or either followed by a region subtag, such
+// as "zh-TW". Locales written in the Latin, Greek, or Cyrillic scripts have no entry, since the base font covers them.
+var localeLanguages = map[string][]string{
+	// Languages
+	"am": {"Ethiopic"}, "ar": arabicLanguages, "as": {"Bengali"}, "bn": {"Bengali"}, "bo": {"Tibetan"},
+	"brx": {"Devanagari"}, "ccp": {"Chakma"}, "chr": {"Cherokee"}, "ckb": arabicLanguages, "cr": {"CanadianAboriginal"},
+	"doi": {"Devanagari"}, "dv": {"Thaana"}, "dz": {"Tibetan"}, "fa": arabicLanguages, "gu": {"Gujarati"},
+	"he": {"Hebrew"}, "hi": {"Devanagari"}, "hy": {"Armenian"}, "ii": {"Yi"}, "iu": {"CanadianAboriginal"},
+	"iw": {"Hebrew"}, "ja": {"CJKjp"}, "ka": {"Georgian"}, "km": {"Khmer"}, "kn": {"Kannada"}, "ko": {"CJKkr"},
+	"kok": {"Devanagari"}, "ks": arabicLanguages, "lo": {"Lao"}, "mai": {"Devanagari"}, "ml": {"Malayalam"},
+	"mr": {"Devanagari"}, "my": {"Myanmar"}, "ne": {"Devanagari"}, "nqo": {"NKo"}, "or": {"Oriya"}, "osa": {"Osage"},
+	"pa": {"Gurmukhi"}, "pa-PK": arabicLanguages, "ps": arabicLanguages, "sa": {"Devanagari"}, "sat": {"OlChiki"},
+	"sd": arabicLanguages, "si": {"Sinhala"}, "syr": {"Syriac"}, "ta": {"Tamil"}, "te": {"Telugu"}, "th": {"Thai"},
+	"ti": {"Ethiopic"}, "tzm": {"Tifinagh"}, "ug": arabicLanguages, "ur": {"NastaliqUrdu", "Arabic", "NaskhArabic", "KufiArabic"},
+	"vai": {"Vai"}, "yi": {"Hebrew"}, "yue": {"CJKhk", "CJKtc"}, "zgh": {"Tifinagh"}, "zh": {"CJKsc"},
+	"zh-HK": {"CJKhk", "CJKtc"}, "zh-MO": {"CJKhk", "CJKtc"}, "zh-TW": {"CJKtc"},
+
+	// Scripts
+	"Adlm": {"Adlam"}, "Arab": arabicLanguages, "Armn": {"Armenian"}, "Bali": {"Balinese"}, "Bamu": {"Bamum"},
+	"Batk": {"Batak"}, "Beng": {"Bengali"}, "Bugi": {"Buginese"}, "Cakm": {"Chakma"}, "Cans": {"CanadianAboriginal"},
+	"Cham": {"Cham"}, "Cher": {"Cherokee"}, "Deva": {"Devanagari"}, "Ethi": {"Ethiopic"}, "Geor": {"Georgian"},
+	"Gujr": {"Gujarati"}, "Guru": {"Gurmukhi"}, "Hang": {"CJKkr"}, "Hans": {"CJKsc"}, "Hant": {"CJKtc"},
+	"Hant-HK": {"CJKhk", "CJKtc"}, "Hant-MO": {"CJKhk", "CJKtc"}, "Hebr": {"Hebrew"}, "Hira": {"CJKjp"},
+	"Java": {"Javanese"}, "Jpan": {"CJKjp"}, "Kali": {"KayahLi"}, "Kana": {"CJKjp"}, "Khmr": {"Khmer"},
+	"Knda": {"Kannada"}, "Kore": {"CJKkr"}, "Laoo": {"Lao"}, "Lepc": {"Lepcha"}, "Limb": {"Limbu"}, "Lisu": {"Lisu"},
+	"Mlym": {"Malayalam"}, "Mong": {"Mongolian"}, "Mtei": {"MeeteiMayek"}, "Mymr": {"Myanmar"}, "Newa": {"Newa"},
+	"Nkoo": {"NKo"}, "Olck": {"OlChiki"}, "Orya": {"Oriya"}, "Osge": {"Osage"}, "Rohg": {"HanifiRohingya"},
+	"Saur": {"Saurashtra"}, "Sinh": {"Sinhala"}, "Sund": {"Sundanese"}, "Sylo": {"SylotiNagri"}, "Syrc": {"Syriac"},
+	"Talu": {"NewTaiLue"}, "Taml": {"Tamil"}, "Tavt": {"TaiViet"}, "Telu": {"Telugu"}, "Tfng": {"Tifinagh"},
+	"Tglg": {"Tagalog"}, "Thaa": {"Thaana"}, "Thai": {"Thai"}, "Tibt": {"Tibetan"}, "Vaii": {"Vai"},
+	"Wcho": {"Wancho"}, "Yiii": {"Yi"},
+}
+
+// firstFonts returns the index in the merged collection of the first font of each language of the source fonts other
+// than the base font, which is the font that renders the language. Fonts of the default language of a family, such as
+// those of the Arabic combo families, are known by the name of the family.
+func firstFonts(sourceFonts []*fontDesc) map[string]int {
+	first := make(map[string]int)
+	for i := len(sourceFonts) - 1; i > 0; i-- {
+		name := sourceFonts[i].language
+		if name == "" {
+			name = sourceFonts[i].family
+		}
+		first[name] = i
+	}
+	return first
+}
+
+// localeFonts returns the index in the merged collection of the font that renders each locale of localeLanguages,
+// for the locales that the source fonts cover.
+func localeFonts(sourceFonts []*fontDesc) map[string]int {
+	first := firstFonts(sourceFonts)
+	fonts := make(map[string]int)
+	for locale, languages := range localeLanguages {
+		for _, l := range languages {
+			if i, ok := first[l]; ok {
+				fonts[locale] = i
+				break
+			}
+		}
+	}
+	return fonts
+}
+
+// generateLocaleHelper writes locales.go, whose LocaleFonts function returns the fonts of the collection that are
+// needed to render the languages of an HTTP Accept-Language header, so that servers that render documents or images
+// for a request can load only those fonts. Stale copies from runs without -locale-helper are removed by
+// removeLocaleHelper.
+func generateLocaleHelper(packageName string, sink fileSink, description string, sourceFonts []*fontDesc, opts *generateOptions) error {
+	header, err := goFileHeader(opts, headerData{File: localeHelperFile, Package: packageName, Description: description, Notice: fontNotice(opts.rebrand)})
+	if err != nil {
+		return err
+	}
+	fonts := localeFonts(sourceFonts)
+	locales := make([]string, 0, len(fonts))
+	for l := range fonts {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	var entries strings.Builder
+	for _, l := range locales {
+		fmt.Fprintf(&entries, "\t%s: %d,\n", strconv.Quote(l), fonts[l])
+	}
+	if err := sink.writeString(localeHelperFile, header+`package `+packageName+`
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localeFonts maps language subtags, script subtags, and either followed by a region subtag to the index of the font
+// of the collection that renders them. Locales that the first font covers have no entry.
+var localeFonts = map[string]int{
+`+entries.String()+`}
+
+// LocaleFonts returns the indices of the fonts of the collection returned by OTC that are needed to render text in the
+// languages of an HTTP Accept-Language header, such as "zh-TW,zh;q=0.9,en;q=0.8", in increasing order. The first
+// font, which covers the Latin, Greek, and Cyrillic scripts, is always included. Languages that are not recognized
+// and languages with a quality of 0 are ignored.
+//
+// The fonts can be loaded individually with the Font method of a golang.org/x/image/font/sfnt Collection, so that
+// servers that render documents or images for a request only load the fonts of its languages.
+func LocaleFonts(acceptLanguage string) []int {
+	fonts := []int{0}
+	for _, entry := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(entry, ";")
+		if rejected(params[1:]) {
+			continue
+		}
+		i, ok := localeFont(strings.TrimSpace(params[0]))
+		if !ok {
+			continue
+		}
+		if j := sort.SearchInts(fonts, i); j == len(fonts) || fonts[j] != i {
+			fonts = append(fonts, 0)
+			copy(fonts[j+1:], fonts[j:])
+			fonts[j] = i
+		}
+	}
+	return fonts
+}
+
+// rejected reports whether the parameters of a language range give it a quality of 0.
+func rejected(params []string) bool {
+	for _, p := range params {
+		p = strings.TrimSpace(p)
+		if len(p) > 2 && (p[0] == 'q' || p[0] == 'Q') && p[1] == '=' {
+			q, err := strconv.ParseFloat(p[2:], 64)
+			return err == nil && q <= 0
+		}
+	}
+	return false
+}
+
+// localeFont returns the index of the font that renders a language tag, such as "zh-Hant-HK" or "pa_PK".
+func localeFont(tag string) (int, bool) {
+	subtags := strings.FieldsFunc(tag, func(r rune) bool { return r == '-' || r == '_' })
+	if len(subtags) == 0 {
+		return 0, false
+	}
+	language := strings.ToLower(subtags[0])
+	var script, region string
+	for _, s := range subtags[1:] {
+		switch {
+		case len(s) == 4 && script == "" && region == "":
+			script = strings.ToUpper(s[:1]) + strings.ToLower(s[1:])
+		case (len(s) == 2 || len(s) == 3 && s[0] >= '0' && s[0] <= '9') && region == "":
+			region = strings.ToUpper(s)
+		}
+	}
+	keys := []string{language + "-" + region, language}
+	if script != "" {
+		keys = []string{script + "-" + region, script}
+	}
+	for _, k := range keys {
+		if i, ok := localeFonts[k]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+`); err != nil {
+		return fmt.Errorf("failed to write locale helper: %w", err)
+	}
+	return nil
+}
+
+// removeLocaleHelper removes the locale helper that a previous run with -locale-helper wrote to the package in
+// outputDir.
+func removeLocaleHelper(outputDir string) error {
+	if err := os.Remove(filepath.Join(outputDir, localeHelperFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete stale locale helper: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// sourceURLSuffix is appended to the path of an archive downloaded by the fetch command to name the file that records
+// its URL, which the lockfile copies.
+const sourceURLSuffix = ".url"
+
+// lockfile records the inputs of a run and the packages generated from them, so that a later run with the same
+// lockfile can show that it regenerated byte-identical packages from the same inputs. It is written by -lock when the
+// file does not exist yet or with -update-lock, and checked otherwise.
+type lockfile struct {
+	Hash     string        `json:"hash,omitempty"` // The -hash algorithm of the checksums; older lockfiles use sha256
+	Inputs   []lockInput   `json:"inputs"`
+	Packages []lockPackage `json:"packages"` // Sorted by name
+}
+
+type lockInput struct {
+	Path      string `json:"path"`          // The input as given on the command line
+	URL       string `json:"url,omitempty"` // The URL from which gonoto fetch downloaded the archive, if known
+	checksums        // The checksum of the archive; not set for directories
+}
+
+type lockPackage struct {
+	Name      string     `json:"name"`
+	checksums            // The checksum of the merged collection
+	Fonts     []lockFont `json:"fonts"` // The source fonts, in fallback order
+}
+
+type lockFont struct {
+	Filename string `json:"filename"`
+	checksums
+}
+
+// readLockfile reads the lockfile at path. It returns nil if the file does not exist.
+func readLockfile(path string) (*lockfile, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l lockfile
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	return &l, nil
+}
+
+// lockInputs records the inputs of a run. Archives are hashed as a whole, including the downloaded archives of git
+// inputs; the fonts of directories and downloads from Google Fonts are only covered by the hashes of the source fonts
+// of each package.
+func lockInputs(sourcePaths []string, h *hashAlgorithm) ([]lockInput, error) {
+	inputs := make([]lockInput, len(sourcePaths))
+	for i, p := range sourcePaths {
+		inputs[i].Path = p
+		if p == stdinInput || strings.HasPrefix(p, googleFontsScheme) {
+			continue
+		}
+		if strings.HasPrefix(p, gitScheme) {
+			archive, err := downloadGitArchive(p)
+			if err != nil {
+				return nil, err
+			}
+			sum, err := h.sumFile(archive)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash input %s: %w", p, err)
+			}
+			inputs[i].set(h, sum)
+			inputs[i].URL, _ = gitArchiveURL(p)
+			continue
+		}
+		if fi, err := os.Stat(p); err != nil || fi.IsDir() {
+			continue
+		}
+		sum, err := h.sumFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash input %s: %w", p, err)
+		}
+		inputs[i].set(h, sum)
+		if url, err := ioutil.ReadFile(p + sourceURLSuffix); err == nil {
+			inputs[i].URL = strings.TrimSpace(string(url))
+		}
+	}
+	return inputs, nil
+}
+
+// checkLockInputs returns an error if the inputs of a run differ from those recorded in the lockfile, or if the
+// lockfile records its checksums in another algorithm than h.
+func checkLockInputs(l *lockfile, path string, sourcePaths []string, h *hashAlgorithm) error {
+	if locked, err := findHash(l.Hash); err != nil {
+		return fmt.Errorf("invalid lockfile %s: %w", path, err)
+	} else if locked != h {
+		return fmt.Errorf("%s records %s checksums, but the run uses -hash %s; use -update-lock to rewrite it",
+			path, locked.label, h.name)
+	}
+	inputs, err := lockInputs(sourcePaths, h)
+	if err != nil {
+		return err
+	}
+	if len(inputs) != len(l.Inputs) {
+		return fmt.Errorf("%s records %d inputs, but %d were given", path, len(l.Inputs), len(inputs))
+	}
+	for i, in := range inputs {
+		if locked := l.Inputs[i]; in.get(h) != locked.get(h) {
+			return fmt.Errorf("input %s differs from %s in %s (%s %s, expected %s); use -update-lock to accept it",
+				in.Path, locked.Path, path, h.label, in.get(h), locked.get(h))
+		}
+	}
+	return nil
+}
+
+// newLockfile records the inputs of a run and the packages generated from them.
+func newLockfile(sourcePaths []string, results []*manifestPackage, h *hashAlgorithm) (*lockfile, error) {
+	inputs, err := lockInputs(sourcePaths, h)
+	if err != nil {
+		return nil, err
+	}
+	l := &lockfile{Hash: h.name, Inputs: inputs}
+	for _, r := range results {
+		p := lockPackage{Name: r.Name, checksums: r.checksums}
+		for _, f := range r.Fonts {
+			p.Fonts = append(p.Fonts, lockFont{Filename: f.Filename, checksums: f.checksums})
+		}
+		l.Packages = append(l.Packages, p)
+	}
+	sort.Slice(l.Packages, func(i, j int) bool { return l.Packages[i].Name < l.Packages[j].Name })
+	return l, nil
+}
+
+// writeLockfile writes the lockfile to path.
+func writeLockfile(l *lockfile, path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	log.infof("Recorded the inputs and %d packages in %s", len(l.Packages), path)
+	return nil
+}
+
+// checkLockPackages returns an error if any generated package differs from the package of the same name in the
+// lockfile, either in its source fonts or in its merged collection. Packages that the lockfile does not record are
+// errors as well.
+func checkLockPackages(l *lockfile, path string, results []*manifestPackage, h *hashAlgorithm) error {
+	locked := make(map[string]*lockPackage)
+	for i := range l.Packages {
+		locked[l.Packages[i].Name] = &l.Packages[i]
+	}
+	var differ []string
+	for _, r := range results {
+		problem := ""
+		p := locked[r.Name]
+		switch {
+		case p == nil:
+			problem = "not recorded"
+		case len(p.Fonts) != len(r.Fonts):
+			problem = fmt.Sprintf("%d source fonts, expected %d", len(r.Fonts), len(p.Fonts))
+		default:
+			for i, f := range r.Fonts {
+				if f.Filename != p.Fonts[i].Filename || f.get(h) != p.Fonts[i].get(h) {
+					problem = fmt.Sprintf("source font %d is %s (%s %s), expected %s (%s %s)",
+						i, f.Filename, h.label, f.get(h), p.Fonts[i].Filename, h.label, p.Fonts[i].get(h))
+					break
+				}
+			}
+			if problem == "" && r.get(h) != p.get(h) {
+				problem = fmt.Sprintf("merged collection has %s %s, expected %s", h.label, r.get(h), p.get(h))
+			}
+		}
+		if problem != "" {
+			log.errorf("%s: %s in %s", r.Name, problem, path)
+			differ = append(differ, r.Name)
+		}
+	}
+	if len(differ) > 0 {
+		sort.Strings(differ)
+		return fmt.Errorf("%d of %d packages differ from %s: %s", len(differ), len(results), path, strings.Join(differ, ", "))
+	}
+	log.infof("All %d packages match %s", len(results), path)
+	return nil
+}
@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// logLevel is the severity of a log message. Messages below the level of the logger are discarded.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = map[logLevel]string{levelDebug: "debug", levelInfo: "info", levelWarn: "warn", levelError: "error"}
+
+// logPrefixes are printed in front of the messages of each level in text mode, matching the messages that gonoto has
+// always printed.
+var logPrefixes = map[logLevel]string{levelWarn: "Warning: ", levelError: "Error: "}
+
+// logger writes the progress messages of the commands, either as text or as one JSON object per line. The results of
+// commands such as list and verify are not log messages and are always printed as text.
+type logger struct {
+	lock  sync.Mutex
+	w     io.Writer
+	level logLevel
+	json  bool
+}
+
+// log is the logger used by all commands. It is configured by logFlags.
+var log = &logger{w: os.Stdout, level: levelInfo}
+
+func (l *logger) logf(level logLevel, format string, a ...interface{}) {
+	if level < l.level {
+		return
+	}
+	msg := fmt.Sprintf(format, a...)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.json {
+		_, _ = fmt.Fprintln(l.w, logPrefixes[level]+msg)
+		return
+	}
+	line, _ := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{time.Now().UTC().Format(time.RFC3339Nano), logLevelNames[level], msg})
+	_, _ = l.w.Write(append(line, '\n'))
+}
+
+func (l *logger) debugf(format string, a ...interface{}) { l.logf(levelDebug, format, a...) }
+func (l *logger) infof(format string, a ...interface{})  { l.logf(levelInfo, format, a...) }
+func (l *logger) warnf(format string, a ...interface{})  { l.logf(levelWarn, format, a...) }
+func (l *logger) errorf(format string, a ...interface{}) { l.logf(levelError, format, a...) }
+
+// logFlags holds the flags that configure the logger.
+type logFlags struct {
+	quiet   bool
+	verbose bool
+	json    bool
+}
+
+func (lf *logFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&lf.quiet, "quiet", false, "only log warnings and errors")
+	fs.BoolVar(&lf.verbose, "verbose", false, "log additional details, such as the order in which packages are generated")
+	fs.BoolVar(&lf.verbose, "v", false, "shorthand for -verbose")
+	fs.BoolVar(&lf.json, "log-json", false, "log one JSON object per line with time, level, and msg fields")
+}
+
+// apply configures the logger from the flags.
+func (lf *logFlags) apply() error {
+	if lf.quiet && lf.verbose {
+		return errors.New("-quiet and -verbose cannot be used together")
+	}
+	log.level = levelInfo
+	if lf.quiet {
+		log.level = levelWarn
+	} else if lf.verbose {
+		log.level = levelDebug
+	}
+	log.json = lf.json
+	return nil
+}
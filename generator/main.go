@@ -0,0 +1,1027 @@
+// Package generator generates the individual font repositories of the Go Noto project. It implements the `gonoto`
+// command, see Run, and lets other programs generate a single package without the command; see GeneratePackage.
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/Nik-U/otcmerge"
+	"github.com/gonoto/gonoto/noto"
+)
+
+const defaultModulePrefix = "github.com/gonoto/"
+
+// minGoVersion is the oldest Go version that can build the generated packages.
+const minGoVersion = "1.14"
+
+// Values accepted by the -output-format flag. Go packages store the font data as selected by -chunk-encoding; OTC
+// output writes the merged collection as a plain file for consumers that are not written in Go.
+const (
+	outputFormatGo        = "go"
+	outputFormatOTC       = "otc"
+	outputFormatModuleZip = "module-zip"
+)
+
+type fontDesc struct {
+	filename       string
+	family         string // The family that the font belongs to, e.g. "Sans"
+	language       string // The language or script covered by the font, or "" for the default (Latin, Greek, Cyrillic)
+	size           int64  // The uncompressed size of the font
+	compressedSize int64  // The compressed size of the font in the input archive
+	crc32          uint32 // The checksum of the font recorded by the input archive, or 0 if unknown
+	weight         int
+	hDensity       int
+	vDensity       int
+	style          int
+}
+
+// generateOptions controls how generateFonts produces the font packages.
+type generateOptions struct {
+	outputFamilies []outputFamily // The packages to generate
+
+	includeLanguages []string     // If set, only languages matching these patterns are merged
+	emojiFormat      string       // The format of the emoji font to merge; see selectEmojiFormat
+	emojiArbitration string       // Which fonts render the characters shared by emoji and text fonts; see arbitrateEmoji
+	emojiRanges      []emojiRange // Overrides the default presentation of characters for emojiArbitrationPresentation
+	excludeLanguages []string     // Languages matching these patterns are not merged
+	topLanguages     int          // If set, only this many languages are merged into each package; see topLanguages
+
+	shapingCheck  string // How to handle missing layout features; see shapingCheck
+	baseTable     string // Either baseTableKeep or baseTableSynthesize
+	skipDiskCheck bool   // Whether to skip checking for sufficient free disk space before merging
+	clean         bool   // Whether to delete the files of each package that the run did not write; see cleanPackageDir
+	changelogPath string // If set, the list of upstream font revision changes is also written to this file
+	changedOnly   bool   // Whether to skip packages whose source fonts are unchanged since the previous run
+	pinCompressor bool   // Whether regenerating chunk files written by a different compressor is an error
+	changedList   string // If set, the names of the generated packages are written to this file
+	lockPath      string // If set, the lockfile that records or checks the inputs and packages; see lockfile
+	updateLock    bool   // Whether to rewrite the lockfile instead of checking the run against it
+	reportPath    string // If set, an HTML report of the changes to the packages is written to this file
+	inputReport   string // If set, the fonts of the inputs that no package merges are listed in this file; see inputReport
+	rebrand       string // If set, replaces the Noto trademark in font names and documentation; see rebrandFonts
+	modulePrefix  string // The import path prefix of the generated modules, ending in a slash
+	stripHints    bool   // Whether to remove TrueType hinting from the source fonts; see stripHints
+	cffOptimizer  string // If set, the command that optimizes the CFF outlines of merged collections; see optimizeCFF
+	goVersion     string // The Go version declared in the generated go.mod files
+	chunkEncoding string // How the chunk files store the compressed data; see chunkEncodingUint64
+
+	chunkSize byteSize // The amount of compressed data in each chunk file
+
+	dropTables     []string // Tables to remove from the source fonts
+	requireHinting bool     // Whether to warn about source fonts without hinting
+	preferHinted   bool     // Whether to take the hinted copies of fonts that the input also has unhinted; see preferFonts
+
+	checkLineMetrics bool // Whether to warn about source fonts that are taller than the base font; see checkLineMetrics
+
+	license         string             // If set, replaces the Apache License in the LICENSE file of each package
+	copyrightYear   int                // The copyright year of the generated code, by default the current year
+	copyrightHolder string             // The copyright holder of the generated code
+	headerTemplate  *template.Template // If set, replaces the comment at the top of each generated Go file
+	readme          *readmeTemplates   // If set, adds links and sections to the README files; see readmeConfig
+
+	dryRun    bool      // Whether to print the source fonts of each package instead of generating them
+	noIndex   bool      // Whether to scan the input ZIP without reading or writing its index file
+	skip      []string  // Input files and directories matching these patterns are ignored; see skipFonts
+	jobs      int       // The maximum number of source fonts read or packages generated at the same time
+	maxMemory byteSize  // If set, limits the estimated memory of the packages generated at the same time
+	lowMemory bool      // Whether to extract the source fonts to disk first and merge one package at a time; see workspace
+	progress  string    // When to show the progress display; see progressAuto
+	summary   io.Writer // If set, a JSON summary of the run is written to it; see runSummary
+	keepGoing bool      // Whether to generate the other packages when one fails, and report the failures at the end
+
+	warningsAsErrors bool // Whether the run fails if it records any warnings; see runWarnings
+
+	hash *hashAlgorithm // The algorithm of the checksums in the manifest, lockfile, and summary
+	fips bool           // Whether to use only FIPS 140 approved algorithms, as checked by checkFIPS
+
+	outputFormat  string // Either outputFormatGo, outputFormatOTC, or outputFormatModuleZip
+	moduleVersion string // The version of the module zips written with outputFormatModuleZip
+
+	matcher *matcher // Chooses the source fonts that substitute for missing styles
+
+	requiredCoverage [][2]rune // Ranges of characters that every package must cover; see checkRequiredCoverage
+	localeHelper     bool      // Whether to write the locale helper of each package; see generateLocaleHelper
+	pdfHelper        bool      // Whether to write the pdf sub-package of each package; see generatePDFHelper
+	testFixture      bool      // Whether to write the fonttest sub-package of each package; see generateTestFixture
+
+	embed       bool   // Whether to write only the Go files of a single package into the output directory; see setupEmbed
+	splitData   bool   // Whether to write the chunk files to a separate data module; see generateDataModule
+	dataVersion string // The version of the data module required by the font module
+}
+
+func generateFonts(sourcePaths []string, outputDir string, opts *generateOptions) error {
+	runWarnings.reset()
+	if opts.fips {
+		if err := checkFIPS(); err != nil {
+			return err
+		}
+	}
+	var lock *lockfile
+	if opts.lockPath != "" && !opts.dryRun {
+		var err error
+		if lock, err = readLockfile(opts.lockPath); err != nil {
+			return err
+		}
+		if lock != nil && !opts.updateLock {
+			if err := checkLockInputs(lock, opts.lockPath, sourcePaths, opts.hash); err != nil {
+				return err
+			}
+		}
+	}
+	recognized := make(map[string]bool)
+	inventory, err := scanInput(sourcePaths, opts.noIndex, opts.skip, opts.preferHinted, recognized)
+	if err != nil {
+		return err
+	}
+	if err := selectEmojiFormat(inventory, opts.emojiFormat); err != nil {
+		return err
+	}
+	z, closeInput, err := openInput(sourcePaths)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = closeInput() }()
+	fontDescriptions, inputFonts := describeFonts(inventory)
+	// Notably, the languages are sorted, which means that CJKsc takes priority over CJKtc for shared Han glyphs unless
+	// the language priority of a package says otherwise; see prioritizeLanguages
+	languages := filterLanguages(inventory.Languages, opts.includeLanguages, opts.excludeLanguages)
+	reportUnusedDisplayFonts(opts.outputFamilies, fontDescriptions)
+
+	// Start the most expensive merges first so that the total running time is bounded by the largest family rather
+	// than by the order in which the families happen to be scheduled.
+	type familyJob struct {
+		family      outputFamily
+		sourceFonts []*fontDesc
+		cost        int64 // The total size of the source fonts, in bytes
+	}
+	jobs := make([]familyJob, len(opts.outputFamilies))
+	for i, outFamily := range opts.outputFamilies {
+		jobs[i] = familyJob{family: outFamily, sourceFonts: familySourceFonts(outFamily, fontDescriptions, languages, opts)}
+		for _, f := range jobs[i].sourceFonts {
+			jobs[i].cost += f.size
+		}
+		// Packages without a base font fail when they are generated
+		if problem := exactSourceProblem(outFamily, jobs[i].sourceFonts); problem != "" && hasBaseFont(outFamily, jobs[i].sourceFonts) {
+			runWarnings.warnf(warnSubstitution, severityMinor, outFamily.name, "%s", problem)
+		}
+	}
+	selected := make([][]*fontDesc, len(jobs))
+	for i, job := range jobs {
+		selected[i] = job.sourceFonts
+	}
+	report, err := newInputReport(sourcePaths, recognized, inputFonts, selected)
+	if err != nil {
+		return err
+	}
+	report.summarize()
+	if opts.inputReport != "" {
+		if err := report.write(opts.inputReport); err != nil {
+			return err
+		}
+	}
+	prev, err := readManifest(outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to read previous manifest: %w", err)
+	}
+	var skipped []string
+	if opts.changedOnly {
+		hashes := make(map[*fontDesc]string)
+		hashFont := func(f *fontDesc) (string, error) {
+			if sum, ok := hashes[f]; ok {
+				return sum, nil
+			}
+			data, err := fs.ReadFile(z, f.filename)
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", f.filename, err)
+			}
+			hashes[f] = opts.hash.sum(data)
+			return hashes[f], nil
+		}
+		kept := jobs[:0]
+		for _, job := range jobs {
+			old := prev.findPackage(job.family.name)
+			unchanged, err := sourcesUnchanged(old, job.sourceFonts, opts.hash, !opts.fips, hashFont)
+			if err != nil {
+				return err
+			}
+			if unchanged && old.Settings != packageSettings(job.family, opts) {
+				log.infof("Regenerating %s: its options changed since the previous run", job.family.name)
+				unchanged = false
+			}
+			if unchanged && !packageExists(filepath.Join(outputDir, job.family.name), opts) {
+				log.infof("Regenerating %s: it is missing from the output directory", job.family.name)
+				unchanged = false
+			}
+			if unchanged {
+				log.infof("Skipping %s: its source fonts are unchanged since the previous run", job.family.name)
+				skipped = append(skipped, job.family.name)
+				continue
+			}
+			kept = append(kept, job)
+		}
+		jobs = kept
+	}
+	// Only the source fonts of the remaining packages need to be loaded, which matters most for variable fonts, whose
+	// instances are derived as they are read
+	var allFonts []*fontDesc
+	loaded := make(map[*fontDesc]bool)
+	for _, job := range jobs {
+		for _, f := range job.sourceFonts {
+			if !loaded[f] {
+				loaded[f] = true
+				allFonts = append(allFonts, f)
+			}
+		}
+	}
+	if opts.outputFormat != outputFormatOTC {
+		var names []string
+		for _, job := range jobs {
+			names = append(names, job.family.name)
+		}
+		if err := checkCompressor(prev, names, opts.pinCompressor); err != nil {
+			return err
+		}
+	}
+	if opts.dryRun {
+		for _, job := range jobs {
+			printPlan(job.family, job.sourceFonts)
+		}
+		return nil
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].cost > jobs[j].cost })
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if !opts.skipDiskCheck {
+		var compressed, extracted int64
+		for _, job := range jobs {
+			for _, f := range job.sourceFonts {
+				compressed += f.compressedSize
+			}
+		}
+		if opts.lowMemory {
+			for _, f := range allFonts {
+				extracted += f.size
+			}
+		}
+		if err := checkDiskSpace(outputDir, compressed, extracted); err != nil {
+			return err
+		}
+	}
+
+	upstreams, err := readUpstreamFonts(z, allFonts)
+	if err != nil {
+		return err
+	}
+
+	// Without a memory budget, every source font is loaded once up front and kept until the last package that merges it
+	// is done. With a budget, each package loads its own source fonts when it starts, unless a running package already
+	// did, which reads shared fonts such as Emoji repeatedly but only keeps the fonts of the running packages in
+	// memory. With -low-memory, every source font is first extracted to a workspace on disk, one at a time, and the
+	// packages, which are generated one at a time, read their fonts from there. Either way, each loaded font is
+	// prepared for merging once; see sourceMemo.
+	budget := newMemoryBudget(int64(opts.maxMemory))
+	var prog *progress
+	if showProgress(opts.progress) {
+		prog = newProgress(os.Stderr)
+		defer prog.close()
+	}
+	for _, job := range jobs {
+		prog.addPackage(job.cost)
+	}
+	var memo *sourceMemo
+	switch {
+	case opts.lowMemory:
+		ws, err := newWorkspace(z, allFonts, outputDir, prog)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = ws.remove() }()
+		_ = closeInput()
+		log.infof("Extracted %d source fonts to %s; merging the packages one at a time", len(allFonts), ws.dir)
+		memo = newSourceMemo(ws, nil, nil, opts, prog)
+	case budget == nil:
+		for _, f := range allFonts {
+			prog.addTotal(stageExtract, f.size)
+		}
+		fontData, err := loadSourceFonts(z, allFonts, opts.jobs, prog)
+		if err != nil {
+			return err
+		}
+		_ = closeInput()
+		packages := make([][]*fontDesc, len(jobs))
+		for i, job := range jobs {
+			packages[i] = job.sourceFonts
+		}
+		memo = newSourceMemo(z, fontData, packages, opts, prog)
+	default:
+		memo = newSourceMemo(z, nil, nil, opts, prog)
+	}
+
+	// Each merge holds the buffer of its worker until its chunk files are written, so the number of workers bounds both.
+	bufs := make([]*seekBuffer, opts.jobs)
+	for i := range bufs {
+		bufs[i] = &seekBuffer{buf: make([]byte, 4096)}
+	}
+
+	var resultsLock sync.Mutex
+	var results []*manifestPackage
+	failed := make(map[string]bool)
+	// fail reports the error of a package. With -keep-going, the error is logged and the other packages continue.
+	fail := func(name string, err error) error {
+		if !opts.keepGoing {
+			return err
+		}
+		log.errorf("%s: %s", name, err.Error())
+		resultsLock.Lock()
+		defer resultsLock.Unlock()
+		failed[name] = true
+		return nil
+	}
+	generators := newPool("generate", opts.jobs, budget)
+	for i, job := range jobs {
+		memory := jobMemory(job.cost)
+		if budget != nil && memory > budget.limit {
+			runWarnings.warnf(warnSize, severityMinor, job.family.name, "needs about %.1f MiB of memory, more than -max-memory; generating it alone",
+				float64(memory)/(1024*1024))
+		}
+		log.debugf("Scheduling %s (%d of %d, %d source fonts, %.1f MiB of input)", job.family.name, i+1, len(jobs),
+			len(job.sourceFonts), float64(job.cost)/(1024*1024))
+		func(job familyJob) {
+			generators.Go(memory, func(worker int) error {
+				// A package without a base font would be a fallback of other languages only, or an empty collection
+				if !hasBaseFont(job.family, job.sourceFonts) {
+					memo.skip(job.sourceFonts)
+					return fail(job.family.name, fmt.Errorf("merged font %s has no base font: %s; use -families to leave it out",
+						job.family.name, exactSourceProblem(job.family, job.sourceFonts)))
+				}
+				buf := bufs[worker]
+				fp := prog.family(job.family.name, job.cost)
+				defer fp.finish()
+				if budget != nil || opts.lowMemory {
+					// Release the merge buffer along with the source fonts rather than keeping it for the next job
+					defer func() { buf.buf = nil }()
+				}
+				fp.setState("preparing source fonts")
+				defer memo.release(job.sourceFonts)
+				fontData, prepared, err := memo.acquire(job.sourceFonts)
+				if err != nil {
+					return fail(job.family.name, err)
+				}
+				outFamily := job.family
+				packageDir := filepath.Join(outputDir, outFamily.name)
+				if opts.embed {
+					packageDir = outputDir
+				}
+				spec := packageSpec{family: outFamily, sourceFonts: job.sourceFonts, fontData: fontData, prepared: prepared,
+					upstreams: upstreams}
+				result, err := generateFont(spec, packageDir, buf, fp, opts)
+				if err != nil {
+					return fail(outFamily.name, err)
+				}
+				resultsLock.Lock()
+				defer resultsLock.Unlock()
+				results = append(results, result)
+				return nil
+			})
+		}(job)
+	}
+	if err := generators.Wait(); err != nil {
+		return fmt.Errorf("error while outputting merged fonts: %w", err)
+	}
+	// The packages that failed with -keep-going, in scheduling order
+	var failedNames []string
+	for _, job := range jobs {
+		if failed[job.family.name] {
+			failedNames = append(failedNames, job.family.name)
+		}
+	}
+	failure := func() error {
+		runWarnings.report()
+		if len(failedNames) > 0 {
+			return fmt.Errorf("%d of %d packages failed: %s", len(failedNames), len(jobs), strings.Join(failedNames, ", "))
+		}
+		if n := len(runWarnings.list()); n > 0 && opts.warningsAsErrors {
+			return fmt.Errorf("the run logged %d warnings, which -warnings-as-errors treats as errors", n)
+		}
+		return nil
+	}
+	if opts.embed {
+		return failure()
+	}
+	if opts.changedList != "" {
+		var names strings.Builder
+		for _, job := range jobs {
+			if !failed[job.family.name] {
+				names.WriteString(job.family.name + "\n")
+			}
+		}
+		if err := ioutil.WriteFile(opts.changedList, []byte(names.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write list of generated packages: %w", err)
+		}
+	}
+	changes, err := updateManifest(outputDir, results, runWarnings.list(), opts)
+	if err != nil {
+		return err
+	}
+	if opts.lockPath != "" && len(failedNames) == 0 {
+		if lock != nil && !opts.updateLock {
+			if err := checkLockPackages(lock, opts.lockPath, results, opts.hash); err != nil {
+				return err
+			}
+		} else {
+			if lock, err = newLockfile(sourcePaths, results, opts.hash); err != nil {
+				return err
+			}
+			if err := writeLockfile(lock, opts.lockPath); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.summary != nil {
+		if err := writeSummary(opts.summary, sourcePaths, outputDir, results, skipped, failedNames, changes, runWarnings.list(), opts); err != nil {
+			return err
+		}
+	}
+	return failure()
+}
+
+// loadSourceFonts reads the data of the source fonts from the input, reading at most jobs fonts at the same time.
+func loadSourceFonts(z fs.FS, fonts []*fontDesc, jobs int, prog *progress) (map[string][]byte, error) {
+	var dataLock sync.Mutex
+	fontData := make(map[string][]byte)
+	readers := newPool("read", jobs, nil)
+	for _, d := range fonts {
+		func(d *fontDesc) {
+			readers.Go(0, func(int) error {
+				log.infof("Loading source font %s", d.filename)
+
+				data, err := fs.ReadFile(z, d.filename)
+				if err != nil {
+					return err
+				}
+				dataLock.Lock()
+				defer dataLock.Unlock()
+				fontData[d.filename] = data
+				prog.advance(stageExtract, d.size)
+
+				return nil
+			})
+		}(d)
+	}
+	if err := readers.Wait(); err != nil {
+		return nil, fmt.Errorf("failed to read a font file from the Noto input: %w", err)
+	}
+	return fontData, nil
+}
+
+// describeFonts converts the fonts of the inventory to fontDesc, grouped by family and language.
+func describeFonts(inventory *noto.Inventory) (map[string]map[string][]*fontDesc, []*fontDesc) {
+	fontDescriptions := make(map[string]map[string][]*fontDesc)
+	for _, f := range families {
+		fontDescriptions[f] = make(map[string][]*fontDesc)
+	}
+	var allFonts []*fontDesc
+	for _, font := range inventory.Fonts {
+		vDensity := ""
+		if font.UI {
+			vDensity = "UI"
+		}
+		d := &fontDesc{
+			filename:       font.Path,
+			family:         font.Family,
+			language:       font.Language,
+			size:           font.Size,
+			compressedSize: font.CompressedSize,
+			crc32:          font.CRC32,
+			weight:         exactIndexOf(font.Weight, weights),
+			hDensity:       exactIndexOf(font.Width, hDensities),
+			vDensity:       exactIndexOf(vDensity, vDensities),
+			style:          exactIndexOf(font.Style, styles),
+		}
+		fontDescriptions[font.Family][font.Language] = append(fontDescriptions[font.Family][font.Language], d)
+		allFonts = append(allFonts, d)
+	}
+	return fontDescriptions, allFonts
+}
+
+// exactSourceProblem describes why the base font of an output family is not in exactly the requested style, such as
+// for a condensed italic package when upstream only has upright condensed fonts, or returns the empty string.
+// Substitutions for other languages are common and expected, so only the base font is checked.
+func exactSourceProblem(outFamily outputFamily, sourceFonts []*fontDesc) string {
+	if !hasBaseFont(outFamily, sourceFonts) {
+		return "the input has no " + outFamily.inputFamily + " font for the default language"
+	}
+	if subs := substitutions(outFamily, sourceFonts[0]); len(subs) > 0 {
+		return fmt.Sprintf("upstream has no %s font; using %s (%s)", familyDisplayName(outFamily),
+			path.Base(sourceFonts[0].filename), strings.Join(subs, ", "))
+	}
+	return ""
+}
+
+// hasBaseFont reports whether the source fonts start with a default language font of the input family.
+func hasBaseFont(outFamily outputFamily, sourceFonts []*fontDesc) bool {
+	return len(sourceFonts) > 0 && sourceFonts[0].family == outFamily.inputFamily && sourceFonts[0].language == ""
+}
+
+// familySourceFonts returns the source fonts of an output family among the languages of the run, limited to the most
+// widely read ones with -top-langs and ordered by the language priority of the family.
+func familySourceFonts(outFamily outputFamily, fontDescriptions map[string]map[string][]*fontDesc, languages []string, opts *generateOptions) []*fontDesc {
+	if opts.topLanguages > 0 {
+		languages = topLanguages(languages, fontDescriptions[outFamily.languageSource()], opts.topLanguages)
+	}
+	languages = prioritizeLanguages(languages, outFamily.priority)
+	return selectSourceFonts(outFamily, fontDescriptions, languages, opts.matcher)
+}
+
+// selectSourceFonts returns the source fonts that are merged to produce an output family, in fallback order.
+func selectSourceFonts(outFamily outputFamily, fontDescriptions map[string]map[string][]*fontDesc, languages []string, m *matcher) []*fontDesc {
+	weight := exactIndexOf(outFamily.weight, weights)
+	hDensity := exactIndexOf(outFamily.hDensity, hDensities)
+	vDensity := exactIndexOf(outFamily.vDensity, vDensities)
+	style := exactIndexOf(outFamily.style, styles)
+
+	// Languages of the input family that are injected as combo families are not also merged in alphabetical order.
+	injected := make(map[string]bool)
+	for _, comboFamily := range append(append([]string(nil), outFamily.prependComboFamilies...), outFamily.appendComboFamilies...) {
+		if family, language, _ := comboSource(comboFamily); family == outFamily.languageSource() {
+			injected[language] = true
+		}
+	}
+	appendCombo := func(sourceFonts []*fontDesc, comboFamily string) []*fontDesc {
+		family, language, _ := comboSource(comboFamily)
+		return m.appendMatch(sourceFonts, fontDescriptions[family][language], weight, hDensity, vDensity, style)
+	}
+
+	var sourceFonts []*fontDesc
+	// Roughly organize fonts from most likely to least likely: ASCII, then combo families
+	// (e.g., Emoji), then all other languages sorted alphabetically.
+	sourceFonts = m.appendMatch(sourceFonts, fontDescriptions[outFamily.inputFamily][""], weight, hDensity, vDensity, style)
+	for _, comboFamily := range outFamily.prependComboFamilies {
+		sourceFonts = appendCombo(sourceFonts, comboFamily)
+	}
+	for _, l := range languages {
+		if l == "" || injected[l] {
+			continue
+		}
+		sourceFonts = m.appendMatch(sourceFonts, fontDescriptions[outFamily.languageSource()][l], weight, hDensity, vDensity, style)
+	}
+	for _, comboFamily := range outFamily.appendComboFamilies {
+		sourceFonts = appendCombo(sourceFonts, comboFamily)
+	}
+	return sourceFonts
+}
+
+func exactIndexOf(s string, l []string) int {
+	for i, x := range l {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// generateFont generates a package into outputDir and removes the files that previous runs with other options left in
+// it.
+func generateFont(spec packageSpec, outputDir string, buf *seekBuffer, fp *familyProgress, opts *generateOptions) (*manifestPackage, error) {
+	log.infof("Generating merged font %s", outputDir)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create font directory %s: %w", outputDir, err)
+	}
+	if opts.outputFormat == outputFormatGo {
+		if opts.splitData {
+			if err := removeStaleChunks(outputDir); err != nil {
+				return nil, err
+			}
+		}
+		if !opts.embed && len(opts.requiredCoverage) == 0 {
+			if err := removeCoverageTest(outputDir); err != nil {
+				return nil, err
+			}
+		}
+		if !opts.embed && !opts.localeHelper {
+			if err := removeLocaleHelper(outputDir); err != nil {
+				return nil, err
+			}
+		}
+		if !opts.embed && !opts.pdfHelper {
+			if err := removePDFHelper(outputDir); err != nil {
+				return nil, err
+			}
+		}
+		if !opts.embed && !opts.testFixture {
+			if err := removeTestFixture(outputDir); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.outputFormat == outputFormatModuleZip {
+		return generateModuleZip(spec, outputDir, buf, fp, opts)
+	}
+	if !opts.clean {
+		return generatePackage(spec, dirSink(outputDir), buf, fp, opts)
+	}
+	written := make(map[string]bool)
+	result, err := generatePackage(spec, recordingSink(dirSink(outputDir), written), buf, fp, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cleanPackageDir(outputDir, written); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// packageSpec describes a package to generate.
+type packageSpec struct {
+	family      outputFamily
+	sourceFonts []*fontDesc              // In fallback order; see selectSourceFonts
+	fontData    map[string][]byte        // The contents of the source fonts by file name
+	upstreams   map[string]*upstreamFont // The files that the derived source fonts were made from; see readUpstreamFonts
+	prepared    []*preparedSource        // The source fonts as they are merged, in the order of sourceFonts; see prepareSource
+}
+
+// generatePackage merges the source fonts of a package and passes each file of the package to sink, so that callers
+// can stream the package into an archive or an upload without writing it to disk first. buf receives the merged
+// collection.
+func generatePackage(spec packageSpec, sink fileSink, buf *seekBuffer, fp *familyProgress, opts *generateOptions) (*manifestPackage, error) {
+	outFamily, sourceFonts, fontData := spec.family, spec.sourceFonts, spec.fontData
+	packageName := outFamily.packageName()
+	sources := make([][]byte, len(sourceFonts))
+	baseReport := baseTableReport{Fonts: len(sourceFonts)}
+	var dropped, stripped int
+	for i, p := range spec.prepared {
+		sources[i] = p.data
+		baseReport.Present += p.base.Present
+		baseReport.Synthesized += p.base.Synthesized
+		if p.dropped {
+			dropped++
+		}
+		if p.stripped {
+			stripped++
+		}
+	}
+	log.infof("BASE tables for %s: %s", packageName, baseReport)
+	// The warnings are also recorded in the manifest for reports
+	var warnings []string
+	if opts.requireHinting {
+		for _, f := range sourceFonts {
+			if !isHinted(fontData[f.filename]) {
+				warnings = append(warnings, f.filename+" has no hinting")
+				runWarnings.warnf(warnFeature, severityMajor, packageName, "%s has no hinting; use a hinted release ZIP with this profile", f.filename)
+			}
+		}
+	}
+	if len(opts.dropTables) > 0 {
+		log.infof("Dropped tables %s from %d of %d fonts for %s", strings.Join(opts.dropTables, ", "), dropped, len(sources), packageName)
+	}
+	if opts.stripHints {
+		log.infof("Stripped hinting from %d of %d fonts for %s", stripped, len(sources), packageName)
+	}
+
+	if opts.emojiArbitration == emojiArbitrationPresentation {
+		var asText, asEmoji int
+		var err error
+		if sources, asText, asEmoji, err = arbitrateEmoji(sources, sourceFonts, opts.emojiRanges); err != nil {
+			return nil, fmt.Errorf("failed to arbitrate the emoji of %s: %w", packageName, err)
+		}
+		log.infof("Emoji arbitration for %s: %d characters shared with the Emoji fonts are rendered as text, %d as emoji",
+			packageName, asText, asEmoji)
+	}
+
+	inputs := make([]io.ReadSeeker, len(sources))
+	for i := range sources {
+		inputs[i] = bytes.NewReader(sources[i])
+	}
+
+	fp.setState("merging %d source fonts", len(inputs))
+	buf.Reset()
+	if err := otcmerge.Merge(inputs, buf); err != nil {
+		return nil, err
+	}
+	fp.advance(stageMerge, 1)
+	var cffSavings int
+	if opts.cffOptimizer != "" {
+		fp.setState("optimizing CFF outlines")
+		optimized, err := optimizeCFF(buf.buf, opts.cffOptimizer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to optimize %s: %w", packageName, err)
+		}
+		if cffSavings = len(buf.buf) - len(optimized); cffSavings > 0 {
+			log.infof("Optimized CFF outlines of %s: %.1f MiB to %.1f MiB (%.1f%% smaller)", packageName,
+				float64(len(buf.buf))/(1024*1024), float64(len(optimized))/(1024*1024), 100*float64(cffSavings)/float64(len(buf.buf)))
+			buf.buf = optimized
+		}
+	}
+	fp.setState("checking the merged font")
+	if opts.shapingCheck != shapingCheckOff {
+		problems, err := checkShaping(buf.buf, sourceFonts, fontData)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range problems {
+			warnings = append(warnings, p.String())
+			severity := severityMinor
+			if p.lostInMerge {
+				severity = severityMajor
+			}
+			runWarnings.warnf(warnFeature, severity, packageName, "%s", p)
+			if p.lostInMerge && opts.shapingCheck == shapingCheckError {
+				return nil, fmt.Errorf("merged font %s failed the shaping check: %s", packageName, p)
+			}
+		}
+	}
+
+	if opts.checkLineMetrics {
+		problems, err := checkLineMetrics(buf.buf, sourceFonts)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range problems {
+			warnings = append(warnings, p)
+			runWarnings.warnf(warnFeature, severityMinor, packageName, "%s", p)
+		}
+	}
+
+	if len(opts.requiredCoverage) > 0 {
+		missing, err := checkRequiredCoverage(buf.buf, opts.requiredCoverage)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("merged font %s does not cover the required characters %s", packageName, formatRanges(missing))
+		}
+	}
+
+	problems, err := checkReservedNames(buf.buf, sourceFonts, fontData, spec.upstreams)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		for _, p := range problems {
+			log.errorf("%s: %s", packageName, p)
+		}
+		return nil, fmt.Errorf("merged font %s contains modified fonts that use the Reserved Font Name %q; "+
+			"use -rebrand to publish modified fonts", packageName, trademark)
+	}
+
+	if opts.outputFormat == outputFormatOTC {
+		if err := sink(outFamily.name+".otc", bytes.NewReader(buf.buf)); err != nil {
+			return nil, fmt.Errorf("failed to write font collection file: %w", err)
+		}
+		result := newManifestPackage(outFamily, sourceFonts, fontData, sources, buf.buf, 0, baseReport, opts)
+		result.Warnings = warnings
+		result.CFFSavings = cffSavings
+		return result, nil
+	}
+	if err := generateSupportFiles(packageName, outFamily.name, outFamily.description, sink, opts); err != nil {
+		return nil, err
+	}
+	if opts.splitData {
+		if err := generateDataModule(packageName, outFamily.name, outFamily.description, sink, opts); err != nil {
+			return nil, err
+		}
+	}
+	chunks, err := generateChunks(packageName, sink, buf.buf, outFamily.description, fp, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.embed {
+		if err := generateSourcesFile(packageName, sink, outFamily.description, sourceFonts, fontData, opts); err != nil {
+			return nil, err
+		}
+		if err := generateScriptsFile(packageName, sink, outFamily.description, sourceFonts, opts); err != nil {
+			return nil, err
+		}
+		if err := generateCoverageTest(packageName, sink, opts.requiredCoverage); err != nil {
+			return nil, err
+		}
+		if opts.localeHelper {
+			if err := generateLocaleHelper(packageName, sink, outFamily.description, sourceFonts, opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.pdfHelper {
+			if err := generatePDFHelper(packageName, outFamily.name, outFamily.description, sink, opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.testFixture {
+			fp.setState("writing test fixture")
+			if err := generateTestFixture(packageName, outFamily.description, buf.buf, sink, opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result := newManifestPackage(outFamily, sourceFonts, fontData, sources, buf.buf, chunks, baseReport, opts)
+	result.Warnings = warnings
+	result.CFFSavings = cffSavings
+	return result, nil
+}
+
+func generateSupportFiles(packageName string, moduleName string, description string, sink fileSink, opts *generateOptions) error {
+	notice := fontNotice(opts.rebrand)
+	header, err := goFileHeader(opts, headerData{File: "otc.go", Package: packageName, Description: description, Notice: notice})
+	if err != nil {
+		return err
+	}
+	doc := `// package ` + packageName + ` ` + description + `
+// This font collection provides broad unicode coverage.
+// Special software is required to use OpenType font collections.
+//
+// See https://github.com/gonoto/gonoto for details.
+`
+	if opts.embed {
+		// The file is part of a package of the user's, so it must not provide the package documentation
+		doc = `// This file ` + description + `
+// This font collection provides broad unicode coverage.
+// Special software is required to use OpenType font collections.
+//
+// This file was generated by gonoto. See https://github.com/gonoto/gonoto for details.
+
+`
+	}
+	if err := sink.writeString("otc.go", header+doc+`package `+packageName+`
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+`+chunkDecoderSource(opts.chunkEncoding)+`
+// `+chunkHeaderVar+` starts the chunk data: a magic string and the version of its format.
+const `+chunkHeaderVar+` = `+strconv.Quote(chunkStreamHeader)+`
+
+var initOnce sync.Once
+var otcData []byte
+
+// OTC returns the font data as an OpenType collection.
+func OTC() []byte {
+	initOnce.Do(func() {
+		var cr chunkDecoder
+		header := make([]byte, len(`+chunkHeaderVar+`))
+		if _, err := io.ReadFull(cr, header); err != nil || string(header) != `+chunkHeaderVar+` {
+			panic("`+packageName+`: the chunk data is not in the format that otc.go reads; " +
+				"regenerate all files of the package with the same version of gonoto")
+		}
+		otcData = make([]byte, decompressedSize)
+		r, _ := gzip.NewReader(cr)
+		_, _ = io.ReadFull(r, otcData)
+		chunks = nil
+	})
+	return otcData
+}
+`); err != nil {
+		return fmt.Errorf("failed to write decoder file: %w", err)
+	}
+	if opts.embed {
+		return nil
+	}
+	if err := generateReadme(packageName, moduleName, description, sink, opts); err != nil {
+		return err
+	}
+	goMod := "module " + opts.modulePrefix + moduleName + "\n\ngo " + opts.goVersion + "\n"
+	if opts.splitData {
+		goMod += dataModuleRequirement(moduleName, opts)
+	}
+	if err := sink.writeString("go.mod", goMod); err != nil {
+		return fmt.Errorf("failed to write go.mod file: %w", err)
+	}
+	if err := sink.writeString("LICENSE", packageLicense(opts)); err != nil {
+		return fmt.Errorf("failed to write LICENSE file: %w", err)
+	}
+	return nil
+}
+
+// packageLicense returns the contents of the LICENSE file of the generated modules.
+func packageLicense(opts *generateOptions) string {
+	if opts.license != "" {
+		return opts.license
+	}
+	return repoLicense
+}
+
+// generateChunks compresses the merged font into chunk files and returns the number of chunk files.
+func generateChunks(packageName string, sink fileSink, data []byte, description string, fp *familyProgress, opts *generateOptions) (int, error) {
+	pr, pw := io.Pipe()
+	var compressed int64 // The amount of data written to the compressor, which only runs ahead of the chunk writer by a block
+	go func() {
+		defer func() { _ = pw.Close() }()
+		if _, err := io.WriteString(pw, chunkStreamHeader); err != nil {
+			return
+		}
+		gz, err := newCompressor(pw)
+		if err != nil {
+			return
+		}
+		// The data is compressed in blocks only to report progress; the output does not depend on the block size
+		for start := 0; start < len(data); start += progressBlockSize {
+			end := start + progressBlockSize
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := gz.Write(data[start:end]); err != nil {
+				return
+			}
+			atomic.StoreInt64(&compressed, int64(end))
+			fp.advance(stageCompress, float64(end)/float64(len(data)))
+		}
+		if err := gz.Close(); err != nil {
+			return
+		}
+	}()
+
+	// With -split-data, the chunks are written to the data package, which exports them to the font package.
+	chunkPackage, chunkDir, chunksVar, sizeConst, doc := packageName, ".", "chunks", "decompressedSize", ""
+	if opts.splitData {
+		chunkPackage, chunkDir, chunksVar, sizeConst = dataPackage, dataPackage, "Chunks", "DecompressedSize"
+		doc = "// Package " + dataPackage + " contains the compressed font data of package " + packageName + ".\n"
+	}
+
+	var chunkVars []string
+	for i := 0; ; i++ {
+		r := io.LimitReader(pr, int64(opts.chunkSize))
+		chunkVar := fmt.Sprintf("chunk%d", i)
+		fp.setState("writing chunk %d", i)
+		header, err := goFileHeader(opts, headerData{File: chunkVar + ".go", Package: chunkPackage, Description: description, Notice: fontNotice(opts.rebrand)})
+		if err != nil {
+			return 0, err
+		}
+		more, err := writeEncodedChunk(opts.chunkEncoding, chunkPackage, sink, chunkDir, chunkVar, r, header)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write data chunk %d for font %s: %w", i, packageName, err)
+		}
+		if !more {
+			break
+		}
+		chunkVars = append(chunkVars, chunkVar)
+		fp.advance(stageWrite, float64(atomic.LoadInt64(&compressed))/float64(len(data)))
+	}
+	header, err := goFileHeader(opts, headerData{File: "chunk.go", Package: chunkPackage, Description: description, Notice: fontNotice(opts.rebrand)})
+	if err != nil {
+		return 0, err
+	}
+	if err := sink.writeString(path.Join(chunkDir, "chunk.go"),
+		header+doc+"package "+chunkPackage+"\n\n"+
+			"var "+chunksVar+" = "+chunkListType(opts.chunkEncoding)+"{"+strings.Join(chunkVars, ", ")+"}\n"+
+			"const "+sizeConst+" = "+strconv.Itoa(len(data))+"\n"); err != nil {
+		return 0, fmt.Errorf("failed to write chunk file: %w", err)
+	}
+	return len(chunkVars), nil
+}
+
+func writeChunk(packageName string, fw io.Writer, varName string, r io.Reader, header string) error {
+	w := bufio.NewWriter(fw)
+
+	var buf [4096]byte
+	if _, err := w.WriteString(
+		header +
+			"package " + packageName + "\n\n" +
+			"var " + varName + " = []uint64{"); err != nil {
+		return err
+	}
+	comma := false
+	for {
+		n, err := io.ReadFull(r, buf[:])
+		if n%8 != 0 {
+			copy(buf[n:], []byte{0, 0, 0, 0})
+			n += 8 - n%8
+		}
+		for i := 0; i < n; i += 8 {
+			encoded := binary.LittleEndian.Uint64(buf[i : i+8])
+			if comma {
+				if _, err := w.WriteString(","); err != nil {
+					return err
+				}
+			}
+			comma = true
+			if _, err := fmt.Fprintf(w, "0x%02X", encoded); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if _, err := w.WriteString("}\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
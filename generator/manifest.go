@@ -0,0 +1,305 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const manifestFile = "manifest.json"
+
+// manifest records what was generated in an output directory. It is rewritten after every run; packages that were
+// not regenerated keep their previous entries.
+type manifest struct {
+	Hash     string             `json:"hash,omitempty"` // The -hash algorithm of the last run; older manifests use sha256
+	Packages []*manifestPackage `json:"packages"`
+	Warnings []runWarning       `json:"run_warnings,omitempty"` // The warnings of the last run; see warningRecorder
+}
+
+type manifestPackage struct {
+	Name             string          `json:"name"`
+	Fonts            []manifestFont  `json:"fonts"`             // The source fonts, in fallback order
+	BaseTables       baseTableReport `json:"base_tables"`       // BASE table coverage of the merged collection
+	DecompressedSize int             `json:"decompressed_size"` // The size of the merged collection, in bytes
+	Chunks           int             `json:"chunks,omitempty"`  // The number of chunk files; 0 for OTC output
+	checksums                        // The checksum of the merged collection
+	Codepoints       int             `json:"codepoints"`            // The number of characters covered by the collection
+	Warnings         []string        `json:"warnings,omitempty"`    // Problems found while checking the merged collection
+	CFFSavings       int             `json:"cff_savings,omitempty"` // The bytes saved by -cff-optimizer
+	Settings         string          `json:"settings,omitempty"`    // A fingerprint of the options; see packageSettings
+	Compressor       string          `json:"compressor,omitempty"`  // The compressor of the chunk files; see compressorFingerprint
+	Generator        *generatorInfo  `json:"generator,omitempty"`   // The build of gonoto that generated the package
+}
+
+type manifestFont struct {
+	Filename  string `json:"filename"`
+	Family    string `json:"family"`
+	Language  string `json:"language,omitempty"`
+	Revision  string `json:"revision,omitempty"` // The head.fontRevision of the font
+	Size      int64  `json:"size,omitempty"`
+	CRC32     uint32 `json:"crc32,omitempty"` // The checksum recorded by the input archive, if any
+	checksums        // The checksum of the font file
+
+	// Substitutions lists the style terms of the font that differ from those of the package, such as
+	// "weight Bold for Black", because the family of the font has no closer match.
+	Substitutions []string `json:"substitutions,omitempty"`
+}
+
+func newManifestPackage(outFamily outputFamily, sourceFonts []*fontDesc, fontData map[string][]byte, sources [][]byte,
+	merged []byte, chunks int, baseReport baseTableReport, opts *generateOptions) *manifestPackage {
+	p := &manifestPackage{
+		Name:             outFamily.name,
+		BaseTables:       baseReport,
+		DecompressedSize: len(merged),
+		Chunks:           chunks,
+		Settings:         packageSettings(outFamily, opts),
+		Generator:        generator,
+	}
+	p.set(opts.hash, opts.hash.sum(merged))
+	if chunks > 0 {
+		p.Compressor = compressorFingerprint()
+	}
+	p.Codepoints, _ = countCoverage(merged)
+	for i, f := range sourceFonts {
+		mf := manifestFont{Filename: f.filename, Family: f.family, Language: f.language, Size: f.size, CRC32: f.crc32,
+			Substitutions: substitutions(outFamily, f)}
+		mf.set(opts.hash, opts.hash.sum(fontData[f.filename]))
+		if fonts, err := parseFontCollection(sources[i]); err == nil && len(fonts) == 1 {
+			mf.Revision, _ = fonts[0].fontRevision()
+		}
+		p.Fonts = append(p.Fonts, mf)
+	}
+	return p
+}
+
+// substitutions describes the style terms of a source font that differ from those requested by the output family.
+func substitutions(outFamily outputFamily, f *fontDesc) []string {
+	var out []string
+	add := func(kind string, terms []string, got int, want string, normal string) {
+		if terms[got] == want {
+			return
+		}
+		name := func(t string) string {
+			if t == "" {
+				return normal
+			}
+			return t
+		}
+		out = append(out, fmt.Sprintf("%s %s for %s", kind, name(terms[got]), name(want)))
+	}
+	add("weight", weights, f.weight, outFamily.weight, "Regular")
+	add("width", hDensities, f.hDensity, outFamily.hDensity, "normal")
+	add("density", vDensities, f.vDensity, outFamily.vDensity, "normal")
+	add("style", styles, f.style, outFamily.style, "normal")
+	return out
+}
+
+// readManifest loads the manifest from outputDir. A missing manifest is returned as nil without an error.
+func readManifest(outputDir string) (*manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", manifestFile, err)
+	}
+	return m, nil
+}
+
+func writeManifest(outputDir string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outputDir, manifestFile), append(data, '\n'), 0644)
+}
+
+func (m *manifest) findPackage(name string) *manifestPackage {
+	if m == nil {
+		return nil
+	}
+	for _, p := range m.Packages {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// sourcesUnchanged reports whether a package previously generated from the fonts recorded in prev would be generated
+// from the same source fonts again, judging by the file names, sizes, and checksums recorded by the input archive. The
+// contents of fonts without a checksum in the archive, or of all fonts unless useCRC is set, are hashed with hashFont
+// in the algorithm h instead. Fonts recorded without a checksum in h, such as those of manifests written by older
+// versions or with another -hash, count as changed.
+func sourcesUnchanged(prev *manifestPackage, sourceFonts []*fontDesc, h *hashAlgorithm, useCRC bool,
+	hashFont func(*fontDesc) (string, error)) (bool, error) {
+	if prev == nil || len(prev.Fonts) != len(sourceFonts) {
+		return false, nil
+	}
+	for i, f := range sourceFonts {
+		old := prev.Fonts[i]
+		if old.Size != f.size || old.Filename != f.filename {
+			return false, nil
+		}
+		if f.crc32 != 0 && useCRC {
+			if old.CRC32 != f.crc32 {
+				return false, nil
+			}
+			continue
+		}
+		if old.get(h) == "" {
+			return false, nil
+		}
+		sum, err := hashFont(f)
+		if err != nil {
+			return false, err
+		}
+		if sum != old.get(h) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// packageSettings returns a fingerprint of the options that affect the generated files of a package other than its
+// choice of source fonts, so that packages are regenerated when the options change.
+func packageSettings(outFamily outputFamily, opts *generateOptions) string {
+	// The copyright year is left out so that a new year does not regenerate the unchanged packages
+	var header string
+	if opts.headerTemplate != nil {
+		header = opts.headerTemplate.Root.String()
+	}
+	settings := []interface{}{
+		outFamily.name, outFamily.description,
+		opts.baseTable, opts.rebrand, opts.modulePrefix, opts.stripHints, opts.goVersion, opts.chunkEncoding,
+		opts.chunkSize, opts.dropTables, opts.license, header, opts.outputFormat, opts.requiredCoverage,
+		opts.splitData, opts.dataVersion, opts.copyrightHolder, opts.cffOptimizer, opts.localeHelper,
+		opts.pdfHelper, opts.testFixture,
+	}
+	// Added only when set, so that the fingerprints of earlier runs stay valid
+	if opts.emojiArbitration == emojiArbitrationPresentation {
+		settings = append(settings, opts.emojiArbitration, (*emojiRangeList)(&opts.emojiRanges).String())
+	}
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// updateManifest reports the upstream font revision changes since the previous run and records the generated
+// packages in the manifest.
+func updateManifest(outputDir string, results []*manifestPackage, warnings []runWarning, opts *generateOptions) ([]string, error) {
+	prev, err := readManifest(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous manifest: %w", err)
+	}
+	var changes []string
+	if prev != nil {
+		changes = revisionChanges(prev, results)
+		if len(changes) == 0 {
+			log.infof("No upstream font revision changes since the previous run")
+		} else {
+			log.infof("Upstream font revision changes since the previous run:")
+			for _, c := range changes {
+				log.infof("  %s", c)
+			}
+		}
+		if opts.changelogPath != "" {
+			var text strings.Builder
+			for _, c := range changes {
+				text.WriteString("* " + c + "\n")
+			}
+			if err := ioutil.WriteFile(opts.changelogPath, []byte(text.String()), 0644); err != nil {
+				return nil, fmt.Errorf("failed to write changelog: %w", err)
+			}
+		}
+	}
+
+	next := &manifest{Hash: opts.hash.name, Packages: results, Warnings: warnings}
+	if prev != nil {
+		for _, p := range prev.Packages {
+			if next.findPackage(p.Name) == nil {
+				next.Packages = append(next.Packages, p)
+			}
+		}
+	}
+	sort.Slice(next.Packages, func(i, j int) bool { return next.Packages[i].Name < next.Packages[j].Name })
+	if err := writeManifest(outputDir, next); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if opts.reportPath != "" {
+		if err := writeReport(opts.reportPath, prev, next, results, changes); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// revisionChanges lists the scripts whose source font revisions differ from the previous manifest, along with the
+// packages that they affect. Packages that do not appear in the previous manifest are ignored.
+func revisionChanges(prev *manifest, results []*manifestPackage) []string {
+	type scriptKey struct{ family, language string }
+	type change struct {
+		script   scriptKey
+		old, new string
+	}
+	affected := make(map[change][]string)
+	for _, p := range results {
+		old := prev.findPackage(p.Name)
+		if old == nil {
+			continue
+		}
+		oldRevisions := make(map[scriptKey]string)
+		for _, f := range old.Fonts {
+			oldRevisions[scriptKey{f.Family, f.Language}] = f.Revision
+		}
+		for _, f := range p.Fonts {
+			key := scriptKey{f.Family, f.Language}
+			oldRevision, ok := oldRevisions[key]
+			delete(oldRevisions, key)
+			if ok && oldRevision == f.Revision {
+				continue
+			}
+			c := change{script: key, new: f.Revision}
+			if ok {
+				c.old = oldRevision
+			}
+			affected[c] = append(affected[c], p.Name)
+		}
+		for key, oldRevision := range oldRevisions {
+			c := change{script: key, old: oldRevision}
+			affected[c] = append(affected[c], p.Name)
+		}
+	}
+
+	var changes []string
+	for c, packages := range affected {
+		script := c.script.family
+		if c.script.language != "" {
+			script += " " + c.script.language
+		}
+		var description string
+		switch {
+		case c.old == "":
+			description = "added at revision " + c.new
+		case c.new == "":
+			description = "removed (was revision " + c.old + ")"
+		default:
+			description = "revision " + c.old + " -> " + c.new
+		}
+		sort.Strings(packages)
+		changes = append(changes, fmt.Sprintf("%s: %s (%s)", script, description, strings.Join(packages, ", ")))
+	}
+	sort.Strings(changes)
+	return changes
+}
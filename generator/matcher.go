@@ -0,0 +1,100 @@
+package generator
+
+import "fmt"
+
+// Style features compared by matcher, as named in the config file.
+const (
+	featureStyle  = "style"
+	featureWeight = "weight"
+	featureWidth  = "width"
+	featureUI     = "ui"
+)
+
+// matcher chooses the source font that best matches the style terms of an output family when the family of the font
+// does not provide an exact match.
+type matcher struct {
+	priority       []string // The features in decreasing order of importance
+	maxWeightSteps int      // The maximum difference in weight of a substitute font, or -1 for no limit
+}
+
+var defaultMatcher = &matcher{
+	priority:       []string{featureStyle, featureWeight, featureWidth, featureUI},
+	maxWeightSteps: -1,
+}
+
+// matchingConfig tunes the matcher in the config file. Unset fields keep the defaults.
+type matchingConfig struct {
+	// Priority lists style, weight, width, and ui in decreasing order of importance. A substitute font is preferred
+	// if it matches a more important feature, regardless of how far it is from the less important ones.
+	Priority []string `json:"priority"`
+	// MaxWeightSteps excludes substitute fonts more than this many weights away, e.g. 2 allows Bold for Black but not
+	// Regular. Languages without a font within the limit are omitted from the package.
+	MaxWeightSteps *int `json:"max_weight_steps"`
+}
+
+func (mc *matchingConfig) matcher() (*matcher, error) {
+	if mc == nil {
+		return defaultMatcher, nil
+	}
+	m := *defaultMatcher
+	if len(mc.Priority) > 0 {
+		if len(mc.Priority) != len(defaultMatcher.priority) {
+			return nil, fmt.Errorf("priority must list each of %v exactly once", defaultMatcher.priority)
+		}
+		seen := make(map[string]bool)
+		for _, f := range mc.Priority {
+			if exactIndexOf(f, defaultMatcher.priority) < 0 || seen[f] {
+				return nil, fmt.Errorf("priority must list each of %v exactly once", defaultMatcher.priority)
+			}
+			seen[f] = true
+		}
+		m.priority = mc.Priority
+	}
+	if mc.MaxWeightSteps != nil {
+		if *mc.MaxWeightSteps < 0 {
+			return nil, fmt.Errorf("invalid max_weight_steps %d", *mc.MaxWeightSteps)
+		}
+		m.maxWeightSteps = *mc.MaxWeightSteps
+	}
+	return &m, nil
+}
+
+// appendMatch appends the font of descriptions that is closest to the requested style terms, given as indices into
+// weights, hDensities, vDensities, and styles, to out. Nothing is appended if no font is close enough.
+func (m *matcher) appendMatch(out []*fontDesc, descriptions []*fontDesc, weight int, hDensity int, vDensity int, style int) []*fontDesc {
+	var match *fontDesc
+	var matchDist int64
+	abs := func(x int) int64 {
+		if x < 0 {
+			return int64(-x)
+		}
+		return int64(x)
+	}
+	descDistance := func(d *fontDesc) int64 {
+		dists := map[string]int64{
+			featureStyle:  abs(style - d.style),
+			featureWeight: abs(weight - d.weight),
+			featureWidth:  abs(hDensity - d.hDensity),
+			featureUI:     abs(vDensity - d.vDensity),
+		}
+		// Produce a weighted distance measure imposing a strict priority of features. This is a bit arbitrary but
+		// decouples this function from explicit knowledge of the exact feature sets. For ties, always prefer the larger
+		// index to make the result deterministic.
+		return 1e14*dists[m.priority[0]] + 1e12*dists[m.priority[1]] + 1e10*dists[m.priority[2]] + 1e8*dists[m.priority[3]] -
+			1e6*int64(d.style) - 1e4*int64(d.weight) - 1e2*int64(d.hDensity) - int64(d.vDensity)
+	}
+	for _, d := range descriptions {
+		if m.maxWeightSteps >= 0 && abs(weight-d.weight) > int64(m.maxWeightSteps) {
+			continue
+		}
+		dist := descDistance(d)
+		if match == nil || dist < matchDist {
+			match = d
+			matchDist = dist
+		}
+	}
+	if match != nil {
+		out = append(out, match)
+	}
+	return out
+}
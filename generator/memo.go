@@ -0,0 +1,171 @@
+package generator
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// preparedSource is a source font as it is merged, after the steps of generatePackage that depend on the font alone.
+type preparedSource struct {
+	data     []byte
+	base     baseTableReport // The BASE table report of the font alone; see prepareBaseTables
+	dropped  bool            // Whether -drop-tables removed any of its tables
+	stripped bool            // Whether -strip-hints removed its hinting
+}
+
+// prepareSource prepares a source font for merging: it synthesizes a BASE table, drops tables, strips hinting, and
+// rebrands the font as the options ask. None of these steps depend on the other fonts of a package.
+func prepareSource(data []byte, opts *generateOptions) (*preparedSource, error) {
+	sources, report, err := prepareBaseTables([][]byte{data}, opts.baseTable == baseTableSynthesize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare its BASE table: %w", err)
+	}
+	p := &preparedSource{base: report}
+	if len(opts.dropTables) > 0 {
+		var dropped int
+		if sources, dropped, err = dropTables(sources, opts.dropTables); err != nil {
+			return nil, fmt.Errorf("failed to drop tables: %w", err)
+		}
+		p.dropped = dropped > 0
+	}
+	if opts.stripHints {
+		var stripped int
+		if sources, stripped, err = stripHints(sources); err != nil {
+			return nil, fmt.Errorf("failed to strip hinting: %w", err)
+		}
+		p.stripped = stripped > 0
+	}
+	if opts.rebrand != "" {
+		if sources, err = rebrandFonts(sources, opts.rebrand); err != nil {
+			return nil, fmt.Errorf("failed to rebrand: %w", err)
+		}
+	}
+	p.data = sources[0]
+	return p, nil
+}
+
+// sourceMemo loads and prepares each source font of a run once, however many packages merge it: the Bold and
+// BoldItalic packages, for example, share the fonts of most languages, and every package shares the Emoji fonts. The
+// first package that needs a font loads it, which derives the instances of variable fonts, and prepares it, while
+// other packages that need it at the same time wait for it. A font is released once no package holds it; see
+// newSourceMemo.
+type sourceMemo struct {
+	fsys    fs.FS // The input, from which the fonts that were not loaded up front are read
+	opts    *generateOptions
+	prog    *progress
+	counted bool // Whether the references of the fonts were counted up front
+
+	mu      sync.Mutex
+	entries map[string]*memoEntry // By file name
+}
+
+type memoEntry struct {
+	refs     int           // The number of packages that hold the font or have yet to acquire it
+	ready    chan struct{} // Created by the package that loads the font and closed once it is prepared
+	data     []byte        // The contents of the font file
+	prepared *preparedSource
+	err      error
+}
+
+// newSourceMemo returns a memo of the source fonts of a run. loaded holds the fonts that were loaded up front, if any.
+// If packages lists the source fonts of every package of the run, each font is kept until the last package that merges
+// it is done; otherwise, a font is only kept while the packages that acquired it are running, which bounds the memory
+// of the run by that of its running packages, as -max-memory needs.
+func newSourceMemo(fsys fs.FS, loaded map[string][]byte, packages [][]*fontDesc, opts *generateOptions, prog *progress) *sourceMemo {
+	m := &sourceMemo{fsys: fsys, opts: opts, prog: prog, counted: packages != nil, entries: make(map[string]*memoEntry)}
+	for name, data := range loaded {
+		m.entries[name] = &memoEntry{data: data}
+	}
+	for _, fonts := range packages {
+		for _, f := range fonts {
+			m.entry(f.filename).refs++
+		}
+	}
+	return m
+}
+
+func (m *sourceMemo) entry(name string) *memoEntry {
+	e, ok := m.entries[name]
+	if !ok {
+		e = new(memoEntry)
+		m.entries[name] = e
+	}
+	return e
+}
+
+// acquire returns the contents of the source fonts of a package by file name, along with the fonts as they are merged,
+// in the order of fonts. The package must release them once it is done, even if acquire fails.
+func (m *sourceMemo) acquire(fonts []*fontDesc) (map[string][]byte, []*preparedSource, error) {
+	if !m.counted {
+		m.mu.Lock()
+		for _, f := range fonts {
+			m.entry(f.filename).refs++
+		}
+		m.mu.Unlock()
+	}
+	fontData := make(map[string][]byte, len(fonts))
+	prepared := make([]*preparedSource, len(fonts))
+	for i, f := range fonts {
+		// Each font is claimed only when it is needed, since a package that claimed several fonts up front could wait
+		// for a font claimed by another package that waits for one of them
+		m.mu.Lock()
+		e := m.entry(f.filename)
+		load := e.ready == nil
+		if load {
+			e.ready = make(chan struct{})
+		}
+		m.mu.Unlock()
+		if load {
+			e.data, e.prepared, e.err = m.load(f, e.data)
+			close(e.ready)
+		} else {
+			<-e.ready
+		}
+		if e.err != nil {
+			return nil, nil, e.err
+		}
+		fontData[f.filename] = e.data
+		prepared[i] = e.prepared
+	}
+	return fontData, prepared, nil
+}
+
+// load reads a source font unless it was loaded up front, and prepares it.
+func (m *sourceMemo) load(f *fontDesc, data []byte) ([]byte, *preparedSource, error) {
+	if data == nil {
+		m.prog.addTotal(stageExtract, f.size)
+		loaded, err := loadSourceFonts(m.fsys, []*fontDesc{f}, 1, m.prog)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = loaded[f.filename]
+	}
+	prepared, err := prepareSource(data, m.opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare %s: %w", f.filename, err)
+	}
+	return data, prepared, nil
+}
+
+// skip gives up the references of a package that fails before acquiring its source fonts, which were counted up front
+// if the memo counts them.
+func (m *sourceMemo) skip(fonts []*fontDesc) {
+	if m.counted {
+		m.release(fonts)
+	}
+}
+
+// release releases the source fonts of a package that acquired them, dropping those that no other package holds or
+// has yet to acquire.
+func (m *sourceMemo) release(fonts []*fontDesc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range fonts {
+		if e, ok := m.entries[f.filename]; ok {
+			if e.refs--; e.refs <= 0 {
+				delete(m.entries, f.filename)
+			}
+		}
+	}
+}
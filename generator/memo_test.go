@@ -0,0 +1,27 @@
+package generator
+
+import "testing"
+
+func TestSourceMemoSkip(t *testing.T) {
+	sans, arabic := &fontDesc{filename: "NotoSans-Regular.ttf"}, &fontDesc{filename: "NotoSansArabic-Regular.ttf"}
+	m := newSourceMemo(nil, nil, [][]*fontDesc{{sans}, {sans, arabic}}, nil, nil)
+	// A package that fails before acquiring its fonts gives up the references counted for it
+	m.skip([]*fontDesc{sans, arabic})
+	if _, ok := m.entries[arabic.filename]; ok {
+		t.Error("the font of the failed package only was kept")
+	}
+	if e := m.entries[sans.filename]; e == nil || e.refs != 1 {
+		t.Fatalf("the font shared with another package was dropped or miscounted: %+v", e)
+	}
+	m.skip([]*fontDesc{sans})
+	if len(m.entries) != 0 {
+		t.Errorf("%d fonts were kept after every package gave them up", len(m.entries))
+	}
+
+	// Without counted references, a package holds none until it acquires its fonts
+	m = newSourceMemo(nil, map[string][]byte{sans.filename: {0}}, nil, nil, nil)
+	m.skip([]*fontDesc{sans})
+	if _, ok := m.entries[sans.filename]; !ok {
+		t.Error("a font loaded up front was dropped by a package that never acquired it")
+	}
+}
@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// byteSize is a flag.Value holding a number of bytes, such as 4GiB or 512MiB. Suffixes are binary multiples.
+type byteSize int64
+
+var byteSizeSuffixes = []struct {
+	suffix string
+	scale  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+func (s *byteSize) String() string {
+	if *s == 0 {
+		return "0"
+	}
+	for _, u := range byteSizeSuffixes[:4] {
+		if int64(*s)%u.scale == 0 && int64(*s)/u.scale < 1024 {
+			return strconv.FormatInt(int64(*s)/u.scale, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *byteSize) Set(value string) error {
+	num, scale := strings.TrimSpace(value), int64(1)
+	for _, u := range byteSizeSuffixes {
+		if strings.HasSuffix(num, u.suffix) {
+			num, scale = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/scale {
+		return errors.New("expected a size such as 4GiB or 512MiB")
+	}
+	*s = byteSize(n * scale)
+	return nil
+}
+
+// memoryBudget limits the estimated memory used by the packages that are generated at the same time. A nil
+// memoryBudget is unlimited.
+type memoryBudget struct {
+	lock  sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.lock)
+	return b
+}
+
+// acquire waits until n bytes fit into the budget and reserves them. A reservation that exceeds the whole budget is
+// granted once nothing else is reserved, so that oversized packages run alone instead of never.
+func (b *memoryBudget) acquire(n int64) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+func (b *memoryBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.used -= n
+	b.cond.Broadcast()
+}
+
+// jobMemory estimates the memory needed to generate a package from source fonts of the given total size: the source
+// fonts themselves, plus a merge buffer of about the same size.
+func jobMemory(cost int64) int64 {
+	return 2 * cost
+}
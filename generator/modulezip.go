@@ -0,0 +1,169 @@
+package generator
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxModuleZipSize is the largest total size of the uncompressed files of a module zip that the go command accepts.
+const maxModuleZipSize = 500 << 20
+
+// moduleZipFiles returns the names of the files that a module proxy serves for a version of a module, which
+// -output-format module-zip writes into the package directory: VERSION.zip, VERSION.mod, and VERSION.info.
+func moduleZipFiles(version string) []string {
+	return []string{version + ".zip", version + ".mod", version + ".info"}
+}
+
+// moduleZipSink returns a sink that writes the files of a package into a module zip. The go command requires every
+// file of the zip to be under the directory MODULE@VERSION/. The contents of go.mod are also copied to mod, since the
+// proxy serves them separately.
+func moduleZipSink(zw *zip.Writer, prefix string, mod *bytes.Buffer) fileSink {
+	var size int64
+	return func(name string, r io.Reader) error {
+		// The modification times are left unset so that the zip only depends on the files
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: prefix + name, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		if name == "go.mod" {
+			r = io.TeeReader(r, mod)
+		}
+		n, err := io.Copy(w, r)
+		if err != nil {
+			return err
+		}
+		if size += n; size > maxModuleZipSize {
+			return fmt.Errorf("the module zip exceeds the limit of %d MiB of the go command", maxModuleZipSize>>20)
+		}
+		return nil
+	}
+}
+
+// generateModuleZip generates a package as a module zip in packageDir, along with the go.mod and version info files
+// that a module proxy serves next to it, so that the package can be uploaded to a proxy such as Athens or Artifactory
+// without a repository. The files are written under temporary names and renamed once the zip is complete.
+func generateModuleZip(spec packageSpec, packageDir string, buf *seekBuffer, fp *familyProgress, opts *generateOptions) (*manifestPackage, error) {
+	modulePath := opts.modulePrefix + spec.family.name
+	tmp, err := ioutil.TempFile(packageDir, ".module-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create module zip: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	zw := zip.NewWriter(tmp)
+	var mod bytes.Buffer
+	result, err := generatePackage(spec, moduleZipSink(zw, modulePath+"@"+opts.moduleVersion+"/", &mod), buf, fp, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write module zip: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write module zip: %w", err)
+	}
+	info, err := json.Marshal(struct {
+		Version string
+		Time    string
+	}{opts.moduleVersion, time.Now().UTC().Format(time.RFC3339)})
+	if err != nil {
+		return nil, err
+	}
+	files := moduleZipFiles(opts.moduleVersion)
+	if err := ioutil.WriteFile(filepath.Join(packageDir, files[1]), mod.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write module file: %w", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(packageDir, files[2]), append(info, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write version info file: %w", err)
+	}
+	// Temporary files are only readable by their owner
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write module zip: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(packageDir, files[0])); err != nil {
+		return nil, fmt.Errorf("failed to write module zip: %w", err)
+	}
+	if opts.clean {
+		written := make(map[string]bool)
+		for _, f := range files {
+			written[f] = true
+		}
+		if err := cleanPackageDir(packageDir, written); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// moduleZips returns the module zips that -output-format module-zip wrote into packageDir, in no particular order.
+// Without -clean, the zips of earlier versions are kept.
+func moduleZips(packageDir string) []string {
+	matches, _ := filepath.Glob(filepath.Join(packageDir, "v*.zip"))
+	return matches
+}
+
+// latestModuleZip returns the most recently written module zip in packageDir, or the empty string if there is none.
+func latestModuleZip(packageDir string) string {
+	var latest string
+	var latestTime time.Time
+	for _, m := range moduleZips(packageDir) {
+		if fi, err := os.Stat(m); err == nil && (latest == "" || fi.ModTime().After(latestTime)) {
+			latest, latestTime = m, fi.ModTime()
+		}
+	}
+	return latest
+}
+
+// moduleZipPrefix returns the directory MODULE@VERSION that holds the files of a module zip, or the empty string if
+// the zip is not a module zip. The module path may contain slashes itself.
+func moduleZipPrefix(z *zip.Reader) string {
+	if len(z.File) == 0 {
+		return ""
+	}
+	name := z.File[0].Name
+	at := strings.IndexByte(name, '@')
+	if at < 0 {
+		return ""
+	}
+	slash := strings.IndexByte(name[at:], '/')
+	if slash < 0 {
+		return ""
+	}
+	return name[:at+slash]
+}
+
+// openModuleZip opens the most recently written module zip in packageDir, and returns the files of the module. The
+// returned function closes the zip. If packageDir contains no module zip, ok is false.
+func openModuleZip(packageDir string) (fsys fs.FS, closeZip func() error, ok bool, err error) {
+	latest := latestModuleZip(packageDir)
+	if latest == "" {
+		return nil, nil, false, nil
+	}
+	z, err := zip.OpenReader(latest)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	prefix := moduleZipPrefix(&z.Reader)
+	if prefix == "" || path.Base(prefix[:strings.IndexByte(prefix, '@')]) != filepath.Base(packageDir) {
+		_ = z.Close()
+		return nil, nil, false, fmt.Errorf("%s is not a module zip of package %s", filepath.Base(latest), filepath.Base(packageDir))
+	}
+	sub, err := fs.Sub(z, prefix)
+	if err != nil {
+		_ = z.Close()
+		return nil, nil, false, err
+	}
+	return sub, z.Close, true, nil
+}
@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// namingData is the data available to naming templates, which compute the names of the output families.
+type namingData struct {
+	Name        string // The standard name of the family, e.g. "notosansbolditalic"
+	Input       string // The input family, e.g. "Sans"
+	Weight      string // e.g. "Bold"
+	WeightClass int    // The OpenType weight class, e.g. 700 for Bold
+	Width       string // e.g. "Condensed", or "" for normal width
+	UI          bool   // Whether the family prefers UI variants
+	Style       string // Either "Italic" or "" for normal style
+	Italic      bool
+}
+
+func newNamingData(f outputFamily) namingData {
+	var weightClass int
+	if w, err := noto.ParseWeight(f.weight); err == nil {
+		weightClass = int(w.Class())
+	}
+	return namingData{
+		Name:        f.name,
+		Input:       f.inputFamily,
+		Weight:      f.weight,
+		WeightClass: weightClass,
+		Width:       f.hDensity,
+		UI:          f.vDensity == "UI",
+		Style:       f.style,
+		Italic:      f.style == "Italic",
+	}
+}
+
+var namingFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// applyNaming renames the families using a text/template naming scheme, such as
+// `corpfont-{{lower .Input}}-{{.WeightClass}}{{if .Italic}}-italic{{end}}`. The new name is used for the output
+// directory and the module path, and the Go package name is derived from it.
+func applyNaming(families []outputFamily, scheme string) ([]outputFamily, error) {
+	t, err := template.New("naming").Funcs(namingFuncs).Option("missingkey=error").Parse(scheme)
+	if err != nil {
+		return nil, fmt.Errorf("invalid naming scheme: %w", err)
+	}
+	out := make([]outputFamily, 0, len(families))
+	for _, f := range families {
+		var b strings.Builder
+		if err := t.Execute(&b, newNamingData(f)); err != nil {
+			return nil, fmt.Errorf("failed to apply naming scheme to %s: %w", f.name, err)
+		}
+		renamed := f
+		renamed.name = b.String()
+		if !isFamilyName(renamed.name) || renamed.packageName() == "" {
+			return nil, fmt.Errorf("naming scheme produced invalid name %q for %s", renamed.name, f.name)
+		}
+		if out, err = appendUniqueFamily(out, renamed); err != nil {
+			return nil, fmt.Errorf("naming scheme is ambiguous: %w", err)
+		}
+	}
+	return out, nil
+}
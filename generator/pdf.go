@@ -0,0 +1,312 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// pdfPackage is the name of the sub-package generated with -pdf-helper, and of its directory within the font module.
+const pdfPackage = "pdf"
+
+// generatePDFHelper writes the pdf sub-package of a font package, which provides the member fonts of the collection
+// in the forms that PDF generators embed: standalone font files, bare CFF tables, and the character mappings needed
+// for ToUnicode CMaps. The sub-package only imports the font package and the standard library, and is only compiled
+// into programs that import it. Stale copies from runs without -pdf-helper are removed by removePDFHelper.
+func generatePDFHelper(packageName string, moduleName string, description string, sink fileSink, opts *generateOptions) error {
+	file := path.Join(pdfPackage, "pdf.go")
+	header, err := goFileHeader(opts, headerData{File: file, Package: pdfPackage, Description: description, Notice: fontNotice(opts.rebrand)})
+	if err != nil {
+		return err
+	}
+	if err := sink.writeString(file, header+`// Package `+pdfPackage+` provides the fonts of package `+packageName+` in the forms that PDF generators embed.
+//
+// A font with TrueType outlines is embedded as a FontFile2 stream with the data returned by Font. A font with CFF
+// outlines is embedded either as a FontFile3 stream of subtype OpenType with the data returned by Font, or of subtype
+// CIDFontType0C with the table returned by CFF. The ToUnicode CMap of a font maps its glyphs to the characters
+// returned by ToUnicode, so that the text of the PDF can be extracted and searched.
+package `+pdfPackage+`
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+
+	`+packageName+` "`+opts.modulePrefix+moduleName+`"
+)
+
+var errInvalid = errors.New("invalid font collection")
+
+// NumFonts returns the number of fonts in the collection.
+func NumFonts() int {
+	otc := `+packageName+`.OTC()
+	if len(otc) < 12 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(otc[8:]))
+}
+
+// table is an entry of the table directory of a font.
+type table struct {
+	tag      string
+	checksum uint32
+	data     []byte
+}
+
+// tables returns the tables of font i of the collection, sorted by tag.
+func tables(i int) ([]table, error) {
+	otc := `+packageName+`.OTC()
+	if i < 0 || i >= NumFonts() || len(otc) < 12+4*(i+1) {
+		return nil, fmt.Errorf("font %d is not in the collection", i)
+	}
+	offset := int(binary.BigEndian.Uint32(otc[12+4*i:]))
+	if offset+12 > len(otc) {
+		return nil, errInvalid
+	}
+	numTables := int(binary.BigEndian.Uint16(otc[offset+4:]))
+	if offset+12+16*numTables > len(otc) {
+		return nil, errInvalid
+	}
+	result := make([]table, numTables)
+	for j := range result {
+		record := otc[offset+12+16*j:]
+		start, length := binary.BigEndian.Uint32(record[8:]), binary.BigEndian.Uint32(record[12:])
+		if uint64(start)+uint64(length) > uint64(len(otc)) {
+			return nil, errInvalid
+		}
+		result[j] = table{string(record[:4]), binary.BigEndian.Uint32(record[4:]), otc[start : start+length]}
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].tag < result[b].tag })
+	return result, nil
+}
+
+// findTable returns the table of font i with the given tag, or nil if the font has no such table.
+func findTable(i int, tag string) ([]byte, error) {
+	ts, err := tables(i)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range ts {
+		if t.tag == tag {
+			return t.data, nil
+		}
+	}
+	return nil, nil
+}
+
+// Font returns font i of the collection as a standalone OpenType font file. The fonts of the collection share
+// tables, which are copied into each font that is extracted.
+func Font(i int) ([]byte, error) {
+	ts, err := tables(i)
+	if err != nil {
+		return nil, err
+	}
+	version := uint32(0x00010000)
+	for _, t := range ts {
+		if t.tag == "CFF " || t.tag == "CFF2" {
+			version = 0x4F54544F // OTTO
+		}
+	}
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= len(ts) {
+		searchRange, entrySelector = searchRange*2, entrySelector+1
+	}
+	size := 12 + 16*len(ts)
+	for _, t := range ts {
+		size += (len(t.data) + 3) &^ 3
+	}
+	font := make([]byte, 12+16*len(ts), size)
+	binary.BigEndian.PutUint32(font, version)
+	binary.BigEndian.PutUint16(font[4:], uint16(len(ts)))
+	binary.BigEndian.PutUint16(font[6:], uint16(searchRange*16))
+	binary.BigEndian.PutUint16(font[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(font[10:], uint16(len(ts)*16-searchRange*16))
+	head := -1
+	for j, t := range ts {
+		record := font[12+16*j:]
+		copy(record, t.tag)
+		binary.BigEndian.PutUint32(record[4:], t.checksum)
+		binary.BigEndian.PutUint32(record[8:], uint32(len(font)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(t.data)))
+		if t.tag == "head" && len(t.data) >= 12 {
+			head = len(font)
+		}
+		font = append(font, t.data...)
+		for len(font)%4 != 0 {
+			font = append(font, 0)
+		}
+	}
+	if head >= 0 {
+		// The checksum adjustment of the head table covers the whole file, so it differs from that in the collection
+		binary.BigEndian.PutUint32(font[head+8:], 0)
+		var sum uint32
+		for j := 0; j < len(font); j += 4 {
+			sum += binary.BigEndian.Uint32(font[j:])
+		}
+		binary.BigEndian.PutUint32(font[head+8:], 0xB1B0AFBA-sum)
+	}
+	return font, nil
+}
+
+// CFF returns the CFF table of font i, or nil if the font has TrueType outlines.
+func CFF(i int) ([]byte, error) {
+	data, err := findTable(i, "CFF ")
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// CMap returns the glyph of each character that font i maps, from the Unicode subtable of its cmap table.
+func CMap(i int) (map[rune]uint16, error) {
+	cmap, err := findTable(i, "cmap")
+	if err != nil {
+		return nil, err
+	}
+	if len(cmap) < 4 {
+		return nil, fmt.Errorf("font %d has no cmap table", i)
+	}
+	// Prefer the subtable with characters beyond the Basic Multilingual Plane
+	var best []byte
+	bestRank := 0
+	for j := 0; j < int(binary.BigEndian.Uint16(cmap[2:])) && 4+8*j+8 <= len(cmap); j++ {
+		record := cmap[4+8*j:]
+		platform, encoding, offset := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:]), binary.BigEndian.Uint32(record[4:])
+		if uint64(offset)+2 > uint64(len(cmap)) {
+			return nil, errInvalid
+		}
+		rank := 0
+		switch format := binary.BigEndian.Uint16(cmap[offset:]); {
+		case format == 12 && (platform == 0 || platform == 3 && encoding == 10):
+			rank = 2
+		case format == 4 && (platform == 0 || platform == 3 && encoding == 1):
+			rank = 1
+		}
+		if rank > bestRank {
+			best, bestRank = cmap[offset:], rank
+		}
+	}
+	glyphs := make(map[rune]uint16)
+	switch bestRank {
+	case 0:
+		return nil, fmt.Errorf("font %d has no Unicode cmap subtable", i)
+	case 1:
+		if len(best) < 14 {
+			return nil, errInvalid
+		}
+		segments := int(binary.BigEndian.Uint16(best[6:])) / 2
+		if 16+8*segments > len(best) {
+			return nil, errInvalid
+		}
+		ends, starts, deltas, rangeOffsets := best[14:], best[16+2*segments:], best[16+4*segments:], best[16+6*segments:]
+		for s := 0; s < segments; s++ {
+			start, end := binary.BigEndian.Uint16(starts[2*s:]), binary.BigEndian.Uint16(ends[2*s:])
+			delta, rangeOffset := binary.BigEndian.Uint16(deltas[2*s:]), int(binary.BigEndian.Uint16(rangeOffsets[2*s:]))
+			for c := int(start); c <= int(end) && c != 0xFFFF; c++ {
+				glyph := uint16(c) + delta
+				if rangeOffset != 0 {
+					at := 16 + 6*segments + 2*s + rangeOffset + 2*(c-int(start))
+					if at+2 > len(best) {
+						return nil, errInvalid
+					}
+					if glyph = binary.BigEndian.Uint16(best[at:]); glyph != 0 {
+						glyph += delta
+					}
+				}
+				if glyph != 0 {
+					glyphs[rune(c)] = glyph
+				}
+			}
+		}
+	case 2:
+		if len(best) < 16 {
+			return nil, errInvalid
+		}
+		groups := int(binary.BigEndian.Uint32(best[12:]))
+		if groups > (len(best)-16)/12 {
+			return nil, errInvalid
+		}
+		for g := 0; g < groups; g++ {
+			group := best[16+12*g:]
+			start, end, glyph := binary.BigEndian.Uint32(group), binary.BigEndian.Uint32(group[4:]), binary.BigEndian.Uint32(group[8:])
+			if end < start || end > 0x10FFFF || glyph+(end-start) > 0xFFFF {
+				return nil, errInvalid
+			}
+			for c := start; c <= end; c++ {
+				glyphs[rune(c)] = uint16(glyph + c - start)
+			}
+		}
+	}
+	return glyphs, nil
+}
+
+// ToUnicode returns the characters that font i maps to each of its glyphs, by glyph ID, as needed for the ToUnicode
+// CMap of the font in a PDF. Glyphs that no character maps to, such as those of ligatures, have no entry. Where
+// several characters map to the same glyph, the lowest is used.
+func ToUnicode(i int) (map[uint16]rune, error) {
+	glyphs, err := CMap(i)
+	if err != nil {
+		return nil, err
+	}
+	chars := make(map[uint16]rune, len(glyphs))
+	for c, g := range glyphs {
+		if prev, ok := chars[g]; !ok || c < prev {
+			chars[g] = c
+		}
+	}
+	return chars, nil
+}
+
+// PostScriptName returns the PostScript name of font i from its name table, which PDF generators use as the BaseFont
+// name of the font.
+func PostScriptName(i int) (string, error) {
+	name, err := findTable(i, "name")
+	if err != nil {
+		return "", err
+	}
+	if len(name) < 6 {
+		return "", fmt.Errorf("font %d has no name table", i)
+	}
+	count, storage := int(binary.BigEndian.Uint16(name[2:])), int(binary.BigEndian.Uint16(name[4:]))
+	for j := 0; j < count && 6+12*j+12 <= len(name); j++ {
+		record := name[6+12*j:]
+		platform, nameID := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[6:])
+		length, offset := int(binary.BigEndian.Uint16(record[8:])), int(binary.BigEndian.Uint16(record[10:]))
+		if nameID != 6 || storage+offset+length > len(name) {
+			continue
+		}
+		value := name[storage+offset : storage+offset+length]
+		switch platform {
+		case 1:
+			return string(value), nil
+		case 0, 3:
+			units := make([]uint16, len(value)/2)
+			for k := range units {
+				units[k] = binary.BigEndian.Uint16(value[2*k:])
+			}
+			return string(utf16.Decode(units)), nil
+		}
+	}
+	return "", fmt.Errorf("font %d has no PostScript name", i)
+}
+`); err != nil {
+		return fmt.Errorf("failed to write PDF helper: %w", err)
+	}
+	return nil
+}
+
+// removePDFHelper removes the pdf sub-package that a previous run with -pdf-helper wrote to the package in outputDir.
+// The directory is kept if it contains other files.
+func removePDFHelper(outputDir string) error {
+	dir := filepath.Join(outputDir, pdfPackage)
+	if err := os.Remove(filepath.Join(dir, "pdf.go")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete stale PDF helper: %w", err)
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+		_ = os.Remove(dir)
+	}
+	return nil
+}
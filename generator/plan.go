@@ -0,0 +1,18 @@
+package generator
+
+import "fmt"
+
+// printPlan describes the package that would be generated for an output family, listing its source fonts in fallback
+// order.
+func printPlan(outFamily outputFamily, sourceFonts []*fontDesc) {
+	var size, compressed int64
+	for _, f := range sourceFonts {
+		size += f.size
+		compressed += f.compressedSize
+	}
+	fmt.Printf("%s: %d source fonts, %.1f MiB (%.1f MiB compressed)\n", outFamily.name, len(sourceFonts),
+		float64(size)/(1024*1024), float64(compressed)/(1024*1024))
+	for _, f := range sourceFonts {
+		fmt.Printf("  %s\n", f.filename)
+	}
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pool runs the tasks of a phase, such as reading the source fonts or generating the packages, on a bounded number of
+// workers. Submitting a task blocks until a worker is free and, with a memory budget, until the estimated memory of
+// the task is available, so tasks start in the order in which they are submitted: callers express priorities by
+// submitting the most important tasks first. Each worker has an index below the number of workers, so that tasks can
+// reuse per-worker resources such as merge buffers.
+type pool struct {
+	phase   string        // The name of the phase in log messages, e.g. "read"
+	workers chan int      // The indices of the idle workers
+	budget  *memoryBudget // If not nil, limits the memory of the running tasks
+	wg      sync.WaitGroup
+
+	errLock sync.Mutex
+	err     error // The first error returned by a task
+
+	start   time.Time
+	tasks   int64 // The number of tasks submitted
+	busy    int64 // The total running time of the tasks, in nanoseconds
+	running int64 // The number of running tasks
+	peak    int64 // The highest number of tasks that ran at the same time
+}
+
+func newPool(phase string, workers int, budget *memoryBudget) *pool {
+	p := &pool{phase: phase, workers: make(chan int, workers), budget: budget, start: time.Now()}
+	for i := 0; i < workers; i++ {
+		p.workers <- i
+	}
+	return p
+}
+
+// Go waits for a free worker and for memory bytes of the budget, then runs task on the worker in a new goroutine.
+func (p *pool) Go(memory int64, task func(worker int) error) {
+	worker := <-p.workers
+	p.budget.acquire(memory)
+	atomic.AddInt64(&p.tasks, 1)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() { p.workers <- worker }()
+		defer p.budget.release(memory)
+		running := atomic.AddInt64(&p.running, 1)
+		for peak := atomic.LoadInt64(&p.peak); running > peak && !atomic.CompareAndSwapInt64(&p.peak, peak, running); {
+			peak = atomic.LoadInt64(&p.peak)
+		}
+		started := time.Now()
+		err := task(worker)
+		atomic.AddInt64(&p.busy, int64(time.Since(started)))
+		atomic.AddInt64(&p.running, -1)
+		if err != nil {
+			p.errLock.Lock()
+			defer p.errLock.Unlock()
+			if p.err == nil {
+				p.err = err
+			}
+		}
+	}()
+}
+
+// Wait waits for all submitted tasks to finish, logs the utilization of the workers, and returns the first error
+// returned by a task.
+func (p *pool) Wait() error {
+	p.wg.Wait()
+	elapsed := time.Since(p.start)
+	log.debugf("Finished %s phase: %d tasks on up to %d of %d workers, %.1fs of work in %.1fs", p.phase,
+		p.tasks, p.peak, cap(p.workers), time.Duration(p.busy).Seconds(), elapsed.Seconds())
+	return p.err
+}
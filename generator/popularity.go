@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generateScriptsFile writes scripts.go, which lists the scripts of the fonts of the collection with the estimated
+// number of their readers from scriptReaders, so that applications can prioritize the fonts at runtime, such as when
+// only some of them can be loaded.
+func generateScriptsFile(packageName string, sink fileSink, description string, sourceFonts []*fontDesc, opts *generateOptions) error {
+	header, err := goFileHeader(opts, headerData{File: "scripts.go", Package: packageName, Description: description, Notice: fontNotice(opts.rebrand)})
+	if err != nil {
+		return err
+	}
+	first := firstFonts(sourceFonts)
+	names := make([]string, 0, len(first))
+	for name := range first {
+		// The fonts of combo families, such as Emoji and SansSymbols, are named after their family rather than a script
+		if exactIndexOf(name, families) < 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return first[names[i]] < first[names[j]] })
+	rankLanguages(names)
+	var entries strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&entries, "\t{%s, %d, %d},\n", strconv.Quote(name), first[name], scriptReaders[name])
+	}
+	if err := sink.writeString("scripts.go", header+`package `+packageName+`
+
+// Script describes a script or language covered by the font collection.
+type Script struct {
+	Name    string // The name of the script or language in the Noto file names, e.g. "Devanagari" or "CJKjp"
+	Font    int    // The index of the font of the collection that renders it
+	Readers int    // The estimated number of people who read the script, in thousands, or 0 if unknown
+}
+
+var scripts = []Script{
+`+entries.String()+`}
+
+// Scripts returns the scripts covered by the fonts of the collection, most widely read first. The first font of the
+// collection, which covers the Latin, Greek, and Cyrillic scripts, and the fonts of combo families, such as Emoji, are
+// not listed.
+func Scripts() []Script {
+	return append([]Script(nil), scripts...)
+}
+`); err != nil {
+		return fmt.Errorf("failed to write scripts file: %w", err)
+	}
+	return nil
+}
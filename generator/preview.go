@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func setupPreview(c *command, fs *flag.FlagSet) func(args []string) error {
+	family := fs.String("family", "notosans", "name of the font package to render the text with")
+	text := fs.String("text", "", "text to render; \\n separates lines (default a line of each sample script of compare)")
+	size := fs.Float64("size", 32, "font size of the text, in pixels")
+	output := fs.String("o", "", "path of the PNG image to write (default FAMILY.png)")
+	var lf logFlags
+	lf.register(fs)
+	return func(args []string) error {
+		args = envArgs(args, "OUTPUT")
+		if len(args) > 1 {
+			return usageErrorf(c, fs, "Expected at most one output directory")
+		}
+		if err := lf.apply(); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if *size < 4 || *size > 512 {
+			return usageErrorf(c, fs, "Invalid -size value %g", *size)
+		}
+		if *family == "" || strings.ContainsAny(*family, `/\`) {
+			return usageErrorf(c, fs, "Invalid -family value %q", *family)
+		}
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		var lines []string
+		if *text == "" {
+			for _, s := range visualSamples {
+				lines = append(lines, s.text)
+			}
+		} else {
+			lines = strings.Split(strings.ReplaceAll(*text, `\n`, "\n"), "\n")
+		}
+		path := *output
+		if path == "" {
+			path = *family + ".png"
+		}
+		return writePreview(filepath.Join(dir, *family), lines, *size, path)
+	}
+}
+
+// writePreview renders lines of text with a generated font package and writes them, in black on white, to a PNG
+// image. As with compare, each character is drawn from the first font in the collection that has a glyph for it,
+// without shaping, so the image shows the coverage and fallback order of the collection rather than how a text layout
+// engine would set the text.
+func writePreview(packageDir string, lines []string, size float64, path string) error {
+	vf, err := loadVisualFonts(packageDir, size)
+	if err != nil {
+		return err
+	}
+	var rendered []*image.Gray
+	width, height, missing := 0, 0, 0
+	for _, line := range lines {
+		img, m := vf.render(line)
+		rendered = append(rendered, img)
+		missing += m
+		if w := img.Bounds().Dx(); w > width {
+			width = w
+		}
+		height += img.Bounds().Dy()
+	}
+	out := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range out.Pix {
+		out.Pix[i] = 255
+	}
+	y := 0
+	for _, img := range rendered {
+		b := img.Bounds()
+		for dy := 0; dy < b.Dy(); dy++ {
+			for dx := 0; dx < b.Dx(); dx++ {
+				out.SetGray(dx, y+dy, color.Gray{Y: 255 - img.GrayAt(b.Min.X+dx, b.Min.Y+dy).Y})
+			}
+		}
+		y += b.Dy()
+	}
+	if missing > 0 {
+		log.warnf("%d characters have no glyph in %s", missing, filepath.Base(packageDir))
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create the directory of %s: %w", path, err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create preview image: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := png.Encode(f, out); err != nil {
+		return fmt.Errorf("failed to write preview image: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write preview image: %w", err)
+	}
+	log.infof("Wrote %s", path)
+	return nil
+}
@@ -0,0 +1,215 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// profile is a preset that tailors the generated packages to a use case. The packages produced with a profile are
+// named after it, so that they can be published alongside the standard packages.
+type profile struct {
+	name    string
+	suffix  string // Appended to the name of every package
+	summary string // Appended to the description of every package
+
+	stripHints     bool     // See -strip-hints
+	dropTables     []string // See -drop-tables
+	requireHinting bool     // Whether to warn about source fonts without hinting
+	sources        string   // The copies of fonts to take, sourcesHinted or sourcesUnhinted; see prefersHinted
+
+	ui               bool // Whether every package prefers the UI variants, which have tighter vertical metrics
+	checkLineMetrics bool // Whether to warn about source fonts that are taller than the base font; see checkLineMetrics
+
+	inputs           []string // If set, only packages of these input families are generated
+	includeLanguages []string // The default for -include-languages
+	allWeights       bool     // See -all-weights
+	prepend, append  []string // If not nil, replace the combo families of every package; see withComboFamilies
+}
+
+// The copies of fonts that a profile takes from inputs that have both hinted and unhinted ones.
+const (
+	sourcesHinted   = "hinted"
+	sourcesUnhinted = "unhinted"
+)
+
+// mobileLayoutTables are the OpenType layout tables that the text stacks of mobile platforms do not read: JSTF, whose
+// justification alternatives neither HarfBuzz nor Core Text applies. The obsolete DSIG signature goes with them.
+var mobileLayoutTables = []string{"JSTF", "DSIG"}
+
+var profiles = []profile{
+	{
+		name:             "minimal",
+		suffix:           "-minimal",
+		summary:          "This variant only covers Latin, Greek, Cyrillic, and CJK text.",
+		inputs:           []string{"Sans"},
+		includeLanguages: []string{"CJK*"},
+		prepend:          []string{},
+		append:           []string{},
+	},
+	{
+		// The standard packages, so that scripts can name the profile that they use
+		name: "standard",
+	},
+	{
+		name:       "full",
+		allWeights: true,
+	},
+	{
+		name:       "mobile",
+		suffix:     "-mobile",
+		summary:    "This variant omits hinting instructions and unused layout tables to reduce the size of mobile app bundles.",
+		stripHints: true,
+		dropTables: mobileLayoutTables,
+		sources:    sourcesUnhinted,
+	},
+	{
+		name:           "desktop",
+		suffix:         "-desktop",
+		summary:        "This variant keeps the hinting instructions for sharper rendering on low-resolution screens.",
+		dropTables:     []string{"DSIG"},
+		requireHinting: true,
+		sources:        sourcesHinted,
+	},
+	{
+		// The UI variants keep the glyphs of every script within the line height of the Latin fonts, so that large
+		// text lays out predictably in any language
+		name:             "accessible",
+		suffix:           "-accessible",
+		summary:          "This variant prefers UI fonts, whose line metrics are consistent across scripts, for large-text layouts.",
+		inputs:           []string{"Sans", "Serif"},
+		ui:               true,
+		checkLineMetrics: true,
+	},
+}
+
+// profileConfig defines a profile in the config file. Profiles in the config file replace built-in profiles with the
+// same name.
+type profileConfig struct {
+	Name           string   `json:"name"`
+	Suffix         string   `json:"suffix"` // Default "-" followed by the name
+	Summary        string   `json:"summary"`
+	StripHints     bool     `json:"strip_hints"`
+	DropTables     []string `json:"drop_tables"`
+	RequireHinting bool     `json:"require_hinting"`
+	Sources        string   `json:"sources"` // "hinted" or "unhinted"; default "hinted" with require_hinting
+
+	UI               bool `json:"ui"`                 // Prefer the UI variants in every package
+	CheckLineMetrics bool `json:"check_line_metrics"` // Warn about source fonts that are taller than the base font
+
+	Inputs           []string `json:"inputs"`            // Only generate packages of these input families, e.g. "Sans"
+	IncludeLanguages []string `json:"include_languages"` // The default for -include-languages
+	AllWeights       bool     `json:"all_weights"`
+	Prepend          []string `json:"prepend"` // Replaces the prepended combo families of every package if set
+	Append           []string `json:"append"`  // Replaces the appended combo families of every package if set
+}
+
+func (pc profileConfig) profile() (profile, error) {
+	p := profile{
+		name:           pc.Name,
+		suffix:         pc.Suffix,
+		summary:        pc.Summary,
+		stripHints:     pc.StripHints,
+		requireHinting: pc.RequireHinting,
+		sources:        pc.Sources,
+
+		ui:               pc.UI,
+		checkLineMetrics: pc.CheckLineMetrics,
+
+		inputs:           pc.Inputs,
+		includeLanguages: pc.IncludeLanguages,
+		allWeights:       pc.AllWeights,
+		prepend:          pc.Prepend,
+		append:           pc.Append,
+	}
+	if !isFamilyName(p.name) {
+		return p, fmt.Errorf("name %q must contain only lowercase letters, digits, and -._ and start with a letter", p.name)
+	}
+	if p.suffix == "" {
+		p.suffix = "-" + p.name
+	}
+	if !isFamilyName("a" + p.suffix) {
+		return p, fmt.Errorf("suffix %q must contain only lowercase letters, digits, and -._", p.suffix)
+	}
+	if p.sources != "" && p.sources != sourcesHinted && p.sources != sourcesUnhinted {
+		return p, fmt.Errorf("sources %q must be %s or %s", p.sources, sourcesHinted, sourcesUnhinted)
+	}
+	for _, input := range p.inputs {
+		if exactIndexOf(input, families) < 0 {
+			return p, fmt.Errorf("unknown input family %q", input)
+		}
+	}
+	for _, c := range append(append([]string(nil), p.prepend...), p.append...) {
+		if _, _, ok := comboSource(c); !ok {
+			return p, fmt.Errorf("unknown combo family %q", c)
+		}
+	}
+	if err := validateLanguagePatterns(p.includeLanguages); err != nil {
+		return p, err
+	}
+	for _, t := range pc.DropTables {
+		tag, err := parseTableTag(t)
+		if err != nil {
+			return p, err
+		}
+		p.dropTables = append(p.dropTables, tag)
+	}
+	return p, nil
+}
+
+// findProfile returns the profile with the given name, looking first at the profiles defined in the config file. The
+// empty name selects no profile and returns nil.
+func findProfile(name string, configured []profileConfig) (*profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	var names []string
+	for _, pc := range configured {
+		if pc.Name == name {
+			p, err := pc.profile()
+			if err != nil {
+				return nil, fmt.Errorf("profile %q: %w", name, err)
+			}
+			return &p, nil
+		}
+		names = append(names, pc.Name)
+	}
+	for i := range profiles {
+		if profiles[i].name == name {
+			return &profiles[i], nil
+		}
+		names = append(names, profiles[i].name)
+	}
+	return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// prefersHinted reports whether the profile, which may be nil, takes the hinted copies of fonts that appear in both the
+// hinted and unhinted directories of an input; see preferFonts. Profiles that do not choose take the hinted copies if
+// they require hinting, and the unhinted ones otherwise.
+func (p *profile) prefersHinted() bool {
+	if p == nil {
+		return false
+	}
+	if p.sources != "" {
+		return p.sources == sourcesHinted
+	}
+	return p.requireHinting
+}
+
+// apply returns copies of the families of the profile's inputs, renamed for the profile.
+func (p *profile) apply(available []outputFamily) []outputFamily {
+	var out []outputFamily
+	for _, f := range available {
+		if len(p.inputs) > 0 && exactIndexOf(f.inputFamily, p.inputs) < 0 {
+			continue
+		}
+		f.name += p.suffix
+		if p.ui {
+			f.vDensity = "UI"
+		}
+		if p.summary != "" {
+			f.description += " " + p.summary
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,281 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values accepted by the -progress flag. With auto, the progress display is shown when standard error is a terminal.
+const (
+	progressAuto   = "auto"
+	progressAlways = "always"
+	progressNever  = "never"
+)
+
+// progressStage is a step that every package goes through. Progress in each stage is measured in bytes of source
+// fonts, so that the stages can be compared and large packages count for more than small ones.
+type progressStage int
+
+const (
+	stageExtract progressStage = iota
+	stageMerge
+	stageCompress
+	stageWrite
+	numStages
+)
+
+var stageNames = [numStages]string{"Extracting", "Merging", "Compressing", "Writing chunks"}
+
+// progressInterval is how often the progress display is redrawn.
+const progressInterval = 250 * time.Millisecond
+
+// progressBlockSize is the amount of data compressed between progress updates.
+const progressBlockSize = 1 << 20
+
+// maxProgressFamilies limits the number of running packages listed below the stages.
+const maxProgressFamilies = 8
+
+// progress tracks how far generateFonts is in each stage and draws a live display of the stages and the running
+// packages to a terminal. A nil progress tracks nothing.
+type progress struct {
+	lock     sync.Mutex
+	w        io.Writer
+	logW     io.Writer // The writer of the logger before the display was started
+	stages   [numStages]stageProgress
+	families []*familyProgress // The running packages, in the order they started
+	lines    int               // The number of lines currently drawn
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+type stageProgress struct {
+	done  int64
+	total int64
+	start time.Time // When the first progress was made
+}
+
+// showProgress reports whether the progress display should be shown for the -progress mode.
+func showProgress(mode string) bool {
+	switch mode {
+	case progressAlways:
+		return true
+	case progressAuto:
+		fi, err := os.Stderr.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0
+	}
+	return false
+}
+
+// newProgress starts drawing the progress display to w. Log messages are printed above the display while it runs.
+func newProgress(w io.Writer) *progress {
+	p := &progress{w: w, stop: make(chan struct{}), stopped: make(chan struct{})}
+	log.lock.Lock()
+	p.logW, log.w = log.w, progressLogWriter{p}
+	log.lock.Unlock()
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.lock.Lock()
+				p.redraw()
+				p.lock.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// close removes the display and restores the output of the logger.
+func (p *progress) close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	log.lock.Lock()
+	log.w = p.logW
+	log.lock.Unlock()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.clear()
+}
+
+// addTotal adds n bytes to the work of a stage.
+func (p *progress) addTotal(stage progressStage, n int64) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stages[stage].total += n
+}
+
+// advance records that n more bytes of a stage are done.
+func (p *progress) advance(stage progressStage, n int64) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.advanceLocked(stage, n)
+}
+
+func (p *progress) advanceLocked(stage progressStage, n int64) {
+	s := &p.stages[stage]
+	if s.start.IsZero() {
+		s.start = time.Now()
+	}
+	s.done += n
+}
+
+// addPackage adds a package whose source fonts total cost bytes to the work of the stages after extraction.
+func (p *progress) addPackage(cost int64) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for stage := stageMerge; stage < numStages; stage++ {
+		p.stages[stage].total += cost
+	}
+}
+
+// family starts showing a package that was added with addPackage.
+func (p *progress) family(name string, cost int64) *familyProgress {
+	if p == nil {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	f := &familyProgress{p: p, name: name, cost: cost, state: "starting"}
+	p.families = append(p.families, f)
+	return f
+}
+
+// clear erases the display. The cursor is left at the start of the first line of the display.
+func (p *progress) clear() {
+	if p.lines > 0 {
+		_, _ = fmt.Fprintf(p.w, "\x1b[%dA\r\x1b[J", p.lines)
+		p.lines = 0
+	}
+}
+
+func (p *progress) redraw() {
+	var b strings.Builder
+	lines := 0
+	for stage := progressStage(0); stage < numStages; stage++ {
+		s := p.stages[stage]
+		if s.total == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%-15s %8.1f / %.1f MiB %3d%%  %s\n", stageNames[stage], float64(s.done)/(1024*1024),
+			float64(s.total)/(1024*1024), 100*s.done/s.total, s.eta())
+		lines++
+	}
+	for i, f := range p.families {
+		if i == maxProgressFamilies {
+			fmt.Fprintf(&b, "  and %d more\n", len(p.families)-i)
+			lines++
+			break
+		}
+		fmt.Fprintf(&b, "  %-24s %s\n", f.name, f.state)
+		lines++
+	}
+	p.clear()
+	_, _ = io.WriteString(p.w, b.String())
+	p.lines = lines
+}
+
+// eta estimates the time until the stage is done from the rate at which it progressed so far.
+func (s stageProgress) eta() string {
+	switch {
+	case s.done >= s.total:
+		return "done"
+	case s.done == 0:
+		return "ETA unknown"
+	}
+	elapsed := time.Since(s.start)
+	remaining := time.Duration(float64(elapsed) * float64(s.total-s.done) / float64(s.done))
+	return "ETA " + remaining.Round(time.Second).String()
+}
+
+// progressLogWriter prints log messages above the progress display.
+type progressLogWriter struct {
+	p *progress
+}
+
+func (w progressLogWriter) Write(b []byte) (int, error) {
+	w.p.lock.Lock()
+	defer w.p.lock.Unlock()
+	w.p.clear()
+	n, err := w.p.logW.Write(b)
+	w.p.redraw()
+	return n, err
+}
+
+// familyProgress tracks the stage of a single package. A nil familyProgress tracks nothing.
+type familyProgress struct {
+	p        *progress
+	name     string
+	cost     int64
+	state    string
+	credited [numStages]int64 // The bytes of each stage already recorded for this package
+}
+
+// setState sets the description of what the package is doing, such as "merging".
+func (f *familyProgress) setState(format string, a ...interface{}) {
+	if f == nil {
+		return
+	}
+	f.p.lock.Lock()
+	defer f.p.lock.Unlock()
+	f.state = fmt.Sprintf(format, a...)
+}
+
+// advance records that the given fraction of a stage is done for the package.
+func (f *familyProgress) advance(stage progressStage, fraction float64) {
+	if f == nil {
+		return
+	}
+	f.p.lock.Lock()
+	defer f.p.lock.Unlock()
+	f.advanceLocked(stage, fraction)
+}
+
+func (f *familyProgress) advanceLocked(stage progressStage, fraction float64) {
+	if fraction > 1 {
+		fraction = 1
+	}
+	if n := int64(fraction*float64(f.cost)) - f.credited[stage]; n > 0 {
+		f.credited[stage] += n
+		f.p.advanceLocked(stage, n)
+	}
+}
+
+// finish records the remaining work of the package as done, including stages it skipped, such as compression for
+// OTC output, and removes it from the display.
+func (f *familyProgress) finish() {
+	if f == nil {
+		return
+	}
+	f.p.lock.Lock()
+	defer f.p.lock.Unlock()
+	for stage := stageMerge; stage < numStages; stage++ {
+		f.advanceLocked(stage, 1)
+	}
+	for i, other := range f.p.families {
+		if other == f {
+			f.p.families = append(f.p.families[:i], f.p.families[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// nameLicense is the name table ID of the license description.
+const nameLicense = 13
+
+// generateSourcesFile writes sources.go, which lists the source fonts of the package with their checksums, revisions,
+// and licenses so that users can check the provenance of the fonts at runtime. The checksums are of the files in the
+// input archive, before any modification by gonoto, in the algorithm of -hash, after which their field is named: SHA256
+// by default, as in the packages of older versions, or SHA512.
+func generateSourcesFile(packageName string, sink fileSink, description string, sourceFonts []*fontDesc,
+	fontData map[string][]byte, opts *generateOptions) error {
+	header, err := goFileHeader(opts, headerData{File: "sources.go", Package: packageName, Description: description, Notice: fontNotice(opts.rebrand)})
+	if err != nil {
+		return err
+	}
+	field := strings.ToUpper(opts.hash.name)
+	var entries strings.Builder
+	for _, f := range sourceFonts {
+		data := fontData[f.filename]
+		var revision, license string
+		if fonts, err := parseFontCollection(data); err == nil && len(fonts) == 1 {
+			revision, _ = fonts[0].fontRevision()
+			if values := fonts[0].names()[nameLicense]; len(values) > 0 {
+				// Only the first line, which names the license; the rest is boilerplate
+				license = strings.TrimSpace(strings.SplitN(values[0], "\n", 2)[0])
+			}
+		}
+		fmt.Fprintf(&entries, "\t{%s, %s, %s, %s},\n", strconv.Quote(path.Base(f.filename)),
+			strconv.Quote(opts.hash.sum(data)), strconv.Quote(revision), strconv.Quote(license))
+	}
+	if err := sink.writeString("sources.go", header+`package `+packageName+`
+
+// SourceFont describes a font file that was merged into the font collection.
+type SourceFont struct {
+	Filename string // The name of the font file in the Noto release
+	`+field+`   string // The hex-encoded `+opts.hash.label+` of the font file
+	Version  string // The revision of the font from its head table, e.g. "2.001"
+	License  string // The license description from the name table of the font
+}
+
+var sources = []SourceFont{
+`+entries.String()+`}
+
+// Sources returns the font files that were merged into the font collection, in fallback order.
+func Sources() []SourceFont {
+	return append([]SourceFont(nil), sources...)
+}
+`); err != nil {
+		return fmt.Errorf("failed to write sources file: %w", err)
+	}
+	return nil
+}
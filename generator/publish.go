@@ -0,0 +1,197 @@
+package generator
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+func setupPublishProxy(c *command, fs *flag.FlagSet) func(args []string) error {
+	proxy := fs.String("proxy", "", "base URL of the module proxy to upload to, e.g. https://athens.local (required)")
+	token := fs.String("token", "", "bearer token sent with each request; basic auth credentials can be part of the -proxy URL instead")
+	var lf logFlags
+	lf.register(fs)
+	return func(args []string) error {
+		args = envArgs(args, "OUTPUT")
+		if len(args) < 1 {
+			return usageErrorf(c, fs, "Expected an output directory")
+		}
+		if err := lf.apply(); err != nil {
+			return usageErrorf(c, fs, "%s", err.Error())
+		}
+		if *proxy == "" {
+			return usageErrorf(c, fs, "Expected -proxy")
+		}
+		u, err := url.Parse(*proxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return usageErrorf(c, fs, "Invalid -proxy value %q: expected an http or https URL", *proxy)
+		}
+		packages := args[1:]
+		if len(packages) == 0 {
+			m, err := readManifest(args[0])
+			if err != nil {
+				return err
+			}
+			if m == nil {
+				return usageErrorf(c, fs, "Expected package names, since %s has no %s", args[0], manifestFile)
+			}
+			for _, p := range m.Packages {
+				packages = append(packages, p.Name)
+			}
+		}
+		// The credentials are sent with each request rather than as part of the URLs, which appear in messages
+		p := &proxyPublisher{user: u.User, token: *token, client: http.DefaultClient}
+		u.User = nil
+		p.base = strings.TrimSuffix(u.String(), "/")
+		var failed []string
+		for _, name := range packages {
+			if err := p.publish(filepath.Join(args[0], name)); err != nil {
+				log.errorf("%s: %s", name, err)
+				failed = append(failed, name)
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%d of %d packages failed to publish: %s", len(failed), len(packages), strings.Join(failed, ", "))
+		}
+		return nil
+	}
+}
+
+// proxyPublisher uploads module zips written by -output-format module-zip to a module proxy, so that the packages
+// can be distributed privately without a repository for each of them.
+type proxyPublisher struct {
+	base   string        // The base URL of the proxy, without credentials or a trailing slash
+	user   *url.Userinfo // If set, the basic auth credentials of the requests
+	token  string        // If set, the bearer token of the requests
+	client *http.Client
+}
+
+// publish uploads the most recently written module zip of a package, along with its go.mod and version info files,
+// with PUT requests to the paths from which the proxy serves them, such as MODULE/@v/VERSION.zip. This is the upload
+// protocol of Artifactory and of proxies backed by a plain file server that accepts PUT requests. The version info
+// file is uploaded last, so that the version is complete by the time it is listed. The files are then downloaded
+// again to check that the proxy serves them unchanged.
+func (p *proxyPublisher) publish(packageDir string) error {
+	zipFile := latestModuleZip(packageDir)
+	if zipFile == "" {
+		return errors.New("no module zip found; generate it with -output-format module-zip")
+	}
+	version := strings.TrimSuffix(filepath.Base(zipFile), ".zip")
+	z, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return err
+	}
+	prefix := moduleZipPrefix(&z.Reader)
+	_ = z.Close()
+	if prefix != "" && !strings.HasSuffix(prefix, "@"+version) {
+		prefix = ""
+	}
+	if prefix == "" {
+		return fmt.Errorf("%s is not a module zip of version %s", filepath.Base(zipFile), version)
+	}
+	modulePath := strings.TrimSuffix(prefix, "@"+version)
+	escaped, err := escapeModulePath(modulePath)
+	if err != nil {
+		return err
+	}
+	log.infof("Publishing %s@%s to %s", modulePath, version, p.base)
+	for _, name := range []string{version + ".mod", version + ".zip", version + ".info"} {
+		data, err := ioutil.ReadFile(filepath.Join(packageDir, name))
+		if err != nil {
+			return err
+		}
+		fileURL := p.base + "/" + escaped + "/@v/" + name
+		if err := p.upload(fileURL, data); err != nil {
+			return err
+		}
+		if err := p.check(fileURL, data); err != nil {
+			return err
+		}
+		log.debugf("Uploaded %s (%d bytes)", fileURL, len(data))
+	}
+	log.infof("Published %s@%s", modulePath, version)
+	return nil
+}
+
+// request sends a request with the credentials of the publisher.
+func (p *proxyPublisher) request(method string, fileURL string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, fileURL, r)
+	if err != nil {
+		return nil, err
+	}
+	if p.user != nil {
+		password, _ := p.user.Password()
+		req.SetBasicAuth(p.user.Username(), password)
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return p.client.Do(req)
+}
+
+// upload stores a file on the proxy.
+func (p *proxyPublisher) upload(fileURL string, data []byte) error {
+	resp, err := p.request(http.MethodPut, fileURL, data)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", fileURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to upload %s: the proxy returned %s", fileURL, resp.Status)
+	}
+	return nil
+}
+
+// check downloads a file from the proxy and compares it with the uploaded data. The version info file is only checked
+// for availability, since proxies may rewrite it.
+func (p *proxyPublisher) check(fileURL string, data []byte) error {
+	resp, err := p.request(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s is not available after uploading it: the proxy returned %s", fileURL, resp.Status)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	if sum := sha256.Sum256(data); !strings.HasSuffix(fileURL, ".info") && !bytes.Equal(h.Sum(nil), sum[:]) {
+		return fmt.Errorf("the proxy serves a different %s than was uploaded", fileURL)
+	}
+	return nil
+}
+
+// escapeModulePath escapes a module path for the URLs of a module proxy, which replace each upper-case letter with an
+// exclamation mark followed by the lower-case letter, so that the paths also work on case-insensitive file systems.
+func escapeModulePath(modulePath string) (string, error) {
+	var b strings.Builder
+	for _, r := range modulePath {
+		switch {
+		case r == '!' || r >= unicode.MaxASCII:
+			return "", fmt.Errorf("invalid character %q in module path %q", r, modulePath)
+		case 'A' <= r && r <= 'Z':
+			b.WriteByte('!')
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
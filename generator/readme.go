@@ -0,0 +1,214 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// readmeConfig adds links and sections to the README files of the generated packages. Each string is a text/template
+// with the fields of readmeData.
+type readmeConfig struct {
+	Repository string        `json:"repository"` // The URL of the repository of each package, e.g. "https://github.com/example/{{.Package}}"
+	Badges     []badgeConfig `json:"badges"`     // The badges shown below the title, in order
+	Sections   string        `json:"sections"`   // Markdown placed before the License section
+}
+
+// badgeConfig is a linked badge image. A badge with only a name uses the standard badge of that name; see
+// standardBadges.
+type badgeConfig struct {
+	Name  string `json:"name"`  // The alternative text of the image
+	Image string `json:"image"` // The URL of the image
+	Link  string `json:"link"`  // The URL the badge links to
+}
+
+// standardBadges are the badges that the readme config can add by name alone.
+var standardBadges = map[string]badgeConfig{
+	"pkg.go.dev": {Image: "https://pkg.go.dev/badge/{{.Module}}.svg", Link: "https://pkg.go.dev/{{.Module}}"},
+	"license": {
+		Image: "https://img.shields.io/badge/license-{{shield \"OFL-1.1\"}}%20%2B%20{{shield .License}}-blue.svg",
+		Link:  "{{with .Repository}}{{.}}/blob/HEAD/{{end}}LICENSE",
+	},
+}
+
+// readmeData is the data available to the templates of the readme config.
+type readmeData struct {
+	Package     string // The Go package name
+	Module      string // The module path
+	Description string // The package description
+	Repository  string // The URL of the repository, or "" if the config sets none
+	License     string // The license of the generated code: "Apache-2.0", or "custom" with -license
+	Year        int    // The copyright year of the generated code; see -copyright-year
+	Holder      string // The copyright holder of the generated code; see -copyright-holder
+}
+
+// readmeFuncs are the functions available to the templates of the readme config.
+var readmeFuncs = template.FuncMap{
+	// shield escapes text for the path of a shields.io badge
+	"shield": strings.NewReplacer("-", "--", "_", "__", " ", "%20").Replace,
+}
+
+// readmeTemplates are the parsed templates of a readme config.
+type readmeTemplates struct {
+	repository *template.Template
+	badges     [][3]*template.Template // The name, image, and link of each badge
+	sections   *template.Template
+}
+
+// templates parses the templates of the readme config. A nil config adds nothing to the README files.
+func (rc *readmeConfig) templates() (*readmeTemplates, error) {
+	if rc == nil {
+		return nil, nil
+	}
+	parse := func(name string, text string) (*template.Template, error) {
+		t, err := template.New(name).Funcs(readmeFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return t, nil
+	}
+	rt := new(readmeTemplates)
+	var err error
+	if rt.repository, err = parse("repository", rc.Repository); err != nil {
+		return nil, err
+	}
+	if rt.sections, err = parse("sections", rc.Sections); err != nil {
+		return nil, err
+	}
+	for i, b := range rc.Badges {
+		if b.Image == "" && b.Link == "" {
+			standard, ok := standardBadges[b.Name]
+			if !ok {
+				return nil, fmt.Errorf("badge %d: %q is not a standard badge and has no image", i+1, b.Name)
+			}
+			b.Image, b.Link = standard.Image, standard.Link
+		}
+		if b.Image == "" {
+			return nil, fmt.Errorf("badge %d has no image", i+1)
+		}
+		var badge [3]*template.Template
+		for j, text := range []string{b.Name, b.Image, b.Link} {
+			if badge[j], err = parse(fmt.Sprintf("badge %d", i+1), text); err != nil {
+				return nil, err
+			}
+		}
+		rt.badges = append(rt.badges, badge)
+	}
+	// Catch references to unknown fields before any fonts are merged
+	if _, _, _, err := rt.render(readmeData{Package: "example", Module: "example.com/example", License: "Apache-2.0",
+		Year: 2020, Holder: defaultCopyrightHolder}); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// render returns the repository URL, the Markdown line of badges, and the extra sections of a README.
+func (rt *readmeTemplates) render(data readmeData) (repository string, badges string, sections string, err error) {
+	if rt == nil {
+		return "", "", "", nil
+	}
+	execute := func(t *template.Template, data readmeData) (string, error) {
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("failed to apply readme config to %s: %w", data.Package, err)
+		}
+		return strings.TrimSpace(b.String()), nil
+	}
+	if repository, err = execute(rt.repository, data); err != nil {
+		return "", "", "", err
+	}
+	data.Repository = strings.TrimSuffix(repository, "/")
+	var line []string
+	for _, badge := range rt.badges {
+		var parts [3]string
+		for i, t := range badge {
+			if parts[i], err = execute(t, data); err != nil {
+				return "", "", "", err
+			}
+		}
+		image := "![" + parts[0] + "](" + parts[1] + ")"
+		if parts[2] != "" {
+			image = "[" + image + "](" + parts[2] + ")"
+		}
+		line = append(line, image)
+	}
+	if sections, err = execute(rt.sections, data); err != nil {
+		return "", "", "", err
+	}
+	return data.Repository, strings.Join(line, " "), sections, nil
+}
+
+// readmeFileData is the data of readmeTemplate.
+type readmeFileData struct {
+	readmeData
+	Title       string // "Go Noto", or the rebranded name
+	Project     string // The sentence that introduces the project
+	Badges      string // The Markdown line of badges, if any
+	Sections    string // The extra sections, if any
+	Notice      string // The trademark and license notice of the fonts
+	FontsName   string // How the license refers to the fonts
+	CodeLicense string // The sentence that states the copyright and license of the generated code
+}
+
+// readmeTemplate is the template of the README.md file of each package.
+var readmeTemplate = template.Must(template.New("README.md").Parse(`# {{.Title}}
+{{if .Badges}}
+{{.Badges}}
+{{end}}
+Package {{.Package}} {{.Description}}
+This font collection provides broad unicode coverage.
+Special software is required to use OpenType font collections.
+
+{{.Project}}
+For usage information, see https://github.com/gonoto/gonoto
+{{- if .Repository}}
+The source of this module is at {{.Repository}}{{end}}
+{{if .Sections}}
+{{.Sections}}
+{{end}}
+## License
+{{.Notice}}
+
+This package contains additional code for the purpose of redistributing {{.FontsName}}.
+{{.CodeLicense}}
+`))
+
+// generateReadme writes the README.md file of a package.
+func generateReadme(packageName string, moduleName string, description string, sink fileSink, opts *generateOptions) error {
+	data := readmeFileData{
+		readmeData: readmeData{
+			Package:     packageName,
+			Module:      opts.modulePrefix + moduleName,
+			Description: description,
+			License:     "Apache-2.0",
+			Year:        opts.copyrightYear,
+			Holder:      opts.copyrightHolder,
+		},
+		Title:     "Go Noto",
+		Project:   "This font package is part of the Go Noto project.",
+		Notice:    strings.Join(fontNotice(opts.rebrand), "\n"),
+		FontsName: "Noto fonts",
+	}
+	if opts.rebrand != "" {
+		data.Title, data.Project, data.FontsName = opts.rebrand+" Fonts", "This font package was generated by gonoto.", "these fonts"
+	}
+	data.CodeLicense = fmt.Sprintf("This additional code is Copyright %d %s and licensed under ", opts.copyrightYear, opts.copyrightHolder)
+	if opts.license != "" {
+		data.License = "custom"
+		data.CodeLicense += "the terms in the LICENSE file."
+	} else {
+		data.CodeLicense += "the Apache License, Version 2.0."
+	}
+	var err error
+	if data.Repository, data.Badges, data.Sections, err = opts.readme.render(data.readmeData); err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := readmeTemplate.Execute(&b, data); err != nil {
+		return fmt.Errorf("failed to write README file: %w", err)
+	}
+	if err := sink.writeString("README.md", b.String()); err != nil {
+		return fmt.Errorf("failed to write README file: %w", err)
+	}
+	return nil
+}
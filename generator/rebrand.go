@@ -0,0 +1,228 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// trademark is the reserved name that is removed by the -rebrand mode.
+const trademark = "Noto"
+
+// fontNotice returns the lines of text describing the trademark and license status of the embedded fonts.
+func fontNotice(rebrand string) []string {
+	if rebrand != "" {
+		return []string{
+			"The fonts in this package are modified versions of open source fonts.",
+			"They are published under the SIL Open Font License, Version 1.1.",
+		}
+	}
+	return []string{
+		"Noto is a trademark of Google Inc. Noto fonts are open source.",
+		"All Noto fonts are published under the SIL Open Font License, Version 1.1.",
+	}
+}
+
+func commentLines(lines []string) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString("// " + l + "\n")
+	}
+	return b.String()
+}
+
+// validateRebrandName returns an error if name cannot replace the trademark in font names. The name is restricted to
+// ASCII letters, digits, and spaces so that it can be stored in every name table encoding and, with spaces removed, in
+// PostScript names.
+func validateRebrandName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("the name must not be empty")
+	}
+	if strings.Contains(strings.ToLower(name), strings.ToLower(trademark)) {
+		return fmt.Errorf("the name must not contain %q", trademark)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != ' ' {
+			return fmt.Errorf("the name may only contain ASCII letters, digits, and spaces")
+		}
+	}
+	return nil
+}
+
+// rebrandDescription replaces the trademark in a package description.
+func rebrandDescription(description string, name string) string {
+	return strings.ReplaceAll(description, trademark, name)
+}
+
+// rebrandFonts rewrites the name table of each font so that the trademark no longer appears in the family, full,
+// unique, or PostScript names, and removes the trademark notice. Copyright and license strings are retained, as
+// required by the SIL Open Font License. Names embedded in CFF tables are not changed; applications use the name
+// table to identify fonts.
+func rebrandFonts(inputs [][]byte, name string) ([][]byte, error) {
+	out := make([][]byte, len(inputs))
+	for i, data := range inputs {
+		fonts, err := parseFontCollection(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(fonts) != 1 {
+			return nil, fmt.Errorf("source font %d is a collection", i)
+		}
+		f := fonts[0]
+		tbl := f.table("name")
+		if tbl == nil {
+			out[i] = data
+			continue
+		}
+		renamed, err := rebrandNameTable(tbl, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite name table of font %d: %w", i, err)
+		}
+		f.tables["name"] = renamed
+		out[i] = f.encode()
+	}
+	return out, nil
+}
+
+// Name IDs defined by the OpenType specification.
+const (
+	nameFamily               = 1
+	nameSubfamily            = 2
+	nameUniqueID             = 3
+	nameFull                 = 4
+	nameTrademark            = 7
+	namePostScript           = 6
+	namePostScriptCID        = 20
+	nameVariationsPSName     = 25
+	nameTypographicFamily    = 16
+	nameTypographicSubfamily = 17
+)
+
+// rebrandedNameIDs lists the human-readable names in which the trademark is replaced.
+var rebrandedNameIDs = map[uint16]bool{1: true, 3: true, 4: true, nameTypographicFamily: true, 18: true, 21: true}
+
+// rebrandNameTable returns a copy of a name table (format 0 or 1) with the trademark replaced.
+func rebrandNameTable(tbl []byte, name string) ([]byte, error) {
+	return rewriteNameTable(tbl, func(platform, nameID uint16, value []byte) ([]byte, bool) {
+		switch {
+		case nameID == nameTrademark:
+			return nil, false
+		case nameID == namePostScript || nameID == namePostScriptCID || nameID == nameVariationsPSName:
+			return replaceNameString(value, platform, strings.ReplaceAll(name, " ", "")), true
+		case rebrandedNameIDs[nameID]:
+			return replaceNameString(value, platform, name), true
+		}
+		return value, true
+	})
+}
+
+// rewriteNameTable returns a copy of a name table (format 0 or 1) in which rewrite replaces the encoded string of each
+// record. Records for which rewrite returns false are removed.
+func rewriteNameTable(tbl []byte, rewrite func(platform, nameID uint16, value []byte) ([]byte, bool)) ([]byte, error) {
+	if len(tbl) < 6 {
+		return nil, errors.New("name table is truncated")
+	}
+	format := binary.BigEndian.Uint16(tbl)
+	count := int(binary.BigEndian.Uint16(tbl[2:]))
+	storage := int(binary.BigEndian.Uint16(tbl[4:]))
+	if format > 1 || len(tbl) < 6+12*count {
+		return nil, errors.New("unsupported or truncated name table")
+	}
+	str := func(length, offset int) ([]byte, error) {
+		if storage+offset+length > len(tbl) {
+			return nil, errors.New("name string is out of bounds")
+		}
+		return tbl[storage+offset : storage+offset+length], nil
+	}
+
+	type record struct {
+		header [4]uint16 // platformID, encodingID, languageID, nameID
+		value  []byte
+	}
+	var records []record
+	for i := 0; i < count; i++ {
+		r := tbl[6+12*i:]
+		var rec record
+		for j := range rec.header {
+			rec.header[j] = binary.BigEndian.Uint16(r[2*j:])
+		}
+		value, err := str(int(binary.BigEndian.Uint16(r[8:])), int(binary.BigEndian.Uint16(r[10:])))
+		if err != nil {
+			return nil, err
+		}
+		value, keep := rewrite(rec.header[0], rec.header[3], value)
+		if !keep {
+			continue
+		}
+		rec.value = value
+		records = append(records, rec)
+	}
+	var langTags [][]byte
+	if format == 1 {
+		pos := 6 + 12*count
+		if len(tbl) < pos+2 {
+			return nil, errors.New("name table is truncated")
+		}
+		langTagCount := int(binary.BigEndian.Uint16(tbl[pos:]))
+		if len(tbl) < pos+2+4*langTagCount {
+			return nil, errors.New("name table is truncated")
+		}
+		for i := 0; i < langTagCount; i++ {
+			r := tbl[pos+2+4*i:]
+			value, err := str(int(binary.BigEndian.Uint16(r)), int(binary.BigEndian.Uint16(r[2:])))
+			if err != nil {
+				return nil, err
+			}
+			langTags = append(langTags, value)
+		}
+	}
+
+	headerSize := 6 + 12*len(records)
+	if format == 1 {
+		headerSize += 2 + 4*len(langTags)
+	}
+	var header, storageBuf bytes.Buffer
+	w := func(v interface{}) { _ = binary.Write(&header, binary.BigEndian, v) }
+	w([3]uint16{format, uint16(len(records)), uint16(headerSize)})
+	for _, rec := range records {
+		w(rec.header)
+		w([2]uint16{uint16(len(rec.value)), uint16(storageBuf.Len())})
+		storageBuf.Write(rec.value)
+	}
+	if format == 1 {
+		w(uint16(len(langTags)))
+		for _, tag := range langTags {
+			w([2]uint16{uint16(len(tag)), uint16(storageBuf.Len())})
+			storageBuf.Write(tag)
+		}
+	}
+	if storageBuf.Len() > 0xffff {
+		return nil, errors.New("rewritten name table is too large")
+	}
+	return append(header.Bytes(), storageBuf.Bytes()...), nil
+}
+
+// replaceNameString replaces the trademark in an encoded name string. Macintosh strings are replaced byte-wise, which
+// is safe because both the trademark and the replacement are ASCII.
+func replaceNameString(value []byte, platform uint16, replacement string) []byte {
+	if platform == 1 {
+		return bytes.ReplaceAll(value, []byte(trademark), []byte(replacement))
+	}
+	return encodeNameString(strings.ReplaceAll(decodeNameString(value, platform), trademark, replacement), platform)
+}
+
+// encodeNameString encodes a name table string; see decodeNameString.
+func encodeNameString(s string, platform uint16) []byte {
+	if platform == 1 {
+		return []byte(s)
+	}
+	encoded := utf16.Encode([]rune(s))
+	out := make([]byte, 2*len(encoded))
+	for i, u := range encoded {
+		binary.BigEndian.PutUint16(out[2*i:], u)
+	}
+	return out
+}
@@ -1,4 +1,4 @@
-package main
+package generator
 
 const repoLicense = `                                 Apache License
                            Version 2.0, January 2004
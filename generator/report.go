@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+)
+
+// reportRow summarizes the changes to a single package for the release report.
+type reportRow struct {
+	Name       string
+	Status     string // "new", "changed", "unchanged", or "not regenerated"
+	Size       string
+	SizeDelta  string
+	Codepoints int
+	Coverage   string // The change in the number of covered characters
+	Chunks     int
+	Fonts      int
+	BaseTables string
+	Warnings   []string
+}
+
+// reportData is the input of reportTemplate.
+type reportData struct {
+	Rows            []reportRow
+	Generated       int // The number of packages generated by this run
+	Changed         int // The number of generated packages whose merged collection changed
+	Warnings        int
+	RevisionChanges []string
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Font package report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+td.num { text-align: right; }
+.new, .changed { background: #fff4d6; }
+.warn { color: #a40; }
+ul { margin: 0; padding-left: 1.2em; }
+</style>
+</head>
+<body>
+<h1>Font package report</h1>
+<p>{{.Generated}} packages generated, {{.Changed}} with a changed or new font collection, {{.Warnings}} warnings.</p>
+<h2>Packages</h2>
+<table>
+<tr><th>Package</th><th>Status</th><th>Size</th><th>Change</th><th>Characters</th><th>Change</th><th>Chunks</th><th>Fonts</th><th>Validation</th></tr>
+{{- range .Rows}}
+<tr class="{{if eq .Status "new"}}new{{else if eq .Status "changed"}}changed{{end}}">
+<td>{{.Name}}</td><td>{{.Status}}</td>
+<td class="num">{{.Size}}</td><td class="num">{{.SizeDelta}}</td>
+<td class="num">{{.Codepoints}}</td><td class="num">{{.Coverage}}</td>
+<td class="num">{{.Chunks}}</td><td class="num">{{.Fonts}}</td>
+<td>{{.BaseTables}}{{if .Warnings}}<ul class="warn">{{range .Warnings}}<li>{{.}}</li>{{end}}</ul>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+<h2>Upstream font revision changes</h2>
+{{- if .RevisionChanges}}
+<ul>{{range .RevisionChanges}}<li>{{.}}</li>{{end}}</ul>
+{{- else}}
+<p>None.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// writeReport writes an HTML page comparing the packages recorded in the previous manifest with those of the new
+// manifest, for attaching to the release pull requests of the generated repositories. The page has no external
+// resources.
+func writeReport(path string, prev *manifest, next *manifest, results []*manifestPackage, revisionChanges []string) error {
+	generated := make(map[string]bool)
+	for _, p := range results {
+		generated[p.Name] = true
+	}
+	data := reportData{Generated: len(results), RevisionChanges: revisionChanges}
+	for _, p := range next.Packages {
+		row := reportRow{
+			Name:       p.Name,
+			Size:       formatMiB(int64(p.DecompressedSize)),
+			Codepoints: p.Codepoints,
+			Chunks:     p.Chunks,
+			Fonts:      len(p.Fonts),
+			BaseTables: p.BaseTables.String(),
+			Warnings:   p.Warnings,
+		}
+		old := prev.findPackage(p.Name)
+		switch {
+		case !generated[p.Name]:
+			row.Status = "not regenerated"
+		case old == nil:
+			row.Status = "new"
+		case old.checksums != p.checksums:
+			row.Status = "changed"
+		default:
+			row.Status = "unchanged"
+		}
+		if old != nil && generated[p.Name] {
+			row.SizeDelta = formatDelta(p.DecompressedSize-old.DecompressedSize, formatMiB)
+			row.Coverage = formatDelta(p.Codepoints-old.Codepoints, func(n int64) string { return fmt.Sprint(n) })
+		}
+		if row.Status == "new" || row.Status == "changed" {
+			data.Changed++
+		}
+		if generated[p.Name] {
+			data.Warnings += len(p.Warnings)
+		}
+		data.Rows = append(data.Rows, row)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := reportTemplate.Execute(f, data); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return f.Close()
+}
+
+func formatMiB(n int64) string {
+	return fmt.Sprintf("%.2f MiB", float64(n)/(1024*1024))
+}
+
+// formatDelta formats a change with an explicit sign, or as an empty string if there is no change.
+func formatDelta(delta int, format func(int64) string) string {
+	switch {
+	case delta > 0:
+		return "+" + format(int64(delta))
+	case delta < 0:
+		return "-" + format(int64(-delta))
+	}
+	return ""
+}
@@ -0,0 +1,388 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"unicode"
+	"unicode/utf16"
+)
+
+// sfntFont provides access to the tables of a single font in SFNT format. It only implements the small amount of
+// parsing needed to validate generated collections and to make targeted adjustments to source fonts.
+type sfntFont struct {
+	version string // The SFNT version tag, e.g. "OTTO" for CFF-based fonts
+	tables  map[string][]byte
+
+	cmap        []byte // The preferred cmap subtable, once located
+	cmapChecked bool
+}
+
+// parseFontCollection returns the fonts contained in an OpenType collection. Individual SFNT files are also accepted
+// and are treated as a collection containing a single font.
+func parseFontCollection(data []byte) ([]*sfntFont, error) {
+	if len(data) < 12 {
+		return nil, errors.New("font data is truncated")
+	}
+	if string(data[:4]) != "ttcf" {
+		f, err := parseSFNT(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []*sfntFont{f}, nil
+	}
+	numFonts := int(binary.BigEndian.Uint32(data[8:12]))
+	if len(data) < 12+4*numFonts {
+		return nil, errors.New("font collection header is truncated")
+	}
+	fonts := make([]*sfntFont, numFonts)
+	for i := range fonts {
+		f, err := parseSFNT(data, binary.BigEndian.Uint32(data[12+4*i:]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse font %d in collection: %w", i, err)
+		}
+		fonts[i] = f
+	}
+	return fonts, nil
+}
+
+func parseSFNT(data []byte, offset uint32) (*sfntFont, error) {
+	start := int(offset)
+	if start < 0 || len(data) < start+12 {
+		return nil, errors.New("SFNT header is truncated")
+	}
+	switch string(data[start : start+4]) {
+	case "\x00\x01\x00\x00", "OTTO", "true":
+	default:
+		return nil, errors.New("unsupported SFNT version")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[start+4:]))
+	if len(data) < start+12+16*numTables {
+		return nil, errors.New("SFNT table directory is truncated")
+	}
+	f := &sfntFont{version: string(data[start : start+4]), tables: make(map[string][]byte, numTables)}
+	for i := 0; i < numTables; i++ {
+		record := data[start+12+16*i:]
+		tag := string(record[:4])
+		tblOffset := int(binary.BigEndian.Uint32(record[8:12]))
+		tblLength := int(binary.BigEndian.Uint32(record[12:16]))
+		if tblOffset < 0 || tblLength < 0 || len(data) < tblOffset+tblLength {
+			return nil, fmt.Errorf("SFNT table %q is truncated", tag)
+		}
+		f.tables[tag] = data[tblOffset : tblOffset+tblLength]
+	}
+	return f, nil
+}
+
+func (f *sfntFont) table(tag string) []byte {
+	return f.tables[tag]
+}
+
+// hasRune reports whether the font maps r to a glyph.
+func (f *sfntFont) hasRune(r rune) bool {
+	if !f.cmapChecked {
+		f.cmap = f.findCMAPSubtable()
+		f.cmapChecked = true
+	}
+	if f.cmap == nil {
+		return false
+	}
+	switch binary.BigEndian.Uint16(f.cmap) {
+	case 4:
+		return cmap4HasRune(f.cmap, r)
+	case 12:
+		return cmap12HasRune(f.cmap, r)
+	}
+	return false
+}
+
+// forEachRune calls fn for each character that the font maps to a glyph, in increasing order.
+func (f *sfntFont) forEachRune(fn func(r rune)) {
+	if !f.cmapChecked {
+		f.cmap = f.findCMAPSubtable()
+		f.cmapChecked = true
+	}
+	if f.cmap == nil {
+		return
+	}
+	switch binary.BigEndian.Uint16(f.cmap) {
+	case 4:
+		sub := f.cmap
+		if len(sub) < 14 {
+			return
+		}
+		segCount := int(binary.BigEndian.Uint16(sub[6:]) / 2)
+		endCodes := 14
+		startCodes := endCodes + 2*segCount + 2
+		idDeltas := startCodes + 2*segCount
+		idRangeOffsets := idDeltas + 2*segCount
+		if len(sub) < idRangeOffsets+2*segCount {
+			return
+		}
+		for i := 0; i < segCount; i++ {
+			start := int(binary.BigEndian.Uint16(sub[startCodes+2*i:]))
+			end := int(binary.BigEndian.Uint16(sub[endCodes+2*i:]))
+			delta := binary.BigEndian.Uint16(sub[idDeltas+2*i:])
+			rangeOffset := int(binary.BigEndian.Uint16(sub[idRangeOffsets+2*i:]))
+			for c := start; c <= end; c++ {
+				glyph := uint16(c)
+				if rangeOffset != 0 {
+					glyphOffset := idRangeOffsets + 2*i + rangeOffset + 2*(c-start)
+					if len(sub) < glyphOffset+2 {
+						break
+					}
+					if glyph = binary.BigEndian.Uint16(sub[glyphOffset:]); glyph == 0 {
+						continue
+					}
+				}
+				if glyph+delta != 0 {
+					fn(rune(c))
+				}
+			}
+		}
+	case 12:
+		sub := f.cmap
+		if len(sub) < 16 {
+			return
+		}
+		numGroups := int(binary.BigEndian.Uint32(sub[12:]))
+		if len(sub) < 16+12*numGroups {
+			return
+		}
+		for i := 0; i < numGroups; i++ {
+			group := sub[16+12*i:]
+			start := binary.BigEndian.Uint32(group)
+			end := binary.BigEndian.Uint32(group[4:])
+			glyph := binary.BigEndian.Uint32(group[8:])
+			for c := start; c <= end && c <= unicode.MaxRune; c++ {
+				if glyph+(c-start) != 0 {
+					fn(rune(c))
+				}
+			}
+		}
+	}
+}
+
+// findCMAPSubtable returns the best supported Unicode cmap subtable, preferring full-repertoire subtables over those
+// restricted to the BMP.
+func (f *sfntFont) findCMAPSubtable() []byte {
+	cmap := f.table("cmap")
+	if len(cmap) < 4 {
+		return nil
+	}
+	numTables := int(binary.BigEndian.Uint16(cmap[2:]))
+	if len(cmap) < 4+8*numTables {
+		return nil
+	}
+	var best []byte
+	bestFormat := uint16(0)
+	for i := 0; i < numTables; i++ {
+		record := cmap[4+8*i:]
+		platform := binary.BigEndian.Uint16(record)
+		encoding := binary.BigEndian.Uint16(record[2:])
+		offset := int(binary.BigEndian.Uint32(record[4:]))
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue
+		}
+		if offset < 0 || len(cmap) < offset+2 {
+			continue
+		}
+		sub := cmap[offset:]
+		format := binary.BigEndian.Uint16(sub)
+		if (format == 4 || format == 12) && format > bestFormat {
+			best, bestFormat = sub, format
+		}
+	}
+	return best
+}
+
+func cmap4HasRune(sub []byte, r rune) bool {
+	if r > 0xffff || len(sub) < 14 {
+		return false
+	}
+	segCount := int(binary.BigEndian.Uint16(sub[6:]) / 2)
+	endCodes := 14
+	startCodes := endCodes + 2*segCount + 2
+	idDeltas := startCodes + 2*segCount
+	idRangeOffsets := idDeltas + 2*segCount
+	if len(sub) < idRangeOffsets+2*segCount {
+		return false
+	}
+	c := uint16(r)
+	for i := 0; i < segCount; i++ {
+		if binary.BigEndian.Uint16(sub[endCodes+2*i:]) < c {
+			continue
+		}
+		start := binary.BigEndian.Uint16(sub[startCodes+2*i:])
+		if start > c {
+			return false
+		}
+		delta := binary.BigEndian.Uint16(sub[idDeltas+2*i:])
+		rangeOffset := int(binary.BigEndian.Uint16(sub[idRangeOffsets+2*i:]))
+		if rangeOffset == 0 {
+			return c+delta != 0
+		}
+		glyphOffset := idRangeOffsets + 2*i + rangeOffset + 2*int(c-start)
+		if len(sub) < glyphOffset+2 {
+			return false
+		}
+		glyph := binary.BigEndian.Uint16(sub[glyphOffset:])
+		return glyph != 0 && glyph+delta != 0
+	}
+	return false
+}
+
+func cmap12HasRune(sub []byte, r rune) bool {
+	if len(sub) < 16 {
+		return false
+	}
+	numGroups := int(binary.BigEndian.Uint32(sub[12:]))
+	if len(sub) < 16+12*numGroups {
+		return false
+	}
+	c := uint32(r)
+	for i := 0; i < numGroups; i++ {
+		group := sub[16+12*i:]
+		start := binary.BigEndian.Uint32(group)
+		end := binary.BigEndian.Uint32(group[4:])
+		if c >= start && c <= end {
+			return binary.BigEndian.Uint32(group[8:])+(c-start) != 0
+		}
+	}
+	return false
+}
+
+// fontRevision returns the revision number set by the font manufacturer in the head table, formatted to three
+// decimal places (e.g., "2.001").
+func (f *sfntFont) fontRevision() (string, bool) {
+	head := f.table("head")
+	if len(head) < 8 {
+		return "", false
+	}
+	revision := float64(int32(binary.BigEndian.Uint32(head[4:]))) / 65536
+	return strconv.FormatFloat(revision, 'f', 3, 64), true
+}
+
+// names returns the strings in the name table, indexed by name ID. Each name ID may have several strings for different
+// platforms and languages. Strings that cannot be decoded are omitted.
+func (f *sfntFont) names() map[uint16][]string {
+	names := make(map[uint16][]string)
+	tbl := f.table("name")
+	if len(tbl) < 6 {
+		return names
+	}
+	count := int(binary.BigEndian.Uint16(tbl[2:]))
+	storage := int(binary.BigEndian.Uint16(tbl[4:]))
+	if len(tbl) < 6+12*count {
+		return names
+	}
+	for i := 0; i < count; i++ {
+		record := tbl[6+12*i:]
+		platform := binary.BigEndian.Uint16(record)
+		nameID := binary.BigEndian.Uint16(record[6:])
+		length := int(binary.BigEndian.Uint16(record[8:]))
+		offset := storage + int(binary.BigEndian.Uint16(record[10:]))
+		if len(tbl) < offset+length {
+			continue
+		}
+		names[nameID] = append(names[nameID], decodeNameString(tbl[offset:offset+length], platform))
+	}
+	return names
+}
+
+// decodeNameString decodes a name table string. Windows and Unicode platform strings are stored in UTF-16BE;
+// Macintosh strings are treated as single-byte strings, which is exact for ASCII.
+func decodeNameString(value []byte, platform uint16) string {
+	if platform == 1 {
+		return string(value)
+	}
+	units := make([]uint16, len(value)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(value[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// layoutFeatures returns the set of feature tags in the feature list of the GSUB or GPOS table.
+func (f *sfntFont) layoutFeatures(tableTag string) map[string]bool {
+	features := make(map[string]bool)
+	tbl := f.table(tableTag)
+	if len(tbl) < 10 {
+		return features
+	}
+	featureList := int(binary.BigEndian.Uint16(tbl[6:]))
+	if len(tbl) < featureList+2 {
+		return features
+	}
+	count := int(binary.BigEndian.Uint16(tbl[featureList:]))
+	if len(tbl) < featureList+2+6*count {
+		return features
+	}
+	for i := 0; i < count; i++ {
+		record := tbl[featureList+2+6*i:]
+		features[string(record[:4])] = true
+	}
+	return features
+}
+
+// encode assembles the font into a standalone SFNT file, recomputing the table directory and checksums.
+func (f *sfntFont) encode() []byte {
+	tags := make([]string, 0, len(f.tables))
+	for tag := range f.tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	numTables := len(tags)
+	entrySelector := bits.Len(uint(numTables)) - 1
+	searchRange := (1 << entrySelector) * 16
+	headerSize := 12 + 16*numTables
+
+	var out bytes.Buffer
+	out.WriteString(f.version)
+	_ = binary.Write(&out, binary.BigEndian, [4]uint16{uint16(numTables), uint16(searchRange), uint16(entrySelector), uint16(numTables*16 - searchRange)})
+	offset := headerSize
+	for _, tag := range tags {
+		tbl := f.tables[tag]
+		if tag == "head" && len(tbl) >= 12 {
+			// The checksum of the head table is computed with checkSumAdjustment set to zero
+			tbl = append([]byte(nil), tbl...)
+			binary.BigEndian.PutUint32(tbl[8:], 0)
+			f.tables[tag] = tbl
+		}
+		out.WriteString(tag)
+		_ = binary.Write(&out, binary.BigEndian, [3]uint32{sfntChecksum(tbl), uint32(offset), uint32(len(tbl))})
+		offset += (len(tbl) + 3) &^ 3
+	}
+	headOffset := -1
+	for _, tag := range tags {
+		if tag == "head" {
+			headOffset = out.Len()
+		}
+		out.Write(f.tables[tag])
+		out.Write(make([]byte, (4-len(f.tables[tag])%4)%4))
+	}
+	data := out.Bytes()
+	if headOffset >= 0 && len(f.tables["head"]) >= 12 {
+		binary.BigEndian.PutUint32(data[headOffset+8:], 0xB1B0AFBA-sfntChecksum(data))
+	}
+	return data
+}
+
+func sfntChecksum(data []byte) uint32 {
+	var sum uint32
+	for len(data) >= 4 {
+		sum += binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+	if len(data) > 0 {
+		var tail [4]byte
+		copy(tail[:], data)
+		sum += binary.BigEndian.Uint32(tail[:])
+	}
+	return sum
+}
@@ -0,0 +1,196 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Values accepted by the -shaping-check flag.
+const (
+	shapingCheckOff   = "off"
+	shapingCheckWarn  = "warn"
+	shapingCheckError = "error"
+)
+
+// shapingCheck describes a representative character cluster that cannot be rendered correctly without complex text
+// layout. The font that provides the glyphs for the cluster must also provide the listed layout features. Without a
+// shaping engine we cannot render the cluster, but losing these features is the most common way that merged output
+// silently regresses.
+type shapingCheck struct {
+	name string
+	text []rune
+	gsub []string // Substitution features required to form the cluster
+	gpos []string // Positioning features required to place marks within the cluster
+}
+
+var shapingChecks = []shapingCheck{
+	{"Devanagari ksha", []rune{0x0915, 0x094D, 0x0937}, []string{"akhn", "half"}, []string{"abvm", "blwm"}},
+	{"Arabic lam-alef", []rune{0x0644, 0x064E, 0x0627}, []string{"init", "medi", "fina", "rlig"}, []string{"mark"}},
+	{"Hangul jamo composition", []rune{0x1100, 0x1161, 0x11A8}, []string{"ljmo", "vjmo", "tjmo"}, nil},
+}
+
+// coverageCheck describes combining marks that must be provided by the same font as the base letters that they attach
+// to: a mark taken from a later font in the fallback order cannot be positioned on the letter. These ranges have been
+// missing from merged output before, which breaks text such as vocalized or biblical Hebrew.
+type coverageCheck struct {
+	name  string
+	base  rune      // A base letter of the script, which selects the font that renders the script
+	marks [][2]rune // Inclusive ranges of marks that the font must provide
+	gpos  []string  // Positioning features required to place the marks
+}
+
+var coverageChecks = []coverageCheck{
+	{"Hebrew niqqud", 0x05D0, [][2]rune{{0x05B0, 0x05BD}, {0x05BF, 0x05BF}, {0x05C1, 0x05C2}, {0x05C7, 0x05C7}}, []string{"mark"}},
+	{"Hebrew cantillation", 0x05D0, [][2]rune{{0x0591, 0x05AF}, {0x05C4, 0x05C5}}, []string{"mark", "mkmk"}},
+}
+
+type shapingProblem struct {
+	check        string
+	font         string   // The source font providing the cluster glyphs
+	missing      []string // The missing features, formatted as TABLE/tag
+	missingRunes []string // The missing characters of a coverage check, formatted as ranges
+	lostInMerge  bool     // Whether the features were present in the source font but not in the merged output
+}
+
+func (p shapingProblem) String() string {
+	cause := "the source font does not provide them either"
+	if p.lostInMerge {
+		cause = "they were lost during merging"
+	}
+	var missing []string
+	if len(p.missingRunes) > 0 {
+		missing = append(missing, "characters "+strings.Join(p.missingRunes, ", "))
+	}
+	if len(p.missing) > 0 {
+		missing = append(missing, "layout features "+strings.Join(p.missing, ", "))
+	}
+	return fmt.Sprintf("%s (from %s) is missing %s; %s", p.check, p.font, strings.Join(missing, " and "), cause)
+}
+
+// checkShaping locates the member font of the merged collection that renders each shaping check (using normal
+// fallback order) and reports any required layout features that it lacks. The collection members must correspond
+// one-to-one with sourceFonts. Checks whose text is not covered by the collection are skipped.
+func checkShaping(merged []byte, sourceFonts []*fontDesc, fontData map[string][]byte) ([]shapingProblem, error) {
+	members, err := parseFontCollection(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merged font collection: %w", err)
+	}
+	if len(members) != len(sourceFonts) {
+		return nil, fmt.Errorf("merged collection contains %d fonts, expected %d", len(members), len(sourceFonts))
+	}
+	var problems []shapingProblem
+	for _, check := range shapingChecks {
+		index := -1
+		for i, m := range members {
+			if coversAll(m, check.text) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		missing := missingFeatures(members[index], check)
+		if len(missing) == 0 {
+			continue
+		}
+		lost := false
+		if source, err := parseFontCollection(fontData[sourceFonts[index].filename]); err == nil && len(source) == 1 {
+			lost = len(missingFeatures(source[0], check)) < len(missing)
+		}
+		problems = append(problems, shapingProblem{
+			check:       check.name,
+			font:        sourceFonts[index].filename,
+			missing:     missing,
+			lostInMerge: lost,
+		})
+	}
+	for _, check := range coverageChecks {
+		index := -1
+		for i, m := range members {
+			if m.hasRune(check.base) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		missingRunes, missing := missingCoverage(members[index], check)
+		if len(missingRunes) == 0 && len(missing) == 0 {
+			continue
+		}
+		lost := false
+		if source, err := parseFontCollection(fontData[sourceFonts[index].filename]); err == nil && len(source) == 1 {
+			sourceRunes, sourceFeatures := missingCoverage(source[0], check)
+			lost = len(sourceRunes) < len(missingRunes) || len(sourceFeatures) < len(missing)
+		}
+		problems = append(problems, shapingProblem{
+			check:        check.name,
+			font:         sourceFonts[index].filename,
+			missing:      missing,
+			missingRunes: missingRunes,
+			lostInMerge:  lost,
+		})
+	}
+	return problems, nil
+}
+
+// missingCoverage returns the ranges of marks of a coverage check that the font lacks, formatted as U+XXXX-U+XXXX, and
+// the missing positioning features. The features are only checked if the font provides some of the marks.
+func missingCoverage(f *sfntFont, check coverageCheck) ([]string, []string) {
+	var ranges []string
+	covered := false
+	for _, r := range check.marks {
+		start := rune(-1)
+		for c := r[0]; c <= r[1]+1; c++ {
+			if c <= r[1] && !f.hasRune(c) {
+				if start < 0 {
+					start = c
+				}
+				continue
+			}
+			if c <= r[1] {
+				covered = true
+			}
+			if start >= 0 {
+				if start == c-1 {
+					ranges = append(ranges, fmt.Sprintf("U+%04X", start))
+				} else {
+					ranges = append(ranges, fmt.Sprintf("U+%04X-U+%04X", start, c-1))
+				}
+				start = -1
+			}
+		}
+	}
+	if !covered {
+		return ranges, nil
+	}
+	return ranges, missingFeatures(f, shapingCheck{gpos: check.gpos})
+}
+
+func coversAll(f *sfntFont, text []rune) bool {
+	for _, r := range text {
+		if !f.hasRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func missingFeatures(f *sfntFont, check shapingCheck) []string {
+	var missing []string
+	gsub := f.layoutFeatures("GSUB")
+	for _, tag := range check.gsub {
+		if !gsub[tag] {
+			missing = append(missing, "GSUB/"+tag)
+		}
+	}
+	gpos := f.layoutFeatures("GPOS")
+	for _, tag := range check.gpos {
+		if !gpos[tag] {
+			missing = append(missing, "GPOS/"+tag)
+		}
+	}
+	return missing
+}
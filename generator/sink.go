@@ -0,0 +1,144 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// FamilySpec describes a single font package for GeneratePackage, with the same terms as the families of the config
+// file and the flags of the embed command.
+type FamilySpec struct {
+	Sources []string // The Noto inputs to merge the fonts from, such as the path of Noto-unhinted.zip; see Run
+	Name    string   // The name of the package, such as "notosans"
+	Input   string   // The family to import language glyphs from, such as "Sans"
+	Weight  string   // Default "Regular"
+	Width   string   // Such as "Condensed"; default normal width
+	UI      bool     // Whether to prefer the UI variants, which have tighter vertical metrics
+	Style   string   // Either "Italic" or normal (the default)
+}
+
+// GeneratePackage generates the package described by spec with the default options of the generate command and
+// passes each of its files to sink instead of writing them to disk, so that a service can stream the package into an
+// archive or an upload. The paths are relative to the package directory and use forward slashes, such as "otc.go" or
+// "chunk0.go", and sink must consume r before it returns. Progress is logged to standard output, as by the command.
+func GeneratePackage(spec FamilySpec, sink func(path string, r io.Reader) error) error {
+	if len(spec.Sources) == 0 {
+		return fmt.Errorf("package %s has no Noto inputs", spec.Name)
+	}
+	f, err := familyConfig{Name: spec.Name, Input: spec.Input, Weight: spec.Weight, Width: spec.Width, UI: spec.UI,
+		Style: spec.Style}.outputFamily()
+	if err != nil {
+		return err
+	}
+	described, err := describeFamilies([]outputFamily{f}, "")
+	if err != nil {
+		return err
+	}
+	family := described[0]
+	opts := &generateOptions{
+		emojiFormat:      emojiFormatMono,
+		emojiArbitration: emojiArbitrationOrder,
+		shapingCheck:     shapingCheckWarn,
+		baseTable:        baseTableKeep,
+		modulePrefix:     defaultModulePrefix,
+		chunkEncoding:    chunkEncodingUint64,
+		chunkSize:        defaultChunkSize,
+		copyrightYear:    time.Now().Year(),
+		copyrightHolder:  defaultCopyrightHolder,
+		jobs:             runtime.NumCPU(),
+		progress:         progressNever,
+		hash:             hashSHA256,
+		outputFormat:     outputFormatGo,
+		matcher:          defaultMatcher,
+		dataVersion:      "v0.0.0",
+	}
+	opts.goVersion = defaultGoVersion(opts)
+
+	inventory, err := scanInput(spec.Sources, false, nil, false, nil)
+	if err != nil {
+		return err
+	}
+	if err := selectEmojiFormat(inventory, opts.emojiFormat); err != nil {
+		return err
+	}
+	z, closeInput, err := openInput(spec.Sources)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = closeInput() }()
+	fontDescriptions, _ := describeFonts(inventory)
+	sourceFonts := familySourceFonts(family, fontDescriptions, filterLanguages(inventory.Languages, nil, nil), opts)
+	if !hasBaseFont(family, sourceFonts) {
+		return fmt.Errorf("merged font %s has no base font: %s", family.name, exactSourceProblem(family, sourceFonts))
+	}
+	upstreams, err := readUpstreamFonts(z, sourceFonts)
+	if err != nil {
+		return err
+	}
+	loaded, err := loadSourceFonts(z, sourceFonts, opts.jobs, nil)
+	if err != nil {
+		return err
+	}
+	memo := newSourceMemo(z, loaded, [][]*fontDesc{sourceFonts}, opts, nil)
+	defer memo.release(sourceFonts)
+	fontData, prepared, err := memo.acquire(sourceFonts)
+	if err != nil {
+		return err
+	}
+	ps := packageSpec{family: family, sourceFonts: sourceFonts, fontData: fontData, prepared: prepared, upstreams: upstreams}
+	_, err = generatePackage(ps, fileSink(sink), &seekBuffer{buf: make([]byte, 4096)}, nil, opts)
+	return err
+}
+
+// fileSink receives the files of a generated package one at a time. The path is relative to the package directory
+// and uses forward slashes, such as "data/chunk0.go". The sink must consume r before it returns, since r may be
+// produced while it is read.
+type fileSink func(path string, r io.Reader) error
+
+// dirSink returns a sink that writes the files into dir, creating subdirectories as needed.
+func dirSink(dir string) fileSink {
+	return func(path string, r io.Reader) error {
+		file := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		fw, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = fw.Close() }()
+		if _, err := io.Copy(fw, r); err != nil {
+			return err
+		}
+		return fw.Close()
+	}
+}
+
+// writeString passes a file with the given contents to the sink.
+func (s fileSink) writeString(path string, data string) error {
+	return s(path, strings.NewReader(data))
+}
+
+// stream passes a file to the sink whose contents are written by write while the sink reads them, so that large files
+// such as chunks are not held in memory.
+func (s fileSink) stream(path string, write func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		_ = pw.CloseWithError(err)
+		writeErr <- err
+	}()
+	err := s(path, pr)
+	// Unblock the writer if the sink stopped reading early
+	_ = pr.Close()
+	if werr := <-writeErr; err == nil && werr != nil {
+		return fmt.Errorf("failed to write %s: %w", path, werr)
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package generator_test
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gonoto/gonoto/generator"
+)
+
+// writeTestInput writes a Noto input ZIP whose only font is testdata/Test-Regular.ttf named as NotoSans-Regular.ttf,
+// which the fonts of ZIP inputs are recognized by.
+func writeTestInput(t *testing.T) string {
+	font, err := ioutil.ReadFile("testdata/Test-Regular.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipPath := filepath.Join(t.TempDir(), "Noto.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("NotoSans-Regular.ttf")
+	if err == nil {
+		_, err = w.Write(font)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func TestGeneratePackage(t *testing.T) {
+	input := writeTestInput(t)
+	files := make(map[string]string)
+	err := generator.GeneratePackage(generator.FamilySpec{Sources: []string{input}, Name: "notosans", Input: "Sans"},
+		func(path string, r io.Reader) error {
+			data, err := ioutil.ReadAll(r)
+			files[path] = string(data)
+			return err
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"otc.go", "chunk0.go", "sources.go", "go.mod", "README.md", "LICENSE"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("GeneratePackage did not write %s; it wrote %d files", name, len(files))
+		}
+	}
+	if mod := files["go.mod"]; !strings.HasPrefix(mod, "module github.com/gonoto/notosans\n") {
+		t.Errorf("go.mod = %q", mod)
+	}
+	if otc := files["otc.go"]; !strings.Contains(otc, "package notosans\n") || !strings.Contains(otc, "func OTC() []byte") {
+		t.Errorf("otc.go does not declare OTC in package notosans:\n%s", otc)
+	}
+	if sources := files["sources.go"]; !strings.Contains(sources, "NotoSans-Regular.ttf") {
+		t.Errorf("sources.go does not list NotoSans-Regular.ttf:\n%s", sources)
+	}
+}
+
+func TestGeneratePackageErrors(t *testing.T) {
+	input := writeTestInput(t)
+	collect := func(path string, r io.Reader) error {
+		_, err := io.Copy(ioutil.Discard, r)
+		return err
+	}
+	for _, spec := range []generator.FamilySpec{
+		{Name: "notosans", Input: "Sans"},
+		{Sources: []string{input}, Name: "notosans", Input: "Fancy"},
+		{Sources: []string{input}, Name: "notosans", Input: "Sans", Weight: "Heavy"},
+		{Sources: []string{input}, Name: "NotoSans", Input: "Sans"},
+		// The input has no Serif fonts to start the package with
+		{Sources: []string{input}, Name: "notoserif", Input: "Serif"},
+	} {
+		if err := generator.GeneratePackage(spec, collect); err == nil {
+			t.Errorf("GeneratePackage(%+v) succeeded, want an error", spec)
+		}
+	}
+
+	errSink := errors.New("upload failed")
+	err := generator.GeneratePackage(generator.FamilySpec{Sources: []string{input}, Name: "notosans", Input: "Sans"},
+		func(path string, r io.Reader) error { return errSink })
+	if !errors.Is(err, errSink) {
+		t.Errorf("GeneratePackage with a failing sink returned %v, want %v", err, errSink)
+	}
+}
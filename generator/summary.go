@@ -0,0 +1,58 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// runSummary is the JSON document that -json prints at the end of a successful run, or of a run with -keep-going whose
+// failures did not stop the other packages, for scripts that process the generated packages. It only describes the
+// packages generated by the run; manifest.json describes all of them.
+type runSummary struct {
+	Input           string            `json:"input"`  // The first input
+	Inputs          []string          `json:"inputs"` // All of the inputs, in order
+	Output          string            `json:"output"`
+	Hash            string            `json:"hash"`                       // The -hash algorithm of the checksums
+	Packages        []*summaryPackage `json:"packages"`                   // The generated packages, sorted by name
+	Skipped         []string          `json:"skipped,omitempty"`          // Packages left unchanged by -changed-only
+	Failed          []string          `json:"failed,omitempty"`           // Packages that failed with -keep-going
+	RevisionChanges []string          `json:"revision_changes,omitempty"` // See revisionChanges
+	Warnings        int               `json:"warnings"`                   // The total number of package warnings
+	RunWarnings     []runWarning      `json:"run_warnings,omitempty"`     // The warnings of the run; see warningRecorder
+}
+
+// summaryPackage adds the module path to the manifest entry of a package.
+type summaryPackage struct {
+	Module string `json:"module"`
+	*manifestPackage
+}
+
+func writeSummary(w io.Writer, sourcePaths []string, outputDir string, results []*manifestPackage, skipped []string,
+	failed []string, changes []string, warnings []runWarning, opts *generateOptions) error {
+	summary := &runSummary{
+		Input:           sourcePaths[0],
+		Inputs:          sourcePaths,
+		Output:          outputDir,
+		Hash:            opts.hash.name,
+		Packages:        []*summaryPackage{},
+		Skipped:         skipped,
+		Failed:          failed,
+		RevisionChanges: changes,
+		RunWarnings:     warnings,
+	}
+	for _, p := range results {
+		summary.Packages = append(summary.Packages, &summaryPackage{Module: opts.modulePrefix + p.Name, manifestPackage: p})
+		summary.Warnings += len(p.Warnings)
+	}
+	sort.Slice(summary.Packages, func(i, j int) bool { return summary.Packages[i].Name < summary.Packages[j].Name })
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package generator
+
+import "fmt"
+
+// dropTables removes the tables with the given tags from the source fonts. Fonts that contain none of the tables are
+// returned unchanged. The number of fonts that were changed is returned as well.
+func dropTables(inputs [][]byte, tags []string) ([][]byte, int, error) {
+	out := make([][]byte, len(inputs))
+	changed := 0
+	for i, data := range inputs {
+		out[i] = data
+		fonts, err := parseFontCollection(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(fonts) != 1 {
+			return nil, 0, fmt.Errorf("source font %d is a collection", i)
+		}
+		f := fonts[0]
+		dropped := false
+		for _, tag := range tags {
+			if f.table(tag) != nil {
+				delete(f.tables, tag)
+				dropped = true
+			}
+		}
+		if dropped {
+			out[i] = f.encode()
+			changed++
+		}
+	}
+	return out, changed, nil
+}
+
+// parseTableTag returns the SFNT table tag spelled by s, padding it with trailing spaces to four characters (so that
+// "cvt" becomes "cvt "). Tags must consist of printable ASCII characters.
+func parseTableTag(s string) (string, error) {
+	if len(s) == 0 || len(s) > 4 {
+		return "", fmt.Errorf("table tag %q must be one to four characters long", s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return "", fmt.Errorf("table tag %q contains invalid characters", s)
+		}
+	}
+	return (s + "   ")[:4], nil
+}
@@ -0,0 +1,346 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// Newer Noto releases ship variable fonts, such as NotoSans[wdth,wght].ttf, instead of a static font for each weight
+// and width. The adapter in this file presents the static instances of each variable font to the merge pipeline as
+// individual fonts named like those of the older releases, such as NotoSans-CondensedBold.ttf, so that the weights
+// and widths of the packages are matched as before.
+
+// variableFontPattern matches the file names of the Noto variable fonts, such as NotoSansArabic[wdth,wght].ttf and
+// NotoSans-Italic[wdth,wght].ttf. The brackets list the axes of the font.
+var variableFontPattern = regexp.MustCompile(`^Noto([A-Za-z0-9]+?)(-Italic)?\[([A-Za-z0-9,]+)\]\.ttf$`)
+
+// weightValues and widthValues map the weights and widths of the Noto file names to the coordinates of the wght and
+// wdth axes. DemiLight is only used by the CJK fonts, which are not variable.
+var (
+	weightValues = map[string]float64{"Thin": 100, "ExtraLight": 200, "Light": 300, "Regular": 400, "Medium": 500,
+		"SemiBold": 600, "Bold": 700, "ExtraBold": 800, "Black": 900}
+	widthValues = map[string]float64{"ExtraCondensed": 62.5, "Condensed": 75, "SemiCondensed": 87.5, "": 100}
+)
+
+// isVariableInstance reports whether a path of the inventory is a static instance of a variable font; see
+// addVariableFonts.
+func isVariableInstance(p string) bool {
+	return variableFontPattern.MatchString(path.Base(path.Dir(p)))
+}
+
+// addVariableFonts adds the static instances of the variable fonts in fsys to the inventory, for each weight and width
+// of the Noto file names that the axes of the font cover. The instances are named like the static fonts, such as
+// NotoSans-Bold.ttf, and their paths are inside the variable font, such as
+// fonts/NotoSans/unhinted/variable-ttf/NotoSans[wdth,wght].ttf/NotoSans-Bold.ttf. They are derived through a
+// variableFS when they are read, so their sizes are those of the variable fonts. preferFonts keeps static fonts of the
+// same name instead.
+func addVariableFonts(fsys fs.FS, inventory *noto.Inventory) error {
+	var variableFonts []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// Variable fonts in WOFF2 format are read as the fonts they decode to; see woff2FontPath
+		if path.Ext(p) == woff2Ext && variableFontPattern.MatchString(strings.TrimSuffix(d.Name(), woff2Ext)+".ttf") {
+			var ok bool
+			if p, _, ok = woff2FontPath(fsys, p); !ok {
+				return nil
+			}
+		}
+		if variableFontPattern.MatchString(path.Base(p)) {
+			variableFonts = append(variableFonts, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan the Noto input for variable fonts: %w", err)
+	}
+	for _, p := range variableFonts {
+		names, size, err := variableInstances(fsys, p)
+		if err != nil {
+			runWarnings.warnf(warnInput, severityMajor, "", "Skipping the variable font %s: %s", p, err)
+			continue
+		}
+		for _, name := range names {
+			f, _ := noto.ParseFilename(name)
+			f.Path = p + "/" + name
+			f.Size = size
+			f.CompressedSize = size
+			inventory.Fonts = append(inventory.Fonts, f)
+		}
+		log.debugf("Found %d static instances of the variable font %s", len(names), p)
+	}
+	return nil
+}
+
+// variableInstances returns the file names of the static instances of a variable font, and the size of the font.
+func variableInstances(fsys fs.FS, variablePath string) ([]string, int64, error) {
+	m := variableFontPattern.FindStringSubmatch(path.Base(variablePath))
+	if m == nil {
+		return nil, 0, fmt.Errorf("%s is not a variable font", variablePath)
+	}
+	domain, italic := m[1], m[2] != ""
+	data, err := fs.ReadFile(fsys, variablePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	fonts, err := parseFontCollection(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(fonts) != 1 {
+		return nil, 0, fmt.Errorf("%s is a collection", variablePath)
+	}
+	if fonts[0].table("glyf") == nil {
+		return nil, 0, fmt.Errorf("only variable fonts with TrueType outlines can be instanced")
+	}
+	axes, err := fontAxes(fonts[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	// Without a wght or wdth axis, the font only has the default weight or width
+	weights, widths := []string{"Regular"}, []string{""}
+	for _, a := range axes {
+		switch a.tag {
+		case "wght":
+			weights = coveredTerms(noto.Weights, weightValues, a)
+		case "wdth":
+			widths = coveredTerms(noto.Widths, widthValues, a)
+		}
+	}
+	var names []string
+	for _, width := range widths {
+		for _, weight := range weights {
+			name := instanceFilename(domain, width, weight, italic)
+			if _, ok := noto.ParseFilename(name); !ok {
+				return nil, 0, fmt.Errorf("%s is not a Noto file name", name)
+			}
+			names = append(names, name)
+		}
+	}
+	return names, int64(len(data)), nil
+}
+
+// coveredTerms returns the terms whose axis coordinates are within the range of the axis, in the order of terms.
+func coveredTerms(terms []string, values map[string]float64, a variationAxis) []string {
+	var covered []string
+	for _, t := range terms {
+		if v, ok := values[t]; ok && v >= a.min && v <= a.max {
+			covered = append(covered, t)
+		}
+	}
+	return covered
+}
+
+// instanceFilename returns the file name of a static Noto font, such as NotoSans-CondensedBoldItalic.ttf. The Regular
+// weight is omitted when another term is present, as in NotoSans-Condensed.ttf and NotoSans-Italic.ttf.
+func instanceFilename(domain string, width string, weight string, italic bool) string {
+	return "Noto" + domain + "-" + strings.Join(styleTerms(width, weight, italic), "") + ".ttf"
+}
+
+// styleTerms returns the terms of the style of a static Noto font, such as ["Condensed", "Bold", "Italic"].
+func styleTerms(width string, weight string, italic bool) []string {
+	var terms []string
+	if width != "" {
+		terms = append(terms, width)
+	}
+	if weight != "Regular" || (width == "" && !italic) {
+		terms = append(terms, weight)
+	}
+	if italic {
+		terms = append(terms, "Italic")
+	}
+	return terms
+}
+
+// staticInstance derives the static font with the given file name, such as NotoSans-CondensedBold.ttf, from the
+// variable font of its family. Apart from the instancing itself, the names and style fields of the font are set to
+// those of the static font; see setInstanceStyle.
+func staticInstance(data []byte, name string) ([]byte, error) {
+	style, ok := noto.ParseFilename(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a Noto file name", name)
+	}
+	fonts, err := parseFontCollection(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(fonts) != 1 {
+		return nil, fmt.Errorf("the variable font of %s is a collection", name)
+	}
+	f := fonts[0]
+	axes, err := fontAxes(f)
+	if err != nil {
+		return nil, err
+	}
+	location := map[string]float64{"wght": weightValues[style.Weight], "wdth": widthValues[style.Width]}
+	if err := instanceFont(f, location); err != nil {
+		return nil, err
+	}
+	varied := make(map[string]bool)
+	for _, a := range axes {
+		varied[a.tag] = true
+	}
+	if err := setInstanceStyle(f, style, varied["wght"], varied["wdth"]); err != nil {
+		return nil, err
+	}
+	return f.encode(), nil
+}
+
+// setInstanceStyle sets the names of a static instance to those of the static Noto font of its style, such as "Noto
+// Sans Condensed Bold" and NotoSans-CondensedBold, and its weight and width classes and style bits to match. The weight
+// and width classes are only set if the variable font had a wght or wdth axis. As in the static fonts, the legacy
+// family name includes the width and any weight other than Regular and Bold, so that the legacy subfamily name is one
+// of Regular, Italic, Bold, and Bold Italic.
+func setInstanceStyle(f *sfntFont, style *noto.Font, setWeight bool, setWidth bool) error {
+	italic := style.Style == "Italic"
+	bold := style.Weight == "Bold"
+	if os2 := f.table("OS/2"); len(os2) >= 64 {
+		os2 = append([]byte(nil), os2...)
+		if setWeight {
+			binary.BigEndian.PutUint16(os2[4:], uint16(weightValues[style.Weight]))
+		}
+		if setWidth {
+			width, err := noto.ParseWidth(style.Width)
+			if err != nil {
+				return err
+			}
+			binary.BigEndian.PutUint16(os2[6:], width.Class())
+		}
+		// fsSelection: ITALIC, BOLD, and REGULAR
+		selection := binary.BigEndian.Uint16(os2[62:]) &^ (1<<0 | 1<<5 | 1<<6)
+		if italic {
+			selection |= 1 << 0
+		}
+		if bold {
+			selection |= 1 << 5
+		}
+		if !italic && !bold {
+			selection |= 1 << 6
+		}
+		binary.BigEndian.PutUint16(os2[62:], selection)
+		f.tables["OS/2"] = os2
+	}
+	if head := f.table("head"); len(head) >= 46 {
+		head = append([]byte(nil), head...)
+		macStyle := binary.BigEndian.Uint16(head[44:]) &^ 3
+		if bold {
+			macStyle |= 1
+		}
+		if italic {
+			macStyle |= 2
+		}
+		binary.BigEndian.PutUint16(head[44:], macStyle)
+		f.tables["head"] = head
+	}
+
+	tbl := f.table("name")
+	if tbl == nil {
+		return nil
+	}
+	names := f.names()
+	first := func(ids ...uint16) string {
+		for _, id := range ids {
+			if len(names[id]) > 0 {
+				return names[id][0]
+			}
+		}
+		return ""
+	}
+	family := first(nameTypographicFamily, nameFamily)
+	postScript := first(namePostScript)
+	postScriptFamily := first(nameVariationsPSName)
+	if postScriptFamily == "" {
+		postScriptFamily = strings.SplitN(postScript, "-", 2)[0]
+	}
+	if family == "" || postScriptFamily == "" {
+		return fmt.Errorf("the variable font has no family or PostScript name")
+	}
+	terms := styleTerms(style.Width, style.Weight, italic)
+	subfamily := strings.Join(terms, " ")
+	legacyFamily := family
+	if style.Width != "" {
+		legacyFamily += " " + style.Width
+	}
+	if style.Weight != "Regular" && !bold {
+		legacyFamily += " " + style.Weight
+	}
+	legacyWeight := "Regular"
+	if bold {
+		legacyWeight = "Bold"
+	}
+	legacySubfamily := strings.Join(styleTerms("", legacyWeight, italic), " ")
+	values := map[uint16]string{
+		nameFamily:               legacyFamily,
+		nameSubfamily:            legacySubfamily,
+		nameFull:                 family + " " + subfamily,
+		namePostScript:           postScriptFamily + "-" + strings.Join(terms, ""),
+		nameTypographicFamily:    family,
+		nameTypographicSubfamily: subfamily,
+	}
+	renamed, err := rewriteNameTable(tbl, func(platform, nameID uint16, value []byte) ([]byte, bool) {
+		switch nameID {
+		case nameVariationsPSName:
+			return nil, false
+		case nameUniqueID:
+			if postScript != "" {
+				s := strings.ReplaceAll(decodeNameString(value, platform), postScript, values[namePostScript])
+				return encodeNameString(s, platform), true
+			}
+		}
+		if s, ok := values[nameID]; ok {
+			return encodeNameString(s, platform), true
+		}
+		return value, true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename the instance: %w", err)
+	}
+	f.tables["name"] = renamed
+	return nil
+}
+
+// variableFS adds the static instances of the variable fonts of an input to it, at the paths that addVariableFonts
+// assigns to them. The most recently read variable font is kept, since the instances of a font are usually read one
+// after the other.
+type variableFS struct {
+	fs.FS
+
+	mu   sync.Mutex
+	path string // The path of the variable font that is kept
+	data []byte
+}
+
+func (v *variableFS) Open(name string) (fs.File, error) {
+	dir := path.Dir(name)
+	if !variableFontPattern.MatchString(path.Base(dir)) {
+		return v.FS.Open(name)
+	}
+	v.mu.Lock()
+	if v.path != dir {
+		data, err := fs.ReadFile(v.FS, dir)
+		if err != nil {
+			v.mu.Unlock()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		v.path, v.data = dir, data
+	}
+	data := v.data
+	v.mu.Unlock()
+	instance, err := staticInstance(data, path.Base(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &memFile{name: path.Base(name), Reader: bytes.NewReader(instance)}, nil
+}
@@ -0,0 +1,404 @@
+package generator
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// itemVariationStore computes the deltas of an ItemVariationStore, which the MVAR and GDEF tables of a variable font
+// use to vary metrics and GPOS positions.
+type itemVariationStore struct {
+	data    []byte
+	regions []float64 // The scalar of each region of the store at the instance
+}
+
+// newItemVariationStore parses the ItemVariationStore at the start of data for the normalized coordinates.
+func newItemVariationStore(data []byte, coords []float64) (*itemVariationStore, error) {
+	if len(data) < 8 {
+		return nil, errors.New("item variation store is truncated")
+	}
+	regionList := int(binary.BigEndian.Uint32(data[2:]))
+	if len(data) < regionList+4 {
+		return nil, errors.New("variation region list is truncated")
+	}
+	axisCount := int(binary.BigEndian.Uint16(data[regionList:]))
+	regionCount := int(binary.BigEndian.Uint16(data[regionList+2:]))
+	if axisCount != len(coords) || len(data) < regionList+4+6*axisCount*regionCount {
+		return nil, errors.New("variation region list is truncated or does not match the axes")
+	}
+	s := &itemVariationStore{data: data, regions: make([]float64, regionCount)}
+	for i := range s.regions {
+		start, peak, end := make([]float64, axisCount), make([]float64, axisCount), make([]float64, axisCount)
+		for j := 0; j < axisCount; j++ {
+			axis := data[regionList+4+6*(axisCount*i+j):]
+			start[j], peak[j], end[j] = f2dot14Value(axis), f2dot14Value(axis[2:]), f2dot14Value(axis[4:])
+		}
+		s.regions[i] = regionScalar(coords, peak, start, end)
+	}
+	return s, nil
+}
+
+// delta returns the delta of the item inner of the item variation data outer at the instance.
+func (s *itemVariationStore) delta(outer, inner int) (float64, error) {
+	outOfBounds := errors.New("item variation data is out of bounds")
+	if outer >= int(binary.BigEndian.Uint16(s.data[6:])) || len(s.data) < 8+4*(outer+1) {
+		return 0, outOfBounds
+	}
+	offset := int(binary.BigEndian.Uint32(s.data[8+4*outer:]))
+	if len(s.data) < offset+6 {
+		return 0, outOfBounds
+	}
+	ivd := s.data[offset:]
+	itemCount := int(binary.BigEndian.Uint16(ivd))
+	wordCount := int(binary.BigEndian.Uint16(ivd[2:]) & 0x7fff)
+	long := binary.BigEndian.Uint16(ivd[2:])&0x8000 != 0
+	regionCount := int(binary.BigEndian.Uint16(ivd[4:]))
+	wordSize, byteSize := 2, 1
+	if long {
+		wordSize, byteSize = 4, 2
+	}
+	rowSize := wordCount*wordSize + (regionCount-wordCount)*byteSize
+	rows := 6 + 2*regionCount
+	if inner >= itemCount || wordCount > regionCount || len(ivd) < rows+rowSize*itemCount {
+		return 0, outOfBounds
+	}
+	row := ivd[rows+rowSize*inner:]
+	delta := 0.0
+	pos := 0
+	for j := 0; j < regionCount; j++ {
+		region := int(binary.BigEndian.Uint16(ivd[6+2*j:]))
+		if region >= len(s.regions) {
+			return 0, outOfBounds
+		}
+		var d int32
+		size := byteSize
+		if j < wordCount {
+			size = wordSize
+		}
+		switch size {
+		case 1:
+			d = int32(int8(row[pos]))
+		case 2:
+			d = int32(int16(binary.BigEndian.Uint16(row[pos:])))
+		case 4:
+			d = int32(binary.BigEndian.Uint32(row[pos:]))
+		}
+		pos += size
+		delta += s.regions[region] * float64(d)
+	}
+	return delta, nil
+}
+
+// mvarField is a font-wide metric that the MVAR table varies.
+type mvarField struct {
+	table    string
+	offset   int
+	unsigned bool
+}
+
+// mvarFields maps the value tags of the MVAR table to the fields that they vary.
+var mvarFields = map[string]mvarField{
+	"hasc": {"OS/2", 68, false}, "hdsc": {"OS/2", 70, false}, "hlgp": {"OS/2", 72, false},
+	"hcla": {"OS/2", 74, true}, "hcld": {"OS/2", 76, true},
+	"sbxs": {"OS/2", 10, false}, "sbys": {"OS/2", 12, false}, "sbxo": {"OS/2", 14, false}, "sbyo": {"OS/2", 16, false},
+	"spxs": {"OS/2", 18, false}, "spys": {"OS/2", 20, false}, "spxo": {"OS/2", 22, false}, "spyo": {"OS/2", 24, false},
+	"strs": {"OS/2", 26, false}, "stro": {"OS/2", 28, false}, "xhgt": {"OS/2", 86, false}, "cpht": {"OS/2", 88, false},
+	"hcrs": {"hhea", 18, false}, "hcrn": {"hhea", 20, false}, "hcof": {"hhea", 22, false},
+	"vasc": {"vhea", 4, false}, "vdsc": {"vhea", 6, false}, "vlgp": {"vhea", 8, false},
+	"vcrs": {"vhea", 18, false}, "vcrn": {"vhea", 20, false}, "vcof": {"vhea", 22, false},
+	"undo": {"post", 8, false}, "unds": {"post", 10, false},
+}
+
+// instanceMetrics applies the deltas of the MVAR table to the font-wide metrics, such as the x-height and the
+// underline position. Tags of metrics that the font does not have, such as those of the gasp table, are ignored.
+func instanceMetrics(f *sfntFont, coords []float64) error {
+	mvar := f.table("MVAR")
+	if mvar == nil {
+		return nil
+	}
+	if len(mvar) < 12 {
+		return errors.New("MVAR table is truncated")
+	}
+	recordSize := int(binary.BigEndian.Uint16(mvar[6:]))
+	count := int(binary.BigEndian.Uint16(mvar[8:]))
+	storeOffset := int(binary.BigEndian.Uint16(mvar[10:]))
+	if count == 0 || storeOffset == 0 {
+		return nil
+	}
+	if recordSize < 8 || len(mvar) < 12+recordSize*count || len(mvar) < storeOffset {
+		return errors.New("MVAR table is truncated")
+	}
+	store, err := newItemVariationStore(mvar[storeOffset:], coords)
+	if err != nil {
+		return err
+	}
+	copied := make(map[string]bool)
+	for i := 0; i < count; i++ {
+		record := mvar[12+recordSize*i:]
+		field, ok := mvarFields[string(record[:4])]
+		tbl := f.table(field.table)
+		if !ok || len(tbl) < field.offset+2 {
+			continue
+		}
+		delta, err := store.delta(int(binary.BigEndian.Uint16(record[4:])), int(binary.BigEndian.Uint16(record[6:])))
+		if err != nil {
+			return err
+		}
+		if !copied[field.table] {
+			tbl = append([]byte(nil), tbl...)
+			f.tables[field.table] = tbl
+			copied[field.table] = true
+		}
+		v := float64(int16(binary.BigEndian.Uint16(tbl[field.offset:])))
+		if field.unsigned {
+			v = float64(binary.BigEndian.Uint16(tbl[field.offset:]))
+		}
+		binary.BigEndian.PutUint16(tbl[field.offset:], uint16(roundHalfUp(v+delta)))
+	}
+	return nil
+}
+
+// gposInstancer adds the deltas of the variation index tables of a GPOS table to the positions that they vary. The
+// variation index tables are kept, since renderers ignore them in fonts without variations; only the values are
+// changed, so the layout of the table stays the same.
+type gposInstancer struct {
+	gpos   []byte
+	store  *itemVariationStore
+	varied map[int]bool // The offsets of the values that were already varied, since subtables may be shared
+}
+
+// instanceGPOS applies the deltas of the ItemVariationStore of the GDEF table to the placements, advances, and anchors
+// of the GPOS table.
+func instanceGPOS(f *sfntFont, coords []float64) error {
+	gdef, gpos := f.table("GDEF"), f.table("GPOS")
+	if len(gdef) < 18 || len(gpos) < 10 || binary.BigEndian.Uint16(gdef) != 1 || binary.BigEndian.Uint16(gdef[2:]) < 3 {
+		return nil
+	}
+	storeOffset := int(binary.BigEndian.Uint32(gdef[14:]))
+	if storeOffset == 0 {
+		return nil
+	}
+	if len(gdef) < storeOffset {
+		return errors.New("GDEF item variation store is out of bounds")
+	}
+	store, err := newItemVariationStore(gdef[storeOffset:], coords)
+	if err != nil {
+		return err
+	}
+	g := &gposInstancer{gpos: append([]byte(nil), gpos...), store: store, varied: make(map[int]bool)}
+	lookupList := g.u16(8)
+	for i := 0; i < g.u16(lookupList); i++ {
+		lookup := lookupList + g.u16(lookupList+2+2*i)
+		lookupType := g.u16(lookup)
+		for j := 0; j < g.u16(lookup+4); j++ {
+			if err := g.subtable(lookupType, lookup+g.u16(lookup+6+2*j)); err != nil {
+				return err
+			}
+		}
+	}
+	f.tables["GPOS"] = g.gpos
+	return nil
+}
+
+var errGPOSBounds = errors.New("GPOS table is truncated")
+
+// u16 reads the uint16 at offset, or 0 if it is out of bounds; callers that follow offsets check them with check.
+func (g *gposInstancer) u16(offset int) int {
+	if offset < 0 || len(g.gpos) < offset+2 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(g.gpos[offset:]))
+}
+
+func (g *gposInstancer) check(offset int, size int) error {
+	if offset < 0 || len(g.gpos) < offset+size {
+		return errGPOSBounds
+	}
+	return nil
+}
+
+// subtable varies the positions of a lookup subtable at offset.
+func (g *gposInstancer) subtable(lookupType int, offset int) error {
+	if err := g.check(offset, 2); err != nil {
+		return err
+	}
+	format := g.u16(offset)
+	switch {
+	case lookupType == 1 && format == 1:
+		return g.valueRecord(offset+6, g.u16(offset+4), offset)
+	case lookupType == 1 && format == 2:
+		valueFormat := g.u16(offset + 4)
+		for i := 0; i < g.u16(offset+6); i++ {
+			if err := g.valueRecord(offset+8+i*valueRecordSize(valueFormat), valueFormat, offset); err != nil {
+				return err
+			}
+		}
+	case lookupType == 2 && format == 1:
+		format1, format2 := g.u16(offset+4), g.u16(offset+6)
+		for i := 0; i < g.u16(offset+8); i++ {
+			pairSet := offset + g.u16(offset+10+2*i)
+			recordSize := 2 + valueRecordSize(format1) + valueRecordSize(format2)
+			for j := 0; j < g.u16(pairSet); j++ {
+				record := pairSet + 2 + j*recordSize
+				if err := g.valueRecord(record+2, format1, pairSet); err != nil {
+					return err
+				}
+				if err := g.valueRecord(record+2+valueRecordSize(format1), format2, pairSet); err != nil {
+					return err
+				}
+			}
+		}
+	case lookupType == 2 && format == 2:
+		format1, format2 := g.u16(offset+4), g.u16(offset+6)
+		size1, size2 := valueRecordSize(format1), valueRecordSize(format2)
+		class1Count, class2Count := g.u16(offset+12), g.u16(offset+14)
+		for i := 0; i < class1Count*class2Count; i++ {
+			record := offset + 16 + i*(size1+size2)
+			if err := g.valueRecord(record, format1, offset); err != nil {
+				return err
+			}
+			if err := g.valueRecord(record+size1, format2, offset); err != nil {
+				return err
+			}
+		}
+	case lookupType == 3 && format == 1:
+		for i := 0; i < 2*g.u16(offset+4); i++ {
+			if err := g.anchor(offset, g.u16(offset+6+2*i)); err != nil {
+				return err
+			}
+		}
+	case (lookupType == 4 || lookupType == 6) && format == 1:
+		classCount := g.u16(offset + 6)
+		if err := g.markArray(offset + g.u16(offset+8)); err != nil {
+			return err
+		}
+		return g.anchorMatrix(offset+g.u16(offset+10), classCount)
+	case lookupType == 5 && format == 1:
+		classCount := g.u16(offset + 6)
+		if err := g.markArray(offset + g.u16(offset+8)); err != nil {
+			return err
+		}
+		ligatureArray := offset + g.u16(offset+10)
+		for i := 0; i < g.u16(ligatureArray); i++ {
+			if err := g.anchorMatrix(ligatureArray+g.u16(ligatureArray+2+2*i), classCount); err != nil {
+				return err
+			}
+		}
+	case lookupType == 9 && format == 1:
+		if err := g.check(offset, 8); err != nil {
+			return err
+		}
+		return g.subtable(g.u16(offset+2), offset+int(binary.BigEndian.Uint32(g.gpos[offset+4:])))
+	}
+	return nil
+}
+
+// valueRecordSize returns the size of a ValueRecord in the given format.
+func valueRecordSize(valueFormat int) int {
+	size := 0
+	for bit := 0; bit < 8; bit++ {
+		if valueFormat&(1<<bit) != 0 {
+			size += 2
+		}
+	}
+	return size
+}
+
+// valueRecord varies the placements and advances of a ValueRecord at offset whose device offsets are relative to
+// parent.
+func (g *gposInstancer) valueRecord(offset int, valueFormat int, parent int) error {
+	if err := g.check(offset, valueRecordSize(valueFormat)); err != nil {
+		return err
+	}
+	// The four values are followed by the offsets of their device tables, each present if its bit is set
+	var values [4]int
+	pos := offset
+	for bit := 0; bit < 4; bit++ {
+		values[bit] = -1
+		if valueFormat&(1<<bit) != 0 {
+			values[bit] = pos
+			pos += 2
+		}
+	}
+	for bit := 0; bit < 4; bit++ {
+		if valueFormat&(1<<(bit+4)) == 0 {
+			continue
+		}
+		device := g.u16(pos)
+		pos += 2
+		if device != 0 && values[bit] >= 0 {
+			if err := g.vary(values[bit], parent+device); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// markArray varies the anchors of a MarkArray.
+func (g *gposInstancer) markArray(offset int) error {
+	for i := 0; i < g.u16(offset); i++ {
+		if err := g.anchor(offset, g.u16(offset+2+4*i+2)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anchorMatrix varies the anchors of a BaseArray, Mark2Array, or LigatureAttach table, which have classCount anchors
+// for each of their records.
+func (g *gposInstancer) anchorMatrix(offset int, classCount int) error {
+	for i := 0; i < g.u16(offset)*classCount; i++ {
+		if err := g.anchor(offset, g.u16(offset+2+2*i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anchor varies the coordinates of the anchor at the offset relative to parent, which is 0 for missing anchors.
+func (g *gposInstancer) anchor(parent int, offset int) error {
+	if offset == 0 {
+		return nil
+	}
+	a := parent + offset
+	if err := g.check(a, 6); err != nil {
+		return err
+	}
+	if g.u16(a) != 3 {
+		return nil
+	}
+	if err := g.check(a, 10); err != nil {
+		return err
+	}
+	for k := 0; k < 2; k++ {
+		if device := g.u16(a + 6 + 2*k); device != 0 {
+			if err := g.vary(a+2+2*k, a+device); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// vary adds the delta of the variation index table at device to the int16 value at offset. Device tables that hold
+// hinting deltas for sizes rather than a variation index are left alone.
+func (g *gposInstancer) vary(offset int, device int) error {
+	if g.varied[offset] {
+		return nil
+	}
+	g.varied[offset] = true
+	if err := g.check(device, 6); err != nil {
+		return err
+	}
+	if g.u16(device+4) != 0x8000 {
+		return nil
+	}
+	delta, err := g.store.delta(g.u16(device), g.u16(device+2))
+	if err != nil {
+		return err
+	}
+	v := float64(int16(binary.BigEndian.Uint16(g.gpos[offset:])))
+	binary.BigEndian.PutUint16(g.gpos[offset:], uint16(int16(roundHalfUp(v+delta))))
+	return nil
+}
@@ -0,0 +1,257 @@
+package generator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	chunkListPattern   = regexp.MustCompile(`var [cC]hunks = (\[\]\[\]uint64|\[\]\[\]string|\[\]string)\{([^}]*)\}`)
+	chunkSizePattern   = regexp.MustCompile(`const [dD]ecompressedSize = ([0-9]+)`)
+	chunkDataPattern   = regexp.MustCompile(`(?s)var (\w+) = \[\](uint64|string)\{(.*)\}`)
+	chunkEmbedPattern  = regexp.MustCompile(`//go:embed (\S+)\s+var (\w+) string`)
+	chunkEncodingTypes = map[string]string{
+		"[][]uint64": chunkEncodingUint64,
+		"[][]string": chunkEncodingString,
+		"[]string":   chunkEncodingEmbed,
+	}
+)
+
+// verifyOptions holds the flags of the verify command.
+type verifyOptions struct {
+	fuzz int   // The number of random glyphs of each font to rasterize; see fuzzGlyphs
+	seed int64 // The seed of the random glyphs and sizes
+
+	harfBuzz bool // Whether to check that HarfBuzz shapes complex clusters; see checkHarfBuzz
+}
+
+// verifyPackages checks that each of the named packages in outputDir contains all of the support files and that the
+// embedded chunk data decodes to a well-formed OpenType collection of the expected size with at least one font.
+func verifyPackages(outputDir string, packages []string, opts verifyOptions) error {
+	var failed []string
+	for _, p := range packages {
+		if err := verifyPackage(filepath.Join(outputDir, p), opts); err != nil {
+			fmt.Printf("FAIL %s: %s\n", p, err.Error())
+			failed = append(failed, p)
+			continue
+		}
+		fmt.Printf("ok   %s\n", p)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d packages failed verification: %s", len(failed), len(packages), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func verifyPackage(packageDir string, opts verifyOptions) error {
+	fsys, closePackage, err := openPackage(packageDir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = closePackage() }()
+	// Packages generated with -output-format otc contain only the font collection
+	if _, err := fs.Stat(fsys, otcFileName(packageDir)); err != nil {
+		for _, name := range []string{"otc.go", "chunk.go", "go.mod", "README.md", "LICENSE"} {
+			if _, err := fs.Stat(fsys, name); err != nil {
+				return fmt.Errorf("missing support file: %w", err)
+			}
+		}
+	}
+	data, err := readPackageFS(fsys, otcFileName(packageDir))
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 || string(data[:4]) != "ttcf" {
+		return errors.New("decompressed data is not an OpenType collection")
+	}
+	// parseFontCollection checks that the offsets of every font and table are in range
+	fonts, err := parseFontCollection(data)
+	if err != nil {
+		return fmt.Errorf("malformed OpenType collection: %w", err)
+	}
+	if len(fonts) == 0 {
+		return errors.New("the OpenType collection contains no fonts")
+	}
+	if opts.fuzz > 0 {
+		if err := fuzzGlyphs(data, opts.fuzz, rand.New(rand.NewSource(opts.seed))); err != nil {
+			return fmt.Errorf("glyph check with -seed %d failed: %w", opts.seed, err)
+		}
+	}
+	if opts.harfBuzz {
+		problems, err := checkHarfBuzz(data)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("HarfBuzz shaping check failed: %s", strings.Join(problems, "; "))
+		}
+	}
+	return nil
+}
+
+// packageExists reports whether the main file of a package in the given output format exists.
+func packageExists(packageDir string, opts *generateOptions) bool {
+	switch opts.outputFormat {
+	case outputFormatOTC:
+		_, err := os.Stat(filepath.Join(packageDir, otcFileName(packageDir)))
+		return err == nil
+	case outputFormatModuleZip:
+		return len(moduleZips(packageDir)) > 0
+	}
+	_, err := os.Stat(filepath.Join(packageDir, "otc.go"))
+	return err == nil
+}
+
+// otcFileName returns the name of the font collection file of a package generated with -output-format otc.
+func otcFileName(packageDir string) string {
+	return filepath.Base(packageDir) + ".otc"
+}
+
+// openPackage returns the files of a generated package: the files of its module zip if it was generated with
+// -output-format module-zip, or else the files of its directory. The returned function closes the package.
+func openPackage(packageDir string) (fs.FS, func() error, error) {
+	fsys, closeZip, ok, err := openModuleZip(packageDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		return fsys, closeZip, nil
+	}
+	return os.DirFS(packageDir), func() error { return nil }, nil
+}
+
+// readPackageData returns the font data of a generated package in any output format; see readPackageFS.
+func readPackageData(packageDir string) ([]byte, error) {
+	fsys, closePackage, err := openPackage(packageDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = closePackage() }()
+	return readPackageFS(fsys, otcFileName(packageDir))
+}
+
+// readPackageFS returns the font data of the package whose files are in fsys, either from its font collection file
+// otcName or from its chunk files in any chunk encoding.
+func readPackageFS(fsys fs.FS, otcName string) ([]byte, error) {
+	if data, err := fs.ReadFile(fsys, otcName); err == nil {
+		return data, nil
+	}
+	// Packages generated with -split-data keep their chunks in the data module
+	chunkDir := dataPackage
+	if _, err := fs.Stat(fsys, path.Join(chunkDir, "chunk.go")); err == nil {
+		for _, name := range []string{"go.mod", "LICENSE"} {
+			if _, err := fs.Stat(fsys, path.Join(chunkDir, name)); err != nil {
+				return nil, fmt.Errorf("missing data module file: %w", err)
+			}
+		}
+	} else {
+		chunkDir = "."
+	}
+	index, err := fs.ReadFile(fsys, path.Join(chunkDir, "chunk.go"))
+	if err != nil {
+		return nil, err
+	}
+	listMatch := chunkListPattern.FindSubmatch(index)
+	sizeMatch := chunkSizePattern.FindSubmatch(index)
+	if listMatch == nil || sizeMatch == nil {
+		return nil, errors.New("chunk.go is malformed")
+	}
+	size, err := strconv.Atoi(string(sizeMatch[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid decompressed size: %w", err)
+	}
+
+	var compressed bytes.Buffer
+	encoding := chunkEncodingTypes[string(listMatch[1])]
+	for _, chunkVar := range strings.Split(string(listMatch[2]), ",") {
+		chunkVar = strings.TrimSpace(chunkVar)
+		if chunkVar == "" {
+			continue
+		}
+		if err := readChunk(fsys, path.Join(chunkDir, chunkVar+".go"), chunkVar, encoding, &compressed); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", chunkVar, err)
+		}
+	}
+
+	otc, err := fs.ReadFile(fsys, "otc.go")
+	if err != nil {
+		return nil, err
+	}
+	stream, err := stripChunkHeader(compressed.Bytes(), !bytes.Contains(otc, []byte(chunkHeaderVar)))
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil, fmt.Errorf("chunk data is not a gzip stream: %w", err)
+	}
+	r.Multistream(false) // The stream is padded to a multiple of 8 bytes
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress chunk data: %w", err)
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("decompressed size is %d bytes, expected %d", len(data), size)
+	}
+	return data, nil
+}
+
+func readChunk(fsys fs.FS, chunkFile string, chunkVar string, encoding string, w io.Writer) error {
+	src, err := fs.ReadFile(fsys, chunkFile)
+	if err != nil {
+		return err
+	}
+	if encoding == chunkEncodingEmbed {
+		m := chunkEmbedPattern.FindSubmatch(src)
+		if m == nil || string(m[2]) != chunkVar {
+			return fmt.Errorf("%s does not define %s", chunkFile, chunkVar)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(path.Dir(chunkFile), string(m[1])))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	m := chunkDataPattern.FindSubmatch(src)
+	if m == nil || string(m[1]) != chunkVar || chunkEncodingTypes["[][]"+string(m[2])] != encoding {
+		return fmt.Errorf("%s does not define %s", chunkFile, chunkVar)
+	}
+	if encoding == chunkEncodingString {
+		for _, line := range strings.Split(strings.TrimSpace(string(m[3])), "\n") {
+			s, err := strconv.Unquote(strings.TrimSuffix(strings.TrimSpace(line), ","))
+			if err != nil {
+				return fmt.Errorf("invalid chunk element: %w", err)
+			}
+			if _, err := io.WriteString(w, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var buf [8]byte
+	for _, v := range bytes.Split(m[3], []byte(",")) {
+		u, err := strconv.ParseUint(strings.TrimSpace(string(v)), 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid chunk element: %w", err)
+		}
+		binary.LittleEndian.PutUint64(buf[:], u)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
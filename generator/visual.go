@@ -0,0 +1,257 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// visualSample is a line of text that is rendered to compare two versions of a package.
+type visualSample struct {
+	script string
+	text   string
+}
+
+var visualSamples = []visualSample{
+	{"Latin", "The quick brown fox jumps over the lazy dog. 0123456789"},
+	{"Latin extended", "Ąąĺľŕťžő ẞ Ǆǆ ƒ Ŋŋ Ðð Þþ ŉ"},
+	{"Greek", "Τάχιστη αλώπηξ βαφής ψημένη γη, δρασκελίζει υπέρ νωθρού κυνός"},
+	{"Cyrillic", "Съешь же ещё этих мягких французских булок, да выпей чаю"},
+	{"Armenian", "Բարեւ աշխարհ"},
+	{"Hebrew", "דג סקרן שט בים מאוכזב ולפתע מצא חברה"},
+	{"Arabic", "نص حكيم له سر قاطع وذو شأن عظيم"},
+	{"Devanagari", "ऋषियों को सताने वाले दुष्ट राक्षसों के राजा रावण का सर्वनाश"},
+	{"Bengali", "আমি বাংলায় গান গাই"},
+	{"Tamil", "யாமறிந்த மொழிகளிலே தமிழ்மொழி போல்"},
+	{"Thai", "เป็นมนุษย์สุดประเสริฐเลิศคุณค่า"},
+	{"Georgian", "ქართული ენა"},
+	{"Ethiopic", "ሰላም ለዓለም"},
+	{"Hangul", "다람쥐 헌 쳇바퀴에 타고파"},
+	{"CJK", "天地玄黄宇宙洪荒 いろはにほへと カタカナ"},
+	{"Symbols", "→ ← ∑ √ ∞ ≠ ★ ☆ ♪ ♫ € ¥ £"},
+}
+
+// visualOptions controls how compareVisuals renders and compares the samples.
+type visualOptions struct {
+	size      float64 // The font size in pixels
+	threshold float64 // The fraction of inked pixels that may change before a sample is reported
+	diffDir   string  // If set, images of the reported samples are written to this directory
+}
+
+// visualChange describes a sample that looks different in the new version of a package.
+type visualChange struct {
+	sample  visualSample
+	changed float64 // The fraction of inked pixels that changed
+	missing [2]int  // The number of characters without a glyph in the old and new version
+}
+
+func (c visualChange) String() string {
+	s := fmt.Sprintf("%s: %.2f%% of pixels changed", c.sample.script, 100*c.changed)
+	if c.missing[0] != c.missing[1] {
+		s += fmt.Sprintf(", %d characters without a glyph (previously %d)", c.missing[1], c.missing[0])
+	}
+	return s
+}
+
+// compareVisuals renders the samples with the previous and new versions of each of the named packages and reports the
+// samples that changed by more than the threshold. The text is drawn one character at a time from the first font in
+// the collection that has a glyph for it, without shaping, so the comparison covers the nominal glyphs, their advances,
+// and the fallback order of the collection, but not the layout features.
+func compareVisuals(oldDir string, newDir string, packages []string, opts visualOptions) error {
+	var failed []string
+	for _, p := range packages {
+		changes, err := comparePackageVisuals(filepath.Join(oldDir, p), filepath.Join(newDir, p), p, opts)
+		if err != nil {
+			fmt.Printf("FAIL %s: %s\n", p, err.Error())
+			failed = append(failed, p)
+			continue
+		}
+		if len(changes) > 0 {
+			for _, c := range changes {
+				fmt.Printf("DIFF %s: %s\n", p, c)
+			}
+			failed = append(failed, p)
+			continue
+		}
+		fmt.Printf("ok   %s\n", p)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d packages changed visually or could not be compared: %s", len(failed), len(packages),
+			strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func comparePackageVisuals(oldDir string, newDir string, packageName string, opts visualOptions) ([]visualChange, error) {
+	oldFonts, err := loadVisualFonts(oldDir, opts.size)
+	if err != nil {
+		return nil, fmt.Errorf("previous version: %w", err)
+	}
+	newFonts, err := loadVisualFonts(newDir, opts.size)
+	if err != nil {
+		return nil, fmt.Errorf("new version: %w", err)
+	}
+	var changes []visualChange
+	for _, sample := range visualSamples {
+		oldImage, oldMissing := oldFonts.render(sample.text)
+		newImage, newMissing := newFonts.render(sample.text)
+		changed := imageDifference(oldImage, newImage)
+		if changed <= opts.threshold && oldMissing == newMissing {
+			continue
+		}
+		changes = append(changes, visualChange{sample, changed, [2]int{oldMissing, newMissing}})
+		if opts.diffDir != "" {
+			name := packageName + "-" + strings.ReplaceAll(strings.ToLower(sample.script), " ", "-") + ".png"
+			if err := writeDiffImage(filepath.Join(opts.diffDir, name), oldImage, newImage); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// visualFonts holds the members of a merged collection in fallback order.
+type visualFonts struct {
+	fonts  []*sfnt.Font
+	faces  []font.Face
+	buf    sfnt.Buffer
+	size   float64
+	ascent fixed.Int26_6
+}
+
+func loadVisualFonts(packageDir string, size float64) (*visualFonts, error) {
+	data, err := readPackageData(packageDir)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the font collection: %w", err)
+	}
+	vf := &visualFonts{size: size}
+	for i := 0; i < collection.NumFonts(); i++ {
+		f, err := collection.Font(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse font %d: %w", i, err)
+		}
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load font %d: %w", i, err)
+		}
+		vf.fonts = append(vf.fonts, f)
+		vf.faces = append(vf.faces, face)
+	}
+	if len(vf.faces) == 0 {
+		return nil, errors.New("the font collection is empty")
+	}
+	vf.ascent = vf.faces[0].Metrics().Ascent
+	return vf, nil
+}
+
+// render draws text in white on black and returns the image along with the number of characters that no font in the
+// collection could draw. The image is cropped to the width of the text.
+func (vf *visualFonts) render(text string) (*image.Gray, int) {
+	runes := []rune(text)
+	img := image.NewGray(image.Rect(0, 0, int(3*vf.size)*len(runes), int(2*vf.size)))
+	dot := fixed.Point26_6{X: fixed.I(int(vf.size) / 2), Y: vf.ascent + fixed.I(int(vf.size)/4)}
+	missing := 0
+	for _, r := range runes {
+		if r == ' ' {
+			dot.X += fixed.I(int(vf.size) / 4)
+			continue
+		}
+		drawn := false
+		for i, f := range vf.fonts {
+			if x, err := f.GlyphIndex(&vf.buf, r); err != nil || x == 0 {
+				continue
+			}
+			dr, mask, maskp, advance, ok := vf.faces[i].Glyph(dot, r)
+			if !ok {
+				// Bitmap-only fonts, such as color emoji, have no outlines to draw
+				continue
+			}
+			draw.DrawMask(img, dr, image.White, image.Point{}, mask, maskp, draw.Over)
+			dot.X += advance
+			drawn = true
+			break
+		}
+		if !drawn {
+			missing++
+			dot.X += fixed.I(int(vf.size) / 2)
+		}
+	}
+	width := dot.X.Ceil() + int(vf.size)/2
+	if width > img.Bounds().Dx() {
+		width = img.Bounds().Dx()
+	}
+	return img.SubImage(image.Rect(0, 0, width, img.Bounds().Dy())).(*image.Gray), missing
+}
+
+// imageDifference returns the fraction of pixels that are inked in either image and differ noticeably between them.
+func imageDifference(a *image.Gray, b *image.Gray) float64 {
+	bounds := a.Bounds().Union(b.Bounds())
+	inked, changed := 0, 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			va, vb := int(a.GrayAt(x, y).Y), int(b.GrayAt(x, y).Y)
+			if va == 0 && vb == 0 {
+				continue
+			}
+			inked++
+			if d := va - vb; d > 32 || d < -32 {
+				changed++
+			}
+		}
+	}
+	if inked == 0 {
+		return 0
+	}
+	return float64(changed) / float64(inked)
+}
+
+// writeDiffImage writes a PNG image that shows the old rendering, the new rendering, and their difference, from top
+// to bottom.
+func writeDiffImage(path string, a *image.Gray, b *image.Gray) error {
+	bounds := a.Bounds().Union(b.Bounds())
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, 3*h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			va, vb := a.GrayAt(x, y).Y, b.GrayAt(x, y).Y
+			out.Set(x, y, color.Gray{Y: 255 - va})
+			out.Set(x, h+y, color.Gray{Y: 255 - vb})
+			// Pixels only in the old rendering are red, pixels only in the new rendering are green
+			out.Set(x, 2*h+y, color.RGBA{R: 255 - vb, G: 255 - va, B: 255 - max8(va, vb), A: 255})
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create diff directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create diff image: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := png.Encode(f, out); err != nil {
+		return fmt.Errorf("failed to write diff image: %w", err)
+	}
+	return f.Close()
+}
+
+func max8(a uint8, b uint8) uint8 {
+	if a > b {
+		return a
+	}
+	return b
+}
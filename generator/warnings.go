@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// warningCategory classifies the warnings of a run in the run report.
+type warningCategory string
+
+const (
+	warnSubstitution warningCategory = "substitution" // A package lacks its base font or uses it in another style
+	warnInput        warningCategory = "input"        // Input files that are skipped, or patterns that match nothing
+	warnFeature      warningCategory = "feature"      // Shaping, hinting, or metrics that a package lost or lacks
+	warnSize         warningCategory = "size"         // Packages that exceed -max-memory
+	warnOutput       warningCategory = "output"       // Output files that change or remain unexpectedly
+)
+
+// warningCategories lists the categories in the order of the run report.
+var warningCategories = []warningCategory{warnSubstitution, warnInput, warnFeature, warnSize, warnOutput}
+
+// The severities of warnings. Major warnings mean that a package lacks characters or features that the options ask
+// for, such as when a source font is skipped; minor warnings are worth a look but do not affect coverage.
+const (
+	severityMajor = "major"
+	severityMinor = "minor"
+)
+
+// runWarning is a warning recorded in the run report.
+type runWarning struct {
+	Category warningCategory `json:"category"`
+	Severity string          `json:"severity"`
+	Package  string          `json:"package,omitempty"` // The package that the warning concerns, if any
+	Message  string          `json:"message"`
+}
+
+func (w runWarning) String() string {
+	if w.Package == "" {
+		return w.Message
+	}
+	return w.Package + ": " + w.Message
+}
+
+// warningRecorder collects the warnings of a run for the run report, while logging them as they occur.
+type warningRecorder struct {
+	mu       sync.Mutex
+	warnings []runWarning
+}
+
+// runWarnings records the warnings of the generate and embed commands.
+var runWarnings = new(warningRecorder)
+
+// warnf logs a warning and records it. pkg is the name of the package that it concerns, or "".
+func (r *warningRecorder) warnf(category warningCategory, severity string, pkg string, format string, a ...interface{}) {
+	w := runWarning{Category: category, Severity: severity, Package: pkg, Message: fmt.Sprintf(format, a...)}
+	log.warnf("%s", w)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, w)
+}
+
+// reset forgets the recorded warnings.
+func (r *warningRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = nil
+}
+
+// list returns the recorded warnings in the order of the run report: by category, with major warnings first, and then
+// by package. Warnings of the same package keep the order in which they occurred.
+func (r *warningRecorder) list() []runWarning {
+	r.mu.Lock()
+	list := append([]runWarning(nil), r.warnings...)
+	r.mu.Unlock()
+	rank := make(map[warningCategory]int, len(warningCategories))
+	for i, c := range warningCategories {
+		rank[c] = i
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Category != b.Category {
+			return rank[a.Category] < rank[b.Category]
+		}
+		if a.Severity != b.Severity {
+			return a.Severity == severityMajor
+		}
+		return a.Package < b.Package
+	})
+	return list
+}
+
+// report logs the run report, which lists the warnings of the run by category once the output is complete, so that
+// they need not be picked out of the progress messages.
+func (r *warningRecorder) report() {
+	list := r.list()
+	if len(list) == 0 {
+		return
+	}
+	major := 0
+	for _, w := range list {
+		if w.Severity == severityMajor {
+			major++
+		}
+	}
+	log.infof("Run report: %d warnings, %d major", len(list), major)
+	for i, w := range list {
+		if i == 0 || w.Category != list[i-1].Category {
+			n := 0
+			for _, v := range list[i:] {
+				if v.Category == w.Category {
+					n++
+				}
+			}
+			log.infof("  %s (%d):", w.Category, n)
+		}
+		log.infof("    %s  %s", w.Severity, w)
+	}
+}
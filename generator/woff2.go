@@ -0,0 +1,561 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/gonoto/gonoto/noto"
+)
+
+// Web distributions of the Noto fonts, such as Google Fonts, ship them in the WOFF2 format, which compresses the
+// tables of a font with Brotli after transforming the glyf, loca, and hmtx tables into a more compact form. The
+// adapter in this file presents them to the merge pipeline as the fonts they decode to, such as NotoSans-Regular.ttf
+// for NotoSans-Regular.woff2. See https://www.w3.org/TR/WOFF2/.
+
+const woff2Ext = ".woff2"
+
+// decompressBrotli decompresses Brotli data into size bytes. It is nil unless gonoto is built with -tags brotli; see
+// woff2_cgo.go.
+var decompressBrotli func(data []byte, size int) ([]byte, error)
+
+// woff2Tags are the tags of the known tables of the WOFF2 table directory, by index.
+var woff2Tags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post", "cvt ", "fpgm", "glyf", "loca", "prep", "CFF ",
+	"VORG", "EBDT", "EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea", "vmtx", "BASE", "GDEF", "GPOS",
+	"GSUB", "EBSC", "JSTF", "MATH", "CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar", "bdat", "bloc",
+	"bsln", "cvar", "fdsc", "feat", "fmtx", "fvar", "gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// woff2HeaderSize is the size of the WOFF2 header, which is followed by the table directory.
+const woff2HeaderSize = 48
+
+var (
+	errWOFF2Truncated = errors.New("WOFF2 data is truncated")
+	errWOFF2Support   = errors.New("gonoto was built without WOFF2 support; rebuild it with -tags brotli")
+)
+
+// woff2Flavor returns the extension of the font that a WOFF2 file decodes to from the start of its header.
+func woff2Flavor(header []byte) (string, error) {
+	if string(header[:4]) != "wOF2" {
+		return "", errors.New("not a WOFF2 font")
+	}
+	switch string(header[4:8]) {
+	case "\x00\x01\x00\x00", "true":
+		return ".ttf", nil
+	case "OTTO":
+		return ".otf", nil
+	case "ttcf":
+		return "", errors.New("WOFF2 collections are not supported")
+	}
+	return "", errors.New("unsupported SFNT version")
+}
+
+// woff2FontPath returns the path at which the font that the WOFF2 file at p decodes to is read, which is inside the
+// WOFF2 file and has the extension of its outlines, such as fonts/NotoSans/NotoSans-Regular.woff2/NotoSans-Regular.ttf
+// for TrueType outlines; see woff2FS. It also returns the size of the decoded font recorded by the WOFF2 header, which
+// is the only part of the file that is read. It reports false, with a warning, for WOFF2 files that cannot be decoded.
+func woff2FontPath(fsys fs.FS, p string) (string, int64, bool) {
+	if decompressBrotli == nil {
+		return "", 0, false
+	}
+	header, err := readWOFF2Header(fsys, p)
+	if err == nil {
+		var ext string
+		if ext, err = woff2Flavor(header); err == nil {
+			return p + "/" + strings.TrimSuffix(path.Base(p), woff2Ext) + ext, int64(binary.BigEndian.Uint32(header[16:])), true
+		}
+	}
+	runWarnings.warnf(warnInput, severityMajor, "", "Skipping the WOFF2 font %s: %s", p, err)
+	return "", 0, false
+}
+
+// readWOFF2Header reads the header of the WOFF2 file at p.
+func readWOFF2Header(fsys fs.FS, p string) ([]byte, error) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	header := make([]byte, woff2HeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, errWOFF2Truncated
+	}
+	return header, nil
+}
+
+// addWOFF2Fonts adds the WOFF2 fonts in fsys to the inventory as the static fonts they decode to, at the paths
+// returned by woff2FontPath. Variable fonts in WOFF2 format are instanced by addVariableFonts instead. preferFonts
+// keeps fonts of the same name in other formats.
+func addWOFF2Fonts(fsys fs.FS, inventory *noto.Inventory) error {
+	var unsupported int
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != woff2Ext || !strings.HasPrefix(d.Name(), "Noto") {
+			return nil
+		}
+		if decompressBrotli == nil {
+			unsupported++
+			return nil
+		}
+		fontPath, size, ok := woff2FontPath(fsys, p)
+		if !ok {
+			return nil
+		}
+		f, ok := noto.ParseFilename(path.Base(fontPath))
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f.Path = fontPath
+		f.Size = size
+		f.CompressedSize = info.Size()
+		inventory.Fonts = append(inventory.Fonts, f)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan the Noto input for WOFF2 fonts: %w", err)
+	}
+	if unsupported > 0 {
+		runWarnings.warnf(warnInput, severityMajor, "", "Skipping %d WOFF2 fonts: %s", unsupported, errWOFF2Support)
+	}
+	return nil
+}
+
+// isWOFF2Font reports whether a path of the inventory is that of a font decoded from a WOFF2 file.
+func isWOFF2Font(p string) bool {
+	for _, dir := range strings.Split(path.Dir(p), "/") {
+		if path.Ext(dir) == woff2Ext {
+			return true
+		}
+	}
+	return false
+}
+
+// woff2FS adds the fonts that the WOFF2 files of an input decode to, at the paths returned by woff2FontPath.
+type woff2FS struct {
+	fs.FS
+}
+
+func (w woff2FS) Open(name string) (fs.File, error) {
+	dir := path.Dir(name)
+	if path.Ext(dir) != woff2Ext {
+		return w.FS.Open(name)
+	}
+	data, err := fs.ReadFile(w.FS, dir)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if len(data) < 8 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errWOFF2Truncated}
+	}
+	if ext, err := woff2Flavor(data); err != nil || strings.TrimSuffix(path.Base(dir), woff2Ext)+ext != path.Base(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	font, err := decodeWOFF2(data)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &memFile{name: path.Base(name), Reader: bytes.NewReader(font)}, nil
+}
+
+// woff2Table is an entry of the WOFF2 table directory.
+type woff2Table struct {
+	tag         string
+	transformed bool
+	version     int    // The transformation version
+	length      uint32 // The length of the table in the compressed stream, which differs for transformed tables
+}
+
+// decodeWOFF2 decodes a WOFF2 font into an SFNT font.
+func decodeWOFF2(data []byte) ([]byte, error) {
+	f, transformed, err := readWOFF2Tables(data)
+	if err != nil {
+		return nil, err
+	}
+	var xMins []int
+	if t := transformed["glyf"]; t != nil {
+		if t.version != 0 || transformed["loca"] == nil {
+			return nil, errors.New("unsupported transformation of the glyf table")
+		}
+		if xMins, err = decodeWOFF2Glyf(f); err != nil {
+			return nil, fmt.Errorf("failed to decode the glyf table: %w", err)
+		}
+		delete(transformed, "glyf")
+		delete(transformed, "loca")
+	}
+	if t := transformed["hmtx"]; t != nil {
+		if t.version != 1 || xMins == nil {
+			return nil, errors.New("unsupported transformation of the hmtx table")
+		}
+		if err := decodeWOFF2Hmtx(f, xMins); err != nil {
+			return nil, fmt.Errorf("failed to decode the hmtx table: %w", err)
+		}
+		delete(transformed, "hmtx")
+	}
+	for tag := range transformed {
+		return nil, fmt.Errorf("unsupported transformation of the %s table", tag)
+	}
+	return f.encode(), nil
+}
+
+// readWOFF2Tables decompresses the tables of a WOFF2 font. The tables that were transformed are returned as they are
+// stored, and listed by tag along with their transformation.
+func readWOFF2Tables(data []byte) (*sfntFont, map[string]*woff2Table, error) {
+	if decompressBrotli == nil {
+		return nil, nil, errWOFF2Support
+	}
+	if len(data) < woff2HeaderSize {
+		return nil, nil, errWOFF2Truncated
+	}
+	if _, err := woff2Flavor(data); err != nil {
+		return nil, nil, err
+	}
+	numTables := int(binary.BigEndian.Uint16(data[12:]))
+	compressedSize := int(binary.BigEndian.Uint32(data[20:]))
+	pos := woff2HeaderSize
+	tables := make([]woff2Table, numTables)
+	total := 0
+	for i := range tables {
+		if len(data) < pos+1 {
+			return nil, nil, errWOFF2Truncated
+		}
+		flags := data[pos]
+		pos++
+		t := &tables[i]
+		if flags&0x3f == 0x3f {
+			if len(data) < pos+4 {
+				return nil, nil, errWOFF2Truncated
+			}
+			t.tag = string(data[pos : pos+4])
+			pos += 4
+		} else {
+			t.tag = woff2Tags[flags&0x3f]
+		}
+		t.version = int(flags >> 6)
+		// Version 0 is the transformation of the glyf and loca tables, and the null transformation of the others
+		t.transformed = t.version != 0
+		if t.tag == "glyf" || t.tag == "loca" {
+			t.transformed = t.version != 3
+		}
+		var n int
+		var err error
+		if t.length, n, err = readUIntBase128(data[pos:]); err != nil {
+			return nil, nil, err
+		}
+		pos += n
+		if t.transformed {
+			if t.length, n, err = readUIntBase128(data[pos:]); err != nil {
+				return nil, nil, err
+			}
+			pos += n
+		}
+		total += int(t.length)
+	}
+	if len(data) < pos+compressedSize {
+		return nil, nil, errWOFF2Truncated
+	}
+	stream, err := decompressBrotli(data[pos:pos+compressedSize], total)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decompress WOFF2 tables: %w", err)
+	}
+	if len(stream) < total {
+		return nil, nil, errWOFF2Truncated
+	}
+
+	f := &sfntFont{version: string(data[4:8]), tables: make(map[string][]byte, numTables)}
+	transformed := make(map[string]*woff2Table)
+	offset := 0
+	for i := range tables {
+		t := &tables[i]
+		f.tables[t.tag] = stream[offset : offset+int(t.length)]
+		offset += int(t.length)
+		if t.transformed {
+			transformed[t.tag] = t
+		}
+	}
+	return f, transformed, nil
+}
+
+// readUIntBase128 reads a variable-length UIntBase128 number and returns it with the number of bytes read.
+func readUIntBase128(data []byte) (uint32, int, error) {
+	var v uint32
+	for i := 0; i < 5 && i < len(data); i++ {
+		b := data[i]
+		if i == 0 && b == 0x80 {
+			return 0, 0, errors.New("UIntBase128 number has leading zeros")
+		}
+		if v&0xfe000000 != 0 {
+			return 0, 0, errors.New("UIntBase128 number overflows")
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errWOFF2Truncated
+}
+
+// woff2Stream reads one of the streams of a transformed glyf table. Reads past its end return zeros and set err.
+type woff2Stream struct {
+	data []byte
+	err  error
+}
+
+func (s *woff2Stream) bytes(n int) []byte {
+	if s.err != nil || n < 0 || len(s.data) < n {
+		s.err = errWOFF2Truncated
+		return make([]byte, maxInt(n, 0))
+	}
+	b := s.data[:n]
+	s.data = s.data[n:]
+	return b
+}
+
+func (s *woff2Stream) uint16() uint16 {
+	return binary.BigEndian.Uint16(s.bytes(2))
+}
+
+// uint255 reads a variable-length 255UInt16 number.
+func (s *woff2Stream) uint255() int {
+	switch code := s.bytes(1)[0]; code {
+	case 253:
+		return int(s.uint16())
+	case 254:
+		return 506 + int(s.bytes(1)[0])
+	case 255:
+		return 253 + int(s.bytes(1)[0])
+	default:
+		return int(code)
+	}
+}
+
+// decodeWOFF2Glyf reconstructs the glyf and loca tables of a font from the transformed glyf table, and returns the
+// xMin of the bounding box of each glyph, from which a transformed hmtx table derives the left side bearings. The
+// glyphs are padded to four bytes, and loca is written in the long format.
+func decodeWOFF2Glyf(f *sfntFont) ([]int, error) {
+	data := f.tables["glyf"]
+	head := f.tables["head"]
+	if len(head) < 54 {
+		return nil, errors.New("head table is truncated")
+	}
+	if len(data) < 36 {
+		return nil, errWOFF2Truncated
+	}
+	optionFlags := binary.BigEndian.Uint16(data[2:])
+	numGlyphs := int(binary.BigEndian.Uint16(data[4:]))
+	var streams [7]*woff2Stream
+	pos := 36
+	for i := range streams {
+		size := int(binary.BigEndian.Uint32(data[8+4*i:]))
+		if size < 0 || len(data) < pos+size {
+			return nil, errWOFF2Truncated
+		}
+		streams[i] = &woff2Stream{data: data[pos : pos+size]}
+		pos += size
+	}
+	contours, points, flags, glyphs, composites, bboxes, instructions :=
+		streams[0], streams[1], streams[2], streams[3], streams[4], streams[5], streams[6]
+	bitmapSize := 4 * ((numGlyphs + 31) / 32)
+	bboxBitmap := bboxes.bytes(bitmapSize)
+	var overlapBitmap []byte
+	if optionFlags&0x0001 != 0 {
+		if len(data) < pos+(numGlyphs+7)/8 {
+			return nil, errWOFF2Truncated
+		}
+		overlapBitmap = data[pos : pos+(numGlyphs+7)/8]
+	}
+	hasBit := func(bitmap []byte, i int) bool { return bitmap[i>>3]&(0x80>>(i&7)) != 0 }
+
+	var glyf bytes.Buffer
+	loca := make([]byte, 4*(numGlyphs+1))
+	xMins := make([]int, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		numContours := int(int16(contours.uint16()))
+		hasBBox := hasBit(bboxBitmap, i)
+		var glyph []byte
+		switch {
+		case numContours == 0:
+			if hasBBox {
+				return nil, fmt.Errorf("empty glyph %d has a bounding box", i)
+			}
+		case numContours < 0:
+			if !hasBBox {
+				return nil, fmt.Errorf("composite glyph %d has no bounding box", i)
+			}
+			bbox := bboxes.bytes(8)
+			start := composites.data
+			hasInstructions := false
+			for more := true; more && composites.err == nil; {
+				flags := composites.uint16()
+				size := 4
+				if flags&argsAreWords != 0 {
+					size = 6
+				}
+				switch {
+				case flags&haveScale != 0:
+					size += 2
+				case flags&haveXYScale != 0:
+					size += 4
+				case flags&haveTwoByTwo != 0:
+					size += 8
+				}
+				composites.bytes(size)
+				hasInstructions = hasInstructions || flags&haveInstructions != 0
+				more = flags&moreComponents != 0
+			}
+			if composites.err != nil {
+				return nil, composites.err
+			}
+			glyph = append(append([]byte{0xff, 0xff}, bbox...), start[:len(start)-len(composites.data)]...)
+			if hasInstructions {
+				length := glyphs.uint255()
+				glyph = append(glyph, byte(length>>8), byte(length))
+				glyph = append(glyph, instructions.bytes(length)...)
+			}
+			xMins[i] = int(int16(binary.BigEndian.Uint16(bbox)))
+		default:
+			o := new(glyphOutline)
+			numPoints := 0
+			for c := 0; c < numContours; c++ {
+				numPoints += points.uint255()
+				o.contourEnds = append(o.contourEnds, numPoints-1)
+			}
+			// Each point has a flag, so the flag stream bounds the number of points of a corrupt glyph
+			if len(flags.data) < numPoints {
+				return nil, fmt.Errorf("glyph %d: %w", i, errWOFF2Truncated)
+			}
+			o.flags = make([]byte, numPoints)
+			o.xs, o.ys = make([]int, numPoints), make([]int, numPoints)
+			x, y := 0, 0
+			for j, flag := range flags.bytes(numPoints) {
+				if flag&0x80 == 0 {
+					o.flags[j] = onCurvePoint
+				}
+				dx, dy := woff2Triplet(flag&0x7f, glyphs)
+				x, y = x+dx, y+dy
+				o.xs[j], o.ys[j] = x, y
+			}
+			if overlapBitmap != nil && hasBit(overlapBitmap, i) && numPoints > 0 {
+				o.flags[0] |= overlapSimple
+			}
+			o.instructions = instructions.bytes(glyphs.uint255())
+			if hasBBox {
+				bbox := bboxes.bytes(8)
+				o.xMin = int(int16(binary.BigEndian.Uint16(bbox)))
+				o.yMin = int(int16(binary.BigEndian.Uint16(bbox[2:])))
+				o.xMax = int(int16(binary.BigEndian.Uint16(bbox[4:])))
+				o.yMax = int(int16(binary.BigEndian.Uint16(bbox[6:])))
+			} else if numPoints > 0 {
+				o.xMin, o.yMin, o.xMax, o.yMax = o.xs[0], o.ys[0], o.xs[0], o.ys[0]
+				for j := range o.xs {
+					o.xMin, o.xMax = minInt(o.xMin, o.xs[j]), maxInt(o.xMax, o.xs[j])
+					o.yMin, o.yMax = minInt(o.yMin, o.ys[j]), maxInt(o.yMax, o.ys[j])
+				}
+			}
+			glyph = o.encode()
+			xMins[i] = o.xMin
+		}
+		for _, s := range streams {
+			if s.err != nil {
+				return nil, fmt.Errorf("glyph %d: %w", i, s.err)
+			}
+		}
+		glyf.Write(glyph)
+		glyf.Write(make([]byte, (4-len(glyph)%4)%4))
+		binary.BigEndian.PutUint32(loca[4*(i+1):], uint32(glyf.Len()))
+	}
+	f.tables["glyf"] = glyf.Bytes()
+	f.tables["loca"] = loca
+	head = append([]byte(nil), head...)
+	binary.BigEndian.PutUint16(head[50:], 1)
+	f.tables["head"] = head
+	return xMins, nil
+}
+
+// woff2Triplet decodes the coordinate deltas of a point of a transformed simple glyph, given the flag of the point
+// without its on-curve bit, from the glyph stream.
+func woff2Triplet(flag byte, glyphs *woff2Stream) (dx int, dy int) {
+	withSign := func(flag byte, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	switch {
+	case flag < 10:
+		b := glyphs.bytes(1)
+		dy = withSign(flag, int(flag&14)<<7+int(b[0]))
+	case flag < 20:
+		b := glyphs.bytes(1)
+		dx = withSign(flag, int((flag-10)&14)<<7+int(b[0]))
+	case flag < 84:
+		b0, b1 := int(flag-20), int(glyphs.bytes(1)[0])
+		dx = withSign(flag, 1+(b0&0x30)+b1>>4)
+		dy = withSign(flag>>1, 1+(b0&0x0c)<<2+b1&0x0f)
+	case flag < 120:
+		b0, b := int(flag-84), glyphs.bytes(2)
+		dx = withSign(flag, 1+(b0/12)<<8+int(b[0]))
+		dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+int(b[1]))
+	case flag < 124:
+		b := glyphs.bytes(3)
+		dx = withSign(flag, int(b[0])<<4+int(b[1])>>4)
+		dy = withSign(flag>>1, int(b[1]&0x0f)<<8+int(b[2]))
+	default:
+		b := glyphs.bytes(4)
+		dx = withSign(flag, int(b[0])<<8+int(b[1]))
+		dy = withSign(flag>>1, int(b[2])<<8+int(b[3]))
+	}
+	return dx, dy
+}
+
+// decodeWOFF2Hmtx reconstructs the hmtx table of a font from the transformed hmtx table, in which the left side
+// bearings that equal the xMin of their glyphs may be omitted.
+func decodeWOFF2Hmtx(f *sfntFont, xMins []int) error {
+	hhea, maxp := f.tables["hhea"], f.tables["maxp"]
+	if len(hhea) < 36 || len(maxp) < 6 {
+		return errors.New("hhea or maxp table is truncated")
+	}
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	if numMetrics < 1 || numMetrics > numGlyphs || numGlyphs != len(xMins) {
+		return errors.New("hmtx table does not match the number of glyphs")
+	}
+	data := f.tables["hmtx"]
+	if len(data) < 1 {
+		return errWOFF2Truncated
+	}
+	flags := data[0]
+	s := &woff2Stream{data: data[1:]}
+	hmtx := make([]byte, 4*numMetrics+2*(numGlyphs-numMetrics))
+	for i := 0; i < numMetrics; i++ {
+		copy(hmtx[4*i:], s.bytes(2))
+	}
+	for i := 0; i < numGlyphs; i++ {
+		pos, omitted := 4*numMetrics+2*(i-numMetrics), flags&0x02 != 0
+		if i < numMetrics {
+			pos, omitted = 4*i+2, flags&0x01 != 0
+		}
+		if omitted {
+			binary.BigEndian.PutUint16(hmtx[pos:], uint16(int16(xMins[i])))
+		} else {
+			copy(hmtx[pos:], s.bytes(2))
+		}
+	}
+	if s.err != nil {
+		return s.err
+	}
+	f.tables["hmtx"] = hmtx
+	return nil
+}
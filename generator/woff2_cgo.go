@@ -0,0 +1,33 @@
+//go:build brotli
+// +build brotli
+
+package generator
+
+// #cgo pkg-config: libbrotlidec
+// #include <brotli/decode.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+)
+
+func init() {
+	decompressBrotli = brotliDecompress
+}
+
+// brotliDecompress decompresses data with libbrotlidec, which fails if the data does not fit into size bytes.
+func brotliDecompress(data []byte, size int) ([]byte, error) {
+	if len(data) == 0 || size == 0 {
+		return nil, errors.New("empty Brotli data")
+	}
+	out := make([]byte, size)
+	n := C.size_t(size)
+	if C.BrotliDecoderDecompress(C.size_t(len(data)), (*C.uint8_t)(&data[0]), &n, (*C.uint8_t)(&out[0])) != C.BROTLI_DECODER_RESULT_SUCCESS {
+		return nil, errors.New("invalid Brotli data")
+	}
+	if int(n) != size {
+		return nil, fmt.Errorf("Brotli data decompressed to %d bytes, expected %d", n, size)
+	}
+	return out, nil
+}
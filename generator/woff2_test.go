@@ -0,0 +1,213 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// testdata/Test-Regular.woff2 is testdata/Test-Regular.ttf in the WOFF2 format, with the glyf, loca, and hmtx tables
+// transformed. Its glyphs are an empty one, a composite one with instructions, and simple ones with instructions, an
+// explicit bounding box, the overlap flag, and coordinate deltas in every class of the triplet encoding.
+
+func readWOFF2Fixture(t *testing.T) []byte {
+	if decompressBrotli == nil {
+		t.Skip("WOFF2 fonts require -tags brotli")
+	}
+	data, err := ioutil.ReadFile("testdata/Test-Regular.woff2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testOutlines decodes the glyphs of a font.
+func testOutlines(t *testing.T, f *sfntFont) []*glyphOutline {
+	head, loca, glyf := f.table("head"), f.table("loca"), f.table("glyf")
+	numGlyphs := int(binary.BigEndian.Uint16(f.table("maxp")[4:]))
+	outlines := make([]*glyphOutline, numGlyphs)
+	for i := range outlines {
+		var start, end int
+		if binary.BigEndian.Uint16(head[50:]) != 0 {
+			start, end = int(binary.BigEndian.Uint32(loca[4*i:])), int(binary.BigEndian.Uint32(loca[4*i+4:]))
+		} else {
+			start, end = 2*int(binary.BigEndian.Uint16(loca[2*i:])), 2*int(binary.BigEndian.Uint16(loca[2*i+2:]))
+		}
+		o, err := decodeGlyph(glyf[start:end])
+		if err != nil {
+			t.Fatalf("glyph %d: %v", i, err)
+		}
+		outlines[i] = o
+	}
+	return outlines
+}
+
+func TestDecodeWOFF2(t *testing.T) {
+	data := readWOFF2Fixture(t)
+	ttf, err := ioutil.ReadFile("testdata/Test-Regular.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeWOFF2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseSFNT(decoded, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := parseSFNT(ttf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.tables) != len(expected.tables) {
+		t.Errorf("decoded %d tables, expected %d", len(got.tables), len(expected.tables))
+	}
+	for tag, table := range expected.tables {
+		switch tag {
+		case "glyf", "loca":
+			// The glyphs are compared below, since they are encoded anew and loca is written in the long format
+		case "head":
+			// Apart from checkSumAdjustment and indexToLocFormat
+			g, e := append([]byte(nil), got.table(tag)...), append([]byte(nil), table...)
+			if len(g) != len(e) {
+				t.Errorf("the head table has %d bytes, expected %d", len(g), len(e))
+				continue
+			}
+			copy(g[8:12], e[8:12])
+			copy(g[50:52], e[50:52])
+			if !bytes.Equal(g, e) {
+				t.Errorf("the head table is % x, expected % x", g, e)
+			}
+		default:
+			if !bytes.Equal(got.table(tag), table) {
+				t.Errorf("the %s table is % x, expected % x", tag, got.table(tag), table)
+			}
+		}
+	}
+	gotOutlines, expectedOutlines := testOutlines(t, got), testOutlines(t, expected)
+	if len(gotOutlines) != len(expectedOutlines) {
+		t.Fatalf("decoded %d glyphs, expected %d", len(gotOutlines), len(expectedOutlines))
+	}
+	for i := range expectedOutlines {
+		if !reflect.DeepEqual(gotOutlines[i], expectedOutlines[i]) {
+			t.Errorf("glyph %d is %+v, expected %+v", i, gotOutlines[i], expectedOutlines[i])
+		}
+	}
+}
+
+func TestDecodeWOFF2Truncated(t *testing.T) {
+	data := readWOFF2Fixture(t)
+	// The file is padded to four bytes after the compressed tables
+	end := len(data) - 3
+	for n := 0; n < end; n++ {
+		if _, err := decodeWOFF2(data[:n]); err == nil {
+			t.Errorf("the first %d bytes of the fixture decoded", n)
+		}
+	}
+
+	f, transformed, err := readWOFF2Tables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transformed["glyf"] == nil || transformed["loca"] == nil || transformed["hmtx"] == nil {
+		t.Fatalf("the glyf, loca, and hmtx tables of the fixture are not transformed: %v", transformed)
+	}
+	for _, tag := range []string{"glyf", "hmtx"} {
+		table := f.tables[tag]
+		for n := 0; n < len(table); n++ {
+			truncated := &sfntFont{tables: map[string][]byte{}}
+			for k, v := range f.tables {
+				truncated.tables[k] = v
+			}
+			truncated.tables[tag] = table[:n]
+			if err := decodeTestTransforms(truncated); err == nil {
+				t.Errorf("the first %d bytes of the transformed %s table decoded", n, tag)
+			}
+		}
+	}
+}
+
+// decodeTestTransforms reverses the transformations of the glyf, loca, and hmtx tables of a font read by
+// readWOFF2Tables.
+func decodeTestTransforms(f *sfntFont) error {
+	xMins, err := decodeWOFF2Glyf(f)
+	if err != nil {
+		return err
+	}
+	return decodeWOFF2Hmtx(f, xMins)
+}
+
+func TestDecodeWOFF2Corrupt(t *testing.T) {
+	data := readWOFF2Fixture(t)
+	corrupt := func(offset int, b ...byte) []byte {
+		c := append([]byte(nil), data...)
+		copy(c[offset:], b)
+		return c
+	}
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"signature", corrupt(0, 'w', 'O', 'F', 'F')},
+		{"collection", corrupt(4, 't', 't', 'c', 'f')},
+		{"flavor", corrupt(4, 0, 0, 0, 0)},
+		{"compressed size", corrupt(20, 0xff, 0xff, 0xff, 0xff)},
+		{"compressed data", corrupt(len(data)-12, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)},
+		{"table count", corrupt(12, 0xff, 0xff)},
+		// The original length of the cmap table, which follows its flags, with a leading zero
+		{"table length", corrupt(woff2HeaderSize+1, 0x80, 0x80)},
+	} {
+		if _, err := decodeWOFF2(test.data); err == nil {
+			t.Errorf("%s: the corrupt fixture decoded", test.name)
+		}
+	}
+
+	// Flipping any byte must fail or decode to some font, but not panic
+	for i := range data {
+		_, _ = decodeWOFF2(corrupt(i, ^data[i]))
+	}
+	f, _, err := readWOFF2Tables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"glyf", "hmtx"} {
+		table := f.tables[tag]
+		for i := range table {
+			for _, b := range []byte{^table[i], 0, 0xfd, 0x7f} {
+				c := &sfntFont{tables: map[string][]byte{}}
+				for k, v := range f.tables {
+					c.tables[k] = v
+				}
+				c.tables[tag] = append([]byte(nil), table...)
+				c.tables[tag][i] = b
+				_ = decodeTestTransforms(c)
+			}
+		}
+	}
+}
+
+func TestReadUIntBase128(t *testing.T) {
+	for _, test := range []struct {
+		data   []byte
+		value  uint32
+		length int
+		ok     bool
+	}{
+		{[]byte{0x3f}, 63, 1, true},
+		{[]byte{0x81, 0x00, 0xff}, 128, 2, true},
+		{[]byte{0x8f, 0xff, 0xff, 0xff, 0x7f}, 0xffffffff, 5, true},
+		{[]byte{0x80, 0x01}, 0, 0, false},                   // A leading zero
+		{[]byte{0x90, 0x80, 0x80, 0x80, 0x00}, 0, 0, false}, // More than 32 bits
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, 0, 0, false},
+		{[]byte{0x81}, 0, 0, false},
+		{nil, 0, 0, false},
+	} {
+		v, n, err := readUIntBase128(test.data)
+		if (err == nil) != test.ok || v != test.value || n != test.length {
+			t.Errorf("readUIntBase128(% x) = %d, %d, %v", test.data, v, n, err)
+		}
+	}
+}
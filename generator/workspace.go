@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// workspace holds the source fonts of a -low-memory run as plain files on disk, so that the packages can be merged
+// without the input: without decompressing its ZIP entries, splitting its collections, or instancing its variable
+// fonts again. It is an fs.FS of the source fonts by their file names in the input.
+type workspace struct {
+	dir   string            // The directory that holds the fonts
+	files map[string]string // The paths of the fonts in dir, by file name in the input
+}
+
+// newWorkspace is the first pass of -low-memory: it reads the source fonts from the input one at a time and writes each
+// of them to a new directory in parent, which the caller removes once the packages are merged. The fonts are stored
+// under numbered names, since the file name of a font derived from a collection or variable font nests it inside
+// the name of that file.
+func newWorkspace(z fs.FS, fonts []*fontDesc, parent string, prog *progress) (*workspace, error) {
+	dir, err := ioutil.TempDir(parent, ".gonoto-low-memory-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the -low-memory workspace: %w", err)
+	}
+	w := &workspace{dir: dir, files: make(map[string]string, len(fonts))}
+	for _, f := range fonts {
+		prog.addTotal(stageExtract, f.size)
+	}
+	for i, f := range fonts {
+		loaded, err := loadSourceFonts(z, []*fontDesc{f}, 1, prog)
+		if err != nil {
+			_ = w.remove()
+			return nil, err
+		}
+		path := filepath.Join(dir, strconv.Itoa(i)+filepath.Ext(f.filename))
+		if err := ioutil.WriteFile(path, loaded[f.filename], 0644); err != nil {
+			_ = w.remove()
+			return nil, fmt.Errorf("failed to write %s to the -low-memory workspace: %w", f.filename, err)
+		}
+		w.files[f.filename] = path
+	}
+	return w, nil
+}
+
+// Open opens the source font with the given file name in the input.
+func (w *workspace) Open(name string) (fs.File, error) {
+	path, ok := w.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return os.Open(path)
+}
+
+// remove deletes the workspace and the fonts in it.
+func (w *workspace) remove() error {
+	return os.RemoveAll(w.dir)
+}
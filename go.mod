@@ -1,8 +1,8 @@
 module github.com/gonoto/gonoto
 
-go 1.14
+go 1.16
 
 require (
 	github.com/Nik-U/otcmerge v0.0.0-20200703002124-0b678d41c1a7
-	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
+	golang.org/x/image v0.10.0
 )
@@ -0,0 +1,71 @@
+//go:build go1.18
+// +build go1.18
+
+package noto
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzParseFilename is the fuzz target of ParseFilename, which starts from the known file names of
+// testdata/filenames.txt:
+//
+//	go test -fuzz FuzzParseFilename ./noto
+//
+// Every name that ParseFilename accepts must parse to the same font once it is written in canonical form, so that
+// prefix and suffix matches cannot depend on the terms around them, such as Light within DemiLight or ExtraLight and
+// Bold within SemiBold, and MatchPrefix and MatchSuffix must take the longest of the style terms that match.
+func FuzzParseFilename(f *testing.F) {
+	for _, known := range readKnownFilenames(f) {
+		f.Add(known.name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		for _, terms := range [][]string{Families, Weights, Widths, VDensities, Styles} {
+			checkMatch(t, name, terms)
+		}
+		font, ok := ParseFilename(name)
+		if !ok {
+			return
+		}
+		canonical := canonicalFilename(font, name[len(name)-len(".ttf"):])
+		g, ok := ParseFilename(canonical)
+		if !ok {
+			t.Fatalf("%q parses as %+v, but its canonical name %q does not parse", name, *font, canonical)
+		}
+		if *g != *font {
+			t.Fatalf("%q parses as %+v, but its canonical name %q parses as %+v", name, *font, canonical, *g)
+		}
+	})
+}
+
+// checkMatch fails unless MatchPrefix and MatchSuffix split s into the longest matching term and the rest.
+func checkMatch(t *testing.T, s string, terms []string) {
+	prefix, rest := MatchPrefix(s, terms)
+	suffix, front := MatchSuffix(s, terms)
+	if prefix+rest != s || front+suffix != s {
+		t.Fatalf("%q is split into %q and %q, or %q and %q", s, prefix, rest, front, suffix)
+	}
+	for _, term := range terms {
+		if len(term) > len(prefix) && strings.HasPrefix(s, term) {
+			t.Fatalf("%q starts with %q, but MatchPrefix returns %q", s, term, prefix)
+		}
+		if len(term) > len(suffix) && strings.HasSuffix(s, term) {
+			t.Fatalf("%q ends with %q, but MatchSuffix returns %q", s, term, suffix)
+		}
+	}
+}
+
+// canonicalFilename returns the file name of a font in the form used by Noto releases, in which the Regular weight is
+// omitted unless it is the only style term, as in NotoSans-Regular.ttf and NotoSans-CondensedItalic.ttf.
+func canonicalFilename(f *Font, ext string) string {
+	styling := f.Width + f.Weight + f.Style
+	if f.Weight == "Regular" && (f.Width != "" || f.Style != "") {
+		styling = f.Width + f.Style
+	}
+	ui := ""
+	if f.UI {
+		ui = "UI"
+	}
+	return "Noto" + f.Family + f.Language + ui + "-" + styling + ext
+}
@@ -0,0 +1,66 @@
+package noto
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// IndexSuffix is appended to the path of an archive to form the path of its index; see ScanZipFile.
+const IndexSuffix = ".index.json"
+
+// indexVersion changes whenever the index format or the parsing of fonts changes, which invalidates old indexes.
+const indexVersion = 6
+
+// index is the content of an index file. Size and ModTime identify the archive that was scanned.
+type index struct {
+	Version int     `json:"version"`
+	Size    int64   `json:"size"`
+	ModTime int64   `json:"mod_time"` // In nanoseconds since the Unix epoch
+	Fonts   []*Font `json:"fonts"`
+}
+
+// ScanZipFile scans the ZIP file at zipPath like Scan. The result is cached in an index file next to the archive
+// (zipPath + IndexSuffix), which is used instead of the archive while the archive keeps its size and modification
+// time. It reports whether the index was used. Failing to write the index is
+// not an error, since the archive may be in a read-only location.
+func ScanZipFile(zipPath string) (*Inventory, bool, error) {
+	fi, err := os.Stat(zipPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if inv, ok := readIndex(zipPath+IndexSuffix, fi); ok {
+		return inv, true, nil
+	}
+
+	z, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = z.Close() }()
+	inv, err := Scan(z)
+	if err != nil {
+		return nil, false, err
+	}
+	if data, err := json.Marshal(&index{Version: indexVersion, Size: fi.Size(), ModTime: fi.ModTime().UnixNano(), Fonts: inv.Fonts}); err == nil {
+		_ = ioutil.WriteFile(zipPath+IndexSuffix, data, 0644)
+	}
+	return inv, false, nil
+}
+
+// readIndex loads the inventory from an index file if it matches the archive described by fi.
+func readIndex(path string, fi os.FileInfo) (*Inventory, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, false
+	}
+	if idx.Version != indexVersion || idx.Size != fi.Size() || idx.ModTime != fi.ModTime().UnixNano() {
+		return nil, false
+	}
+	return newInventory(idx.Fonts), true
+}
@@ -0,0 +1,261 @@
+package noto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Weight is one of the weights of Weights. Its values are the indices of the terms in Weights, so weights compare
+// from lightest to heaviest.
+type Weight int
+
+// The weights of Weights.
+const (
+	Thin Weight = iota
+	ExtraLight
+	Light
+	DemiLight
+	Regular
+	Medium
+	SemiBold
+	Bold
+	ExtraBold
+	Black
+)
+
+// ParseWeight parses a weight term, such as "SemiBold". Unlike in file names, the Regular weight must be named.
+func ParseWeight(s string) (Weight, error) {
+	if i := termIndex(s, Weights); i >= 0 {
+		return Weight(i), nil
+	}
+	return 0, fmt.Errorf("unknown weight %q (expected one of %s)", s, strings.Join(Weights, ", "))
+}
+
+// String returns the term of the weight in Weights.
+func (w Weight) String() string {
+	if w < 0 || int(w) >= len(Weights) {
+		return fmt.Sprintf("Weight(%d)", int(w))
+	}
+	return Weights[w]
+}
+
+// weightClasses are the usWeightClass values of the OS/2 table for the weights. DemiLight is the 350 of the CJK fonts.
+var weightClasses = [...]uint16{100, 200, 300, 350, 400, 500, 600, 700, 800, 900}
+
+// Class returns the usWeightClass value of the OS/2 table that fonts of the weight use, such as 350 for DemiLight, or
+// 0 for an invalid weight.
+func (w Weight) Class() uint16 {
+	if w < 0 || int(w) >= len(weightClasses) {
+		return 0
+	}
+	return weightClasses[w]
+}
+
+// weightOfClass returns the weight whose Class is c, if any.
+func weightOfClass(c uint16) (Weight, bool) {
+	for w, class := range weightClasses {
+		if class == c {
+			return Weight(w), true
+		}
+	}
+	return 0, false
+}
+
+// Width is one of the widths of Widths. Its values are the indices of the terms in Widths, so widths compare from
+// narrowest to widest.
+type Width int
+
+// The widths of Widths.
+const (
+	ExtraCondensed Width = iota
+	Condensed
+	SemiCondensed
+	NormalWidth
+)
+
+// ParseWidth parses a width term, such as "Condensed". The normal width may be given either as "Normal", as in the
+// configuration files of the gonoto command, or as "", as in file names.
+func ParseWidth(s string) (Width, error) {
+	if s == "Normal" {
+		return NormalWidth, nil
+	}
+	if i := termIndex(s, Widths); i >= 0 {
+		return Width(i), nil
+	}
+	return 0, fmt.Errorf("unknown width %q (expected one of ExtraCondensed, Condensed, SemiCondensed, Normal)", s)
+}
+
+// String returns the term of the width in Widths, or "Normal" for the normal width; see Term.
+func (w Width) String() string {
+	if w == NormalWidth {
+		return "Normal"
+	}
+	if w < 0 || int(w) >= len(Widths) {
+		return fmt.Sprintf("Width(%d)", int(w))
+	}
+	return Widths[w]
+}
+
+// Term returns the term of the width in file names, which is "" for the normal width.
+func (w Width) Term() string {
+	if w == NormalWidth {
+		return ""
+	}
+	return w.String()
+}
+
+// widthClasses are the usWidthClass values of the OS/2 table for the widths.
+var widthClasses = [...]uint16{2, 3, 4, 5}
+
+// Class returns the usWidthClass value of the OS/2 table that fonts of the width use, or 0 for an invalid width.
+func (w Width) Class() uint16 {
+	if w < 0 || int(w) >= len(widthClasses) {
+		return 0
+	}
+	return widthClasses[w]
+}
+
+// widthOfClass returns the width whose Class is c, if any.
+func widthOfClass(c uint16) (Width, bool) {
+	for w, class := range widthClasses {
+		if class == c {
+			return Width(w), true
+		}
+	}
+	return 0, false
+}
+
+// Style is one of the styles of Styles.
+type Style int
+
+// The styles of Styles.
+const (
+	NormalStyle Style = iota
+	Italic
+)
+
+// ParseStyle parses a style term. As with ParseWidth, the normal style may be given either as "Normal" or as "".
+func ParseStyle(s string) (Style, error) {
+	if s == "Normal" {
+		return NormalStyle, nil
+	}
+	if i := termIndex(s, Styles); i >= 0 {
+		return Style(i), nil
+	}
+	return 0, fmt.Errorf("unknown style %q (expected Normal or Italic)", s)
+}
+
+// String returns the term of the style in Styles, or "Normal" for the normal style; see Term.
+func (s Style) String() string {
+	if s == NormalStyle {
+		return "Normal"
+	}
+	if s < 0 || int(s) >= len(Styles) {
+		return fmt.Sprintf("Style(%d)", int(s))
+	}
+	return Styles[s]
+}
+
+// Term returns the term of the style in file names, which is "" for the normal style.
+func (s Style) Term() string {
+	if s == NormalStyle {
+		return ""
+	}
+	return s.String()
+}
+
+// Script is the language or script that a font covers, such as "Devanagari" or "CJKsc", as it appears in file names
+// between the family and the style terms. The empty script is the default one of each family, which covers Latin,
+// Greek, and Cyrillic.
+type Script string
+
+// ParseScript validates a script: it must consist of ASCII letters and digits, start with an uppercase letter, and not
+// be confused with the terms around it in a file name, as "Mono" or "UI" would be.
+func ParseScript(s string) (Script, error) {
+	if s == "" {
+		return "", nil
+	}
+	valid := s[0] >= 'A' && s[0] <= 'Z'
+	for _, c := range s {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			valid = false
+		}
+	}
+	if valid {
+		// Every family is followed by the script in file names, so one that parses back from a name of Sans parses
+		// back from those of the others
+		f, ok := ParseFilename("NotoSans" + s + "-Regular.ttf")
+		valid = ok && f.Family == "Sans" && f.Language == s && !f.UI
+	}
+	if !valid {
+		return "", fmt.Errorf("invalid script %q", s)
+	}
+	return Script(s), nil
+}
+
+// String returns the script as it appears in file names, which is "" for the default script.
+func (s Script) String() string {
+	return string(s)
+}
+
+// Naming is the validated form of the naming fields of a Font.
+type Naming struct {
+	Family string // One of Families
+	Script Script
+	Weight Weight
+	Width  Width
+	UI     bool
+	Style  Style
+}
+
+// Naming validates the family, language, weight, width, and style of the font, which are always valid for the fonts
+// returned by ParseFilename, ParseFont, and Scan.
+func (f *Font) Naming() (Naming, error) {
+	n := Naming{Family: f.Family, UI: f.UI}
+	if termIndex(f.Family, Families) < 0 {
+		return n, fmt.Errorf("unknown family %q", f.Family)
+	}
+	var err error
+	if n.Script, err = ParseScript(f.Language); err != nil {
+		return n, err
+	}
+	if n.Weight, err = ParseWeight(f.Weight); err != nil {
+		return n, err
+	}
+	// The names of the normal width and style are only accepted in the configuration files of the gonoto command
+	if f.Width == "Normal" || f.Style == "Normal" {
+		return n, fmt.Errorf("the normal width and style of a Font must be empty, found %q and %q", f.Width, f.Style)
+	}
+	if n.Width, err = ParseWidth(f.Width); err != nil {
+		return n, err
+	}
+	if n.Style, err = ParseStyle(f.Style); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// Filename returns the canonical name of a font file with the naming and the given extension, such as ".ttf", which
+// omits the default terms: NotoSansDevanagariUI-CondensedItalic.ttf rather than
+// NotoSansDevanagariUI-CondensedRegularItalic.ttf. ParseFilename parses it back into the same naming.
+func (n Naming) Filename(ext string) string {
+	styling := n.Width.Term() + n.Weight.String() + n.Style.Term()
+	if n.Weight == Regular && (n.Width != NormalWidth || n.Style != NormalStyle) {
+		styling = n.Width.Term() + n.Style.Term()
+	}
+	ui := ""
+	if n.UI {
+		ui = "UI"
+	}
+	return "Noto" + n.Family + string(n.Script) + ui + "-" + styling + ext
+}
+
+// termIndex returns the index of s in terms, or -1 if it is not one of them.
+func termIndex(s string, terms []string) int {
+	for i, t := range terms {
+		if t == s {
+			return i
+		}
+	}
+	return -1
+}
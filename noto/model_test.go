@@ -0,0 +1,196 @@
+package noto
+
+import (
+	"path"
+	"testing"
+)
+
+func TestParseWeight(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		want  Weight
+		class uint16
+		ok    bool
+	}{
+		{"Thin", Thin, 100, true},
+		{"DemiLight", DemiLight, 350, true},
+		{"Regular", Regular, 400, true},
+		{"SemiBold", SemiBold, 600, true},
+		{"Black", Black, 900, true},
+		{"", 0, 0, false},
+		{"Normal", 0, 0, false},
+		{"bold", 0, 0, false},
+		{"Heavy", 0, 0, false},
+	} {
+		w, err := ParseWeight(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseWeight(%q) error = %v, want ok %v", tc.in, err, tc.ok)
+			continue
+		}
+		if !tc.ok {
+			continue
+		}
+		if w != tc.want || w.String() != tc.in || w.Class() != tc.class {
+			t.Errorf("ParseWeight(%q) = %v with class %d, want %v with class %d", tc.in, w, w.Class(), tc.want, tc.class)
+		}
+	}
+	for _, w := range []Weight{-1, Weight(len(Weights))} {
+		if w.Class() != 0 {
+			t.Errorf("%v.Class() = %d, want 0", w, w.Class())
+		}
+	}
+}
+
+func TestParseWidth(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		want  Width
+		term  string
+		class uint16
+		ok    bool
+	}{
+		{"ExtraCondensed", ExtraCondensed, "ExtraCondensed", 2, true},
+		{"Condensed", Condensed, "Condensed", 3, true},
+		{"SemiCondensed", SemiCondensed, "SemiCondensed", 4, true},
+		{"Normal", NormalWidth, "", 5, true},
+		{"", NormalWidth, "", 5, true},
+		{"Expanded", 0, "", 0, false},
+		{"condensed", 0, "", 0, false},
+	} {
+		w, err := ParseWidth(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseWidth(%q) error = %v, want ok %v", tc.in, err, tc.ok)
+			continue
+		}
+		if !tc.ok {
+			continue
+		}
+		if w != tc.want || w.Term() != tc.term || w.Class() != tc.class {
+			t.Errorf("ParseWidth(%q) = %v with term %q and class %d, want %v with term %q and class %d",
+				tc.in, w, w.Term(), w.Class(), tc.want, tc.term, tc.class)
+		}
+		if back, err := ParseWidth(w.String()); err != nil || back != w {
+			t.Errorf("ParseWidth(%q) = %v, %v, want %v", w.String(), back, err, w)
+		}
+	}
+	if w := Width(len(Widths)); w.Class() != 0 {
+		t.Errorf("%v.Class() = %d, want 0", w, w.Class())
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Style
+		term string
+		ok   bool
+	}{
+		{"Italic", Italic, "Italic", true},
+		{"Normal", NormalStyle, "", true},
+		{"", NormalStyle, "", true},
+		{"Oblique", 0, "", false},
+		{"italic", 0, "", false},
+	} {
+		s, err := ParseStyle(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseStyle(%q) error = %v, want ok %v", tc.in, err, tc.ok)
+			continue
+		}
+		if !tc.ok {
+			continue
+		}
+		if s != tc.want || s.Term() != tc.term {
+			t.Errorf("ParseStyle(%q) = %v with term %q, want %v with term %q", tc.in, s, s.Term(), tc.want, tc.term)
+		}
+		if back, err := ParseStyle(s.String()); err != nil || back != s {
+			t.Errorf("ParseStyle(%q) = %v, %v, want %v", s.String(), back, err, s)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	for _, tc := range []struct {
+		in string
+		ok bool
+	}{
+		{"", true},
+		{"Devanagari", true},
+		{"CJKsc", true},
+		{"OldItalic", true},
+		{"devanagari", false},
+		{"Old Italic", false},
+		{"Deva-nagari", false},
+		{"UI", false},
+		{"Mono", false},
+		{"Display", false},
+	} {
+		s, err := ParseScript(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseScript(%q) error = %v, want ok %v", tc.in, err, tc.ok)
+		} else if tc.ok && s.String() != tc.in {
+			t.Errorf("ParseScript(%q) = %q", tc.in, s)
+		}
+	}
+}
+
+func TestNamingFilename(t *testing.T) {
+	for _, tc := range []struct {
+		naming Naming
+		want   string
+	}{
+		{Naming{Family: "Sans", Weight: Regular, Width: NormalWidth}, "NotoSans-Regular.ttf"},
+		{Naming{Family: "Sans", Weight: Regular, Style: Italic, Width: NormalWidth}, "NotoSans-Italic.ttf"},
+		{Naming{Family: "Sans", Script: "Devanagari", UI: true, Weight: Regular, Width: Condensed, Style: Italic},
+			"NotoSansDevanagariUI-CondensedItalic.ttf"},
+		{Naming{Family: "Serif", Weight: SemiBold, Width: ExtraCondensed}, "NotoSerif-ExtraCondensedSemiBold.ttf"},
+		{Naming{Family: "SansMono", Script: "CJKsc", Weight: Bold, Width: NormalWidth}, "NotoSansMonoCJKsc-Bold.ttf"},
+	} {
+		name := tc.naming.Filename(".ttf")
+		if name != tc.want {
+			t.Errorf("%+v.Filename() = %q, want %q", tc.naming, name, tc.want)
+			continue
+		}
+		f, ok := ParseFilename(name)
+		if !ok {
+			t.Errorf("ParseFilename(%q) failed", name)
+			continue
+		}
+		if n, err := f.Naming(); err != nil || n != tc.naming {
+			t.Errorf("ParseFilename(%q).Naming() = %+v, %v, want %+v", name, n, err, tc.naming)
+		}
+	}
+}
+
+// TestNamingRoundTrip checks that the canonical name of every known Noto file name parses back into the same font.
+func TestNamingRoundTrip(t *testing.T) {
+	for _, k := range readKnownFilenames(t) {
+		if k.font == nil {
+			continue
+		}
+		n, err := k.font.Naming()
+		if err != nil {
+			t.Errorf("%s: Naming() failed: %v", k.name, err)
+			continue
+		}
+		name := n.Filename(path.Ext(k.name))
+		f, ok := ParseFilename(name)
+		if !ok || *f != *k.font {
+			t.Errorf("%s: ParseFilename(%q) = %+v, %v, want %+v", k.name, name, f, ok, k.font)
+		}
+	}
+}
+
+func TestFontNamingInvalid(t *testing.T) {
+	for _, f := range []*Font{
+		{Family: "Fancy", Weight: "Regular"},
+		{Family: "Sans", Language: "devanagari", Weight: "Regular"},
+		{Family: "Sans", Weight: "Heavy"},
+		{Family: "Sans", Weight: "Regular", Width: "Normal"},
+		{Family: "Sans", Weight: "Regular", Style: "Normal"},
+		{Family: "Sans", Weight: "Regular", Style: "Oblique"},
+	} {
+		if n, err := f.Naming(); err == nil {
+			t.Errorf("%+v.Naming() = %+v, want an error", f, n)
+		}
+	}
+}
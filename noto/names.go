@@ -0,0 +1,212 @@
+package noto
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// The IDs of the name table records that ParseFont reads.
+const (
+	nameIDFamily            = 1
+	nameIDSubfamily         = 2
+	nameIDTypographicFamily = 16
+	nameIDTypographicSub    = 17
+)
+
+// maxNameTableSize bounds the size of the name and OS/2 tables that ParseFont reads, so that a malformed table
+// directory cannot make it allocate an arbitrary amount of memory.
+const maxNameTableSize = 1 << 20
+
+// ParseFont describes the OpenType font read from r by its name and OS/2 tables rather than by its file name, so that
+// upstream renames of files do not change how they are recognized. The family and language come from the typographic
+// family name (or the family name), such as "Noto Sans Devanagari UI", and the weight, width, and style from the
+// typographic subfamily name (or the subfamily name), such as "Condensed SemiBold Italic", or else from the weight and
+// width classes and the italic bit of the OS/2 table. The file is read once from start to end, so r need not support
+// seeking, as the files of a ZIP archive do not, but only the two tables are kept in memory; if r is an io.Seeker,
+// the data before and between the tables is skipped rather than read. It reports false for
+// fonts that cannot be read or are not Noto fonts in the families and styles that ParseFilename recognizes, and for
+// variable fonts, which hold several styles. The Path and sizes of the result are not set.
+func ParseFont(r io.Reader) (*Font, bool) {
+	tables, ok := readTables(r, "name", "OS/2", "fvar")
+	if !ok || tables["name"] == nil || len(tables["OS/2"]) < 64 || tables["fvar"] != nil {
+		return nil, false
+	}
+	os2 := tables["OS/2"]
+	weightClass, weightOK := weightOfClass(binary.BigEndian.Uint16(os2[4:]))
+	widthClass, widthOK := widthOfClass(binary.BigEndian.Uint16(os2[6:]))
+	weight, width, style := weightClass.String(), widthClass.Term(), NormalStyle.Term()
+	if binary.BigEndian.Uint16(os2[62:])&1 != 0 {
+		style = Italic.Term()
+	}
+	names := readNames(tables["name"])
+	family, subfamily := names[nameIDTypographicFamily], names[nameIDTypographicSub]
+	if family == "" {
+		family = names[nameIDFamily]
+	}
+	if subfamily == "" {
+		subfamily = names[nameIDSubfamily]
+	}
+	family = strings.ReplaceAll(family, " ", "")
+	subfamily = strings.ReplaceAll(subfamily, " ", "")
+	if !strings.HasPrefix(family, "Noto") {
+		return nil, false
+	}
+
+	// Fonts without typographic names, and some with, name the weight and width of styles other than Regular, Italic,
+	// Bold, and Bold Italic in the family name, as in "Noto Sans Condensed SemiBold". The trailing style terms are moved
+	// to the subfamily if the result agrees with the OS/2 table, since a language may end with a term too, as in
+	// "Noto Sans Old Italic". Weight classes other than those of Weight.Class, such as the 250 that some Thin fonts
+	// use, are not compared.
+	if domain, terms := splitStyleTerms(family[4:]); terms != "" && widthOK {
+		styling := subfamily
+		if styling == "Regular" {
+			styling = ""
+		}
+		f, ok := parseStyling(terms + styling)
+		if ok && (f.Weight == weight || !weightOK) && f.Width == width && f.Style == style {
+			family, subfamily = "Noto"+domain, terms+styling
+		}
+	}
+
+	fam, domain := SplitFamily(family[4:])
+	if fam == "" {
+		return nil, false
+	}
+	vDensity, domain := MatchSuffix(domain, VDensities)
+	if len(domain) == 5 && strings.HasPrefix(domain, "CJK") {
+		// "Noto Sans CJK JP" is named NotoSansCJKjp in file names
+		domain = "CJK" + strings.ToLower(domain[3:])
+	}
+	f, ok := parseStyling(subfamily)
+	if !ok {
+		if !weightOK || !widthOK {
+			return nil, false
+		}
+		f = &Font{Weight: weight, Width: width, Style: style}
+	}
+	f.Family = fam
+	f.Language = domain
+	f.UI = vDensity == "UI"
+	return f, true
+}
+
+// splitStyleTerms splits the style terms off the end of a name, such as "SansCondensedSemiBold" into "Sans" and
+// "CondensedSemiBold"; see MatchSuffix.
+func splitStyleTerms(name string) (rest string, terms string) {
+	var all []string
+	for _, list := range [][]string{Weights, Widths, Styles} {
+		all = append(all, list...)
+	}
+	for {
+		t, r := MatchSuffix(name, all)
+		if t == "" || r == "" {
+			return name, terms
+		}
+		name, terms = r, t+terms
+	}
+}
+
+// readTables reads the named tables of the OpenType font read from r, which are nil if the font has none. The data
+// between the tables is skipped by seeking if r is an io.Seeker, and read and discarded otherwise. It reports false if
+// the font is malformed or is a collection.
+func readTables(r io.Reader, tags ...string) (map[string][]byte, bool) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, false
+	}
+	switch string(header[:4]) {
+	case "\x00\x01\x00\x00", "OTTO", "true":
+	default:
+		return nil, false
+	}
+	numTables := int(binary.BigEndian.Uint16(header[4:]))
+	dir := make([]byte, 16*numTables)
+	if _, err := io.ReadFull(r, dir); err != nil {
+		return nil, false
+	}
+	type entry struct {
+		tag            string
+		offset, length int64
+	}
+	var entries []entry
+	for i := 0; i < numTables; i++ {
+		record := dir[16*i:]
+		tag := string(record[:4])
+		for _, t := range tags {
+			if tag == t {
+				offset, length := binary.BigEndian.Uint32(record[8:]), binary.BigEndian.Uint32(record[12:])
+				entries = append(entries, entry{tag, int64(offset), int64(length)})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].offset < entries[j].offset })
+	tables := make(map[string][]byte, len(entries))
+	pos := int64(len(header) + len(dir))
+	for _, e := range entries {
+		if e.offset < pos || e.length > maxNameTableSize {
+			return nil, false
+		}
+		if s, ok := r.(io.Seeker); ok {
+			if _, err := s.Seek(e.offset, io.SeekStart); err != nil {
+				return nil, false
+			}
+		} else if _, err := io.CopyN(ioutil.Discard, r, e.offset-pos); err != nil {
+			return nil, false
+		}
+		data := make([]byte, e.length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, false
+		}
+		tables[e.tag] = data
+		pos = e.offset + e.length
+	}
+	return tables, true
+}
+
+// readNames returns the English names of a name table by name ID. Windows names are preferred over Unicode names, and
+// those over Macintosh names.
+func readNames(table []byte) map[uint16]string {
+	names := make(map[uint16]string)
+	if len(table) < 6 {
+		return names
+	}
+	count := int(binary.BigEndian.Uint16(table[2:]))
+	storage := int(binary.BigEndian.Uint16(table[4:]))
+	priority := make(map[uint16]int)
+	for i := 0; i < count && 6+12*(i+1) <= len(table); i++ {
+		record := table[6+12*i:]
+		platform, encoding := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:])
+		language, id := binary.BigEndian.Uint16(record[4:]), binary.BigEndian.Uint16(record[6:])
+		length, offset := int(binary.BigEndian.Uint16(record[8:])), int(binary.BigEndian.Uint16(record[10:]))
+		var p int
+		switch {
+		case platform == 3 && (encoding == 1 || encoding == 10) && language == 0x409:
+			p = 3
+		case platform == 0:
+			p = 2
+		case platform == 1 && encoding == 0 && language == 0:
+			p = 1
+		default:
+			continue
+		}
+		if p <= priority[id] || storage+offset+length > len(table) {
+			continue
+		}
+		data := table[storage+offset : storage+offset+length]
+		if platform == 1 {
+			names[id] = string(data)
+		} else {
+			units := make([]uint16, len(data)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(data[2*j:])
+			}
+			names[id] = string(utf16.Decode(units))
+		}
+		priority[id] = p
+	}
+	return names
+}
@@ -0,0 +1,188 @@
+package noto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"testing"
+	"unicode/utf16"
+)
+
+// testFont is the naming of a minimal OpenType font for ParseFont, which reads only the name and OS/2 tables.
+type testFont struct {
+	names       map[uint16]string // Windows English names by name ID
+	weightClass uint16
+	widthClass  uint16
+	italic      bool
+	variable    bool // Whether the font has an fvar table
+}
+
+// encode returns an SFNT font with the name and OS/2 tables of the naming, and an empty fvar table if it is variable.
+func (tf testFont) encode() []byte {
+	os2 := make([]byte, 78)
+	binary.BigEndian.PutUint16(os2[4:], tf.weightClass)
+	binary.BigEndian.PutUint16(os2[6:], tf.widthClass)
+	if tf.italic {
+		binary.BigEndian.PutUint16(os2[62:], 1)
+	}
+
+	ids := make([]int, 0, len(tf.names))
+	for id := range tf.names {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	var records, storage bytes.Buffer
+	for _, id := range ids {
+		units := utf16.Encode([]rune(tf.names[uint16(id)]))
+		_ = binary.Write(&records, binary.BigEndian, [6]uint16{3, 1, 0x409, uint16(id), uint16(2 * len(units)),
+			uint16(storage.Len())})
+		_ = binary.Write(&storage, binary.BigEndian, units)
+	}
+	name := new(bytes.Buffer)
+	_ = binary.Write(name, binary.BigEndian, [3]uint16{0, uint16(len(ids)), uint16(6 + records.Len())})
+	name.Write(records.Bytes())
+	name.Write(storage.Bytes())
+
+	tables := map[string][]byte{"OS/2": os2, "name": name.Bytes()}
+	if tf.variable {
+		tables["fvar"] = make([]byte, 16)
+	}
+	return encodeTestTables(tables)
+}
+
+// encodeTestTables returns a TrueType font with the tables, whose checksums are left out.
+func encodeTestTables(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	var out bytes.Buffer
+	out.WriteString("\x00\x01\x00\x00")
+	_ = binary.Write(&out, binary.BigEndian, [4]uint16{uint16(len(tags))})
+	offset := 12 + 16*len(tags)
+	for _, tag := range tags {
+		out.WriteString(tag)
+		_ = binary.Write(&out, binary.BigEndian, [3]uint32{0, uint32(offset), uint32(len(tables[tag]))})
+		offset += (len(tables[tag]) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		out.Write(tables[tag])
+		out.Write(make([]byte, (4-len(tables[tag])%4)%4))
+	}
+	return out.Bytes()
+}
+
+// names returns the family and subfamily names of a test font.
+func names(family, subfamily string) map[uint16]string {
+	return map[uint16]string{nameIDFamily: family, nameIDSubfamily: subfamily}
+}
+
+func TestParseFont(t *testing.T) {
+	for _, test := range []struct {
+		font     testFont
+		expected *Font // nil if the font is rejected
+	}{
+		// The subfamily names the style, whatever the OS/2 table says
+		{testFont{names: names("Noto Sans", "Regular"), weightClass: 700, widthClass: 3},
+			&Font{Family: "Sans", Weight: "Regular"}},
+		{testFont{names: names("Noto Serif", "Bold Italic"), weightClass: 700, widthClass: 5, italic: true},
+			&Font{Family: "Serif", Weight: "Bold", Style: "Italic"}},
+		// The typographic names are preferred
+		{testFont{names: map[uint16]string{
+			nameIDFamily: "Noto Sans Devanagari UI Cond SemBd", nameIDSubfamily: "Regular",
+			nameIDTypographicFamily: "Noto Sans Devanagari UI", nameIDTypographicSub: "Condensed SemiBold Italic",
+		}, weightClass: 600, widthClass: 3, italic: true},
+			&Font{Family: "Sans", Language: "Devanagari", Weight: "SemiBold", Width: "Condensed", UI: true,
+				Style: "Italic"}},
+		{testFont{names: names("Noto Sans CJK JP", "Regular"), weightClass: 400, widthClass: 5},
+			&Font{Family: "Sans", Language: "CJKjp", Weight: "Regular"}},
+		// Style terms at the end of the family name are moved to the subfamily if the OS/2 table agrees
+		{testFont{names: names("Noto Sans Condensed SemiBold", "Italic"), weightClass: 600, widthClass: 3,
+			italic: true},
+			&Font{Family: "Sans", Weight: "SemiBold", Width: "Condensed", Style: "Italic"}},
+		{testFont{names: names("Noto Sans Thin", "Regular"), weightClass: 250, widthClass: 5},
+			&Font{Family: "Sans", Weight: "Thin"}},
+		{testFont{names: names("Noto Sans Old Italic", "Regular"), weightClass: 400, widthClass: 5},
+			&Font{Family: "Sans", Language: "OldItalic", Weight: "Regular"}},
+
+		// Fonts whose subfamily does not parse take the style from the weight and width classes and the italic bit
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 100, widthClass: 5},
+			&Font{Family: "Sans", Weight: "Thin"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 200, widthClass: 2},
+			&Font{Family: "Sans", Weight: "ExtraLight", Width: "ExtraCondensed"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 300, widthClass: 3, italic: true},
+			&Font{Family: "Sans", Weight: "Light", Width: "Condensed", Style: "Italic"}},
+		{testFont{names: names("Noto Sans CJK SC", "Book"), weightClass: 350, widthClass: 5},
+			&Font{Family: "Sans", Language: "CJKsc", Weight: "DemiLight"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 400, widthClass: 4},
+			&Font{Family: "Sans", Weight: "Regular", Width: "SemiCondensed"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 500, widthClass: 5},
+			&Font{Family: "Sans", Weight: "Medium"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 600, widthClass: 5},
+			&Font{Family: "Sans", Weight: "SemiBold"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 700, widthClass: 5},
+			&Font{Family: "Sans", Weight: "Bold"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 800, widthClass: 5},
+			&Font{Family: "Sans", Weight: "ExtraBold"}},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 900, widthClass: 5, italic: true},
+			&Font{Family: "Sans", Weight: "Black", Style: "Italic"}},
+		// Classes without a term
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 250, widthClass: 5}, nil},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 400, widthClass: 1}, nil},
+		{testFont{names: names("Noto Sans", "Book"), weightClass: 400, widthClass: 6}, nil},
+
+		// Variable fonts hold several styles
+		{testFont{names: names("Noto Sans", "Regular"), weightClass: 400, widthClass: 5, variable: true}, nil},
+		// Fonts of other projects, and unknown families
+		{testFont{names: names("Go", "Regular"), weightClass: 400, widthClass: 5}, nil},
+		{testFont{names: names("Noto Fancy", "Regular"), weightClass: 400, widthClass: 5}, nil},
+		{testFont{names: map[uint16]string{}, weightClass: 400, widthClass: 5}, nil},
+	} {
+		desc := test.font.names[nameIDFamily] + "/" + test.font.names[nameIDSubfamily]
+		f, ok := ParseFont(bytes.NewReader(test.font.encode()))
+		switch {
+		case test.expected == nil && ok:
+			t.Errorf("%s: parsed as %+v, expected it to be rejected", desc, *f)
+		case test.expected != nil && !ok:
+			t.Errorf("%s: rejected, expected %+v", desc, *test.expected)
+		case ok && *f != *test.expected:
+			t.Errorf("%s: parsed as %+v, expected %+v", desc, *f, *test.expected)
+		}
+	}
+}
+
+func TestParseFontMalformed(t *testing.T) {
+	valid := testFont{names: names("Noto Sans", "Regular"), weightClass: 400, widthClass: 5}.encode()
+	if _, ok := ParseFont(bytes.NewReader(valid)); !ok {
+		t.Fatal("the valid font was rejected")
+	}
+	corrupt := func(offset int, b ...byte) []byte {
+		c := append([]byte(nil), valid...)
+		copy(c[offset:], b)
+		return c
+	}
+	// The tables are sorted by tag: OS/2, then name
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"collection", corrupt(0, 't', 't', 'c', 'f')},
+		{"WOFF", corrupt(0, 'w', 'O', 'F', 'F')},
+		{"table count", corrupt(4, 0x10, 0)},
+		{"OS/2 length", corrupt(12+12, 0, 0, 0, 63)},
+		{"OS/2 in the table directory", corrupt(12+8, 0, 0, 0, 12)},
+		{"overlapping tables", corrupt(12+16+8, 0, 0, 0, 44+16)},
+		{"oversized name", corrupt(12+16+12, 0x7f, 0xff, 0xff, 0xff)},
+		{"name past the end", corrupt(12+16+8, 0, 0, 0x10, 0)},
+	} {
+		if f, ok := ParseFont(bytes.NewReader(test.data)); ok {
+			t.Errorf("%s: parsed as %+v", test.name, *f)
+		}
+	}
+	for n := 0; n < len(valid)-3; n++ {
+		if f, ok := ParseFont(bytes.NewReader(valid[:n])); ok {
+			t.Errorf("the first %d bytes parsed as %+v", n, *f)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package noto describes the contents of Noto font release archives. It is used by the gonoto command to select the
+// fonts that are merged into each package, and can be used by other tools to inspect an archive without generating
+// any packages.
+package noto
+
+import "strings"
+
+// Families lists the font families recognized in Noto file names. Names that share a prefix, such as Sans and
+// SansMono, are told apart by taking the longest match; see MatchPrefix. The symbol, math, and music fonts are
+// families of their own rather than languages of Sans, like the Arabic display families, so that packages of any
+// family can merge them. The monospaced CJK fonts, such as NotoSansMonoCJKsc-Regular.otf, are the CJK languages of
+// SansMono.
+//
+// There is some confusion over whether SerifDisplay / SansDisplay are meant to be the compact or non-compact
+// versions of Serif / Sans. https://github.com/googlefonts/noto-source/blob/master/FONT_CONTRIBUTION.md seems to
+// suggest that Serif / Sans are "UI" fonts and that the "Display" variants are "less compact", which seems to
+// contradict the name. Moreover, comparing the versions with notodiff reveals that "Display" is actually more
+// compact (see https://github.com/googlefonts/noto-fonts/issues/1056 ). Consequently, the gonoto command only
+// generates outputs based on these variants when asked to with -include-display, as separate Display packages.
+var Families = []string{
+	"SerifDisplay", "SansDisplay",
+	"SansMono", "Serif", "Sans", "Mono",
+	"Emoji", "KufiArabic", "NaskhArabic", "NastaliqUrdu",
+	"SansMath", "SansSymbols", "SansSymbols2", "Music"}
+
+// The style terms that appear in Noto file names, from lightest to heaviest weight, narrowest to widest width, and so
+// on. The empty string denotes the default term, which is omitted from file names.
+var (
+	Weights    = []string{"Thin", "ExtraLight", "Light", "DemiLight", "Regular", "Medium", "SemiBold", "Bold", "ExtraBold", "Black"}
+	Widths     = []string{"ExtraCondensed", "Condensed", "SemiCondensed", ""}
+	VDensities = []string{"UI", ""}
+	Styles     = []string{"", "Italic"}
+)
+
+// Font describes a single font file in a Noto archive.
+type Font struct {
+	Path string // The path of the file within the archive
+
+	Family   string // The family that the font belongs to, e.g. "Sans"
+	Language string // The language or script covered by the font, or "" for the default (Latin, Greek, Cyrillic)
+	Weight   string // One of Weights
+	Width    string // One of Widths
+	UI       bool   // Whether this is a UI variant, which has tighter vertical metrics
+	Style    string // One of Styles
+
+	Size           int64  // The uncompressed size of the file, in bytes
+	CompressedSize int64  // The compressed size of the file in the archive, or Size if the archive is not compressed
+	CRC32          uint32 // The CRC-32 checksum of the file recorded by the archive, or 0 if the archive has none
+}
+
+// ParseFilename parses the base name of a Noto font file, such as "NotoSansDevanagariUI-Bold.ttf". It reports false
+// for files that are not Noto fonts in OpenType format, or whose names use unknown families or style terms. The Path
+// and sizes of the result are not set.
+func ParseFilename(name string) (*Font, bool) {
+	var ext string
+	switch {
+	case strings.HasSuffix(name, ".otf"):
+		ext = ".otf"
+	case strings.HasSuffix(name, ".ttf"):
+		ext = ".ttf"
+	default:
+		return nil, false
+	}
+	if len(name) < 9 || !strings.HasPrefix(name, "Noto") {
+		return nil, false
+	}
+	terms := strings.SplitN(name[4:len(name)-len(ext)], "-", 2)
+	if len(terms) != 2 {
+		return nil, false
+	}
+	domain, styling := terms[0], terms[1]
+
+	family, domain := SplitFamily(domain)
+	if family == "" {
+		return nil, false
+	}
+	vDensity, domain := MatchSuffix(domain, VDensities)
+	f, ok := parseStyling(styling)
+	if !ok {
+		return nil, false
+	}
+	f.Family = family
+	f.Language = domain
+	f.UI = vDensity == "UI"
+	return f, true
+}
+
+// parseStyling parses the style terms of a Noto font name, such as "CondensedSemiBoldItalic", into the weight, width,
+// and style of a Font. An empty name is the Regular weight.
+func parseStyling(styling string) (*Font, bool) {
+	style, styling := MatchSuffix(styling, Styles)
+	width, styling := MatchPrefix(styling, Widths)
+	weight, styling := MatchPrefix(styling, Weights)
+	if styling != "" {
+		return nil, false
+	}
+	// If no explicit weight was found, assume it was "Regular"
+	if weight == "" {
+		weight = "Regular"
+	}
+	return &Font{Weight: weight, Width: width, Style: style}, true
+}
+
+// SplitFamily splits a name such as "SansDevanagari" into a family ("Sans") and the remainder ("Devanagari"). The
+// family is empty if the name does not start with one of Families.
+func SplitFamily(name string) (family string, rest string) {
+	return MatchPrefix(name, Families)
+}
+
+// MatchPrefix returns the longest member of terms that s starts with, along with the remainder of s, or the empty
+// string and s if no member matches. Taking the longest match rather than the first makes the result independent of
+// the order of terms, so that Sans never matches the start of SansMono.
+func MatchPrefix(s string, terms []string) (term string, rest string) {
+	for _, t := range terms {
+		if len(t) > len(term) && strings.HasPrefix(s, t) {
+			term = t
+		}
+	}
+	return term, s[len(term):]
+}
+
+// MatchSuffix returns the longest member of terms that s ends with, along with the remainder of s, or the empty string
+// and s if no member matches. As with MatchPrefix, a term never matches the end of a longer one: Light does not match
+// ExtraLight or DemiLight, Bold does not match SemiBold, and Condensed does not match SemiCondensed.
+func MatchSuffix(s string, terms []string) (term string, rest string) {
+	for _, t := range terms {
+		if len(t) > len(term) && strings.HasSuffix(s, t) {
+			term = t
+		}
+	}
+	return term, s[:len(s)-len(term)]
+}
@@ -0,0 +1,157 @@
+package noto
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// knownFilename is a line of testdata/filenames.txt: a file name from a Noto release or checkout, and the font that
+// ParseFilename returns for it, or nil if the name is rejected.
+type knownFilename struct {
+	name string
+	font *Font
+}
+
+// readKnownFilenames reads testdata/filenames.txt, which lists the file names of several Noto releases and checkouts
+// of noto-fonts, noto-cjk, and noto-emoji, including names that ParseFilename rejects, along with the fields that
+// ParseFilename returns for each of them.
+func readKnownFilenames(tb testing.TB) []knownFilename {
+	data, err := ioutil.ReadFile("testdata/filenames.txt")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var known []knownFilename
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		switch {
+		case len(fields) == 2 && fields[1] == "rejected":
+			known = append(known, knownFilename{name: fields[0]})
+			continue
+		case len(fields) != 7:
+			tb.Fatalf("malformed line %q in testdata/filenames.txt", line)
+		}
+		for i, f := range fields {
+			if f == "-" {
+				fields[i] = ""
+			}
+		}
+		known = append(known, knownFilename{fields[0], &Font{
+			Family:   fields[1],
+			Language: fields[2],
+			Weight:   fields[3],
+			Width:    fields[4],
+			UI:       fields[5] == "UI",
+			Style:    fields[6],
+		}})
+	}
+	return known
+}
+
+func TestParseFilename(t *testing.T) {
+	known := readKnownFilenames(t)
+	if len(known) == 0 {
+		t.Fatal("testdata/filenames.txt lists no file names")
+	}
+	for _, test := range known {
+		f, ok := ParseFilename(test.name)
+		if test.font == nil {
+			if ok {
+				t.Errorf("%s: parsed as %+v, expected it to be rejected", test.name, *f)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: rejected", test.name)
+			continue
+		}
+		for _, field := range []struct {
+			name          string
+			got, expected interface{}
+		}{
+			{"family", f.Family, test.font.Family},
+			{"language", f.Language, test.font.Language},
+			{"weight", f.Weight, test.font.Weight},
+			{"width", f.Width, test.font.Width},
+			{"UI", f.UI, test.font.UI},
+			{"style", f.Style, test.font.Style},
+			{"path", f.Path, ""},
+			{"size", f.Size, int64(0)},
+		} {
+			if field.got != field.expected {
+				t.Errorf("%s: the %s is %#v, expected %#v", test.name, field.name, field.got, field.expected)
+			}
+		}
+	}
+}
+
+func TestMatchPrefix(t *testing.T) {
+	for _, test := range []struct {
+		s, term, rest string
+		terms         []string
+	}{
+		{"ExtraLightItalic", "ExtraLight", "Italic", Weights},
+		{"LightItalic", "Light", "Italic", Weights},
+		{"DemiLight", "DemiLight", "", Weights},
+		{"SemiBold", "SemiBold", "", Weights},
+		{"BoldItalic", "Bold", "Italic", Weights},
+		{"SemiCondensedBold", "SemiCondensed", "Bold", Widths},
+		{"CondensedBold", "Condensed", "Bold", Widths},
+		{"ExtraCondensed", "ExtraCondensed", "", Widths},
+		{"SansMonoCJKjp", "SansMono", "CJKjp", Families},
+		{"SansSymbols2", "SansSymbols2", "", Families},
+		// Whatever the order of the terms
+		{"ExtraLightItalic", "ExtraLight", "Italic", []string{"Light", "ExtraLight"}},
+		{"SemiBold", "SemiBold", "", []string{"Semi", "SemiBold"}},
+		// Terms match only at the start
+		{"ItalicLight", "", "ItalicLight", Weights},
+		{"Italic", "", "Italic", Weights},
+		{"", "", "", Weights},
+		{"Light", "", "Light", nil},
+		// The empty term of Widths matches every string
+		{"Bold", "", "Bold", Widths},
+	} {
+		term, rest := MatchPrefix(test.s, test.terms)
+		if term != test.term || rest != test.rest {
+			t.Errorf("MatchPrefix(%q) = %q, %q, expected %q, %q", test.s, term, rest, test.term, test.rest)
+		}
+	}
+}
+
+func TestMatchSuffix(t *testing.T) {
+	for _, test := range []struct {
+		s, term, rest string
+		terms         []string
+	}{
+		{"CondensedExtraLight", "ExtraLight", "Condensed", Weights},
+		{"CondensedLight", "Light", "Condensed", Weights},
+		{"DemiLight", "DemiLight", "", Weights},
+		{"CondensedSemiBold", "SemiBold", "Condensed", Weights},
+		{"CondensedBold", "Bold", "Condensed", Weights},
+		{"SansSemiCondensed", "SemiCondensed", "Sans", Widths},
+		{"SansCondensed", "Condensed", "Sans", Widths},
+		{"SansExtraCondensed", "ExtraCondensed", "Sans", Widths},
+		{"DevanagariUI", "UI", "Devanagari", VDensities},
+		{"BoldItalic", "Italic", "Bold", Styles},
+		// Whatever the order of the terms
+		{"DemiLight", "DemiLight", "", []string{"Light", "DemiLight"}},
+		{"SemiCondensed", "SemiCondensed", "", []string{"Condensed", "SemiCondensed"}},
+		// Terms match only at the end
+		{"LightItalic", "", "LightItalic", Weights},
+		{"Devanagari", "", "Devanagari", VDensities},
+		{"", "", "", Weights},
+		{"Light", "", "Light", nil},
+	} {
+		term, rest := MatchSuffix(test.s, test.terms)
+		if term != test.term || rest != test.rest {
+			t.Errorf("MatchSuffix(%q) = %q, %q, expected %q, %q", test.s, term, rest, test.term, test.rest)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package noto
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// Inventory lists the Noto fonts found in an archive.
+type Inventory struct {
+	Fonts     []*Font  // The fonts, sorted by path
+	Languages []string // The distinct languages of the fonts, sorted; "" denotes the default language
+}
+
+// Scan walks an archive, such as a *zip.Reader or a directory opened with os.DirFS, and returns the Noto fonts that it
+// contains. Each .ttf and .otf file is described by its name and OS/2 tables, see ParseFont, or, if they do not
+// describe a Noto font, by its file name, see ParseFilename. Files that cannot seek, such as the compressed files of a
+// ZIP archive, would have to be decompressed up to their name tables, which usually follow the glyphs, so they are
+// described by their file names where these are recognized, and by their tables otherwise. Other files are ignored.
+func Scan(archive fs.FS) (*Inventory, error) {
+	var fonts []*Font
+	err := fs.WalkDir(archive, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		font, ok := parseFile(archive, p)
+		if !ok {
+			font, ok = ParseFilename(path.Base(p))
+		}
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		font.Path = p
+		font.Size = info.Size()
+		font.CompressedSize = info.Size()
+		if h, ok := info.Sys().(*zip.FileHeader); ok {
+			font.CompressedSize = int64(h.CompressedSize64)
+			font.CRC32 = h.CRC32
+		}
+		fonts = append(fonts, font)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newInventory(fonts), nil
+}
+
+// parseFile describes a font file of an archive by its tables; see ParseFont. Files that cannot be read are left to
+// ParseFilename, so that the error is reported when their data is needed, as are files that cannot seek and whose
+// names ParseFilename recognizes.
+func parseFile(archive fs.FS, p string) (*Font, bool) {
+	if ext := path.Ext(p); ext != ".ttf" && ext != ".otf" {
+		return nil, false
+	}
+	f, err := archive.Open(p)
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = f.Close() }()
+	if _, ok := f.(io.Seeker); !ok {
+		if _, ok := ParseFilename(path.Base(p)); ok {
+			return nil, false
+		}
+	}
+	return ParseFont(f)
+}
+
+// newInventory sorts the fonts and collects their languages.
+func newInventory(fonts []*Font) *Inventory {
+	inv := &Inventory{Fonts: fonts}
+	sort.Slice(inv.Fonts, func(i, j int) bool { return inv.Fonts[i].Path < inv.Fonts[j].Path })
+	languages := make(map[string]bool)
+	for _, f := range inv.Fonts {
+		languages[f.Language] = true
+	}
+	for l := range languages {
+		inv.Languages = append(inv.Languages, l)
+	}
+	sort.Strings(inv.Languages)
+	return inv
+}
+
+// Lookup returns the fonts of a family that cover a language, in path order.
+func (inv *Inventory) Lookup(family string, language string) []*Font {
+	var out []*Font
+	for _, f := range inv.Fonts {
+		if f.Family == family && f.Language == language {
+			out = append(out, f)
+		}
+	}
+	return out
+}
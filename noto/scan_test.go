@@ -0,0 +1,102 @@
+package noto
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestScan(t *testing.T) {
+	devanagari := testFont{names: names("Noto Sans Devanagari", "Bold"), weightClass: 700, widthClass: 5}.encode()
+	variable := testFont{names: names("Noto Sans Arabic", "Regular"), weightClass: 400, widthClass: 5,
+		variable: true}.encode()
+	other := testFont{names: names("Go", "Regular"), weightClass: 400, widthClass: 5}.encode()
+	archive := fstest.MapFS{
+		// A renamed file is recognized by its tables
+		"fonts/NotoSans-Regular.ttf": {Data: devanagari},
+		// Files whose tables do not describe a static Noto font are recognized by their names
+		"fonts/NotoSansArabic-Regular.ttf":    {Data: variable},
+		"fonts/NotoSansThai-Bold.ttf":         {Data: other},
+		"fonts/NotoSerif-CondensedItalic.ttf": {Data: []byte("not a font")},
+		"fonts/NotoSansTamil-Light.otf":       {Data: devanagari[:40]},
+		// Other files are ignored
+		"fonts/Go-Regular.ttf":       {Data: other},
+		"fonts/NotoSans-Regular.txt": {Data: devanagari},
+		"LICENSE":                    {Data: []byte("license")},
+	}
+	inv, err := Scan(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Font{
+		{Path: "fonts/NotoSans-Regular.ttf", Family: "Sans", Language: "Devanagari", Weight: "Bold",
+			Size: int64(len(devanagari))},
+		{Path: "fonts/NotoSansArabic-Regular.ttf", Family: "Sans", Language: "Arabic", Weight: "Regular",
+			Size: int64(len(variable))},
+		{Path: "fonts/NotoSansTamil-Light.otf", Family: "Sans", Language: "Tamil", Weight: "Light", Size: 40},
+		{Path: "fonts/NotoSansThai-Bold.ttf", Family: "Sans", Language: "Thai", Weight: "Bold",
+			Size: int64(len(other))},
+		{Path: "fonts/NotoSerif-CondensedItalic.ttf", Family: "Serif", Weight: "Regular", Width: "Condensed",
+			Style: "Italic", Size: int64(len("not a font"))},
+	}
+	for _, f := range expected {
+		f.CompressedSize = f.Size
+	}
+	if len(inv.Fonts) != len(expected) {
+		t.Fatalf("found %d fonts, expected %d", len(inv.Fonts), len(expected))
+	}
+	for i, f := range inv.Fonts {
+		if *f != *expected[i] {
+			t.Errorf("found %+v, expected %+v", *f, *expected[i])
+		}
+	}
+	if languages := []string{"", "Arabic", "Devanagari", "Tamil", "Thai"}; !reflect.DeepEqual(inv.Languages, languages) {
+		t.Errorf("found the languages %q, expected %q", inv.Languages, languages)
+	}
+	if fonts := inv.Lookup("Sans", "Arabic"); len(fonts) != 1 || fonts[0].Path != "fonts/NotoSansArabic-Regular.ttf" {
+		t.Errorf("Lookup(Sans, Arabic) = %v", fonts)
+	}
+}
+
+// TestScanZip checks that the compressed fonts of a ZIP archive are only decompressed if their names are not
+// recognized.
+func TestScanZip(t *testing.T) {
+	devanagari := testFont{names: names("Noto Sans Devanagari", "Bold"), weightClass: 700, widthClass: 5}.encode()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"NotoSans-Regular.ttf", "NotoSansDeva-Bd.ttf"} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(devanagari); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := Scan(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Font{
+		{Path: "NotoSans-Regular.ttf", Family: "Sans", Weight: "Regular"},
+		{Path: "NotoSansDeva-Bd.ttf", Family: "Sans", Language: "Devanagari", Weight: "Bold"},
+	}
+	if len(inv.Fonts) != len(expected) {
+		t.Fatalf("found %d fonts, expected %d", len(inv.Fonts), len(expected))
+	}
+	for i, f := range inv.Fonts {
+		got := Font{Path: f.Path, Family: f.Family, Language: f.Language, Weight: f.Weight}
+		if got != expected[i] {
+			t.Errorf("found %+v, expected %+v", got, expected[i])
+		}
+	}
+}